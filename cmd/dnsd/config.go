@@ -0,0 +1,282 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shuLhan/share/lib/dns"
+	"github.com/shuLhan/share/lib/ini"
+	libnet "github.com/shuLhan/share/lib/net"
+)
+
+//
+// List of sections and keys in configuration file.
+//
+const (
+	cfgSection     = "dns"
+	cfgSubServer   = "server"
+	cfgSubForward  = "forward"
+	cfgListen      = "listen"
+	cfgUDPPort     = "udp-port"
+	cfgTCPPort     = "tcp-port"
+	cfgDoHPort     = "doh-port"
+	cfgDoTPort     = "dot-port"
+	cfgDoHCert     = "doh-certificate"
+	cfgDoHCertKey  = "doh-certificate-key"
+	cfgDoHInsecure = "doh-allow-insecure"
+	cfgHosts       = "hosts"
+	cfgZone        = "zone"
+	cfgNameServer  = "nameserver"
+	cfgTimeout     = "timeout"
+)
+
+const (
+	defListen     = "127.0.0.1"
+	defResolvConf = "/etc/resolv.conf"
+)
+
+//
+// config contains the daemon configuration.
+//
+type config struct {
+	server dns.ServerOptions
+
+	// hosts and zones contains the path to hosts files and master files
+	// that will be loaded.
+	hosts []string
+	zones []string
+
+	// nameServers contains the parent name servers for query that is not
+	// in hosts or zones.
+	nameServers []string
+	timeout     time.Duration
+}
+
+//
+// loadConfig load the configuration from INI file.
+//
+func loadConfig(file string) (cfg *config, err error) {
+	in, err := ini.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg = &config{
+		server: dns.ServerOptions{
+			IPAddress: defListen,
+		},
+	}
+
+	sec := in.GetSection(cfgSection, cfgSubServer)
+	if sec != nil {
+		err = cfg.parseServer(sec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sec = in.GetSection(cfgSection, cfgSubForward)
+	if sec != nil {
+		err = cfg.parseForward(sec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.nameServers) == 0 {
+		cfg.nameServers, err = cfg.resolvNameServers(defResolvConf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+//
+// parseServer parse the keys in "dns server" section.
+//
+func (cfg *config) parseServer(sec *ini.Section) (err error) {
+	for _, v := range sec.Vars {
+		value := strings.TrimSpace(v.Value)
+
+		switch v.KeyLower {
+		case cfgListen:
+			cfg.server.IPAddress = value
+		case cfgUDPPort:
+			cfg.server.UDPPort, err = parsePort(v.Key, value)
+		case cfgTCPPort:
+			cfg.server.TCPPort, err = parsePort(v.Key, value)
+		case cfgDoHPort:
+			cfg.server.DoHPort, err = parsePort(v.Key, value)
+		case cfgDoTPort:
+			cfg.server.DoTPort, err = parsePort(v.Key, value)
+		case cfgDoHCert:
+			cfg.server.DoHCert = value
+		case cfgDoHCertKey:
+			cfg.server.DoHCertKey = value
+		case cfgDoHInsecure:
+			cfg.server.DoHAllowInsecure = ini.IsValueBoolTrue(value)
+		case cfgHosts:
+			cfg.hosts = append(cfg.hosts, value)
+		case cfgZone:
+			cfg.zones = append(cfg.zones, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// parseForward parse the keys in "dns forward" section.
+//
+func (cfg *config) parseForward(sec *ini.Section) (err error) {
+	for _, v := range sec.Vars {
+		value := strings.TrimSpace(v.Value)
+
+		switch v.KeyLower {
+		case cfgNameServer:
+			cfg.nameServers = append(cfg.nameServers, value)
+		case cfgTimeout:
+			cfg.timeout, err = time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", v.Key, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+//
+// resolvNameServers return the name servers in resolv.conf file, excluding
+// the name servers that refer to the server itself, to prevent the query
+// forwarded back to the server.
+//
+func (cfg *config) resolvNameServers(file string) (nameServers []string, err error) {
+	rc, err := libnet.NewResolvConf(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ns := range rc.NameServers {
+		if cfg.isListenAddr(ns) {
+			continue
+		}
+		nameServers = append(nameServers, ns)
+	}
+	if len(nameServers) == 0 {
+		return nil, fmt.Errorf("no name server in %s other than listen address %s",
+			file, cfg.server.IPAddress)
+	}
+
+	return nameServers, nil
+}
+
+//
+// isListenAddr will return true if the name server address is equal to the
+// UDP or TCP listen address of server.  If the server listen on all
+// addresses, the loopback name server is the server itself.
+//
+func (cfg *config) isListenAddr(ns string) bool {
+	addr, err := libnet.ParseUDPAddr(ns, dns.DefaultPort)
+	if err != nil {
+		return false
+	}
+
+	udpPort, tcpPort := cfg.server.UDPPort, cfg.server.TCPPort
+	if udpPort == 0 {
+		udpPort = dns.DefaultPort
+	}
+	if tcpPort == 0 {
+		tcpPort = dns.DefaultPort
+	}
+	port := uint16(addr.Port)
+	if port != udpPort && port != tcpPort {
+		return false
+	}
+
+	listen := net.ParseIP(cfg.server.IPAddress)
+	if listen == nil {
+		return false
+	}
+	if listen.IsUnspecified() {
+		return addr.IP.IsLoopback()
+	}
+
+	return listen.Equal(addr.IP)
+}
+
+func parsePort(key, value string) (uint16, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return uint16(port), nil
+}
+
+//
+// newClients create the clients to parent name servers.  The name server
+// can be prefixed with "https://" to forward using DNS over HTTPS, with
+// "tls://" to forward using DNS over TLS, or with "tcp://" to forward using
+// TCP; otherwise the query is forwarded using UDP.
+//
+func (cfg *config) newClients() (clients []dns.Client, err error) {
+	for _, ns := range cfg.nameServers {
+		var cl dns.Client
+
+		switch {
+		case strings.HasPrefix(ns, "https://"):
+			cl, err = dns.NewDoHClient(ns, false)
+		case strings.HasPrefix(ns, "tls://"):
+			cl, err = dns.NewDoTClient(strings.TrimPrefix(ns, "tls://"), false)
+		case strings.HasPrefix(ns, "tcp://"):
+			cl, err = newTCPClient(strings.TrimPrefix(ns, "tcp://"))
+		default:
+			cl, err = newUDPClient(ns)
+		}
+		if err != nil {
+			closeClients(clients)
+			return nil, fmt.Errorf("nameserver %q: %s", ns, err)
+		}
+		if cfg.timeout > 0 {
+			cl.SetTimeout(cfg.timeout)
+		}
+
+		clients = append(clients, cl)
+	}
+
+	return clients, nil
+}
+
+func newTCPClient(ns string) (dns.Client, error) {
+	addr, err := libnet.ParseTCPAddr(ns, dns.DefaultPort)
+	if err != nil {
+		return nil, err
+	}
+	return dns.NewTCPClient(addr.String())
+}
+
+func newUDPClient(ns string) (dns.Client, error) {
+	addr, err := libnet.ParseUDPAddr(ns, dns.DefaultPort)
+	if err != nil {
+		return nil, err
+	}
+	return dns.NewUDPClient(addr.String())
+}
+
+func closeClients(clients []dns.Client) {
+	for _, cl := range clients {
+		_ = cl.Close()
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//
+// Command dnsd is a DNS server that answer the query from hosts files and
+// master files, and forward the rest of queries to the parent name servers.
+// The server listen on UDP and TCP, on DNS over HTTPS (DoH) if the
+// certificate is set, and on DNS over TLS (DoT) if the certificate and
+// "dot-port" are set.
+//
+// The configuration is read from INI file, default to "/etc/dnsd.conf",
+// for example,
+//
+//	[dns "server"]
+//	listen = 127.0.0.1
+//	udp-port = 53
+//	tcp-port = 53
+//	doh-port = 443
+//	dot-port = 853
+//	doh-certificate = /etc/dnsd/cert.pem
+//	doh-certificate-key = /etc/dnsd/key.pem
+//	doh-allow-insecure = false
+//	hosts = /etc/hosts
+//	zone = /etc/dnsd/example.com
+//
+//	[dns "forward"]
+//	nameserver = 192.0.2.53
+//	nameserver = tcp://192.0.2.53:53
+//	nameserver = tls://dns.example.net
+//	nameserver = https://dns.example.net/dns-query
+//	timeout = 6s
+//
+// The "hosts" and "zone" keys can be set more than once; the "hosts" key
+// with empty value load the system hosts file.  If no "nameserver" is set,
+// the name servers in "/etc/resolv.conf" are used as parent name servers,
+// excluding the name server that is equal to the listen address and port
+// of dnsd itself.
+//
+// On SIGHUP, the configuration, hosts files, and master files are reloaded.
+// If the reload failed, the server keep answering with the previous
+// configuration.  Changes on listen address, ports, and certificate require
+// restart.  On SIGINT or SIGTERM, the server is stopped after all in-flight
+// requests has been answered.
+//
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/shuLhan/share/lib/dns"
+)
+
+const (
+	defConfig = "/etc/dnsd.conf"
+
+	// closeDelay define the time to wait before closing the clients of
+	// previous configuration, so in-flight queries can be completed.
+	closeDelay = 30 * time.Second
+
+	shutdownTimeout = 10 * time.Second
+)
+
+//
+// daemon contains the server and the handler of current configuration.
+//
+type daemon struct {
+	file string
+	cfg  *config
+	srv  *dns.Server
+
+	// handler contains the current *dns.ZoneHandler.
+	handler atomic.Value
+
+	resolver *dns.Resolver
+	clients  []dns.Client
+}
+
+//
+// ServeDNS pass the request to the handler of current configuration.
+//
+func (d *daemon) ServeDNS(req *dns.Request) {
+	d.handler.Load().(*dns.ZoneHandler).ServeDNS(req)
+}
+
+//
+// load the configuration file and replace the handler.  The resolver is
+// reused if the parent name servers does not changes, to keep its cache.
+//
+func (d *daemon) load() (err error) {
+	cfg, err := loadConfig(d.file)
+	if err != nil {
+		return err
+	}
+
+	resolver := d.resolver
+	var clients []dns.Client
+
+	if d.cfg == nil || d.cfg.timeout != cfg.timeout ||
+		!reflect.DeepEqual(d.cfg.nameServers, cfg.nameServers) {
+		clients, err = cfg.newClients()
+		if err != nil {
+			return err
+		}
+		resolver = dns.NewResolver(clients...)
+	}
+
+	zh := dns.NewZoneHandler()
+	zh.Fallback = resolver
+
+	for _, hosts := range cfg.hosts {
+		err = zh.LoadHosts(hosts)
+		if err != nil {
+			closeClients(clients)
+			return err
+		}
+	}
+	for _, zone := range cfg.zones {
+		err = zh.LoadMaster(zone, "", 0)
+		if err != nil {
+			closeClients(clients)
+			return err
+		}
+	}
+
+	if d.cfg != nil && !reflect.DeepEqual(d.cfg.server, cfg.server) {
+		log.Println("dnsd: changes on server listen options require restart")
+		cfg.server = d.cfg.server
+	}
+
+	d.handler.Store(zh)
+
+	if resolver != d.resolver {
+		old := d.clients
+		time.AfterFunc(closeDelay, func() {
+			closeClients(old)
+		})
+		d.resolver = resolver
+		d.clients = clients
+	}
+	d.cfg = cfg
+
+	return nil
+}
+
+//
+// serve run the server and wait for signals.
+//
+func (d *daemon) serve() (err error) {
+	d.srv = &dns.Server{
+		Handler: d,
+	}
+
+	opts := d.cfg.server
+	cherr := make(chan error, 1)
+	go func() {
+		cherr <- d.srv.ListenAndServe(&opts)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case err = <-cherr:
+			return err
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				err = d.load()
+				if err != nil {
+					log.Printf("dnsd: reload: %s\n", err)
+				} else {
+					log.Println("dnsd: configuration reloaded")
+				}
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(),
+				shutdownTimeout)
+			err = d.srv.Shutdown(ctx)
+			cancel()
+			closeClients(d.clients)
+			return err
+		}
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "%s [options]\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	file := flag.String("c", defConfig, "configuration file")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	d := &daemon{
+		file: *file,
+	}
+
+	err := d.load()
+	if err != nil {
+		log.Fatal("dnsd: ", err)
+	}
+
+	err = d.serve()
+	if err != nil {
+		log.Fatal("dnsd: ", err)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//
+// Command dnsq send a DNS query to name server and print the response in the
+// same format as dig command, using the same clients as lib/dns, so the
+// response printed is the response seen by the library.
+//
+// Usage,
+//
+//	dnsq [@server] [name] [type] [class] [-x address] [+option...]
+//
+// The server is the IP address of name server, with optional port, or the
+// DoH URL if +https is set.  If server is not set, the first name server in
+// /etc/resolv.conf is used.  The name default to ".", the type default to A,
+// and the class default to IN.  The "-x" option query the PTR record of
+// address.  If the UDP response is truncated, the query is retried using
+// TCP.
+//
+// List of options,
+//
+//	+tcp          query using TCP
+//	+https        query using DNS over HTTPS (DoH)
+//	+tls          query using DNS over TLS (DoT)
+//	+insecure     skip verification of server certificate on DoH and DoT
+//	+noedns       do not add OPT pseudo-RR into query
+//	+bufsize=N    set the EDNS UDP payload size, default to 1232
+//	+dnssec       set the DNSSEC OK (DO) bit
+//	+subnet=CIDR  set the EDNS client subnet option
+//	+nsid         request the name server identifier
+//	+cd           set the checking disabled (CD) bit
+//	+norec        unset the recursion desired (RD) bit
+//	+timeout=N    set the query timeout, in seconds
+//	+hex          print the query and response packets in hexadecimal
+//
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shuLhan/share/lib/dns"
+	libnet "github.com/shuLhan/share/lib/net"
+)
+
+const (
+	defUDPSize    = 1232
+	maxPacketSize = 65535
+	resolvConf    = "/etc/resolv.conf"
+	protoUDP      = "UDP"
+	protoTCP      = "TCP"
+	protoDoH      = "HTTPS"
+	protoDoT      = "TLS"
+	dohPathSuffix = "/dns-query"
+)
+
+//
+// options contains the query parameters from command line arguments.
+//
+type options struct {
+	server     string
+	name       string
+	qtype      uint16
+	qclass     uint16
+	proto      string
+	isInsecure bool
+	noEDNS     bool
+	udpSize    uint16
+	do         bool
+	subnet     string
+	nsid       bool
+	cd         bool
+	noRec      bool
+	timeout    time.Duration
+	dumpHex    bool
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "%s [@server] [name] [type] [class] [-x address] [+option...]\n\n",
+		os.Args[0])
+	fmt.Fprint(os.Stderr, `Options:
+  +tcp          query using TCP
+  +https        query using DNS over HTTPS (DoH)
+  +tls          query using DNS over TLS (DoT)
+  +insecure     skip verification of server certificate on DoH and DoT
+  +noedns       do not add OPT pseudo-RR into query
+  +bufsize=N    set the EDNS UDP payload size, default to 1232
+  +dnssec       set the DNSSEC OK (DO) bit
+  +subnet=CIDR  set the EDNS client subnet option
+  +nsid         request the name server identifier
+  +cd           set the checking disabled (CD) bit
+  +norec        unset the recursion desired (RD) bit
+  +timeout=N    set the query timeout, in seconds
+  +hex          print the query and response packets in hexadecimal
+`)
+}
+
+func main() {
+	log.SetFlags(0)
+
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		log.Printf("dnsq: %s\n\n", err)
+		usage()
+		os.Exit(1)
+	}
+
+	msg, err := newQuery(opts)
+	if err != nil {
+		log.Fatal("dnsq: ", err)
+	}
+
+	cl, err := newClient(opts)
+	if err != nil {
+		log.Fatal("dnsq: ", err)
+	}
+	cl.SetTimeout(opts.timeout)
+
+	if opts.dumpHex {
+		fmt.Printf(";; QUERY PACKET (%d bytes):\n%s\n", len(msg.Packet),
+			hex.Dump(msg.Packet))
+	}
+
+	start := time.Now()
+	res, err := query(cl, msg, opts)
+	elapsed := time.Since(start)
+	if err != nil {
+		log.Fatal("dnsq: ", err)
+	}
+
+	if opts.dumpHex {
+		fmt.Printf(";; RESPONSE PACKET (%d bytes):\n%s\n",
+			len(res.Packet), hex.Dump(res.Packet))
+	}
+
+	fmt.Print(res.String())
+	fmt.Printf("\n;; Query time: %d msec\n", elapsed.Milliseconds())
+	fmt.Printf(";; SERVER: %s (%s)\n", opts.server, opts.proto)
+	fmt.Printf(";; WHEN: %s\n", start.Format(time.UnixDate))
+	fmt.Printf(";; MSG SIZE  rcvd: %d\n", len(res.Packet))
+}
+
+//
+// parseArgs parse the command line arguments in the same syntax as dig.
+// The first argument that is not the server, option, query type, or query
+// class is the name.
+//
+func parseArgs(args []string) (opts *options, err error) {
+	opts = &options{
+		qtype:   dns.QueryTypeA,
+		qclass:  dns.QueryClassIN,
+		proto:   protoUDP,
+		udpSize: defUDPSize,
+		timeout: 5 * time.Second,
+	}
+
+	for x := 0; x < len(args); x++ {
+		arg := args[x]
+
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			opts.server = arg[1:]
+
+		case arg == "-x":
+			x++
+			if x == len(args) {
+				return nil, fmt.Errorf("missing address on -x")
+			}
+			name := dns.ReverseName(net.ParseIP(args[x]))
+			if len(name) == 0 {
+				return nil, fmt.Errorf("invalid address %q", args[x])
+			}
+			opts.name = name
+			opts.qtype = dns.QueryTypePTR
+
+		case strings.HasPrefix(arg, "+"):
+			err = opts.parseOption(arg[1:])
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			if qtype, ok := parseType(arg); ok {
+				opts.qtype = qtype
+				continue
+			}
+			if qclass, ok := parseClass(arg); ok {
+				opts.qclass = qclass
+				continue
+			}
+			if len(opts.name) > 0 {
+				return nil, fmt.Errorf("unknown argument %q", arg)
+			}
+			opts.name = arg
+		}
+	}
+
+	if len(opts.name) == 0 {
+		opts.name = "."
+	}
+	if len(opts.server) == 0 {
+		rc, err := libnet.NewResolvConf(resolvConf)
+		if err != nil {
+			return nil, err
+		}
+		if len(rc.NameServers) == 0 {
+			return nil, fmt.Errorf("no name server in %s", resolvConf)
+		}
+		opts.server = rc.NameServers[0]
+	}
+
+	return opts, nil
+}
+
+//
+// parseType parse the query type mnemonic, "ANY", or the generic type
+// "TYPEn" (RFC 3597 section 5).
+//
+func parseType(s string) (qtype uint16, ok bool) {
+	s = strings.ToUpper(s)
+	if s == "ANY" {
+		return dns.QueryTypeALL, true
+	}
+	qtype, ok = dns.QueryTypes[s]
+	if ok {
+		return qtype, true
+	}
+	return parseGeneric(s, "TYPE")
+}
+
+//
+// parseClass parse the query class mnemonic, "ANY", or the generic class
+// "CLASSn" (RFC 3597 section 5).
+//
+func parseClass(s string) (qclass uint16, ok bool) {
+	s = strings.ToUpper(s)
+	if s == "ANY" {
+		return dns.QueryClassANY, true
+	}
+	qclass, ok = dns.QueryClasses[s]
+	if ok {
+		return qclass, true
+	}
+	return parseGeneric(s, "CLASS")
+}
+
+func parseGeneric(s, prefix string) (v uint16, ok bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[len(prefix):], 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(n), true
+}
+
+//
+// parseOption parse the option, without "+" prefix.
+//
+func (opts *options) parseOption(opt string) (err error) {
+	var value string
+
+	kv := strings.SplitN(opt, "=", 2)
+	if len(kv) == 2 {
+		value = kv[1]
+	}
+
+	switch kv[0] {
+	case "tcp":
+		opts.proto = protoTCP
+	case "https":
+		opts.proto = protoDoH
+	case "tls":
+		opts.proto = protoDoT
+	case "insecure":
+		opts.isInsecure = true
+	case "noedns":
+		opts.noEDNS = true
+	case "bufsize":
+		size, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid bufsize %q", value)
+		}
+		opts.udpSize = uint16(size)
+	case "dnssec":
+		opts.do = true
+	case "subnet":
+		opts.subnet = value
+	case "nsid":
+		opts.nsid = true
+	case "cd":
+		opts.cd = true
+	case "norec":
+		opts.noRec = true
+	case "timeout":
+		secs, err := strconv.Atoi(value)
+		if err != nil || secs <= 0 {
+			return fmt.Errorf("invalid timeout %q", value)
+		}
+		opts.timeout = time.Duration(secs) * time.Second
+	case "hex":
+		opts.dumpHex = true
+	default:
+		return fmt.Errorf("unknown option %q", "+"+opt)
+	}
+
+	return nil
+}
+
+//
+// newQuery create and pack the query message from options.
+//
+func newQuery(opts *options) (msg *dns.Message, err error) {
+	rand.Seed(time.Now().UnixNano())
+
+	msg = dns.NewMessage()
+	msg.Header.ID = uint16(rand.Intn(0x10000))
+	msg.Header.IsRD = !opts.noRec
+	msg.Header.IsCD = opts.cd
+	msg.Question.Name = []byte(strings.TrimSuffix(opts.name, "."))
+	msg.Question.Type = opts.qtype
+	msg.Question.Class = opts.qclass
+
+	if !opts.noEDNS {
+		opt := msg.SetEDNS(opts.udpSize, opts.do)
+
+		if len(opts.subnet) > 0 {
+			ecs, err := dns.NewEDNSClientSubnet(opts.subnet)
+			if err != nil {
+				return nil, err
+			}
+			err = opt.SetClientSubnet(ecs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.nsid {
+			opt.SetOption(dns.EDNSOptionNSID, nil)
+		}
+	}
+
+	_, err = msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+//
+// newClient create the client to name server based on protocol in options.
+// The server address in options is normalized to the address used by
+// client.
+//
+func newClient(opts *options) (cl dns.Client, err error) {
+	switch opts.proto {
+	case protoDoH:
+		if !strings.HasPrefix(opts.server, "https://") {
+			opts.server = "https://" + opts.server + dohPathSuffix
+		}
+		return dns.NewDoHClient(opts.server, opts.isInsecure)
+
+	case protoDoT:
+		return dns.NewDoTClient(opts.server, opts.isInsecure)
+	}
+
+	addr, err := libnet.ParseUDPAddr(opts.server, dns.DefaultPort)
+	if err != nil {
+		return nil, err
+	}
+	opts.server = addr.String()
+
+	if opts.proto == protoTCP {
+		return dns.NewTCPClient(opts.server)
+	}
+	return dns.NewUDPClient(opts.server)
+}
+
+//
+// query send the message to name server and return the response.  The UDP
+// query is sent and received using the client directly, instead of using
+// the Query method that silently retry the truncated response using TCP,
+// so the truncated response is reported and retried using TCP, the same
+// as dig.
+//
+func query(cl dns.Client, msg *dns.Message, opts *options) (
+	res *dns.Message, err error,
+) {
+	if opts.proto != protoUDP {
+		return cl.Query(msg, nil)
+	}
+
+	_, err = cl.Send(msg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res = dns.NewMessage()
+	res.Packet = make([]byte, maxPacketSize)
+
+	_, err = cl.Recv(res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = res.Unpack()
+	if err != nil {
+		return nil, err
+	}
+	if res.Header.ID != msg.Header.ID {
+		return nil, fmt.Errorf("response ID %d does not match query ID %d",
+			res.Header.ID, msg.Header.ID)
+	}
+	if !res.Header.IsTC {
+		return res, nil
+	}
+
+	fmt.Println(";; Truncated, retrying in TCP mode.")
+
+	opts.proto = protoTCP
+
+	tcl, err := dns.NewTCPClient(opts.server)
+	if err != nil {
+		return nil, err
+	}
+	tcl.SetTimeout(opts.timeout)
+
+	res, err = tcl.Query(msg, nil)
+	_ = tcl.Close()
+
+	return res, err
+}
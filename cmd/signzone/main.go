@@ -0,0 +1,122 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//
+// Command signzone sign the zone in master file using DNSSEC keys and write
+// the signed zone in master file syntax.
+//
+// The key files are in the format generated by BIND dnssec-keygen, for
+// example "Kexample.com.+013+12345.key" and "Kexample.com.+013+12345.private".
+// Key with secure entry point flag (257) is used as key signing key, the
+// others as zone signing keys.
+//
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/shuLhan/share/lib/dns"
+	libtime "github.com/shuLhan/share/lib/time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "%s [options] <zone-file> <key-file>...\n\n",
+		os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		origin     = flag.String("o", "", "zone origin, default to SOA owner or base name of zone file")
+		out        = flag.String("f", "", "output file, default to zone file with \".signed\" suffix")
+		validity   = flag.String("e", "30d", "validity period of signatures")
+		useNSEC3   = flag.Bool("3", false, "use NSEC3 chain instead of NSEC")
+		iterations = flag.Uint("i", 0, "number of additional NSEC3 hash iterations")
+		salt       = flag.String("s", "-", "NSEC3 salt in hexadecimal, or \"-\" for empty salt")
+	)
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	zoneFile := flag.Arg(0)
+	if len(*out) == 0 {
+		*out = zoneFile + ".signed"
+	}
+
+	dur, err := libtime.ParseDuration(*validity)
+	if err != nil {
+		log.Fatal("signzone: invalid validity: ", err)
+	}
+
+	zone, err := dns.LoadZone(zoneFile, *origin, 0)
+	if err != nil {
+		log.Fatal("signzone: ", err)
+	}
+
+	inception := time.Now().Add(-time.Hour)
+	zs := &dns.ZoneSigner{
+		Inception:  inception,
+		Expiration: inception.Add(dur),
+	}
+
+	for _, file := range flag.Args()[1:] {
+		key, err := dns.LoadDNSSECKey(file)
+		if err != nil {
+			log.Fatal("signzone: ", err)
+		}
+		zs.Keys = append(zs.Keys, key)
+	}
+
+	if *useNSEC3 {
+		zs.NSEC3 = &dns.RDataNSEC3PARAM{
+			HashAlgorithm: 1,
+			Iterations:    uint16(*iterations),
+		}
+		if *salt != "-" {
+			zs.NSEC3.Salt, err = hex.DecodeString(*salt)
+			if err != nil {
+				log.Fatal("signzone: invalid salt: ", err)
+			}
+		}
+	}
+
+	err = zs.Sign(zone)
+	if err != nil {
+		log.Fatal("signzone: ", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal("signzone: ", err)
+	}
+
+	w := bufio.NewWriter(f)
+
+	err = zone.Write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		_ = f.Close()
+		log.Fatal("signzone: ", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		log.Fatal("signzone: ", err)
+	}
+
+	fmt.Println(*out)
+}
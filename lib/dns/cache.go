@@ -0,0 +1,264 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// cachePruneInterval define the minimum number of seconds between
+	// two prunes of expired answers.
+	cachePruneInterval = 60
+
+	// cacheSnapshotMagic define the first bytes of cache snapshot.
+	cacheSnapshotMagic = "DNSCACHE1"
+)
+
+//
+// errCacheSnapshot is returned when reading invalid cache snapshot.
+//
+var errCacheSnapshot = errors.New("dns: invalid cache snapshot")
+
+//
+// cacheAnswer contains the cached message and the time when its TTL was
+// last updated.
+//
+type cacheAnswer struct {
+	// updatedAt contains the time, in Unix seconds, when the TTL in
+	// message was last subtracted.
+	updatedAt int64
+	msg       *Message
+}
+
+//
+// packet return copy of message packet after subtracting the TTL with
+// elapsed time since the last update.  If the message is expired it will
+// return nil.
+//
+func (ans *cacheAnswer) packet(now int64) []byte {
+	elapsed := now - ans.updatedAt
+	if elapsed > 0 {
+		if ans.msg.IsExpired(uint32(elapsed)) {
+			return nil
+		}
+		ans.msg.SubTTL(uint32(elapsed))
+		ans.updatedAt = now
+	}
+
+	packet := make([]byte, len(ans.msg.Packet))
+	copy(packet, ans.msg.Packet)
+
+	return packet
+}
+
+//
+// cache contains list of answers indexed by question key.
+//
+type cache struct {
+	sync.Mutex
+	v        map[string]*cacheAnswer
+	prunedAt int64
+}
+
+func newCache() *cache {
+	return &cache{
+		v:        make(map[string]*cacheAnswer),
+		prunedAt: time.Now().Unix(),
+	}
+}
+
+//
+// get the copy of cached packet by question key.  The TTL of each resource
+// records in the cached message will be subtracted by the time elapsed since
+// it was last updated.  If the answer is expired, it will be removed from
+// cache and nil will be returned.
+//
+func (c *cache) get(key string) (packet []byte) {
+	c.Lock()
+	ans, ok := c.v[key]
+	if ok {
+		packet = ans.packet(time.Now().Unix())
+		if packet == nil {
+			delete(c.v, key)
+		}
+	}
+	c.Unlock()
+
+	return packet
+}
+
+//
+// upsert insert or replace the cached message by question key.  Message
+// without answer or with zero TTL will not be cached.  It will return true if
+// message is cached, otherwise it will return false.
+//
+func (c *cache) upsert(key string, msg *Message) bool {
+	if len(msg.Answer) == 0 || msg.IsExpired(0) {
+		return false
+	}
+
+	now := time.Now().Unix()
+
+	c.Lock()
+	c.v[key] = &cacheAnswer{
+		updatedAt: now,
+		msg:       msg,
+	}
+	if now-c.prunedAt >= cachePruneInterval {
+		c.prune(now)
+	}
+	c.Unlock()
+
+	return true
+}
+
+//
+// prune remove all expired answers from cache.  The caller must hold the
+// lock.
+//
+func (c *cache) prune(now int64) {
+	for k, ans := range c.v {
+		elapsed := now - ans.updatedAt
+		if elapsed > 0 && ans.msg.IsExpired(uint32(elapsed)) {
+			delete(c.v, k)
+		}
+	}
+	c.prunedAt = now
+}
+
+//
+// write the snapshot of cache into w.  The snapshot contains the magic
+// bytes, the time when its written in Unix seconds, and the packet of each
+// answers with the remaining TTL, prefixed with two bytes length as in the
+// TCP message (RFC 1035 section 4.2.2).  The expired answers are not
+// written.  It will return the number of answers that has been written.
+//
+func (c *cache) write(w io.Writer) (n int, err error) {
+	now := time.Now().Unix()
+
+	bw := bufio.NewWriter(w)
+
+	_, err = bw.WriteString(cacheSnapshotMagic)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(now))
+	_, err = bw.Write(buf[:])
+	if err != nil {
+		return 0, err
+	}
+
+	var packets [][]byte
+
+	c.Lock()
+	for key, ans := range c.v {
+		packet := ans.packet(now)
+		if packet == nil {
+			delete(c.v, key)
+			continue
+		}
+		packets = append(packets, packet)
+	}
+	c.Unlock()
+
+	for _, packet := range packets {
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(packet)))
+		_, err = bw.Write(buf[:2])
+		if err != nil {
+			return 0, err
+		}
+		_, err = bw.Write(packet)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(packets), nil
+}
+
+//
+// read the snapshot of cache from r, and insert the answers that have not
+// expired since the snapshot was written.  The answer in cache with the
+// same question is replaced.  It will return the number of answers that
+// has been inserted.
+//
+func (c *cache) read(r io.Reader) (n int, err error) {
+	now := time.Now().Unix()
+
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(cacheSnapshotMagic))
+	_, err = io.ReadFull(br, magic)
+	if err != nil || string(magic) != cacheSnapshotMagic {
+		return 0, errCacheSnapshot
+	}
+
+	var buf [8]byte
+	_, err = io.ReadFull(br, buf[:])
+	if err != nil {
+		return 0, errCacheSnapshot
+	}
+
+	writtenAt := int64(binary.BigEndian.Uint64(buf[:]))
+	elapsed := now - writtenAt
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	var answers []*cacheAnswer
+
+	for {
+		_, err = io.ReadFull(br, buf[:2])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, errCacheSnapshot
+		}
+
+		msg := NewMessage()
+		msg.Packet = make([]byte, binary.BigEndian.Uint16(buf[:2]))
+
+		_, err = io.ReadFull(br, msg.Packet)
+		if err != nil {
+			return 0, errCacheSnapshot
+		}
+
+		err = msg.Unpack()
+		if err != nil {
+			return 0, errCacheSnapshot
+		}
+
+		if len(msg.Answer) == 0 || msg.IsExpired(uint32(elapsed)) {
+			continue
+		}
+
+		answers = append(answers, &cacheAnswer{
+			updatedAt: writtenAt,
+			msg:       msg,
+		})
+	}
+
+	c.Lock()
+	for _, ans := range answers {
+		c.v[ans.msg.Question.key()] = ans
+	}
+	c.Unlock()
+
+	return len(answers), nil
+}
@@ -9,8 +9,25 @@
 //	- RFC1034 DOMAIN NAMES - CONCEPTS AND FACILITIES
 //	- RFC1035 DOMAIN NAMES - IMPLEMENTATION AND SPECIFICATION
 //	- RFC1886 DNS Extensions to support IP version 6.
+//	- RFC1995 Incremental Zone Transfer in DNS
 //	- RFC2782 A DNS RR for specifying the location of services (DNS SRV)
+//	- RFC3403 Dynamic Delegation Discovery System (DDDS) Part Three: The
+//	  Domain Name System (DNS) Database (NAPTR)
+//	- RFC4034 Resource Records for the DNS Security Extensions
+//	- RFC4035 Protocol Modifications for the DNS Security Extensions
+//	- RFC5155 DNS Security (DNSSEC) Hashed Authenticated Denial of Existence
+//	- RFC4255 Using DNS to Securely Publish Secure Shell (SSH) Key
+//	  Fingerprints (SSHFP)
+//	- RFC5936 DNS Zone Transfer Protocol (AXFR)
 //	- RFC6891 Extension Mechanisms for DNS (EDNS(0))
+//	- RFC6698 The DNS-Based Authentication of Named Entities (DANE)
+//	  Transport Layer Security (TLS) Protocol: TLSA
+//	- RFC7553 The Uniform Resource Identifier (URI) DNS Resource Record
+//	- RFC7858 Specification for DNS over Transport Layer Security (TLS)
+//	- RFC8659 DNS Certification Authority Authorization (CAA) Resource
+//	  Record
+//	- RFC9460 Service Binding and Parameter Specification via the DNS
+//	  (SVCB and HTTPS Resource Records)
 //
 package dns
 
@@ -30,6 +47,9 @@ const (
 	// DefaultDoHPort define default port for DoH.
 	DefaultDoHPort        uint16        = 443
 	defaultDoHIdleTimeout time.Duration = 120 * time.Second
+
+	// DefaultDoTPort define default port for DNS over TLS (DoT).
+	DefaultDoTPort uint16 = 853
 )
 
 const (
@@ -37,10 +57,13 @@ const (
 	maskOffset  byte   = 0x3F
 	maskOPTDO   uint32 = 0x00008000
 
-	maxLabelSize     = 63
-	maxUDPPacketSize = 4096
-	rdataIPv4Size    = 4
-	rdataIPv6Size    = 16
+	maxCharStringSize = 255
+	maxLabelSize      = 63
+	maxNamePointers   = 127
+	maxUDPPacketSize  = 4096
+	maxTCPPacketSize  = 65535
+	rdataIPv4Size     = 4
+	rdataIPv6Size     = 16
 	// sectionHeaderSize define the size of section header in DNS message.
 	sectionHeaderSize = 12
 
@@ -58,6 +81,9 @@ var (
 	ErrInvalidAddress = errors.New("Invalid address")
 	ErrIPv4Length     = errors.New("Invalid length of A RDATA format")
 	ErrIPv6Length     = errors.New("Invalid length of AAAA RDATA format")
+	ErrRDataLength    = errors.New("Invalid length of RDATA")
+	ErrNameLength     = errors.New("Invalid length of domain name")
+	ErrNamePointer    = errors.New("Invalid domain name compression pointer")
 )
 
 var (
@@ -71,34 +97,51 @@ const (
 	OpCodeQuery  OpCode = iota // a standard query (QUERY)
 	OpCodeIQuery               // an inverse query (IQUERY), obsolete by RFC3425
 	OpCodeStatus               // a server status request (STATUS)
+	OpCodeNotify OpCode = 4    // a zone change notification (NOTIFY), RFC 1996
+	OpCodeUpdate OpCode = 5    // a dynamic update (UPDATE), RFC 2136
 )
 
 // List of code for known DNS query types.
 const (
-	QueryTypeZERO  uint16 = iota // Empty query type.
-	QueryTypeA                   // A host address
-	QueryTypeNS                  // An authoritative name server
-	QueryTypeMD                  // A mail destination (Obsolete - use MX)
-	QueryTypeMF                  // A mail forwarder (Obsolete - use MX)
-	QueryTypeCNAME               // The canonical name for an alias
-	QueryTypeSOA                 // Marks the start of a zone of authority
-	QueryTypeMB                  // A mailbox domain name (EXPERIMENTAL)
-	QueryTypeMG                  // A mail group member (EXPERIMENTAL)
-	QueryTypeMR                  // A mail rename domain name (EXPERIMENTAL)
-	QueryTypeNULL                // A null RR (EXPERIMENTAL)
-	QueryTypeWKS                 // A well known service description
-	QueryTypePTR                 // A domain name pointer
-	QueryTypeHINFO               // Host information
-	QueryTypeMINFO               // Mailbox or mail list information
-	QueryTypeMX                  // Mail exchange
-	QueryTypeTXT                 // (16) Text strings
-	QueryTypeAAAA  uint16 = 28   // IPv6 address
-	QueryTypeSRV   uint16 = 33   // A SRV RR for locating service.
-	QueryTypeOPT   uint16 = 41   // An OPT pseudo-RR (sometimes called a meta-RR)
-	QueryTypeAXFR  uint16 = 252  // A request for a transfer of an entire zone
-	QueryTypeMAILB uint16 = 253  // A request for mailbox-related records (MB, MG or MR)
-	QueryTypeMAILA uint16 = 254  // A request for mail agent RRs (Obsolete - see MX)
-	QueryTypeALL   uint16 = 255  // A request for all records
+	QueryTypeZERO       uint16 = iota // Empty query type.
+	QueryTypeA                        // A host address
+	QueryTypeNS                       // An authoritative name server
+	QueryTypeMD                       // A mail destination (Obsolete - use MX)
+	QueryTypeMF                       // A mail forwarder (Obsolete - use MX)
+	QueryTypeCNAME                    // The canonical name for an alias
+	QueryTypeSOA                      // Marks the start of a zone of authority
+	QueryTypeMB                       // A mailbox domain name (EXPERIMENTAL)
+	QueryTypeMG                       // A mail group member (EXPERIMENTAL)
+	QueryTypeMR                       // A mail rename domain name (EXPERIMENTAL)
+	QueryTypeNULL                     // A null RR (EXPERIMENTAL)
+	QueryTypeWKS                      // A well known service description
+	QueryTypePTR                      // A domain name pointer
+	QueryTypeHINFO                    // Host information
+	QueryTypeMINFO                    // Mailbox or mail list information
+	QueryTypeMX                       // Mail exchange
+	QueryTypeTXT                      // (16) Text strings
+	QueryTypeAAAA       uint16 = 28   // IPv6 address
+	QueryTypeSRV        uint16 = 33   // A SRV RR for locating service.
+	QueryTypeNAPTR      uint16 = 35   // Naming authority pointer
+	QueryTypeOPT        uint16 = 41   // An OPT pseudo-RR (sometimes called a meta-RR)
+	QueryTypeDS         uint16 = 43   // Delegation signer
+	QueryTypeSSHFP      uint16 = 44   // SSH public key fingerprint
+	QueryTypeRRSIG      uint16 = 46   // Signature of RRset
+	QueryTypeNSEC       uint16 = 47   // Next secure record
+	QueryTypeDNSKEY     uint16 = 48   // Public key of zone
+	QueryTypeNSEC3      uint16 = 50   // Hashed next secure record
+	QueryTypeNSEC3PARAM uint16 = 51   // NSEC3 parameters
+	QueryTypeTLSA       uint16 = 52   // TLSA certificate association
+	QueryTypeSVCB       uint16 = 64   // General purpose service binding
+	QueryTypeHTTPS      uint16 = 65   // Service binding for HTTPS
+	QueryTypeTSIG       uint16 = 250  // Transaction signature
+	QueryTypeIXFR       uint16 = 251  // A request for incremental transfer of a zone
+	QueryTypeAXFR       uint16 = 252  // A request for a transfer of an entire zone
+	QueryTypeMAILB      uint16 = 253  // A request for mailbox-related records (MB, MG or MR)
+	QueryTypeMAILA      uint16 = 254  // A request for mail agent RRs (Obsolete - see MX)
+	QueryTypeALL        uint16 = 255  // A request for all records
+	QueryTypeURI        uint16 = 256  // Uniform resource identifier
+	QueryTypeCAA        uint16 = 257  // Certification authority authorization
 )
 
 //
@@ -106,23 +149,36 @@ const (
 // type with their decimal value.
 //
 var QueryTypes = map[string]uint16{
-	"A":     QueryTypeA,
-	"NS":    QueryTypeNS,
-	"CNAME": QueryTypeCNAME,
-	"SOA":   QueryTypeSOA,
-	"MB":    QueryTypeMB,
-	"MG":    QueryTypeMG,
-	"MR":    QueryTypeMR,
-	"NULL":  QueryTypeNULL,
-	"WKS":   QueryTypeWKS,
-	"PTR":   QueryTypePTR,
-	"HINFO": QueryTypeHINFO,
-	"MINFO": QueryTypeMINFO,
-	"MX":    QueryTypeMX,
-	"TXT":   QueryTypeTXT,
-	"AAAA":  QueryTypeAAAA,
-	"SRV":   QueryTypeSRV,
-	"OPT":   QueryTypeOPT,
+	"A":          QueryTypeA,
+	"NS":         QueryTypeNS,
+	"CNAME":      QueryTypeCNAME,
+	"SOA":        QueryTypeSOA,
+	"MB":         QueryTypeMB,
+	"MG":         QueryTypeMG,
+	"MR":         QueryTypeMR,
+	"NULL":       QueryTypeNULL,
+	"WKS":        QueryTypeWKS,
+	"PTR":        QueryTypePTR,
+	"HINFO":      QueryTypeHINFO,
+	"MINFO":      QueryTypeMINFO,
+	"MX":         QueryTypeMX,
+	"TXT":        QueryTypeTXT,
+	"AAAA":       QueryTypeAAAA,
+	"SRV":        QueryTypeSRV,
+	"NAPTR":      QueryTypeNAPTR,
+	"OPT":        QueryTypeOPT,
+	"DS":         QueryTypeDS,
+	"SSHFP":      QueryTypeSSHFP,
+	"RRSIG":      QueryTypeRRSIG,
+	"NSEC":       QueryTypeNSEC,
+	"DNSKEY":     QueryTypeDNSKEY,
+	"NSEC3":      QueryTypeNSEC3,
+	"NSEC3PARAM": QueryTypeNSEC3PARAM,
+	"TLSA":       QueryTypeTLSA,
+	"SVCB":       QueryTypeSVCB,
+	"HTTPS":      QueryTypeHTTPS,
+	"URI":        QueryTypeURI,
+	"CAA":        QueryTypeCAA,
 }
 
 // List of code known DNS query class.
@@ -132,6 +188,7 @@ const (
 	QueryClassCS                 // The CSNET class (Obsolete - used only for examples in some obsolete RFCs)
 	QueryClassCH                 // The CHAOS class
 	QueryClassHS                 // Hesiod [Dyer 87]
+	QueryClassNONE uint16 = 254  // None class, used in dynamic update (RFC 2136)
 	QueryClassANY  uint16 = 255  // Any class
 )
 
@@ -174,6 +231,23 @@ const (
 	// name server may not wish to perform a particular operation (e.g.,
 	// zone transfer) for particular data.
 	RCodeRefused
+
+	// Some name that ought not to exist, does exist (RFC 2136).
+	RCodeYXDomain
+
+	// Some RRset that ought not to exist, does exist (RFC 2136).
+	RCodeYXRRSet
+
+	// Some RRset that ought to exist, does not exist (RFC 2136).
+	RCodeNXRRSet
+
+	// The server is not authoritative for the zone named in the Zone
+	// Section (RFC 2136).
+	RCodeNotAuth
+
+	// A name used in the Prerequisite or Update Section is not within
+	// the zone denoted by the Zone Section (RFC 2136).
+	RCodeNotZone
 )
 
 //
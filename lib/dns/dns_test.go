@@ -178,7 +178,7 @@ func (h *serverHandler) ServeDNS(req *Request) {
 		}
 		FreeRequest(req)
 
-	case ConnTypeTCP:
+	case ConnTypeTCP, ConnTypeDoT:
 		if req.Sender != nil {
 			_, err = req.Sender.Send(res, nil)
 			if err != nil {
@@ -217,6 +217,7 @@ func TestMain(m *testing.M) {
 		UDPPort:          5353,
 		TCPPort:          5353,
 		DoHPort:          8443,
+		DoTPort:          8853,
 		DoHCert:          "testdata/domain.crt",
 		DoHCertKey:       "testdata/domain.key",
 		DoHAllowInsecure: true,
@@ -0,0 +1,519 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+// List of DNSSEC algorithm numbers (RFC 8624 section 3.1).
+const (
+	DNSSECAlgRSASHA1         byte = 5
+	DNSSECAlgRSASHA1NSEC3    byte = 7
+	DNSSECAlgRSASHA256       byte = 8
+	DNSSECAlgRSASHA512       byte = 10
+	DNSSECAlgECDSAP256SHA256 byte = 13
+	DNSSECAlgECDSAP384SHA384 byte = 14
+	DNSSECAlgED25519         byte = 15
+)
+
+//
+// List of DNSSEC errors.
+//
+var (
+	ErrDNSSECAlgorithm  = errors.New("dnssec: unsupported algorithm")
+	ErrDNSSECDigestType = errors.New("dnssec: unsupported digest type")
+	ErrDNSSECPublicKey  = errors.New("dnssec: invalid public key")
+	ErrDNSSECSignature  = errors.New("dnssec: invalid signature")
+	ErrDNSSECExpired    = errors.New("dnssec: signature expired or not yet valid")
+	ErrDNSSECUnsigned   = errors.New("dnssec: missing signature in secure zone")
+)
+
+//
+// packTypeBitmap convert list of RR types into type bit maps format as
+// defined in RFC 4034 section 4.1.2.
+//
+func packTypeBitmap(types []uint16) (out []byte) {
+	if len(types) == 0 {
+		return nil
+	}
+
+	sorted := make([]uint16, len(types))
+	copy(sorted, types)
+	sort.Slice(sorted, func(x, y int) bool {
+		return sorted[x] < sorted[y]
+	})
+
+	var (
+		window = -1
+		bitmap []byte
+	)
+
+	flush := func() {
+		if window >= 0 {
+			out = append(out, byte(window), byte(len(bitmap)))
+			out = append(out, bitmap...)
+		}
+	}
+
+	for _, t := range sorted {
+		w := int(t >> 8)
+		if w != window {
+			flush()
+			window = w
+			bitmap = bitmap[:0]
+		}
+
+		low := byte(t)
+		idx := int(low / 8)
+		for len(bitmap) <= idx {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[idx] |= 0x80 >> (low % 8)
+	}
+	flush()
+
+	return out
+}
+
+//
+// unpackTypeBitmap convert type bit maps into list of RR types.
+//
+func unpackTypeBitmap(data []byte) (types []uint16, err error) {
+	for x := 0; x < len(data); {
+		if x+2 > len(data) {
+			return nil, ErrRDataLength
+		}
+
+		window := uint16(data[x])
+		n := int(data[x+1])
+		x += 2
+
+		if n == 0 || n > 32 || x+n > len(data) {
+			return nil, ErrRDataLength
+		}
+
+		for y := 0; y < n; y++ {
+			b := data[x+y]
+			for bit := uint16(0); bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, window<<8|uint16(y)*8+bit)
+				}
+			}
+		}
+		x += n
+	}
+
+	return types, nil
+}
+
+//
+// packCanonicalName return the domain name in canonical wire format:
+// lowercase and uncompressed.
+//
+func packCanonicalName(name []byte) []byte {
+	msg := &Message{
+		dnameOff:   make(map[string]uint16),
+		noCompress: true,
+	}
+
+	dname := make([]byte, len(name))
+	copy(dname, name)
+
+	msg.packDomainName(dname, false)
+
+	return msg.Packet
+}
+
+//
+// canonicalRData return the RDATA of resource record in canonical wire
+// format (RFC 4034 section 6.2).
+//
+func (rr *ResourceRecord) canonicalRData() []byte {
+	msg := &Message{
+		dnameOff:   make(map[string]uint16),
+		noCompress: true,
+	}
+
+	msg.packRData(rr)
+	if len(msg.Packet) < 2 {
+		return nil
+	}
+
+	return msg.Packet[2:]
+}
+
+//
+// countLabels return the number of labels in domain name, not including
+// the root and the wildcard label.
+//
+func countLabels(name []byte) (n byte) {
+	name = bytes.TrimSuffix(name, []byte{'.'})
+	if len(name) == 0 {
+		return 0
+	}
+	if bytes.HasPrefix(name, []byte("*.")) {
+		name = name[2:]
+	}
+	return byte(bytes.Count(name, []byte{'.'}) + 1)
+}
+
+//
+// signedData return the data that is signed by RRSIG, as defined in RFC
+// 4034 section 3.1.8.1.
+//
+func signedData(sig *RDataRRSIG, rrset []*ResourceRecord) []byte {
+	data := sig.pack()
+	data = append(data, packCanonicalName(sig.SignerName)...)
+
+	type canonicalRR struct {
+		owner []byte
+		rr    *ResourceRecord
+		rdata []byte
+	}
+
+	list := make([]canonicalRR, 0, len(rrset))
+
+	for _, rr := range rrset {
+		owner := bytes.ToLower(bytes.TrimSuffix(rr.Name, []byte{'.'}))
+
+		// Expand the wildcard owner name (RFC 4035 section 5.3.2).
+		if countLabels(owner) > sig.Labels {
+			labels := bytes.Split(owner, []byte{'.'})
+			labels = labels[len(labels)-int(sig.Labels):]
+			owner = append([]byte("*."), bytes.Join(labels, []byte{'.'})...)
+		}
+
+		list = append(list, canonicalRR{
+			owner: packCanonicalName(owner),
+			rr:    rr,
+			rdata: rr.canonicalRData(),
+		})
+	}
+
+	sort.Slice(list, func(x, y int) bool {
+		return bytes.Compare(list[x].rdata, list[y].rdata) < 0
+	})
+
+	for x, c := range list {
+		// Remove duplicate RR (RFC 4034 section 6.3).
+		if x > 0 && bytes.Equal(c.rdata, list[x-1].rdata) {
+			continue
+		}
+
+		data = append(data, c.owner...)
+		libbytes.AppendUint16(&data, c.rr.Type)
+		libbytes.AppendUint16(&data, c.rr.Class)
+		libbytes.AppendUint32(&data, sig.OrigTTL)
+		libbytes.AppendUint16(&data, uint16(len(c.rdata)))
+		data = append(data, c.rdata...)
+	}
+
+	return data
+}
+
+//
+// hashByAlgorithm return the hash function used by DNSSEC algorithm.
+// It will return 0 for algorithm that sign the data without hashing.
+//
+func hashByAlgorithm(alg byte) (crypto.Hash, error) {
+	switch alg {
+	case DNSSECAlgRSASHA1, DNSSECAlgRSASHA1NSEC3:
+		return crypto.SHA1, nil
+	case DNSSECAlgRSASHA256, DNSSECAlgECDSAP256SHA256:
+		return crypto.SHA256, nil
+	case DNSSECAlgECDSAP384SHA384:
+		return crypto.SHA384, nil
+	case DNSSECAlgRSASHA512:
+		return crypto.SHA512, nil
+	case DNSSECAlgED25519:
+		return 0, nil
+	}
+	return 0, ErrDNSSECAlgorithm
+}
+
+//
+// publicKey convert the DNSKEY public key into crypto public key.
+//
+func (key *RDataDNSKEY) publicKey() (crypto.PublicKey, error) {
+	raw := key.PublicKey
+
+	switch key.Algorithm {
+	case DNSSECAlgRSASHA1, DNSSECAlgRSASHA1NSEC3, DNSSECAlgRSASHA256,
+		DNSSECAlgRSASHA512:
+		// RFC 3110 section 2.
+		if len(raw) < 3 {
+			return nil, ErrDNSSECPublicKey
+		}
+		elen := int(raw[0])
+		raw = raw[1:]
+		if elen == 0 {
+			elen = int(raw[0])<<8 | int(raw[1])
+			raw = raw[2:]
+		}
+		if elen == 0 || elen > 8 || len(raw) <= elen {
+			return nil, ErrDNSSECPublicKey
+		}
+
+		e := 0
+		for _, b := range raw[:elen] {
+			e = e<<8 | int(b)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(raw[elen:]),
+			E: e,
+		}, nil
+
+	case DNSSECAlgECDSAP256SHA256, DNSSECAlgECDSAP384SHA384:
+		// RFC 6605 section 4.
+		curve := elliptic.P256()
+		if key.Algorithm == DNSSECAlgECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		size := curve.Params().BitSize / 8
+		if len(raw) != 2*size {
+			return nil, ErrDNSSECPublicKey
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(raw[:size]),
+			Y:     new(big.Int).SetBytes(raw[size:]),
+		}, nil
+
+	case DNSSECAlgED25519:
+		// RFC 8080 section 3.
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, ErrDNSSECPublicKey
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+
+	return nil, ErrDNSSECAlgorithm
+}
+
+//
+// verifyRRSIG verify the signature of RRset using the DNSKEY.  The RRset
+// must have the same name, type, and class.  This function does not check
+// the validity period of signature.
+//
+func verifyRRSIG(sig *RDataRRSIG, rrset []*ResourceRecord, key *RDataDNSKEY) error {
+	if sig.Algorithm != key.Algorithm || sig.KeyTag != key.KeyTag() {
+		return fmt.Errorf("dnssec: signature key tag %d does not match key %d",
+			sig.KeyTag, key.KeyTag())
+	}
+	if key.Protocol != 3 || key.Flags&DNSKEYFlagZone == 0 {
+		return ErrDNSSECPublicKey
+	}
+
+	pub, err := key.publicKey()
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashByAlgorithm(sig.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	data := signedData(sig, rrset)
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, hash, digest, sig.Signature)
+		if err != nil {
+			return ErrDNSSECSignature
+		}
+
+	case *ecdsa.PublicKey:
+		size := pub.Curve.Params().BitSize / 8
+		if len(sig.Signature) != 2*size {
+			return ErrDNSSECSignature
+		}
+		r := new(big.Int).SetBytes(sig.Signature[:size])
+		s := new(big.Int).SetBytes(sig.Signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrDNSSECSignature
+		}
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig.Signature) {
+			return ErrDNSSECSignature
+		}
+	}
+
+	return nil
+}
+
+//
+// signRRSIG sign the RRset and store the signature in sig.Signature.
+// All fields in sig, except Signature, must already been set.
+//
+func signRRSIG(sig *RDataRRSIG, rrset []*ResourceRecord, signer crypto.Signer) (err error) {
+	hash, err := hashByAlgorithm(sig.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	data := signedData(sig, rrset)
+
+	if hash == 0 {
+		sig.Signature, err = signer.Sign(rand.Reader, data, crypto.Hash(0))
+		return err
+	}
+
+	h := hash.New()
+	h.Write(data)
+
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		return err
+	}
+
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		sig.Signature = signature
+		return nil
+	}
+
+	// Convert the ASN.1 ECDSA signature into "r | s" (RFC 6605 section
+	// 4).
+	var rs struct {
+		R, S *big.Int
+	}
+
+	_, err = asn1.Unmarshal(signature, &rs)
+	if err != nil {
+		return err
+	}
+
+	size := pub.Curve.Params().BitSize / 8
+	sig.Signature = make([]byte, 2*size)
+	rs.R.FillBytes(sig.Signature[:size])
+	rs.S.FillBytes(sig.Signature[size:])
+
+	return nil
+}
+
+//
+// isValidPeriod will return true if the time t is within signature
+// inception and expiration, using serial number arithmetic (RFC 4034
+// section 3.1.5).
+//
+func (sig *RDataRRSIG) isValidPeriod(t time.Time) bool {
+	now := uint32(t.Unix())
+	return !serialLess(now, sig.Inception) && !serialLess(sig.Expiration, now)
+}
+
+//
+// digestDS compute the digest of DNSKEY for DS record (RFC 4034 section
+// 5.1.4).
+//
+func digestDS(owner []byte, key *RDataDNSKEY, digestType byte) ([]byte, error) {
+	data := packCanonicalName(owner)
+	data = append(data, key.pack()...)
+
+	switch digestType {
+	case DSDigestSHA1:
+		sum := sha1.Sum(data)
+		return sum[:], nil
+	case DSDigestSHA256:
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	case DSDigestSHA384:
+		sum := sha512.Sum384(data)
+		return sum[:], nil
+	}
+
+	return nil, ErrDNSSECDigestType
+}
+
+//
+// isMatchDS will return true if the DS record refer to the DNSKEY.
+//
+func (ds *RDataDS) isMatchDS(owner []byte, key *RDataDNSKEY) bool {
+	if ds.Algorithm != key.Algorithm || ds.KeyTag != key.KeyTag() {
+		return false
+	}
+
+	digest, err := digestDS(owner, key, ds.DigestType)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(digest, ds.Digest)
+}
+
+//
+// nsec3Hash compute the hash of domain name using the NSEC3 parameters
+// (RFC 5155 section 5).
+//
+func nsec3Hash(name []byte, alg byte, iterations uint16, salt []byte) (
+	[]byte, error,
+) {
+	if alg != 1 {
+		return nil, ErrDNSSECAlgorithm
+	}
+
+	data := append(packCanonicalName(name), salt...)
+	sum := sha1.Sum(data)
+
+	for x := uint16(0); x < iterations; x++ {
+		data = append(sum[:], salt...)
+		sum = sha1.Sum(data)
+	}
+
+	return sum[:], nil
+}
+
+//
+// canonicalLess will return true if domain name a is sorted before b in
+// canonical ordering (RFC 4034 section 6.1): the names are compared by
+// their labels, start from the rightmost label, as lowercase octets.
+//
+func canonicalLess(a, b string) bool {
+	la := strings.Split(strings.ToLower(a), ".")
+	lb := strings.Split(strings.ToLower(b), ".")
+
+	if len(a) == 0 {
+		la = nil
+	}
+	if len(b) == 0 {
+		lb = nil
+	}
+
+	for x, y := len(la)-1, len(lb)-1; x >= 0 && y >= 0; x, y = x-1, y-1 {
+		if la[x] != lb[y] {
+			return la[x] < lb[y]
+		}
+	}
+
+	return len(la) < len(lb)
+}
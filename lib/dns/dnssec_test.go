@@ -0,0 +1,192 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestTypeBitmap(t *testing.T) {
+	// Example from RFC 4034 section 4.3.
+	types := []uint16{QueryTypeA, QueryTypeMX, QueryTypeRRSIG,
+		QueryTypeNSEC, 1234}
+	exp := "0006400100000003041b000000000000000000000000000000000000000000000000000020"
+
+	got := packTypeBitmap(types)
+	test.Assert(t, "packTypeBitmap", exp, hex.EncodeToString(got), true)
+
+	gotTypes, err := unpackTypeBitmap(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "unpackTypeBitmap", types, gotTypes, true)
+
+	_, err = unpackTypeBitmap([]byte{0, 2, 0x40})
+	test.Assert(t, "unpackTypeBitmap error", ErrRDataLength, err, true)
+}
+
+func TestMasterParseDNSSEC(t *testing.T) {
+	// Example from RFC 4034 section 5.4.
+	data := `$ORIGIN example.com.
+dskey 86400 IN DNSKEY 256 3 5 ( AQOeiiR0GOMYkDshWoSKz9Xz
+	fwJr1AYtsmx3TGkJaNXVbfi/
+	2pHm822aJ5iI9BMzNXxeYCmZ
+	DRD99WYwYqUSdjMmmAphXdvx
+	egXd/M5+X7OrzKBaMbCVdFLU
+	Uh6DhweJBjEVv5f2wwjM9Xzc
+	nOf+EPbtG9DMBmADjFDc2w/r
+	ljwvFw==
+	) ;  key id = 60485
+dskey 86400 IN DS 60485 5 1 ( 2BB183AF5F22588179A53B0A
+	98631FAD1A292118 )
+host 3600 IN NSEC Host2.example.com. A MX RRSIG NSEC
+host 3600 IN RRSIG A 5 3 86400 20030322173103 (
+	20030220173103 2642 example.com.
+	oJB1W6WNGv+ldvQ3WDG0MQkg5IEhjRip8WTr
+	J5D6fwFm8nN+6pBzeDQfsS3Ap3o= )
+0p9mhaveqvm6t7vbl5lop2u3t2rp3tom 3600 IN NSEC3 1 1 12 aabbccdd (
+	2t7b4g4vsa5smi47k61mv5bv1a22bojr MX DNSKEY NS
+	SOA RRSIG )
+`
+	m := newMaster()
+	m.Init(data, "example.com", 3600)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[uint16]*ResourceRecord)
+	for _, msg := range m.msgs {
+		got[msg.Answer[0].Type] = msg.Answer[0]
+	}
+
+	dnskey := got[QueryTypeDNSKEY]
+	test.Assert(t, "DNSKEY name", "dskey.example.com", string(dnskey.Name), true)
+	test.Assert(t, "DNSKEY KeyTag", uint16(60485), dnskey.DNSKEY.KeyTag(), true)
+
+	ds := got[QueryTypeDS]
+	test.Assert(t, "DS KeyTag", uint16(60485), ds.DS.KeyTag, true)
+	test.Assert(t, "DS isMatchDS", true,
+		ds.DS.isMatchDS(dnskey.Name, dnskey.DNSKEY), true)
+
+	nsec := got[QueryTypeNSEC]
+	test.Assert(t, "NSEC NextName", "host2.example.com",
+		string(nsec.NSEC.NextName), true)
+	test.Assert(t, "NSEC Types", []uint16{QueryTypeA, QueryTypeMX,
+		QueryTypeRRSIG, QueryTypeNSEC}, nsec.NSEC.Types, true)
+
+	rrsig := got[QueryTypeRRSIG]
+	test.Assert(t, "RRSIG TypeCovered", QueryTypeA, rrsig.RRSIG.TypeCovered, true)
+	test.Assert(t, "RRSIG Expiration", uint32(1048354263), rrsig.RRSIG.Expiration, true)
+	test.Assert(t, "RRSIG Inception", uint32(1045762263), rrsig.RRSIG.Inception, true)
+	test.Assert(t, "RRSIG KeyTag", uint16(2642), rrsig.RRSIG.KeyTag, true)
+	test.Assert(t, "RRSIG SignerName", "example.com",
+		string(rrsig.RRSIG.SignerName), true)
+
+	nsec3 := got[QueryTypeNSEC3]
+	test.Assert(t, "NSEC3 Salt", "aabbccdd", hex.EncodeToString(nsec3.NSEC3.Salt), true)
+	test.Assert(t, "NSEC3 NextHashedOwner", "2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		base32HexNoPad.EncodeToString(nsec3.NSEC3.NextHashedOwner), true)
+	test.Assert(t, "NSEC3 Types", 5, len(nsec3.NSEC3.Types), true)
+}
+
+func TestMessageDNSSEC(t *testing.T) {
+	msg := &Message{
+		Header: &SectionHeader{
+			ID:   1,
+			IsAD: true,
+		},
+		Question: &SectionQuestion{
+			Name:  []byte("example.com"),
+			Type:  QueryTypeDNSKEY,
+			Class: QueryClassIN,
+		},
+		Answer: []*ResourceRecord{{
+			Name:  []byte("example.com"),
+			Type:  QueryTypeDNSKEY,
+			Class: QueryClassIN,
+			TTL:   3600,
+			DNSKEY: &RDataDNSKEY{
+				Flags:     257,
+				Protocol:  3,
+				Algorithm: DNSSECAlgED25519,
+				PublicKey: make([]byte, 32),
+			},
+		}, {
+			Name:  []byte("example.com"),
+			Type:  QueryTypeRRSIG,
+			Class: QueryClassIN,
+			TTL:   3600,
+			RRSIG: &RDataRRSIG{
+				TypeCovered: QueryTypeDNSKEY,
+				Algorithm:   DNSSECAlgED25519,
+				Labels:      2,
+				OrigTTL:     3600,
+				Expiration:  2000,
+				Inception:   1000,
+				KeyTag:      1,
+				SignerName:  []byte("example.com"),
+				Signature:   []byte{1, 2, 3, 4},
+			},
+		}},
+		Authority: []*ResourceRecord{{
+			Name:  []byte("example.com"),
+			Type:  QueryTypeNSEC,
+			Class: QueryClassIN,
+			TTL:   3600,
+			NSEC: &RDataNSEC{
+				NextName: []byte("a.example.com"),
+				Types:    []uint16{QueryTypeNS, QueryTypeSOA},
+			},
+		}, {
+			Name:  []byte("sub.example.com"),
+			Type:  QueryTypeDS,
+			Class: QueryClassIN,
+			TTL:   3600,
+			DS: &RDataDS{
+				KeyTag:     1,
+				Algorithm:  DNSSECAlgED25519,
+				DigestType: DSDigestSHA256,
+				Digest:     []byte{5, 6, 7},
+			},
+		}, {
+			Name:  []byte("abc.example.com"),
+			Type:  QueryTypeNSEC3,
+			Class: QueryClassIN,
+			TTL:   3600,
+			NSEC3: &RDataNSEC3{
+				HashAlgorithm:   1,
+				Flags:           NSEC3FlagOptOut,
+				Iterations:      10,
+				NextHashedOwner: []byte{8, 9},
+				Types:           []uint16{QueryTypeA},
+			},
+		}},
+	}
+
+	_, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewMessage()
+	got.Packet = append(got.Packet[:0], msg.Packet...)
+
+	err = got.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "IsAD", true, got.Header.IsAD, true)
+	test.Assert(t, "DNSKEY", msg.Answer[0].DNSKEY, got.Answer[0].DNSKEY, true)
+	test.Assert(t, "RRSIG", msg.Answer[1].RRSIG, got.Answer[1].RRSIG, true)
+	test.Assert(t, "NSEC", msg.Authority[0].NSEC, got.Authority[0].NSEC, true)
+	test.Assert(t, "DS", msg.Authority[1].DS, got.Authority[1].DS, true)
+	test.Assert(t, "NSEC3", msg.Authority[2].NSEC3, got.Authority[2].NSEC3, true)
+}
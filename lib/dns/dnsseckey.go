@@ -0,0 +1,209 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+)
+
+//
+// DNSSECKey contains the DNSKEY record and its private key, used to sign
+// the zone.
+//
+type DNSSECKey struct {
+	// DNSKEY record of the key.
+	DNSKEY *ResourceRecord
+
+	// PrivateKey is the private part of the key.
+	PrivateKey crypto.Signer
+}
+
+//
+// LoadDNSSECKey load the DNSSEC key from a pair of files in the format
+// generated by BIND dnssec-keygen: the public key file with ".key"
+// extension contains the DNSKEY record in master file syntax, and the
+// private key file with ".private" extension contains the private key in
+// "Private-key-format: v1.3".
+//
+// The file parameter is the path to one of those files, with or without
+// extension, for example "Kexample.com.+013+12345".
+//
+// Supported algorithms are RSASHA1, RSASHA1-NSEC3-SHA1, RSASHA256,
+// RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384, and ED25519.
+//
+func LoadDNSSECKey(file string) (key *DNSSECKey, err error) {
+	file = strings.TrimSuffix(file, ".key")
+	file = strings.TrimSuffix(file, ".private")
+
+	pub, err := ioutil.ReadFile(file + ".key")
+	if err != nil {
+		return nil, err
+	}
+
+	m := newMaster()
+	m.Init(string(pub), "", 0)
+	m.file = file + ".key"
+
+	err = m.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	key = &DNSSECKey{}
+	for _, msg := range m.msgs {
+		for _, rr := range msg.Answer {
+			if rr.Type == QueryTypeDNSKEY {
+				key.DNSKEY = rr
+				break
+			}
+		}
+	}
+	if key.DNSKEY == nil {
+		return nil, fmt.Errorf("dns: LoadDNSSECKey: %s: missing DNSKEY record",
+			file+".key")
+	}
+
+	priv, err := ioutil.ReadFile(file + ".private")
+	if err != nil {
+		return nil, err
+	}
+
+	key.PrivateKey, err = parsePrivateKey(key.DNSKEY.DNSKEY, priv)
+	if err != nil {
+		return nil, fmt.Errorf("dns: LoadDNSSECKey: %s: %s",
+			file+".private", err)
+	}
+
+	return key, nil
+}
+
+//
+// IsKSK will return true if the key has the secure entry point flag,
+// which mean it is used as key signing key.
+//
+func (key *DNSSECKey) IsKSK() bool {
+	return key.DNSKEY.DNSKEY.Flags&DNSKEYFlagSEP != 0
+}
+
+//
+// privateKeyFields contains the fields of key material in private key file.
+// Other fields, for example the algorithm and the timing metadata, are
+// ignored.
+//
+var privateKeyFields = map[string]bool{
+	"Modulus":         true,
+	"PublicExponent":  true,
+	"PrivateExponent": true,
+	"Prime1":          true,
+	"Prime2":          true,
+	"Exponent1":       true,
+	"Exponent2":       true,
+	"Coefficient":     true,
+	"PrivateKey":      true,
+}
+
+//
+// parsePrivateKey parse the content of private key file.
+//
+func parsePrivateKey(dnskey *RDataDNSKEY, content []byte) (
+	signer crypto.Signer, err error,
+) {
+	fields := make(map[string][]byte)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		k := strings.TrimSpace(kv[0])
+		v := strings.TrimSpace(kv[1])
+
+		if !privateKeyFields[k] {
+			continue
+		}
+
+		fields[k], err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %s", k, err)
+		}
+	}
+
+	pub, err := dnskey.publicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		names := []string{"PrivateExponent", "Prime1", "Prime2"}
+		v := make([]*big.Int, len(names))
+		for x, name := range names {
+			if len(fields[name]) == 0 {
+				return nil, fmt.Errorf("missing %s", name)
+			}
+			v[x] = new(big.Int).SetBytes(fields[name])
+		}
+
+		priv := &rsa.PrivateKey{
+			PublicKey: *pub,
+			D:         v[0],
+			Primes:    []*big.Int{v[1], v[2]},
+		}
+
+		err = priv.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		priv.Precompute()
+
+		return priv, nil
+
+	case *ecdsa.PublicKey:
+		d := fields["PrivateKey"]
+		if len(d) == 0 {
+			return nil, fmt.Errorf("missing PrivateKey")
+		}
+
+		priv := &ecdsa.PrivateKey{
+			PublicKey: *pub,
+			D:         new(big.Int).SetBytes(d),
+		}
+
+		x, y := pub.Curve.ScalarBaseMult(d)
+		if x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+			return nil, fmt.Errorf("private key does not match DNSKEY")
+		}
+
+		return priv, nil
+
+	case ed25519.PublicKey:
+		seed := fields["PrivateKey"]
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid PrivateKey")
+		}
+
+		priv := ed25519.NewKeyFromSeed(seed)
+		if !bytes.Equal(priv.Public().(ed25519.PublicKey), pub) {
+			return nil, fmt.Errorf("private key does not match DNSKEY")
+		}
+
+		return priv, nil
+	}
+
+	return nil, ErrDNSSECAlgorithm
+}
@@ -0,0 +1,106 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestLoadDNSSECKey(t *testing.T) {
+	cases := []struct {
+		file   string
+		expTag uint16
+		isKSK  bool
+	}{{
+		file:   testKSKFile,
+		expTag: 41112,
+		isKSK:  true,
+	}, {
+		file:   testZSKFile,
+		expTag: 62151,
+	}, {
+		file:   "testdata/Kexample.com.+015+42001.private",
+		expTag: 42001,
+	}, {
+		file:   "testdata/Kexample.com.+008+19453",
+		expTag: 19453,
+	}}
+
+	now := time.Now()
+	rrset := []*ResourceRecord{newTestA("www.example.com", "10.0.0.1")}
+
+	for _, c := range cases {
+		t.Log(c.file)
+
+		key, err := LoadDNSSECKey(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.Assert(t, "KeyTag", c.expTag, key.DNSKEY.DNSKEY.KeyTag(), true)
+		test.Assert(t, "IsKSK", c.isKSK, key.IsKSK(), true)
+
+		rrsig, err := signRRSet(rrset, key, now, now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = verifyRRSIG(rrsig.RRSIG, rrset, key.DNSKEY.DNSKEY)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := LoadDNSSECKey("testdata/Kexample.com.+000+00000")
+	test.Assert(t, "error", true, err != nil, true)
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	ksk, err := LoadDNSSECKey(testKSKFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		desc    string
+		content string
+		expErr  string
+	}{{
+		desc: "With timing metadata",
+		content: `Private-key-format: v1.3
+Algorithm: 13 (ECDSAP256SHA256)
+PrivateKey: HrEP+Iqv/7Dxiv3ao1GcAQlE0I686y+fSKMs7Q2ipHo=
+Created: 20181001000000
+Publish: 20181001000000
+Activate: 20181001000000
+Inactive: 20191001000000
+Delete: 20201001000000
+SyncPublish: 20181001000000
+SyncDelete: 20201001000000
+`,
+	}, {
+		desc: "With private key of other DNSKEY",
+		content: `Private-key-format: v1.3
+Algorithm: 13 (ECDSAP256SHA256)
+PrivateKey: yGsqQtF6v8x1TByV7K/vOL/X4SCB4kCAkgnQTixFACY=
+`,
+		expErr: "private key does not match DNSKEY",
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		_, err := parsePrivateKey(ksk.DNSKEY.DNSKEY, []byte(c.content))
+		if err != nil {
+			test.Assert(t, "error", c.expErr, err.Error(), true)
+			continue
+		}
+
+		test.Assert(t, "error", c.expErr, "", true)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shuLhan/share/lib/debug"
+)
+
+//
+// errDoTClosed is returned when the connection closed before the response
+// of query received.
+//
+var errDoTClosed = fmt.Errorf("dns: DoTClient: connection closed")
+
+//
+// DoTClient client for DNS over TLS (RFC 7858).
+//
+// The TLS connection is reused by all queries and the queries are
+// pipelined: multiple queries can be sent without waiting for the previous
+// response, and each response is matched with its query by message ID.  If
+// the connection is closed by server, it will be reopened on the next
+// query.
+//
+// This client is safe to be used concurrently.
+//
+type DoTClient struct {
+	Timeout time.Duration
+
+	addr          string
+	allowInsecure bool
+	tlsConfig     *tls.Config
+
+	// wlock protect writing to connection.
+	wlock sync.Mutex
+
+	// Mutex protect the connection and pending queries.
+	sync.Mutex
+	conn    *tls.Conn
+	pending map[uint16]chan *Message
+
+	// chRecv contains the response that does not have pending query,
+	// for example message sent using Send instead of Query.
+	chRecv chan *Message
+}
+
+//
+// NewDoTClient will create new DNS client over TLS connection.  The
+// nameserver is in the form of "host:port"; if port is empty it will
+// default to 853.
+//
+func NewDoTClient(nameserver string, allowInsecure bool) (*DoTClient, error) {
+	cl := &DoTClient{
+		Timeout:       clientTimeout,
+		allowInsecure: allowInsecure,
+		pending:       make(map[uint16]chan *Message),
+		chRecv:        make(chan *Message, 1),
+	}
+
+	err := cl.SetRemoteAddr(nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	cl.Lock()
+	err = cl.connect()
+	cl.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+//
+// Close the client connection.  All pending queries will be failed.
+//
+func (cl *DoTClient) Close() error {
+	cl.Lock()
+	err := cl.closeConn()
+	cl.Unlock()
+	return err
+}
+
+//
+// Lookup will query the name server with specific type, class, and name.
+//
+func (cl *DoTClient) Lookup(qtype, qclass uint16, qname []byte) (*Message, error) {
+	if len(qname) == 0 {
+		return nil, nil
+	}
+	if qtype == 0 {
+		qtype = QueryTypeA
+	}
+	if qclass == 0 {
+		qclass = QueryClassIN
+	}
+
+	msg := NewMessage()
+
+	msg.Header.ID = getNextID()
+	msg.Header.QDCount = 1
+	msg.Question.Type = qtype
+	msg.Question.Class = qclass
+	msg.Question.Name = append(msg.Question.Name, qname...)
+
+	_, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	return cl.Query(msg, nil)
+}
+
+//
+// Query send DNS query to name server and wait for its response.
+// If the connection closed before the response received, the query will be
+// sent once more using new connection.
+// The addr parameter is unused.
+//
+func (cl *DoTClient) Query(msg *Message, ns net.Addr) (res *Message, err error) {
+	for x := 0; x < 2; x++ {
+		res, err = cl.query(msg)
+		if err != errDoTClosed {
+			break
+		}
+	}
+	return res, err
+}
+
+func (cl *DoTClient) query(msg *Message) (*Message, error) {
+	id := msg.Header.ID
+	ch := make(chan *Message, 1)
+
+	cl.Lock()
+	if _, ok := cl.pending[id]; ok {
+		cl.Unlock()
+		return nil, fmt.Errorf("dns: DoTClient: duplicate query ID %d", id)
+	}
+	if cl.conn == nil {
+		err := cl.connect()
+		if err != nil {
+			cl.Unlock()
+			return nil, err
+		}
+	}
+	conn := cl.conn
+	cl.pending[id] = ch
+	cl.Unlock()
+
+	_, err := cl.write(conn, msg)
+	if err != nil {
+		cl.Lock()
+		delete(cl.pending, id)
+		cl.Unlock()
+		return nil, err
+	}
+
+	timer := time.NewTimer(cl.Timeout)
+	defer timer.Stop()
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return nil, errDoTClosed
+		}
+		return res, nil
+	case <-timer.C:
+	}
+
+	cl.Lock()
+	delete(cl.pending, id)
+	cl.Unlock()
+
+	return nil, fmt.Errorf("dns: DoTClient: timeout waiting response ID %d", id)
+}
+
+//
+// RemoteAddr return client remote name server address.
+//
+func (cl *DoTClient) RemoteAddr() string {
+	return cl.addr
+}
+
+//
+// Recv read the response that does not have pending query, for example
+// response of message sent using Send.
+//
+func (cl *DoTClient) Recv(msg *Message) (n int, err error) {
+	timer := time.NewTimer(cl.Timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-cl.chRecv:
+		msg.Packet = append(msg.Packet[:0], res.Packet...)
+		return len(msg.Packet), nil
+	case <-timer.C:
+	}
+
+	return 0, fmt.Errorf("dns: DoTClient: timeout on Recv")
+}
+
+//
+// Send DNS message to name server.  The response can be read using Recv.
+//
+// The message packet must already been filled, using Pack().
+// The addr parameter is unused.
+//
+func (cl *DoTClient) Send(msg *Message, addr net.Addr) (n int, err error) {
+	cl.Lock()
+	if cl.conn == nil {
+		err = cl.connect()
+		if err != nil {
+			cl.Unlock()
+			return 0, err
+		}
+	}
+	conn := cl.conn
+	cl.Unlock()
+
+	return cl.write(conn, msg)
+}
+
+//
+// SetRemoteAddr set the remote name server address.  If the client already
+// connected, the current connection will be closed.
+//
+func (cl *DoTClient) SetRemoteAddr(addr string) (err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		port = strconv.Itoa(int(DefaultDoTPort))
+	}
+
+	cl.Lock()
+	_ = cl.closeConn()
+	cl.addr = net.JoinHostPort(host, port)
+	cl.tlsConfig = &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: cl.allowInsecure,
+	}
+	cl.Unlock()
+
+	return nil
+}
+
+//
+// SetTimeout set the timeout for sending and receiving packet.
+//
+func (cl *DoTClient) SetTimeout(t time.Duration) {
+	cl.Timeout = t
+}
+
+//
+// connect open new TLS connection to name server and start reading the
+// responses in another goroutine.  This method must be called with lock.
+//
+func (cl *DoTClient) connect() (err error) {
+	dialer := &net.Dialer{
+		Timeout: cl.Timeout,
+	}
+
+	cl.conn, err = tls.DialWithDialer(dialer, "tcp", cl.addr, cl.tlsConfig)
+	if err != nil {
+		cl.conn = nil
+		return err
+	}
+
+	go cl.serve(cl.conn)
+
+	return nil
+}
+
+//
+// closeConn close the current connection and fail all pending queries.
+// This method must be called with lock.
+//
+func (cl *DoTClient) closeConn() (err error) {
+	if cl.conn != nil {
+		err = cl.conn.Close()
+		cl.conn = nil
+	}
+	for id, ch := range cl.pending {
+		close(ch)
+		delete(cl.pending, id)
+	}
+	return err
+}
+
+//
+// serve read the responses from connection and pass it to their pending
+// query, until the connection closed.
+//
+func (cl *DoTClient) serve(conn *tls.Conn) {
+	for {
+		res := NewMessage()
+
+		_, err := recvStream(conn, res)
+		if err != nil {
+			if debug.Value >= 1 {
+				log.Println("dns: DoTClient: serve:", err)
+			}
+			break
+		}
+
+		err = res.Unpack()
+		if err != nil {
+			continue
+		}
+
+		cl.Lock()
+		ch, ok := cl.pending[res.Header.ID]
+		if ok {
+			delete(cl.pending, res.Header.ID)
+		}
+		cl.Unlock()
+
+		if ok {
+			ch <- res
+			continue
+		}
+
+		select {
+		case cl.chRecv <- res:
+		default:
+		}
+	}
+
+	cl.Lock()
+	if cl.conn == conn {
+		_ = cl.closeConn()
+	}
+	cl.Unlock()
+}
+
+//
+// write the message into connection, prefixed with two octets length.
+//
+func (cl *DoTClient) write(conn *tls.Conn, msg *Message) (n int, err error) {
+	cl.wlock.Lock()
+	defer cl.wlock.Unlock()
+
+	err = conn.SetWriteDeadline(time.Now().Add(cl.Timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	return sendStream(conn, msg)
+}
@@ -0,0 +1,101 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestDoTClientQuery(t *testing.T) {
+	cl, err := NewDoTClient("127.0.0.1:8853", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qtypes := []uint16{
+		QueryTypeA,
+		QueryTypeSOA,
+		QueryTypeTXT,
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		ress = make(map[uint16]*Message)
+	)
+
+	// Send all queries concurrently using the same connection.
+	for x, qtype := range qtypes {
+		msg := NewMessage()
+		msg.Header.ID = uint16(1000 + x)
+		msg.Header.QDCount = 1
+		msg.Question.Type = qtype
+		msg.Question.Class = QueryClassIN
+		msg.Question.Name = append(msg.Question.Name, "kilabit.info"...)
+
+		_, err = msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(msg *Message) {
+			res, err := cl.Query(msg, nil)
+
+			mu.Lock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				ress[msg.Header.ID] = res
+			}
+			mu.Unlock()
+
+			wg.Done()
+		}(msg)
+	}
+
+	wg.Wait()
+
+	test.Assert(t, "errors", 0, len(errs), true)
+
+	for x, qtype := range qtypes {
+		res := ress[uint16(1000+x)]
+
+		test.Assert(t, "ID", uint16(1000+x), res.Header.ID, true)
+		test.Assert(t, "Question.Type", qtype, res.Question.Type, true)
+		test.Assert(t, "ANCount", uint16(1), res.Header.ANCount, true)
+	}
+
+	// Query after the connection closed should reconnect.
+	err = cl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := NewMessage()
+	msg.Header.ID = 1100
+	msg.Header.QDCount = 1
+	msg.Question.Type = QueryTypeA
+	msg.Question.Class = QueryClassIN
+	msg.Question.Name = append(msg.Question.Name, "kilabit.info"...)
+
+	_, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cl.Query(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "ID", uint16(1100), res.Header.ID, true)
+
+	_ = cl.Close()
+}
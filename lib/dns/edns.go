@@ -0,0 +1,261 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// List of known EDNS option codes.
+//
+const (
+	EDNSOptionNSID          uint16 = 3  // Name server identifier (RFC 5001)
+	EDNSOptionClientSubnet  uint16 = 8  // Client subnet (RFC 7871)
+	EDNSOptionCookie        uint16 = 10 // DNS cookie (RFC 7873)
+	EDNSOptionTCPKeepalive  uint16 = 11 // TCP keepalive (RFC 7828)
+	EDNSOptionPadding       uint16 = 12 // Padding (RFC 7830)
+	EDNSOptionExtendedError uint16 = 15 // Extended DNS error (RFC 8914)
+)
+
+//
+// List of extended DNS error codes (RFC 8914 section 4).
+//
+const (
+	EDEOther                      uint16 = iota // Other error
+	EDEUnsupportedDNSKEYAlgorithm               // Unsupported DNSKEY algorithm
+	EDEUnsupportedDSDigestType                  // Unsupported DS digest type
+	EDEStaleAnswer                              // Stale answer
+	EDEForgedAnswer                             // Forged answer
+	EDEDNSSECIndeterminate                      // DNSSEC indeterminate
+	EDEDNSSECBogus                              // DNSSEC bogus
+	EDESignatureExpired                         // Signature expired
+	EDESignatureNotYetValid                     // Signature not yet valid
+	EDEDNSKEYMissing                            // DNSKEY missing
+	EDERRSIGsMissing                            // RRSIGs missing
+	EDENoZoneKeyBitSet                          // No zone key bit set
+	EDENSECMissing                              // NSEC missing
+	EDECachedError                              // Cached error
+	EDENotReady                                 // Not ready
+	EDEBlocked                                  // Blocked
+	EDECensored                                 // Censored
+	EDEFiltered                                 // Filtered
+	EDEProhibited                               // Prohibited
+	EDEStaleNXDomainAnswer                      // Stale NXDOMAIN answer
+	EDENotAuthoritative                         // Not authoritative
+	EDENotSupported                             // Not supported
+	EDENoReachableAuthority                     // No reachable authority
+	EDENetworkError                             // Network error
+	EDEInvalidData                              // Invalid data
+)
+
+const (
+	// EDNSPaddingBlockSize define the recommended block size to pad the
+	// response (RFC 8467 section 4.1).
+	EDNSPaddingBlockSize = 468
+
+	ednsFamilyIPv4 = 1
+	ednsFamilyIPv6 = 2
+)
+
+//
+// ErrEDNSOption define an error when the EDNS option data is invalid.
+//
+var ErrEDNSOption = errors.New("Invalid EDNS option")
+
+//
+// EDNSOption contains the code and data of EDNS option in OPT RDATA (RFC
+// 6891 section 6.1.2).
+//
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+//
+// EDNSClientSubnet define the client subnet option (RFC 7871 section 6).
+// It contains the network address of client, which can be used by
+// authoritative server to return the answer that is close to the client.
+//
+type EDNSClientSubnet struct {
+	// SourcePrefix is the number of leftmost bits of Address to be
+	// used in the lookup.
+	SourcePrefix byte
+
+	// ScopePrefix is the number of leftmost bits of Address that the
+	// response covers.  It must be zero in query.
+	ScopePrefix byte
+
+	// Address is the IPv4 or IPv6 address of client.
+	Address net.IP
+}
+
+//
+// NewEDNSClientSubnet create client subnet option from network address in
+// CIDR notation, for example "192.0.2.0/24".
+//
+func NewEDNSClientSubnet(cidr string) (*EDNSClientSubnet, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, _ := ipnet.Mask.Size()
+	if ip.To4() != nil {
+		ip = ip.To4()
+	}
+
+	return &EDNSClientSubnet{
+		SourcePrefix: byte(ones),
+		Address:      ip.Mask(ipnet.Mask),
+	}, nil
+}
+
+//
+// String return readable representation of client subnet.
+//
+func (ecs *EDNSClientSubnet) String() string {
+	return fmt.Sprintf("%s/%d/%d", ecs.Address, ecs.SourcePrefix,
+		ecs.ScopePrefix)
+}
+
+func (ecs *EDNSClientSubnet) pack() (data []byte, err error) {
+	family := uint16(ednsFamilyIPv6)
+	addr := ecs.Address.To16()
+	if ip4 := ecs.Address.To4(); ip4 != nil {
+		family = ednsFamilyIPv4
+		addr = ip4
+	}
+	if addr == nil || int(ecs.SourcePrefix) > len(addr)*8 {
+		return nil, ErrEDNSOption
+	}
+
+	// The address must be truncated to the number of bits indicated
+	// by source prefix, padding with 0 bits to pad to the end of the
+	// last octet.
+	n := (int(ecs.SourcePrefix) + 7) / 8
+	mask := net.CIDRMask(int(ecs.SourcePrefix), len(addr)*8)
+
+	libbytes.AppendUint16(&data, family)
+	data = append(data, ecs.SourcePrefix, ecs.ScopePrefix)
+	data = append(data, addr.Mask(mask)[:n]...)
+
+	return data, nil
+}
+
+func unpackEDNSClientSubnet(data []byte) (*EDNSClientSubnet, error) {
+	if len(data) < 4 {
+		return nil, ErrEDNSOption
+	}
+
+	ecs := &EDNSClientSubnet{
+		SourcePrefix: data[2],
+		ScopePrefix:  data[3],
+	}
+
+	size := 0
+	switch libbytes.ReadUint16(data, 0) {
+	case ednsFamilyIPv4:
+		size = net.IPv4len
+	case ednsFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return nil, ErrEDNSOption
+	}
+
+	addr := data[4:]
+	if len(addr) > size || len(addr) != (int(ecs.SourcePrefix)+7)/8 {
+		return nil, ErrEDNSOption
+	}
+
+	ecs.Address = make(net.IP, size)
+	copy(ecs.Address, addr)
+
+	return ecs, nil
+}
+
+//
+// EDNSCookie define the DNS cookie option (RFC 7873 section 4).
+//
+type EDNSCookie struct {
+	// Client cookie, 8 octets.
+	Client []byte
+
+	// Server cookie, between 8 to 32 octets, or empty if the client
+	// does not know the server cookie yet.
+	Server []byte
+}
+
+func (cookie *EDNSCookie) pack() (data []byte, err error) {
+	if len(cookie.Client) != 8 {
+		return nil, ErrEDNSOption
+	}
+	if len(cookie.Server) > 0 &&
+		(len(cookie.Server) < 8 || len(cookie.Server) > 32) {
+		return nil, ErrEDNSOption
+	}
+
+	data = append(data, cookie.Client...)
+	data = append(data, cookie.Server...)
+
+	return data, nil
+}
+
+func unpackEDNSCookie(data []byte) (*EDNSCookie, error) {
+	if len(data) != 8 && (len(data) < 16 || len(data) > 40) {
+		return nil, ErrEDNSOption
+	}
+
+	cookie := &EDNSCookie{
+		Client: append([]byte(nil), data[:8]...),
+	}
+	if len(data) > 8 {
+		cookie.Server = append([]byte(nil), data[8:]...)
+	}
+
+	return cookie, nil
+}
+
+//
+// EDNSExtendedError define the extended DNS error option (RFC 8914
+// section 2), which provide additional information about the cause of
+// error.
+//
+type EDNSExtendedError struct {
+	// InfoCode is one of the EDE code.
+	InfoCode uint16
+
+	// ExtraText is an optional UTF-8 text for human.
+	ExtraText string
+}
+
+//
+// String return readable representation of extended DNS error.
+//
+func (ede *EDNSExtendedError) String() string {
+	return fmt.Sprintf("{InfoCode:%d ExtraText:%s}", ede.InfoCode,
+		ede.ExtraText)
+}
+
+func (ede *EDNSExtendedError) pack() (data []byte) {
+	libbytes.AppendUint16(&data, ede.InfoCode)
+	return append(data, ede.ExtraText...)
+}
+
+func unpackEDNSExtendedError(data []byte) (*EDNSExtendedError, error) {
+	if len(data) < 2 {
+		return nil, ErrEDNSOption
+	}
+
+	return &EDNSExtendedError{
+		InfoCode:  libbytes.ReadUint16(data, 0),
+		ExtraText: strings.TrimRight(string(data[2:]), "\x00"),
+	}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestMessageEDNS(t *testing.T) {
+	msg := NewMessage()
+	msg.Header.ID = 1
+	msg.Question.Name = []byte("www.example.com")
+	msg.Question.Type = QueryTypeA
+	msg.Question.Class = QueryClassIN
+
+	opt := msg.SetEDNS(4096, true)
+
+	ecs, err := NewEDNSClientSubnet("192.0.2.130/25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = opt.SetClientSubnet(ecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := &EDNSCookie{
+		Client: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	err = opt.SetCookie(cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt.AddExtendedError(&EDNSExtendedError{
+		InfoCode:  EDEBlocked,
+		ExtraText: "blocked by policy",
+	})
+
+	_, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The query on server side only have the header and question
+	// unpacked.
+	got := NewMessage()
+	got.Packet = append(got.Packet[:0], msg.Packet...)
+
+	got.UnpackHeaderQuestion()
+
+	gotOpt := got.EDNS()
+	if gotOpt == nil {
+		t.Fatal("expecting OPT record")
+	}
+
+	test.Assert(t, "UDP size", uint16(4096), got.Additional[0].Class, true)
+	test.Assert(t, "DO", true, gotOpt.DO, true)
+
+	gotECS, err := gotOpt.ClientSubnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "ClientSubnet", "192.0.2.128/25/0", gotECS.String(), true)
+
+	gotCookie, err := gotOpt.Cookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "Cookie", cookie, gotCookie, true)
+
+	edes, err := gotOpt.ExtendedErrors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "number of ExtendedErrors", 1, len(edes), true)
+	test.Assert(t, "InfoCode", EDEBlocked, edes[0].InfoCode, true)
+	test.Assert(t, "ExtraText", "blocked by policy", edes[0].ExtraText, true)
+
+	// Calling SetEDNS again must update the existing OPT record.
+	got.SetEDNS(1232, false)
+	test.Assert(t, "number of OPT", 1, len(got.Additional), true)
+	test.Assert(t, "DO", false, gotOpt.DO, true)
+}
+
+func TestEDNSClientSubnet(t *testing.T) {
+	cases := []struct {
+		cidr    string
+		expAddr net.IP
+		expData []byte
+	}{{
+		cidr:    "192.0.2.0/24",
+		expAddr: net.ParseIP("192.0.2.0").To4(),
+		expData: []byte{0, 1, 24, 0, 192, 0, 2},
+	}, {
+		cidr:    "2001:db8:ffff::/36",
+		expAddr: net.ParseIP("2001:db8:f000::"),
+		expData: []byte{0, 2, 36, 0, 0x20, 0x01, 0x0d, 0xb8, 0xf0},
+	}}
+
+	for _, c := range cases {
+		t.Log(c.cidr)
+
+		ecs, err := NewEDNSClientSubnet(c.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ecs.pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Assert(t, "pack", c.expData, data, true)
+
+		got, err := unpackEDNSClientSubnet(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Assert(t, "Address", c.expAddr, got.Address, true)
+	}
+
+	_, err := unpackEDNSClientSubnet([]byte{0, 1, 24, 0, 192, 0})
+	test.Assert(t, "error", ErrEDNSOption, err, true)
+}
+
+func TestMessagePad(t *testing.T) {
+	res := NewMessage()
+	res.Header.ID = 1
+	res.Header.IsQuery = false
+	res.Question.Name = []byte("www.example.com")
+	res.Question.Type = QueryTypeA
+	res.Question.Class = QueryClassIN
+	res.Answer = append(res.Answer, newTestA("www.example.com", "10.0.0.1"))
+
+	_, err := res.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 2; x++ {
+		err = res.Pad(EDNSPaddingBlockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.Assert(t, "padded length", 0,
+			len(res.Packet)%EDNSPaddingBlockSize, true)
+		test.Assert(t, "number of OPT", 1, len(res.Additional), true)
+	}
+
+	got := NewMessage()
+	got.Packet = append(got.Packet[:0], res.Packet...)
+
+	err = got.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "answer", "10.0.0.1", string(got.Answer[0].Text.Value), true)
+	test.Assert(t, "padding", true,
+		got.EDNS().Option(EDNSOptionPadding) != nil, true)
+}
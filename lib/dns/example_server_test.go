@@ -136,7 +136,7 @@ func (h *serverHandler) ServeDNS(req *dns.Request) {
 
 	// Return empty answer
 	if res == nil {
-		res := &dns.Message{
+		res = &dns.Message{
 			Header: &dns.SectionHeader{
 				ID:      req.Message.Header.ID,
 				QDCount: 1,
@@ -146,43 +146,14 @@ func (h *serverHandler) ServeDNS(req *dns.Request) {
 
 		_, err = res.Pack()
 		if err != nil {
+			dns.FreeRequest(req)
 			return
 		}
 	} else {
 		res.SetID(req.Message.Header.ID)
 	}
 
-	switch req.Kind {
-	case dns.ConnTypeUDP:
-		if req.Sender != nil {
-			_, err = req.Sender.Send(res, req.UDPAddr)
-			if err != nil {
-				log.Println("! ServeDNS: Sender.Send: ", err)
-			}
-		}
-		dns.FreeRequest(req)
-
-	case dns.ConnTypeTCP:
-		if req.Sender != nil {
-			_, err = req.Sender.Send(res, nil)
-			if err != nil {
-				log.Println("! ServeDNS: Sender.Send: ", err)
-			}
-		}
-		dns.FreeRequest(req)
-
-	case dns.ConnTypeDoH:
-		if req.ResponseWriter != nil {
-			_, err = req.ResponseWriter.Write(res.Packet)
-			if err != nil {
-				log.Println("! ServeDNS: ResponseWriter.Write: ", err)
-			}
-			req.ChanResponded <- true
-		}
-
-	default:
-		dns.FreeRequest(req)
-	}
+	req.Respond(res)
 }
 
 func clientLookup(nameserver string) {
@@ -5,7 +5,8 @@
 package dns
 
 //
-// A Handler responds to DNS request.
+// A Handler responds to DNS request.  The response should be sent using
+// the Respond method of request.
 //
 type Handler interface {
 	ServeDNS(*Request)
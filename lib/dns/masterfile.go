@@ -6,9 +6,12 @@ package dns
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +24,10 @@ import (
 
 const (
 	defMinimumTTL = 3600
+
+	// maxGenerateRecords define the maximum number of records that can
+	// be generated by one $GENERATE directive.
+	maxGenerateRecords = 65536
 )
 
 const (
@@ -40,16 +47,6 @@ const (
 	parseSOAEnd     = 31
 )
 
-const (
-	parseSRVService = 1 << iota
-	parseSRVProto
-	parseSRVName
-	parseSRVPriority
-	parseSRVWeight
-	parseSRVPort
-	parseSRVTarget
-)
-
 type master struct {
 	file   string
 	lineno int
@@ -61,6 +58,18 @@ type master struct {
 	origin string
 	ttl    uint32
 	flag   int
+
+	// isTTLSet is true if the default TTL has been set, by caller, by
+	// $TTL directive, or by the minimum field of SOA record.
+	isTTLSet bool
+
+	// noTTL contains the RRs without explicit TTL that are parsed before
+	// the default TTL is set.
+	noTTL []*ResourceRecord
+
+	// termc contains the character that terminate the first token of
+	// RDATA.
+	termc byte
 }
 
 //
@@ -73,6 +82,7 @@ func MasterLoad(file, origin string, ttl uint32) ([]*Message, error) {
 	m := newMaster()
 	m.file = file
 	m.ttl = ttl
+	m.isTTLSet = ttl > 0
 
 	if len(origin) > 0 {
 		m.origin = origin
@@ -111,6 +121,8 @@ func (m *master) Init(data, origin string, ttl uint32) {
 	m.lineno = 1
 	m.origin = strings.ToLower(origin)
 	m.ttl = ttl
+	m.isTTLSet = ttl > 0
+	m.noTTL = nil
 	if m.reader == nil {
 		m.reader = new(libio.Reader)
 	}
@@ -134,6 +146,8 @@ func (m *master) Init(data, origin string, ttl uint32) {
 //
 //    $INCLUDE <file-name> [<domain-name>] [<comment>]
 //
+//    $GENERATE <range> <lhs> [<ttl>] [<class>] <type> <rhs> [<comment>]
+//
 //    <domain-name><rr> [<comment>]
 //
 //    <blank><rr> [<comment>]
@@ -149,6 +163,8 @@ func (m *master) Init(data, origin string, ttl uint32) {
 // origin of the parent file, regardless of changes to the relative origin
 // made within the included file.
 //
+// The $GENERATE is an extension from BIND, see parseDirectiveGenerate.
+//
 // The last two forms represent RRs.  If an entry for an RR begins with a
 // blank, then the RR is assumed to be owned by the last stated owner.  If
 // an RR entry begins with a <domain-name>, then the owner name is reset.
@@ -220,8 +236,10 @@ func (m *master) parse() (err error) {
 			err = m.parseDirectiveInclude()
 		case "$TTL":
 			err = m.parseDirectiveTTL()
+		case "$GENERATE":
+			err = m.parseDirectiveGenerate()
 		case "@":
-			rr, err = m.parseRR(nil, []byte(m.origin))
+			rr, err = m.parseRR(nil, tok)
 		default:
 			if n == 0 {
 				rr, err = m.parseRR(nil, tok)
@@ -237,11 +255,11 @@ func (m *master) parse() (err error) {
 		}
 	}
 
-	if m.ttl == 0 {
+	if !m.isTTLSet {
 		m.ttl = defMinimumTTL
 	}
 
-	m.setMinimumTTL()
+	m.setDefaultTTL()
 	m.pack()
 
 	return nil
@@ -368,9 +386,12 @@ func (m *master) parseDirectiveTTL() (err error) {
 	if err != nil {
 		return
 	}
+	m.isTTLSet = true
 
 	if isTerm {
-		m.reader.SkipUntilNewline()
+		if c == ';' {
+			m.reader.SkipUntilNewline()
+		}
 		m.lineno++
 	} else {
 		c = m.reader.SkipSpace()
@@ -440,6 +461,10 @@ func (m *master) parseRR(prevRR *ResourceRecord, tok []byte) (*ResourceRecord, e
 
 	m.flag = 0
 
+	// isNoTTL is true if the RR does not have explicit TTL and the
+	// default TTL, or the TTL of previous RR, is not set yet.
+	isNoTTL := !m.isTTLSet
+
 	if prevRR == nil {
 		rr.Name = m.generateDomainName(tok)
 		rr.TTL = m.ttl
@@ -453,6 +478,9 @@ func (m *master) parseRR(prevRR *ResourceRecord, tok []byte) (*ResourceRecord, e
 		rr.TTL = prevRR.TTL
 		rr.Class = prevRR.Class
 
+		n := len(m.noTTL)
+		isNoTTL = n > 0 && m.noTTL[n-1] == prevRR
+
 		if libbytes.IsDigit(tok[0]) {
 			ttl, err := parseTTL(tok, stok)
 			if err != nil {
@@ -485,8 +513,10 @@ func (m *master) parseRR(prevRR *ResourceRecord, tok []byte) (*ResourceRecord, e
 			return nil, err
 		}
 
-		libbytes.ToUpper(&tok)
-		stok = string(tok)
+		// The token is kept in its original case, because RDATA may
+		// contains case sensitive value, for example TXT.
+		stok = strings.ToUpper(string(tok))
+		m.termc = c
 
 		switch m.flag {
 		case parseRRStart:
@@ -549,10 +579,17 @@ func (m *master) parseRR(prevRR *ResourceRecord, tok []byte) (*ResourceRecord, e
 			parseRRTTL | parseRRType,
 			parseRRClass | parseRRType,
 			parseRRTTL | parseRRClass | parseRRType:
+			// The flag is checked before parsing the RDATA,
+			// because parsing SOA RDATA reuse the flag.
+			isNoTTL = isNoTTL && m.flag&parseRRTTL == 0
+
 			err := m.parseRRData(rr, tok)
 			if err != nil {
 				return nil, err
 			}
+			if isNoTTL {
+				m.noTTL = append(m.noTTL, rr)
+			}
 			return rr, nil
 		}
 	}
@@ -581,7 +618,8 @@ func (m *master) parseRRClassOrType(rr *ResourceRecord, stok string) bool {
 }
 
 //
-// parseRRClass check if token is known class.
+// parseRRClass check if token is known class or in the form of "CLASSnnn"
+// (RFC 3597 section 5).
 // It will set the rr.Class and return true if stok is one of known class;
 // otherwise it will return false.
 //
@@ -592,11 +630,16 @@ func (m *master) parseRRClass(rr *ResourceRecord, stok string) bool {
 			return true
 		}
 	}
-	return false
+	v, ok := parseGenericCode(stok, "CLASS")
+	if ok {
+		rr.Class = v
+	}
+	return ok
 }
 
 //
-// parseRRType check if token is one of known query type.
+// parseRRType check if token is one of known query type or in the form of
+// "TYPEnnn" (RFC 3597 section 5).
 // It will set rr.Type and return true if token found, otherwise it will
 // return false.
 //
@@ -607,16 +650,54 @@ func (m *master) parseRRType(rr *ResourceRecord, stok string) bool {
 			return true
 		}
 	}
-	return false
+	v, ok := parseGenericCode(stok, "TYPE")
+	if ok {
+		rr.Type = v
+	}
+	return ok
+}
+
+//
+// parseGenericCode parse the generic type or class, the prefix followed by
+// decimal value, for example "TYPE123".
+//
+func parseGenericCode(stok, prefix string) (uint16, bool) {
+	if len(stok) <= len(prefix) || !strings.HasPrefix(stok, prefix) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(stok[len(prefix):], 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(v), true
+}
+
+//
+// parseTypeName convert the upper case type mnemonic or the generic type
+// "TYPEnnn" (RFC 3597 section 5) into type value.
+//
+func parseTypeName(stok string) (uint16, bool) {
+	v, ok := QueryTypes[stok]
+	if ok {
+		return v, true
+	}
+	return parseGenericCode(stok, "TYPE")
 }
 
 func (m *master) parseRRData(rr *ResourceRecord, tok []byte) (err error) {
+	if bytes.Equal(tok, []byte(`\#`)) {
+		return m.parseGeneric(rr, tok)
+	}
+
 	switch rr.Type {
-	case QueryTypeA, QueryTypeTXT, QueryTypeAAAA:
+	case QueryTypeA, QueryTypeAAAA:
 		rr.Text = &RDataText{
 			Value: tok,
 		}
 
+	case QueryTypeTXT:
+		err = m.parseTXT(rr, tok)
+
 	case QueryTypeNS, QueryTypeCNAME, QueryTypeMB, QueryTypeMG, QueryTypeMR, QueryTypePTR:
 		dname := m.generateDomainName(tok)
 		rr.Text = &RDataText{
@@ -646,6 +727,42 @@ func (m *master) parseRRData(rr *ResourceRecord, tok []byte) (err error) {
 
 	case QueryTypeSRV:
 		err = m.parseSRV(rr, tok)
+
+	case QueryTypeDS:
+		err = m.parseDS(rr, tok)
+
+	case QueryTypeRRSIG:
+		err = m.parseRRSIG(rr, tok)
+
+	case QueryTypeNSEC:
+		err = m.parseNSEC(rr, tok)
+
+	case QueryTypeDNSKEY:
+		err = m.parseDNSKEY(rr, tok)
+
+	case QueryTypeNSEC3:
+		err = m.parseNSEC3(rr, tok)
+
+	case QueryTypeNSEC3PARAM:
+		err = m.parseNSEC3PARAM(rr, tok)
+
+	case QueryTypeNAPTR:
+		err = m.parseNAPTR(rr, tok)
+
+	case QueryTypeSSHFP:
+		err = m.parseSSHFP(rr, tok)
+
+	case QueryTypeTLSA:
+		err = m.parseTLSA(rr, tok)
+
+	case QueryTypeSVCB, QueryTypeHTTPS:
+		err = m.parseSVCB(rr, tok)
+
+	case QueryTypeURI:
+		err = m.parseURI(rr, tok)
+
+	case QueryTypeCAA:
+		err = m.parseCAA(rr, tok)
 	}
 	return
 }
@@ -696,7 +813,7 @@ func (m *master) parseSOA(rr *ResourceRecord, tok []byte) (err error) {
 			return
 		}
 		rr.SOA.Serial = uint32(v)
-		m.flag |= parseSOASerial
+		m.flag = parseSOASerial
 	}
 
 	for {
@@ -792,44 +909,34 @@ out:
 		}
 	}
 
-	if m.ttl == 0 {
+	if !m.isTTLSet {
 		m.ttl = rr.SOA.Minimum
+		m.isTTLSet = true
 	}
 
 	return
 }
 
 func (m *master) parseHInfo(rr *ResourceRecord, tok []byte) (err error) {
-	rr.HInfo = &RDataHINFO{
-		CPU: tok,
-	}
-
-	_, c := m.reader.SkipHorizontalSpace()
-	if c == 0 || c == ';' {
-		err = fmt.Errorf("! %s:%d Missing HInfo OS value", m.file, m.lineno)
-		return
+	texts, err := m.parseText(tok, m.termc)
+	if err != nil {
+		return err
 	}
-
-	// Get OS
-	tok, isTerm, _ := m.reader.ReadUntil(m.seps, m.terms)
-	if len(tok) == 0 {
-		err = fmt.Errorf("! %s:%d Missing HInfo OS value", m.file, m.lineno)
-		return
+	if len(texts) != 2 {
+		return fmt.Errorf("! %s:%d Missing HInfo OS value", m.file, m.lineno)
 	}
 
-	rr.HInfo.OS = tok
-
-	if !isTerm {
-		m.reader.SkipUntilNewline()
-		m.lineno++
+	rr.HInfo = &RDataHINFO{
+		CPU: texts[0],
+		OS:  texts[1],
 	}
 
-	return
+	return nil
 }
 
 func (m *master) parseMInfo(rr *ResourceRecord, tok []byte) (err error) {
 	rr.MInfo = &RDataMINFO{
-		RMailBox: tok,
+		RMailBox: m.generateDomainName(tok),
 	}
 
 	_, c := m.reader.SkipHorizontalSpace()
@@ -845,7 +952,7 @@ func (m *master) parseMInfo(rr *ResourceRecord, tok []byte) (err error) {
 		return
 	}
 
-	rr.MInfo.EmailBox = tok
+	rr.MInfo.EmailBox = m.generateDomainName(tok)
 
 	if !isTerm {
 		m.reader.SkipUntilNewline()
@@ -890,79 +997,770 @@ func (m *master) parseMX(rr *ResourceRecord, tok []byte) (err error) {
 	return
 }
 
+//
+// parseSRV parse the SRV RDATA in the form of (RFC 2782),
+//
+//	_Service._Proto.Name TTL Class SRV Priority Weight Port Target
+//
+// The Service, Proto, and Name is derived from the owner name.
+//
 func (m *master) parseSRV(rr *ResourceRecord, tok []byte) (err error) {
-	var v int
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) != 4 {
+		return fmt.Errorf("! %s:%d Invalid SRV RDATA", m.file, m.lineno)
+	}
+
+	rr.SRV = &RDataSRV{}
+
+	labels := bytes.SplitN(rr.Name, []byte{'.'}, 3)
+	rr.SRV.Service = labels[0]
+	if len(labels) > 1 {
+		rr.SRV.Proto = labels[1]
+	}
+	if len(labels) > 2 {
+		rr.SRV.Name = labels[2]
+	}
+
+	values := make([]uint16, 3)
+	for x := range values {
+		v, err := strconv.ParseUint(string(toks[x]), 10, 16)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid SRV RDATA: %s",
+				m.file, m.lineno, err)
+		}
+		values[x] = uint16(v)
+	}
+
+	rr.SRV.Priority = values[0]
+	rr.SRV.Weight = values[1]
+	rr.SRV.Port = values[2]
+	rr.SRV.Target = m.generateDomainName(toks[3])
+
+	return nil
+}
+
+//
+// parseRDataTokens read the rest of RDATA tokens until the end of line.
+// Parentheses can be used to continue the RDATA across lines.
+// The returned list include the first token, without parentheses.
+//
+func (m *master) parseRDataTokens(first []byte) (toks [][]byte, err error) {
+	var (
+		isMultiline bool
+		seps        = []byte{' ', '\t', '\r'}
+		terms       = []byte{';', '\n', '(', ')'}
+	)
 
-	rr.SRV = &RDataSRV{
-		Service: tok,
+	add := func(tok []byte) {
+		var v []byte
+		for _, c := range tok {
+			switch c {
+			case '(':
+				isMultiline = true
+			case ')':
+				isMultiline = false
+			default:
+				v = append(v, c)
+				continue
+			}
+			if len(v) > 0 {
+				toks = append(toks, v)
+				v = nil
+			}
+		}
+		if len(v) > 0 {
+			toks = append(toks, v)
+		}
 	}
 
-	m.flag = parseSRVService
+	add(first)
 
+	c := m.termc
 	for {
-		_, c := m.reader.SkipHorizontalSpace()
-		if c == 0 || c == ';' {
-			err = fmt.Errorf("! %s:%d Incomplete SRV RDATA", m.file, m.lineno)
-			return
+		switch c {
+		case '(':
+			isMultiline = true
+		case ')':
+			isMultiline = false
+		case ';':
+			m.reader.SkipUntilNewline()
+			m.lineno++
+			if !isMultiline {
+				return toks, nil
+			}
+		case '\n':
+			m.lineno++
+			if !isMultiline {
+				return toks, nil
+			}
+		case 0:
+			if isMultiline {
+				err = fmt.Errorf("! %s:%d Missing closing parentheses",
+					m.file, m.lineno)
+				return nil, err
+			}
+			return toks, nil
 		}
 
-		tok, _, _ = m.reader.ReadUntil(m.seps, m.terms)
-		if len(tok) == 0 {
-			err = fmt.Errorf("! %s:%d Incomplete SRV RDATA", m.file, m.lineno)
-			return
+		var tok []byte
+		tok, _, c = m.reader.ReadUntil(seps, terms)
+		if len(tok) > 0 {
+			toks = append(toks, tok)
 		}
+	}
+}
 
-		switch m.flag {
-		case parseSRVService:
-			rr.SRV.Proto = tok
-			m.flag |= parseSRVProto
+//
+// parseGeneric parse the RDATA in generic format (RFC 3597 section 5),
+//
+//	\# <length> <hex data>
+//
+// If the type is known, the RDATA is converted into the type specific
+// record, otherwise it will be stored as opaque data.
+//
+func (m *master) parseGeneric(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 2 {
+		return fmt.Errorf("! %s:%d Missing RDATA length", m.file, m.lineno)
+	}
 
-		case parseSRVService | parseSRVProto:
-			rr.SRV.Name = tok
-			m.flag |= parseSRVName
+	n, err := strconv.ParseUint(string(toks[1]), 10, 16)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid RDATA length: %s", m.file,
+			m.lineno, err)
+	}
 
-		case parseSRVService | parseSRVProto | parseSRVName:
-			v, err = strconv.Atoi(string(tok))
-			if err != nil {
-				return
+	rdata, err := hex.DecodeString(string(bytes.Join(toks[2:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid RDATA: %s", m.file, m.lineno,
+			err)
+	}
+	if len(rdata) != int(n) {
+		return fmt.Errorf("! %s:%d RDATA length mismatch, expecting %d got %d",
+			m.file, m.lineno, n, len(rdata))
+	}
+
+	rr.rdlen = uint16(n)
+	rr.rdata = rdata
+
+	err = rr.unpackRData(rdata, 0)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid RDATA for type %s: %s",
+			m.file, m.lineno, masterTypeName(rr.Type), err)
+	}
+
+	return nil
+}
+
+//
+// parseText read the list of <character-string> until the end of line,
+// starting from the first token tok that is terminated by character c.
+// Each <character-string> is either a contiguous set of characters without
+// interior spaces, or a string quoted with '"'.
+//
+func (m *master) parseText(tok []byte, c byte) (texts [][]byte, err error) {
+	quote := []byte{'"'}
+
+	for {
+		if len(tok) > 0 && tok[0] == '"' {
+			tok = tok[1:]
+			if !isQuoteClosed(tok) {
+				if c == 0 {
+					return nil, fmt.Errorf("! %s:%d Missing closing quote",
+						m.file, m.lineno)
+				}
+				tok = append(tok, c)
+				for {
+					var b []byte
+					b, _, c = m.reader.ReadUntil(nil, quote)
+					tok = append(tok, b...)
+					if c == 0 {
+						return nil, fmt.Errorf("! %s:%d Missing closing quote",
+							m.file, m.lineno)
+					}
+					tok = append(tok, '"')
+					if isQuoteClosed(tok) {
+						break
+					}
+				}
+				m.lineno += bytes.Count(tok, []byte{'\n'})
+
+				var rest []byte
+				rest, _, c = m.reader.ReadUntil(m.seps, m.terms)
+				if len(rest) > 0 {
+					return nil, fmt.Errorf("! %s:%d Invalid character after quote '%s'",
+						m.file, m.lineno, rest)
+				}
 			}
-			rr.SRV.Priority = uint16(v)
-			m.flag |= parseSRVPriority
+			tok = tok[:len(tok)-1]
+		}
 
-		case parseSRVService | parseSRVProto | parseSRVName | parseSRVPriority:
-			v, err = strconv.Atoi(string(tok))
-			if err != nil {
-				return
+		texts = append(texts, unescapeText(tok))
+
+		switch c {
+		case 0:
+			return texts, nil
+		case '\n':
+			m.lineno++
+			return texts, nil
+		case ';':
+			m.reader.SkipUntilNewline()
+			m.lineno++
+			return texts, nil
+		}
+
+		_, c = m.reader.SkipHorizontalSpace()
+		switch c {
+		case 0:
+			return texts, nil
+		case '\n', ';':
+			m.reader.SkipUntilNewline()
+			m.lineno++
+			return texts, nil
+		}
+
+		tok, _, c = m.reader.ReadUntil(m.seps, m.terms)
+	}
+}
+
+//
+// parseTXT parse one or more <character-string> of TXT RDATA.  Multiple
+// strings are concatenated into single value.
+//
+func (m *master) parseTXT(rr *ResourceRecord, tok []byte) (err error) {
+	texts, err := m.parseText(tok, m.termc)
+	if err != nil {
+		return err
+	}
+
+	rr.Text = &RDataText{
+		Value: bytes.Join(texts, nil),
+		Texts: texts,
+	}
+
+	return nil
+}
+
+//
+// isQuoteClosed will return true if text end with '"' that is not escaped
+// by back slash.
+//
+func isQuoteClosed(text []byte) bool {
+	if len(text) == 0 || text[len(text)-1] != '"' {
+		return false
+	}
+	n := 0
+	for x := len(text) - 2; x >= 0 && text[x] == '\\'; x-- {
+		n++
+	}
+	return n%2 == 0
+}
+
+//
+// unescapeText convert the escaped characters "\X" and "\DDD" in text into
+// its octet value.
+//
+func unescapeText(text []byte) (out []byte) {
+	out = make([]byte, 0, len(text))
+	for x := 0; x < len(text); x++ {
+		if text[x] != '\\' || x+1 == len(text) {
+			out = append(out, text[x])
+			continue
+		}
+		x++
+		if x+2 < len(text) && libbytes.IsDigits(text[x:x+3]) {
+			v, err := strconv.Atoi(string(text[x : x+3]))
+			if err == nil && v <= 255 {
+				out = append(out, byte(v))
+				x += 2
+				continue
 			}
-			rr.SRV.Weight = uint16(v)
-			m.flag |= parseSRVWeight
+		}
+		out = append(out, text[x])
+	}
+	return out
+}
+
+func (m *master) parseDS(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 4 {
+		return fmt.Errorf("! %s:%d Incomplete DS RDATA", m.file, m.lineno)
+	}
 
-		case parseSRVService | parseSRVProto | parseSRVName | parseSRVPriority | parseSRVWeight:
-			v, err = strconv.Atoi(string(tok))
+	keyTag, err := strconv.ParseUint(string(toks[0]), 10, 16)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DS key tag: %s", m.file, m.lineno, err)
+	}
+	alg, err := strconv.ParseUint(string(toks[1]), 10, 8)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DS algorithm: %s", m.file, m.lineno, err)
+	}
+	digestType, err := strconv.ParseUint(string(toks[2]), 10, 8)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DS digest type: %s", m.file, m.lineno, err)
+	}
+	digest, err := hex.DecodeString(string(bytes.Join(toks[3:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DS digest: %s", m.file, m.lineno, err)
+	}
+
+	rr.DS = &RDataDS{
+		KeyTag:     uint16(keyTag),
+		Algorithm:  byte(alg),
+		DigestType: byte(digestType),
+		Digest:     digest,
+	}
+
+	return nil
+}
+
+func (m *master) parseRRSIG(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 9 {
+		return fmt.Errorf("! %s:%d Incomplete RRSIG RDATA", m.file, m.lineno)
+	}
+
+	rr.RRSIG = &RDataRRSIG{}
+
+	libbytes.ToUpper(&toks[0])
+	typeCovered, ok := parseTypeName(string(toks[0]))
+	if !ok {
+		return fmt.Errorf("! %s:%d Unknown RRSIG type covered '%s'",
+			m.file, m.lineno, toks[0])
+	}
+	rr.RRSIG.TypeCovered = typeCovered
+
+	var v [6]uint64
+	for x, bitSize := range []int{8, 8, 32, 32, 32, 16} {
+		tok = toks[x+1]
+		if (x == 3 || x == 4) && len(tok) == 14 {
+			// The expiration and inception time in the form of
+			// YYYYMMDDHHmmSS (RFC 4034 section 3.2).
+			t, err := time.Parse("20060102150405", string(tok))
 			if err != nil {
-				return
+				return fmt.Errorf("! %s:%d Invalid RRSIG time: %s",
+					m.file, m.lineno, err)
 			}
-			rr.SRV.Port = uint16(v)
-			m.flag |= parseSRVPort
+			v[x] = uint64(uint32(t.Unix()))
+			continue
+		}
 
-		case parseSRVService | parseSRVProto | parseSRVName | parseSRVPriority | parseSRVWeight | parseSRVPort:
-			rr.SRV.Target = tok
-			m.flag |= parseSRVTarget
-			goto out
+		v[x], err = strconv.ParseUint(string(tok), 10, bitSize)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid RRSIG RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
 
-		default:
-			err = fmt.Errorf("! %s:%d Invalid SRV RData", m.file, m.lineno)
-			return
+	rr.RRSIG.Algorithm = byte(v[0])
+	rr.RRSIG.Labels = byte(v[1])
+	rr.RRSIG.OrigTTL = uint32(v[2])
+	rr.RRSIG.Expiration = uint32(v[3])
+	rr.RRSIG.Inception = uint32(v[4])
+	rr.RRSIG.KeyTag = uint16(v[5])
+	rr.RRSIG.SignerName = m.generateDomainName(toks[7])
+
+	rr.RRSIG.Signature, err = base64.StdEncoding.DecodeString(
+		string(bytes.Join(toks[8:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid RRSIG signature: %s",
+			m.file, m.lineno, err)
+	}
+
+	return nil
+}
+
+func (m *master) parseNSEC(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 1 {
+		return fmt.Errorf("! %s:%d Incomplete NSEC RDATA", m.file, m.lineno)
+	}
+
+	rr.NSEC = &RDataNSEC{
+		NextName: m.generateDomainName(toks[0]),
+	}
+
+	rr.NSEC.Types, err = m.parseTypes(toks[1:])
+
+	return err
+}
+
+func (m *master) parseDNSKEY(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 4 {
+		return fmt.Errorf("! %s:%d Incomplete DNSKEY RDATA", m.file, m.lineno)
+	}
+
+	flags, err := strconv.ParseUint(string(toks[0]), 10, 16)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DNSKEY flags: %s", m.file, m.lineno, err)
+	}
+	protocol, err := strconv.ParseUint(string(toks[1]), 10, 8)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DNSKEY protocol: %s", m.file, m.lineno, err)
+	}
+	alg, err := strconv.ParseUint(string(toks[2]), 10, 8)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DNSKEY algorithm: %s", m.file, m.lineno, err)
+	}
+	pubkey, err := base64.StdEncoding.DecodeString(string(bytes.Join(toks[3:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid DNSKEY public key: %s", m.file, m.lineno, err)
+	}
+
+	rr.DNSKEY = &RDataDNSKEY{
+		Flags:     uint16(flags),
+		Protocol:  byte(protocol),
+		Algorithm: byte(alg),
+		PublicKey: pubkey,
+	}
+
+	return nil
+}
+
+func (m *master) parseNSEC3(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 5 {
+		return fmt.Errorf("! %s:%d Incomplete NSEC3 RDATA", m.file, m.lineno)
+	}
+
+	var v [3]uint64
+	for x, bitSize := range []int{8, 8, 16} {
+		v[x], err = strconv.ParseUint(string(toks[x]), 10, bitSize)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid NSEC3 RDATA: %s",
+				m.file, m.lineno, err)
 		}
 	}
-out:
-	_, c := m.reader.SkipHorizontalSpace()
-	if c == ';' {
-		m.reader.SkipUntilNewline()
-		m.lineno++
+
+	rr.NSEC3 = &RDataNSEC3{
+		HashAlgorithm: byte(v[0]),
+		Flags:         byte(v[1]),
+		Iterations:    uint16(v[2]),
 	}
 
-	return
+	if !bytes.Equal(toks[3], []byte("-")) {
+		rr.NSEC3.Salt, err = hex.DecodeString(string(toks[3]))
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid NSEC3 salt: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	libbytes.ToUpper(&toks[4])
+	rr.NSEC3.NextHashedOwner, err = base32HexNoPad.DecodeString(string(toks[4]))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid NSEC3 next hashed owner: %s",
+			m.file, m.lineno, err)
+	}
+
+	rr.NSEC3.Types, err = m.parseTypes(toks[5:])
+
+	return err
+}
+
+func (m *master) parseNSEC3PARAM(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) != 4 {
+		return fmt.Errorf("! %s:%d Invalid NSEC3PARAM RDATA", m.file, m.lineno)
+	}
+
+	var v [3]uint64
+	for x, bitSize := range []int{8, 8, 16} {
+		v[x], err = strconv.ParseUint(string(toks[x]), 10, bitSize)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid NSEC3PARAM RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	rr.NSEC3PARAM = &RDataNSEC3PARAM{
+		HashAlgorithm: byte(v[0]),
+		Flags:         byte(v[1]),
+		Iterations:    uint16(v[2]),
+	}
+
+	if !bytes.Equal(toks[3], []byte("-")) {
+		rr.NSEC3PARAM.Salt, err = hex.DecodeString(string(toks[3]))
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid NSEC3PARAM salt: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	return nil
+}
+
+//
+// parseNAPTR parse the NAPTR RDATA in the form of,
+//
+//	Order Preference "Flags" "Services" "Regexp" Replacement
+//
+func (m *master) parseNAPTR(rr *ResourceRecord, tok []byte) (err error) {
+	texts, err := m.parseText(tok, m.termc)
+	if err != nil {
+		return err
+	}
+	if len(texts) != 6 {
+		return fmt.Errorf("! %s:%d Invalid NAPTR RDATA", m.file, m.lineno)
+	}
+
+	var v [2]uint64
+	for x := range v {
+		v[x], err = strconv.ParseUint(string(texts[x]), 10, 16)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid NAPTR RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	rr.NAPTR = &RDataNAPTR{
+		Order:       uint16(v[0]),
+		Preference:  uint16(v[1]),
+		Flags:       texts[2],
+		Services:    texts[3],
+		Regexp:      texts[4],
+		Replacement: m.generateDomainName(texts[5]),
+	}
+
+	return nil
+}
+
+//
+// parseSSHFP parse the SSHFP RDATA in the form of,
+//
+//	Algorithm FPType Fingerprint
+//
+func (m *master) parseSSHFP(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 3 {
+		return fmt.Errorf("! %s:%d Incomplete SSHFP RDATA", m.file, m.lineno)
+	}
+
+	var v [2]uint64
+	for x := range v {
+		v[x], err = strconv.ParseUint(string(toks[x]), 10, 8)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid SSHFP RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	fp, err := hex.DecodeString(string(bytes.Join(toks[2:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid SSHFP fingerprint: %s",
+			m.file, m.lineno, err)
+	}
+
+	rr.SSHFP = &RDataSSHFP{
+		Algorithm:   byte(v[0]),
+		FPType:      byte(v[1]),
+		Fingerprint: fp,
+	}
+
+	return nil
+}
+
+//
+// parseTLSA parse the TLSA RDATA in the form of,
+//
+//	Usage Selector MatchingType CertData
+//
+func (m *master) parseTLSA(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 4 {
+		return fmt.Errorf("! %s:%d Incomplete TLSA RDATA", m.file, m.lineno)
+	}
+
+	var v [3]uint64
+	for x := range v {
+		v[x], err = strconv.ParseUint(string(toks[x]), 10, 8)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid TLSA RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	data, err := hex.DecodeString(string(bytes.Join(toks[3:], nil)))
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid TLSA certificate data: %s",
+			m.file, m.lineno, err)
+	}
+
+	rr.TLSA = &RDataTLSA{
+		Usage:        byte(v[0]),
+		Selector:     byte(v[1]),
+		MatchingType: byte(v[2]),
+		CertData:     data,
+	}
+
+	return nil
+}
+
+//
+// parseSVCB parse the SVCB or HTTPS RDATA in the form of,
+//
+//	Priority Target [key=value ...]
+//
+func (m *master) parseSVCB(rr *ResourceRecord, tok []byte) (err error) {
+	toks, err := m.parseRDataTokens(tok)
+	if err != nil {
+		return err
+	}
+	if len(toks) < 2 {
+		return fmt.Errorf("! %s:%d Incomplete %s RDATA", m.file,
+			m.lineno, masterTypeName(rr.Type))
+	}
+
+	prio, err := strconv.ParseUint(string(toks[0]), 10, 16)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid %s priority: %s", m.file,
+			m.lineno, masterTypeName(rr.Type), err)
+	}
+
+	rr.SVCB = &RDataSVCB{
+		Priority: uint16(prio),
+		Target:   m.generateDomainName(toks[1]),
+	}
+
+	for x := 2; x < len(toks); x++ {
+		// Join the quoted value that contains spaces.
+		tok := toks[x]
+		if bytes.Count(tok, []byte{'"'})%2 == 1 {
+			for x+1 < len(toks) && !isQuoteClosed(tok) {
+				x++
+				tok = append(append(tok, ' '), toks[x]...)
+			}
+		}
+
+		p, err := parseSVCBParam(string(tok))
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid %s parameter: %s",
+				m.file, m.lineno, masterTypeName(rr.Type), err)
+		}
+		if _, ok := rr.SVCB.Param(p.Key); ok {
+			return fmt.Errorf("! %s:%d Duplicate %s parameter %q",
+				m.file, m.lineno, masterTypeName(rr.Type),
+				svcbKeyName(p.Key))
+		}
+		rr.SVCB.Params = append(rr.SVCB.Params, p)
+	}
+
+	sort.Slice(rr.SVCB.Params, func(x, y int) bool {
+		return rr.SVCB.Params[x].Key < rr.SVCB.Params[y].Key
+	})
+
+	return nil
+}
+
+//
+// parseURI parse the URI RDATA in the form of,
+//
+//	Priority Weight "Target"
+//
+func (m *master) parseURI(rr *ResourceRecord, tok []byte) (err error) {
+	texts, err := m.parseText(tok, m.termc)
+	if err != nil {
+		return err
+	}
+	if len(texts) != 3 {
+		return fmt.Errorf("! %s:%d Invalid URI RDATA", m.file, m.lineno)
+	}
+
+	var v [2]uint64
+	for x := range v {
+		v[x], err = strconv.ParseUint(string(texts[x]), 10, 16)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid URI RDATA: %s",
+				m.file, m.lineno, err)
+		}
+	}
+
+	rr.URI = &RDataURI{
+		Priority: uint16(v[0]),
+		Weight:   uint16(v[1]),
+		Target:   texts[2],
+	}
+
+	return nil
+}
+
+//
+// parseCAA parse the CAA RDATA in the form of,
+//
+//	Flags Tag "Value"
+//
+func (m *master) parseCAA(rr *ResourceRecord, tok []byte) (err error) {
+	texts, err := m.parseText(tok, m.termc)
+	if err != nil {
+		return err
+	}
+	if len(texts) != 3 {
+		return fmt.Errorf("! %s:%d Invalid CAA RDATA", m.file, m.lineno)
+	}
+
+	flags, err := strconv.ParseUint(string(texts[0]), 10, 8)
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid CAA flags: %s", m.file,
+			m.lineno, err)
+	}
+	if len(texts[1]) == 0 || len(texts[1]) > 255 {
+		return fmt.Errorf("! %s:%d Invalid CAA tag", m.file, m.lineno)
+	}
+
+	rr.CAA = &RDataCAA{
+		Flags: byte(flags),
+		Tag:   bytes.ToLower(texts[1]),
+		Value: texts[2],
+	}
+
+	return nil
+}
+
+//
+// parseTypes convert list of type mnemonics into list of type values.
+//
+func (m *master) parseTypes(toks [][]byte) (types []uint16, err error) {
+	for _, tok := range toks {
+		libbytes.ToUpper(&tok)
+		t, ok := parseTypeName(string(tok))
+		if !ok {
+			return nil, fmt.Errorf("! %s:%d Unknown type '%s'",
+				m.file, m.lineno, tok)
+		}
+		types = append(types, t)
+	}
+	return types, nil
 }
 
 func (m *master) generateDomainName(dname []byte) []byte {
@@ -979,6 +1777,242 @@ func (m *master) generateDomainName(dname []byte) []byte {
 	return dname
 }
 
+//
+// parseDirectiveGenerate parse the $GENERATE directive, which create a
+// series of RRs that differ only by an iterator,
+//
+//	$GENERATE <start>-<stop>[/<step>] <lhs> [<ttl>] [<class>] <type> <rhs>
+//
+// The lhs define the owner name and the rhs define the RDATA of each RR.
+// Any "$" in lhs and rhs is replaced with the iterator value, and "\$" is
+// replaced with literal "$".  The iterator value can be modified with
+// "${offset[,width[,base]]}", where offset is added to the iterator, width
+// is the minimum number of digits padded with zero, and base is one of
+// "d" (decimal, the default), "o" (octal), "x" or "X" (hexadecimal), or
+// "n" or "N" (reversed hexadecimal nibbles separated by dot, as in
+// ip6.arpa).  For example, the following directive create the PTR records
+// of 192.0.2.1 until 192.0.2.10 in zone 2.0.192.in-addr.arpa,
+//
+//	$GENERATE 1-10 $ PTR host-${0,3}.example.com.
+//
+func (m *master) parseDirectiveGenerate() (err error) {
+	line, _, _ := m.reader.ReadUntil(nil, []byte{'\n'})
+	lineno := m.lineno
+	m.lineno++
+
+	x := bytes.IndexByte(line, ';')
+	if x >= 0 {
+		line = line[:x]
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 4 {
+		return fmt.Errorf("! %s:%d Invalid $generate directive",
+			m.file, lineno)
+	}
+
+	start, stop, step, err := parseGenerateRange(fields[0])
+	if err != nil {
+		return fmt.Errorf("! %s:%d Invalid $generate range %q: %s",
+			m.file, lineno, fields[0], err)
+	}
+
+	lhs := fields[1]
+	middle := strings.Join(fields[2:len(fields)-1], " ")
+	rhs := fields[len(fields)-1]
+
+	var sb strings.Builder
+
+	for it := start; it <= stop; it += step {
+		owner, err := generateText(lhs, it)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid $generate lhs %q: %s",
+				m.file, lineno, lhs, err)
+		}
+		// The TTL, class, and type may contains the iterator too.
+		mid, err := generateText(middle, it)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid $generate field %q: %s",
+				m.file, lineno, middle, err)
+		}
+		rdata, err := generateText(rhs, it)
+		if err != nil {
+			return fmt.Errorf("! %s:%d Invalid $generate rhs %q: %s",
+				m.file, lineno, rhs, err)
+		}
+		fmt.Fprintf(&sb, "%s %s %s\n", owner, mid, rdata)
+	}
+
+	gen := newMaster()
+	gen.Init(sb.String(), m.origin, m.ttl)
+	gen.isTTLSet = m.isTTLSet
+	gen.file = m.file
+	gen.lineno = lineno
+
+	err = gen.parse()
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range gen.msgs {
+		for _, rr := range msg.Answer {
+			m.push(rr)
+		}
+	}
+	m.noTTL = append(m.noTTL, gen.noTTL...)
+
+	return nil
+}
+
+//
+// parseGenerateRange parse the range of $GENERATE directive in the form of
+// "start-stop[/step]".
+//
+func parseGenerateRange(v string) (start, stop, step int, err error) {
+	step = 1
+
+	x := strings.IndexByte(v, '/')
+	if x >= 0 {
+		step, err = strconv.Atoi(v[x+1:])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		v = v[:x]
+	}
+
+	x = strings.IndexByte(v, '-')
+	if x < 0 {
+		return 0, 0, 0, fmt.Errorf("missing stop")
+	}
+
+	start, err = strconv.Atoi(v[:x])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	stop, err = strconv.Atoi(v[x+1:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if start < 0 || stop < start || step <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid value")
+	}
+	if (stop-start)/step >= maxGenerateRecords {
+		return 0, 0, 0, fmt.Errorf("too many records, maximum is %d",
+			maxGenerateRecords)
+	}
+
+	return start, stop, step, nil
+}
+
+//
+// generateText replace the "$" and "${offset[,width[,base]]}" in template
+// with iterator value.
+//
+func generateText(tmpl string, it int) (string, error) {
+	var sb strings.Builder
+
+	for x := 0; x < len(tmpl); x++ {
+		c := tmpl[x]
+		if c == '\\' && x+1 < len(tmpl) && tmpl[x+1] == '$' {
+			sb.WriteByte('$')
+			x++
+			continue
+		}
+		if c != '$' {
+			sb.WriteByte(c)
+			continue
+		}
+		if x+1 >= len(tmpl) || tmpl[x+1] != '{' {
+			sb.WriteString(strconv.Itoa(it))
+			continue
+		}
+
+		end := strings.IndexByte(tmpl[x:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("missing '}'")
+		}
+
+		v, err := generateModifier(tmpl[x+2:x+end], it)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(v)
+		x += end
+	}
+
+	return sb.String(), nil
+}
+
+//
+// generateModifier format the iterator value using modifier
+// "offset[,width[,base]]".
+//
+func generateModifier(mod string, it int) (string, error) {
+	var (
+		width int
+		base  = "d"
+		err   error
+	)
+
+	args := strings.Split(mod, ",")
+	if len(args) > 3 {
+		return "", fmt.Errorf("invalid modifier %q", mod)
+	}
+
+	offset, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", err
+	}
+	if len(args) > 1 {
+		width, err = strconv.Atoi(args[1])
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(args) > 2 {
+		base = args[2]
+	}
+
+	v := it + offset
+	if v < 0 {
+		return "", fmt.Errorf("negative value %d", v)
+	}
+
+	var out string
+
+	switch base {
+	case "d":
+		out = strconv.Itoa(v)
+	case "o":
+		out = strconv.FormatInt(int64(v), 8)
+	case "x":
+		out = strconv.FormatInt(int64(v), 16)
+	case "X":
+		out = strings.ToUpper(strconv.FormatInt(int64(v), 16))
+	case "n", "N":
+		hex := strconv.FormatInt(int64(v), 16)
+		if len(hex) < width {
+			hex = strings.Repeat("0", width-len(hex)) + hex
+		}
+		if base == "N" {
+			hex = strings.ToUpper(hex)
+		}
+		nibbles := make([]string, len(hex))
+		for x := range hex {
+			nibbles[len(hex)-1-x] = hex[x : x+1]
+		}
+		return strings.Join(nibbles, "."), nil
+	default:
+		return "", fmt.Errorf("invalid base %q", base)
+	}
+
+	if len(out) < width {
+		out = strings.Repeat("0", width-len(out)) + out
+	}
+
+	return out, nil
+}
+
 //
 // push resource record (RR) into message answer only if domain name, type,
 // and class already exist; otherwise it will create new message with question
@@ -1022,23 +2056,13 @@ func (m *master) push(rr *ResourceRecord) bool {
 	return true
 }
 
-func (m *master) setMinimumTTL() {
-	for _, msg := range m.msgs {
-		for x := 0; x < len(msg.Answer); x++ {
-			if msg.Answer[x].TTL < m.ttl {
-				msg.Answer[x].TTL = m.ttl
-			}
-		}
-		for x := 0; x < len(msg.Authority); x++ {
-			if msg.Authority[x].TTL < m.ttl {
-				msg.Authority[x].TTL = m.ttl
-			}
-		}
-		for x := 0; x < len(msg.Additional); x++ {
-			if msg.Additional[x].TTL < m.ttl {
-				msg.Additional[x].TTL = m.ttl
-			}
-		}
+//
+// setDefaultTTL set the TTL of RRs that does not have explicit TTL to the
+// default TTL.
+//
+func (m *master) setDefaultTTL() {
+	for _, rr := range m.noTTL {
+		rr.TTL = m.ttl
 	}
 }
 
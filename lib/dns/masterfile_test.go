@@ -5,6 +5,7 @@
 package dns
 
 import (
+	"fmt"
 	"testing"
 
 	libtest "github.com/shuLhan/share/lib/test"
@@ -129,6 +130,220 @@ func TestMasterParseDirectiveTTL(t *testing.T) {
 	}
 }
 
+func TestMasterParseRRTTL(t *testing.T) {
+	cases := []struct {
+		desc string
+		in   string
+		ttl  uint32
+		exp  []string
+	}{{
+		desc: "Without TTL",
+		in: `$origin example.com.
+a A 10.0.0.1
+  TXT "a"`,
+		exp: []string{
+			"a.example.com A 3600",
+			"a.example.com TXT 3600",
+		},
+	}, {
+		desc: "With TTL from SOA",
+		in: `$origin example.com.
+a A 10.0.0.1
+@ SOA ns admin 1 2 3 4 300`,
+		exp: []string{
+			"a.example.com A 300",
+			"example.com SOA 300",
+		},
+	}, {
+		desc: "With TTL from caller",
+		in: `$origin example.com.
+a A 10.0.0.1`,
+		ttl: 60,
+		exp: []string{
+			"a.example.com A 60",
+		},
+	}, {
+		desc: "With zero TTL",
+		in: `$origin example.com.
+a 0 A 10.0.0.1
+  TXT "a"
+b IN 0 A 10.0.0.2
+c A 10.0.0.3`,
+		ttl: 60,
+		exp: []string{
+			"a.example.com A 0",
+			"a.example.com TXT 0",
+			"b.example.com A 0",
+			"c.example.com A 60",
+		},
+	}, {
+		desc: "With zero $TTL",
+		in: `$origin example.com.
+$ttl 0
+a A 10.0.0.1
+@ SOA ns admin 1 2 3 4 300`,
+		ttl: 60,
+		exp: []string{
+			"a.example.com A 0",
+			"example.com SOA 0",
+		},
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		m := newMaster()
+		m.Init(c.in, "", c.ttl)
+
+		err := m.parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, msg := range m.msgs {
+			for _, rr := range msg.Answer {
+				got = append(got, fmt.Sprintf("%s %s %d", rr.Name,
+					masterTypeName(rr.Type), rr.TTL))
+			}
+		}
+
+		libtest.Assert(t, "records", c.exp, got, true)
+	}
+}
+
+func TestMasterParseTypeBitmap(t *testing.T) {
+	in := `$ORIGIN example.com.
+host 3600 IN NSEC next.example.com. A TYPE1234 RRSIG NSEC
+host 3600 IN RRSIG TYPE1234 8 3 3600 20300101000000 20200101000000 1 example.com. AAAA
+0p9mhaveqvm6t7vbl5lop2u3t2rp3tom 3600 IN NSEC3 1 1 12 aabbccdd 2t7b4g4vsa5smi47k61mv5bv1a22bojr A type65534
+`
+	m := newMaster()
+	m.Init(in, "", 0)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[uint16]*ResourceRecord)
+	for _, msg := range m.msgs {
+		got[msg.Answer[0].Type] = msg.Answer[0]
+	}
+
+	libtest.Assert(t, "NSEC Types", []uint16{QueryTypeA, 1234,
+		QueryTypeRRSIG, QueryTypeNSEC}, got[QueryTypeNSEC].NSEC.Types, true)
+	libtest.Assert(t, "RRSIG TypeCovered", uint16(1234),
+		got[QueryTypeRRSIG].RRSIG.TypeCovered, true)
+	libtest.Assert(t, "NSEC3 Types", []uint16{QueryTypeA, 65534},
+		got[QueryTypeNSEC3].NSEC3.Types, true)
+
+	m = newMaster()
+	m.Init("host.example.com. 3600 IN NSEC next.example.com. A TYPEX", "", 0)
+
+	err = m.parse()
+	libtest.Assert(t, "error", "! (data):1 Unknown type 'TYPEX'",
+		err.Error(), true)
+}
+
+func TestMasterParseDirectiveGenerate(t *testing.T) {
+	cases := []struct {
+		desc   string
+		in     string
+		expErr string
+		exp    []string
+		expTTL []uint32
+	}{{
+		desc:   "Without type and rhs",
+		in:     `$generate 1-2 $`,
+		expErr: "! (data):1 Invalid $generate directive",
+	}, {
+		desc:   "With invalid range",
+		in:     `$generate 2-1 $ PTR host-$.`,
+		expErr: `! (data):1 Invalid $generate range "2-1": invalid value`,
+	}, {
+		desc:   "With too many records",
+		in:     `$generate 0-65536 $ PTR host-$.`,
+		expErr: `! (data):1 Invalid $generate range "0-65536": too many records, maximum is 65536`,
+	}, {
+		desc:   "With invalid TTL modifier",
+		in:     `$generate 1-2 $ ${0,0,z} PTR host-$.`,
+		expErr: `! (data):1 Invalid $generate field "${0,0,z} PTR": invalid base "z"`,
+	}, {
+		desc:   "With invalid base",
+		in:     `$generate 1-2 $ PTR host-${0,0,z}.`,
+		expErr: `! (data):1 Invalid $generate rhs "host-${0,0,z}.": invalid base "z"`,
+	}, {
+		desc: "With iterator",
+		in: `$origin 2.0.192.in-addr.arpa.
+$generate 1-3 $ 300 IN PTR host-$.example.com. ; comment`,
+		exp: []string{
+			"1.2.0.192.in-addr.arpa PTR host-1.example.com",
+			"2.2.0.192.in-addr.arpa PTR host-2.example.com",
+			"3.2.0.192.in-addr.arpa PTR host-3.example.com",
+		},
+	}, {
+		desc: "With step, modifier, and escape",
+		in: `$origin example.com.
+$generate 0-20/10 host-${1,3} A 10.0.0.$
+$generate 10-11 \$${0,2,x} CNAME x${0,0,X}`,
+		exp: []string{
+			"host-001.example.com A 10.0.0.0",
+			"host-011.example.com A 10.0.0.10",
+			"host-021.example.com A 10.0.0.20",
+			"$0a.example.com CNAME xa.example.com",
+			"$0b.example.com CNAME xb.example.com",
+		},
+	}, {
+		desc: "With nibble",
+		in: `$origin 0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.
+$generate 255-256 ${0,4,n}.0.0.0.0.0.0.0.0.0.0.0.0 PTR h$.example.com.`,
+		exp: []string{
+			"f.f.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa PTR h255.example.com",
+			"0.0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa PTR h256.example.com",
+		},
+	}, {
+		desc: "With iterator in TTL",
+		in: `$origin example.com.
+$generate 1-2 h$ 30$ IN A 10.0.0.$`,
+		exp: []string{
+			"h1.example.com A 10.0.0.1",
+			"h2.example.com A 10.0.0.2",
+		},
+		expTTL: []uint32{301, 302},
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		m := newMaster()
+		m.Init(c.in, "", 0)
+
+		err := m.parse()
+		if err != nil {
+			libtest.Assert(t, "err", c.expErr, err.Error(), true)
+			continue
+		}
+
+		var (
+			got    []string
+			gotTTL []uint32
+		)
+		for _, msg := range m.msgs {
+			for _, rr := range msg.Answer {
+				got = append(got, fmt.Sprintf("%s %s %s", rr.Name,
+					masterTypeName(rr.Type), rr.Text.Value))
+				gotTTL = append(gotTTL, rr.TTL)
+			}
+		}
+
+		libtest.Assert(t, "records", c.exp, got, true)
+		if len(c.expTTL) > 0 {
+			libtest.Assert(t, "TTL", c.expTTL, gotTTL, true)
+		}
+	}
+}
+
 func TestMasterInitRFC1035(t *testing.T) {
 	cases := []struct {
 		desc   string
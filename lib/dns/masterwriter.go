@@ -0,0 +1,352 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// masterTypeName return the mnemonic of RR type, or "TYPEnnn" if type is
+// unknown (RFC 3597 section 5).
+//
+func masterTypeName(t uint16) string {
+	for k, v := range QueryTypes {
+		if v == t {
+			return k
+		}
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+//
+// masterClassName return the mnemonic of RR class, or "CLASSnnn" if class
+// is unknown (RFC 3597 section 5).
+//
+func masterClassName(c uint16) string {
+	for k, v := range QueryClasses {
+		if v == c {
+			return k
+		}
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+//
+// masterAbsName return the domain name in absolute form, with trailing
+// dot.
+//
+func masterAbsName(name []byte) string {
+	if len(name) == 0 || name[len(name)-1] != '.' {
+		return string(name) + "."
+	}
+	return string(name)
+}
+
+//
+// masterText return the character-string quoted with '"'.
+//
+func masterText(text []byte) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, c := range text {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+//
+// masterTime return the RRSIG time in the form of YYYYMMDDHHmmSS.
+//
+func masterTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+//
+// masterTypes return the list of types as space separated mnemonics.
+//
+func masterTypes(types []uint16) string {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, masterTypeName(t))
+	}
+	return strings.Join(names, " ")
+}
+
+//
+// masterRData return the RDATA of resource record in master file syntax.
+// Each domain name in RDATA is converted using function dname.
+//
+func masterRData(rr *ResourceRecord, dname func([]byte) string) (
+	string, error,
+) {
+	switch rr.Type {
+	case QueryTypeA, QueryTypeAAAA:
+		return string(rr.Text.Value), nil
+
+	case QueryTypeNS, QueryTypeCNAME, QueryTypeMB, QueryTypeMG,
+		QueryTypeMR, QueryTypePTR:
+		return dname(rr.Text.Value), nil
+
+	case QueryTypeTXT:
+		texts := rr.Text.charStrings()
+		out := make([]string, 0, len(texts))
+		for _, text := range texts {
+			out = append(out, masterText(text))
+		}
+		return strings.Join(out, " "), nil
+
+	case QueryTypeSOA:
+		soa := rr.SOA
+		return fmt.Sprintf("%s %s %d %d %d %d %d", dname(soa.MName),
+			dname(soa.RName), soa.Serial, soa.Refresh, soa.Retry,
+			soa.Expire, soa.Minimum), nil
+
+	case QueryTypeHINFO:
+		return masterText(rr.HInfo.CPU) + " " + masterText(rr.HInfo.OS), nil
+
+	case QueryTypeMINFO:
+		return dname(rr.MInfo.RMailBox) + " " + dname(rr.MInfo.EmailBox), nil
+
+	case QueryTypeMX:
+		return fmt.Sprintf("%d %s", rr.MX.Preference,
+			dname(rr.MX.Exchange)), nil
+
+	case QueryTypeSRV:
+		return fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight,
+			rr.SRV.Port, dname(rr.SRV.Target)), nil
+
+	case QueryTypeDS:
+		return fmt.Sprintf("%d %d %d %s", rr.DS.KeyTag, rr.DS.Algorithm,
+			rr.DS.DigestType,
+			strings.ToUpper(hex.EncodeToString(rr.DS.Digest))), nil
+
+	case QueryTypeRRSIG:
+		sig := rr.RRSIG
+		return fmt.Sprintf("%s %d %d %d %s %s %d %s %s",
+			masterTypeName(sig.TypeCovered), sig.Algorithm,
+			sig.Labels, sig.OrigTTL, masterTime(sig.Expiration),
+			masterTime(sig.Inception), sig.KeyTag,
+			dname(sig.SignerName),
+			base64.StdEncoding.EncodeToString(sig.Signature)), nil
+
+	case QueryTypeNSEC:
+		return strings.TrimSpace(dname(rr.NSEC.NextName) + " " +
+			masterTypes(rr.NSEC.Types)), nil
+
+	case QueryTypeDNSKEY:
+		return fmt.Sprintf("%d %d %d %s", rr.DNSKEY.Flags,
+			rr.DNSKEY.Protocol, rr.DNSKEY.Algorithm,
+			base64.StdEncoding.EncodeToString(rr.DNSKEY.PublicKey)), nil
+
+	case QueryTypeNSEC3:
+		nsec3 := rr.NSEC3
+		salt := "-"
+		if len(nsec3.Salt) > 0 {
+			salt = strings.ToUpper(hex.EncodeToString(nsec3.Salt))
+		}
+		return strings.TrimSpace(fmt.Sprintf("%d %d %d %s %s %s",
+			nsec3.HashAlgorithm, nsec3.Flags, nsec3.Iterations, salt,
+			base32HexNoPad.EncodeToString(nsec3.NextHashedOwner),
+			masterTypes(nsec3.Types))), nil
+
+	case QueryTypeNSEC3PARAM:
+		param := rr.NSEC3PARAM
+		salt := "-"
+		if len(param.Salt) > 0 {
+			salt = strings.ToUpper(hex.EncodeToString(param.Salt))
+		}
+		return fmt.Sprintf("%d %d %d %s", param.HashAlgorithm,
+			param.Flags, param.Iterations, salt), nil
+
+	case QueryTypeNAPTR:
+		naptr := rr.NAPTR
+		return fmt.Sprintf("%d %d %s %s %s %s", naptr.Order,
+			naptr.Preference, masterText(naptr.Flags),
+			masterText(naptr.Services), masterText(naptr.Regexp),
+			dname(naptr.Replacement)), nil
+
+	case QueryTypeSSHFP:
+		return fmt.Sprintf("%d %d %s", rr.SSHFP.Algorithm,
+			rr.SSHFP.FPType,
+			strings.ToUpper(hex.EncodeToString(rr.SSHFP.Fingerprint))), nil
+
+	case QueryTypeTLSA:
+		tlsa := rr.TLSA
+		return fmt.Sprintf("%d %d %d %s", tlsa.Usage, tlsa.Selector,
+			tlsa.MatchingType,
+			strings.ToUpper(hex.EncodeToString(tlsa.CertData))), nil
+
+	case QueryTypeSVCB, QueryTypeHTTPS:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d %s", rr.SVCB.Priority, dname(rr.SVCB.Target))
+		for _, p := range rr.SVCB.Params {
+			b.WriteByte(' ')
+			b.WriteString(p.String())
+		}
+		return b.String(), nil
+
+	case QueryTypeURI:
+		return fmt.Sprintf("%d %d %s", rr.URI.Priority, rr.URI.Weight,
+			masterText(rr.URI.Target)), nil
+
+	case QueryTypeCAA:
+		return fmt.Sprintf("%d %s %s", rr.CAA.Flags, rr.CAA.Tag,
+			masterText(rr.CAA.Value)), nil
+
+	case QueryTypeOPT, QueryTypeTSIG:
+		return "", fmt.Errorf("dns: type %s can not be written to master file",
+			masterTypeName(rr.Type))
+	}
+
+	// Other types is written using generic format (RFC 3597 section 5).
+	rdata := rr.packRData()
+	if len(rdata) == 0 {
+		return `\# 0`, nil
+	}
+
+	return fmt.Sprintf(`\# %d %s`, len(rdata),
+		strings.ToUpper(hex.EncodeToString(rdata))), nil
+}
+
+//
+// writeMasterRR write the resource record into w in master file syntax,
+// using absolute domain names.
+//
+func writeMasterRR(w io.Writer, rr *ResourceRecord) (err error) {
+	rdata, err := masterRData(rr, masterAbsName)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", masterAbsName(rr.Name),
+		rr.TTL, masterClassName(rr.Class), masterTypeName(rr.Type),
+		rdata)
+
+	return err
+}
+
+//
+// MasterWrite write the resource records in msgs into w as master file,
+// the reverse of MasterLoad.
+//
+// The file start with $ORIGIN directive, if origin is not empty, and $TTL
+// directive.  The value of $TTL is the lowest TTL of all records, so the
+// TTL field is omitted on records that have the same TTL.  The SOA record
+// of origin, if its exist, is written first, followed by the other records
+// in the same order as in msgs.  The domain names that are equal to or
+// below the origin are written relative to the origin.
+//
+// Records in the Answer, Authority, and Additional sections are written,
+// except OPT pseudo-record.  It will return an error if one of the record
+// type can not be represented in master file.
+//
+func MasterWrite(w io.Writer, origin string, msgs []*Message) (err error) {
+	origin = strings.TrimSuffix(strings.ToLower(origin), ".")
+
+	var rrs []*ResourceRecord
+	for _, msg := range msgs {
+		for _, section := range [][]*ResourceRecord{
+			msg.Answer, msg.Authority, msg.Additional,
+		} {
+			for _, rr := range section {
+				if rr.Type != QueryTypeOPT {
+					rrs = append(rrs, rr)
+				}
+			}
+		}
+	}
+
+	// Move the SOA of origin to the top.
+	for x, rr := range rrs {
+		if rr.Type == QueryTypeSOA && masterRelName(rr.Name, origin) == "@" {
+			copy(rrs[1:x+1], rrs[:x])
+			rrs[0] = rr
+			break
+		}
+	}
+
+	var ttl uint32
+	for x, rr := range rrs {
+		if x == 0 || rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+
+	if len(origin) > 0 {
+		_, err = fmt.Fprintf(w, "$ORIGIN %s.\n", origin)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "$TTL %d\n", ttl)
+	if err != nil {
+		return err
+	}
+
+	dname := func(name []byte) string {
+		return masterRelName(name, origin)
+	}
+
+	for _, rr := range rrs {
+		rdata, err := masterRData(rr, dname)
+		if err != nil {
+			return err
+		}
+
+		owner := dname(rr.Name)
+		class := masterClassName(rr.Class)
+		qtype := masterTypeName(rr.Type)
+
+		if rr.TTL == ttl {
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", owner, class,
+				qtype, rdata)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", owner,
+				rr.TTL, class, qtype, rdata)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// masterRelName return the domain name relative to origin: "@" if name is
+// equal to origin, the name without origin if name is below origin, or
+// absolute name otherwise.
+//
+func masterRelName(name []byte, origin string) string {
+	sname := strings.TrimSuffix(strings.ToLower(string(name)), ".")
+
+	switch {
+	case len(origin) == 0:
+	case sname == origin:
+		return "@"
+	case strings.HasSuffix(sname, "."+origin):
+		return sname[:len(sname)-len(origin)-1]
+	}
+
+	return sname + "."
+}
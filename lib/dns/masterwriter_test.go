@@ -0,0 +1,198 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"testing"
+
+	libtest "github.com/shuLhan/share/lib/test"
+)
+
+func TestMasterWrite(t *testing.T) {
+	in := `$ORIGIN example.com.
+$TTL 3600
+www	IN	A	10.0.0.1
+@	IN	SOA	ns1 admin.mail.example.com. 2018100101 3600 600 86400 300
+@	IN	NS	ns1.example.com.
+@	IN	MX	10 mail
+@	300	IN	TXT	"v=spf1 \"mx\"; -all"
+txt	IN	TXT	Hello "world" ; comment
+ns1	IN	AAAA	::1
+host	IN	HINFO	"Intel i7" Linux
+host	IN	MINFO	admin errors.example.net.
+ftp	IN	CNAME	www.example.net.
+_sip._tcp	IN	SRV	0 5 5060 sip
+`
+	exp := `$ORIGIN example.com.
+$TTL 300
+@	3600	IN	SOA	ns1 admin.mail 2018100101 3600 600 86400 300
+www	3600	IN	A	10.0.0.1
+@	3600	IN	NS	ns1
+@	3600	IN	MX	10 mail
+@	IN	TXT	"v=spf1 \"mx\"; -all"
+txt	3600	IN	TXT	"Hello" "world"
+ns1	3600	IN	AAAA	::1
+host	3600	IN	HINFO	"Intel i7" "Linux"
+host	3600	IN	MINFO	admin errors.example.net.
+ftp	3600	IN	CNAME	www.example.net.
+_sip._tcp	3600	IN	SRV	0 5 5060 sip
+`
+
+	m := newMaster()
+	m.Init(in, "", 0)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	err = MasterWrite(&out, "example.com", m.msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	libtest.Assert(t, "MasterWrite", exp, out.String(), true)
+
+	// Parsing the output must return the same records.
+	got := newMaster()
+	got.Init(out.String(), "", 0)
+
+	err = got.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	libtest.Assert(t, "number of messages", len(m.msgs), len(got.msgs), true)
+
+	for _, msg := range m.msgs {
+		for _, rr := range msg.Answer {
+			found := false
+			for _, gotMsg := range got.msgs {
+				for _, gotRR := range gotMsg.Answer {
+					if rr.isEqual(gotRR) && rr.TTL == gotRR.TTL {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("record not found after write: %s %d",
+					rr.Name, rr.Type)
+			}
+		}
+	}
+}
+
+func TestMasterWriteRDataTypes(t *testing.T) {
+	in := `$ORIGIN example.com.
+$TTL 300
+@	IN	CAA	0 issue "letsencrypt.org; validationmethods=dns-01"
+@	IN	CAA	128 iodef "mailto:security@example.com"
+@	IN	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp
+@	IN	NAPTR	100 20 "U" "E2U+sip" "!^.*$!sip:info@example.com!" .
+_443._tcp.www	IN	TLSA	3 1 1 ( 0C72AC70B745AC19998811B131D662C9
+	AC69DBDBE7CB23E5B514B56664C5D3D6 )
+host	IN	SSHFP	4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789
+_svc	IN	SVCB	0 svc.example.net.
+@	IN	HTTPS	1 . alpn=h3,h2 port=8443 ipv4hint=192.0.2.1,192.0.2.2 ech=AAEC ipv6hint=2001:db8::1 key65000="x y"
+www	IN	HTTPS	2 www mandatory=alpn alpn=h2 no-default-alpn
+_ftp._tcp	IN	URI	10 1 "ftp://ftp.example.com/public"
+`
+	exp := `$ORIGIN example.com.
+$TTL 300
+@	IN	CAA	0 issue "letsencrypt.org; validationmethods=dns-01"
+@	IN	CAA	128 iodef "mailto:security@example.com"
+@	IN	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp
+@	IN	NAPTR	100 20 "U" "E2U+sip" "!^.*$!sip:info@example.com!" .
+_443._tcp.www	IN	TLSA	3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6
+host	IN	SSHFP	4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789
+_svc	IN	SVCB	0 svc.example.net.
+@	IN	HTTPS	1 . alpn=h3,h2 port=8443 ipv4hint=192.0.2.1,192.0.2.2 ech=AAEC ipv6hint=2001:db8::1 key65000=x\032y
+www	IN	HTTPS	2 www mandatory=alpn alpn=h2 no-default-alpn
+_ftp._tcp	IN	URI	10 1 "ftp://ftp.example.com/public"
+`
+
+	m := newMaster()
+	m.Init(in, "", 0)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	err = MasterWrite(&out, "example.com", m.msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	libtest.Assert(t, "MasterWrite", exp, out.String(), true)
+
+	// Each record must be able to be unpacked from its packed message.
+	for _, msg := range m.msgs {
+		got := NewMessage()
+		got.Packet = append(got.Packet[:0], msg.Packet...)
+
+		err = got.Unpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		libtest.Assert(t, "number of answer", len(msg.Answer),
+			len(got.Answer), true)
+
+		for x, rr := range msg.Answer {
+			if !rr.isEqual(got.Answer[x]) {
+				t.Fatalf("%s: expecting %v, got %v",
+					masterTypeName(rr.Type), rr.RData(),
+					got.Answer[x].RData())
+			}
+		}
+	}
+}
+
+func TestMasterWriteGeneric(t *testing.T) {
+	in := `$ORIGIN example.com.
+$TTL 300
+a	CLASS1	TYPE1	\# 4 0A000001
+b	IN	TYPE65534	\# 3 ( ABCD
+	EF )
+c	CLASS32	TYPE731	\# 0
+d	IN	NULL	\# 2 0102
+`
+	exp := `$ORIGIN example.com.
+$TTL 300
+a	IN	A	10.0.0.1
+b	IN	TYPE65534	\# 3 ABCDEF
+c	CLASS32	TYPE731	\# 0
+d	IN	NULL	\# 2 0102
+`
+
+	m := newMaster()
+	m.Init(in, "", 0)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	err = MasterWrite(&out, "example.com", m.msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	libtest.Assert(t, "MasterWrite", exp, out.String(), true)
+
+	m.Init(`x IN A \# 3 0A0000`, "example.com", 0)
+
+	err = m.parse()
+	libtest.Assert(t, "error", "! (data):1 Invalid RDATA for type A: "+
+		ErrIPv4Length.Error(), err.Error(), true)
+}
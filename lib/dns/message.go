@@ -64,6 +64,14 @@ type Message struct {
 	// Mapping between name and their offset for message compression.
 	dnameOff map[string]uint16
 	dname    string
+
+	// noCompress disable the domain name compression, used to pack
+	// resource record in canonical form (RFC 4034 section 6.2).
+	noCompress bool
+
+	// tsigOff is the offset of TSIG record in Packet after unpacking,
+	// used to verify the MAC.
+	tsigOff uint
 }
 
 //
@@ -85,6 +93,32 @@ func NewMessage() *Message {
 	}
 }
 
+//
+// newResponse create new response message for query message "q" with
+// response code "rcode".  The response header copy the ID, operation code,
+// and recursion desired flag from query, and the question is copied from
+// query.
+//
+func newResponse(q *Message, rcode ResponseCode) *Message {
+	res := &Message{
+		Header: &SectionHeader{
+			ID:      q.Header.ID,
+			Op:      q.Header.Op,
+			IsRD:    q.Header.IsRD,
+			RCode:   rcode,
+			QDCount: 1,
+		},
+		Question: &SectionQuestion{
+			Name:  append([]byte{}, q.Question.Name...),
+			Type:  q.Question.Type,
+			Class: q.Question.Class,
+		},
+		dnameOff: make(map[string]uint16),
+	}
+
+	return res
+}
+
 func (msg *Message) compress() bool {
 	off, ok := msg.dnameOff[msg.dname]
 	if ok {
@@ -108,6 +142,10 @@ func (msg *Message) packDomainName(dname []byte, doCompress bool) (n int) {
 	libbytes.ToLower(&dname)
 	msg.dname = string(dname)
 
+	if msg.noCompress {
+		doCompress = false
+	}
+
 	if doCompress {
 		ok = msg.compress()
 		if ok {
@@ -176,6 +214,8 @@ func (msg *Message) packDomainName(dname []byte, doCompress bool) (n int) {
 			msg.dnameOff[msg.dname] = msg.off
 
 			if x+1 == len(dname) {
+				msg.off++
+				n++
 				return
 			}
 
@@ -185,16 +225,17 @@ func (msg *Message) packDomainName(dname []byte, doCompress bool) (n int) {
 		msg.Packet = append(msg.Packet, c)
 		count++
 	}
+	// If the name is root, e.g. ".", the zero octet that has been
+	// appended before is the root label.
 	if count > 0 {
 		msg.Packet[msg.off] = count
 		msg.off += uint16(count + 1)
 		n += int(count + 1)
-	}
-	if len(dname) > 0 {
 		msg.Packet = append(msg.Packet, 0)
-		msg.off++
-		n++
 	}
+	// Count the zero octet of root label.
+	msg.off++
+	n++
 
 	return
 }
@@ -210,6 +251,10 @@ func (msg *Message) packRR(rr *ResourceRecord) {
 	if rr.Type == QueryTypeOPT {
 		// MUST be 0 (root domain).
 		msg.Packet = append(msg.Packet, 0)
+	} else if rr.Type == QueryTypeTSIG {
+		// The TSIG name must not be compressed (RFC 8945 section
+		// 4.2).
+		msg.packDomainName(rr.Name, false)
 	} else {
 		msg.packDomainName(rr.Name, true)
 	}
@@ -233,6 +278,12 @@ func (msg *Message) packRR(rr *ResourceRecord) {
 	libbytes.AppendUint32(&msg.Packet, rr.TTL)
 	msg.off += 4
 
+	if rr.isEmptyRData() {
+		libbytes.AppendUint16(&msg.Packet, 0)
+		msg.off += 2
+		return
+	}
+
 	msg.packRData(rr)
 }
 
@@ -243,9 +294,9 @@ func (msg *Message) packRData(rr *ResourceRecord) {
 	case QueryTypeNS:
 		msg.packTextAsDomain(rr)
 	case QueryTypeMD:
-		// obsolete
+		msg.packTextAsDomain(rr)
 	case QueryTypeMF:
-		// obsolete
+		msg.packTextAsDomain(rr)
 	case QueryTypeCNAME:
 		msg.packTextAsDomain(rr)
 	case QueryTypeSOA:
@@ -257,7 +308,7 @@ func (msg *Message) packRData(rr *ResourceRecord) {
 	case QueryTypeMR:
 		msg.packTextAsDomain(rr)
 	case QueryTypeNULL:
-		msg.packTextAsDomain(rr)
+		msg.packOpaque(rr)
 	case QueryTypeWKS:
 		msg.packWKS(rr)
 	case QueryTypePTR:
@@ -276,6 +327,34 @@ func (msg *Message) packRData(rr *ResourceRecord) {
 		msg.packAAAA(rr)
 	case QueryTypeOPT:
 		msg.packOPT(rr)
+	case QueryTypeDS:
+		msg.packDS(rr)
+	case QueryTypeRRSIG:
+		msg.packRRSIG(rr)
+	case QueryTypeNSEC:
+		msg.packNSEC(rr)
+	case QueryTypeDNSKEY:
+		msg.packDNSKEY(rr)
+	case QueryTypeNSEC3:
+		msg.packNSEC3(rr)
+	case QueryTypeNSEC3PARAM:
+		msg.packNSEC3PARAM(rr)
+	case QueryTypeNAPTR:
+		msg.packNAPTR(rr)
+	case QueryTypeSSHFP:
+		msg.packSSHFP(rr)
+	case QueryTypeTLSA:
+		msg.packTLSA(rr)
+	case QueryTypeSVCB, QueryTypeHTTPS:
+		msg.packSVCB(rr)
+	case QueryTypeURI:
+		msg.packURI(rr)
+	case QueryTypeCAA:
+		msg.packCAA(rr)
+	case QueryTypeTSIG:
+		msg.packTSIG(rr)
+	default:
+		msg.packOpaque(rr)
 	}
 }
 
@@ -325,7 +404,7 @@ func (msg *Message) packSOA(rr *ResourceRecord) {
 
 	// Write rdlength.
 	libbytes.WriteUint16(&msg.Packet, off, uint16(n+20))
-	msg.off += uint16(n + 20)
+	msg.off += 20
 }
 
 func (msg *Message) packWKS(rr *ResourceRecord) {
@@ -380,13 +459,17 @@ func (msg *Message) packMX(rr *ResourceRecord) {
 }
 
 func (msg *Message) packTXT(rr *ResourceRecord) {
-	n := uint16(len(rr.Text.Value))
-	libbytes.AppendUint16(&msg.Packet, n+1)
-	msg.off += 2
+	// Reserve two octets for rdlength.
+	off := uint(msg.off)
+	libbytes.AppendUint16(&msg.Packet, 0)
 
-	msg.Packet = append(msg.Packet, byte(n))
-	msg.Packet = append(msg.Packet, rr.Text.Value...)
-	msg.off += n
+	for _, s := range rr.Text.charStrings() {
+		msg.Packet = appendCharString(msg.Packet, s)
+	}
+	msg.off = uint16(len(msg.Packet))
+
+	// Write rdlength.
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
 }
 
 func (msg *Message) packSRV(rr *ResourceRecord) {
@@ -420,37 +503,214 @@ func (msg *Message) packAAAA(rr *ResourceRecord) {
 	}
 
 	msg.off += rdataIPv6Size
-
-	msg.off += rdataIPv6Size
 }
 
 func (msg *Message) packOPT(rr *ResourceRecord) {
+	rdata := rr.OPT.pack()
+
+	libbytes.AppendUint16(&msg.Packet, uint16(len(rdata)))
+	msg.Packet = append(msg.Packet, rdata...)
+	msg.off += uint16(2 + len(rdata))
+}
+
+func (msg *Message) packDS(rr *ResourceRecord) {
+	n := uint16(4 + len(rr.DS.Digest))
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.off += 2
+
+	libbytes.AppendUint16(&msg.Packet, rr.DS.KeyTag)
+	msg.Packet = append(msg.Packet, rr.DS.Algorithm, rr.DS.DigestType)
+	msg.Packet = append(msg.Packet, rr.DS.Digest...)
+	msg.off += n
+}
+
+func (msg *Message) packDNSKEY(rr *ResourceRecord) {
+	rdata := rr.DNSKEY.pack()
+
+	libbytes.AppendUint16(&msg.Packet, uint16(len(rdata)))
+	msg.Packet = append(msg.Packet, rdata...)
+	msg.off += uint16(2 + len(rdata))
+}
+
+func (msg *Message) packRRSIG(rr *ResourceRecord) {
 	// Reserve two octets for rdlength.
 	off := uint(msg.off)
 	libbytes.AppendUint16(&msg.Packet, 0)
 	msg.off += 2
 
-	if rr.OPT.Length == 0 {
-		return
-	}
+	msg.Packet = append(msg.Packet, rr.RRSIG.pack()...)
+	msg.off = uint16(len(msg.Packet))
 
-	// Pack OPT rdata
-	libbytes.AppendUint16(&msg.Packet, rr.OPT.Code)
+	// The signer name must not be compressed (RFC 4034 section 3.1.7).
+	msg.packDomainName(rr.RRSIG.SignerName, false)
 
-	// Values of less than 512 bytes MUST be treated as equal to 512
-	// bytes (RFC6891 P11).
-	if rr.OPT.Length < 512 {
-		libbytes.AppendUint16(&msg.Packet, 512)
-	} else {
-		libbytes.AppendUint16(&msg.Packet, rr.OPT.Length)
-	}
+	msg.Packet = append(msg.Packet, rr.RRSIG.Signature...)
+	msg.off = uint16(len(msg.Packet))
+
+	// Write rdlength.
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
+}
 
-	msg.Packet = append(msg.Packet, rr.OPT.Data[:rr.OPT.Length]...)
+func (msg *Message) packNSEC(rr *ResourceRecord) {
+	// Reserve two octets for rdlength.
+	off := uint(msg.off)
+	libbytes.AppendUint16(&msg.Packet, 0)
+	msg.off += 2
+
+	// The next domain name must not be compressed (RFC 4034 section
+	// 4.1.1).
+	msg.packDomainName(rr.NSEC.NextName, false)
+
+	msg.Packet = append(msg.Packet, packTypeBitmap(rr.NSEC.Types)...)
+	msg.off = uint16(len(msg.Packet))
 
 	// Write rdlength.
-	n := uint16(4 + rr.OPT.Length)
-	libbytes.WriteUint16(&msg.Packet, off, uint16(n))
-	msg.off += n
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
+}
+
+func (msg *Message) packNSEC3(rr *ResourceRecord) {
+	nsec3 := rr.NSEC3
+
+	// Reserve two octets for rdlength.
+	off := uint(msg.off)
+	libbytes.AppendUint16(&msg.Packet, 0)
+
+	msg.Packet = append(msg.Packet, nsec3.HashAlgorithm, nsec3.Flags)
+	libbytes.AppendUint16(&msg.Packet, nsec3.Iterations)
+	msg.Packet = append(msg.Packet, byte(len(nsec3.Salt)))
+	msg.Packet = append(msg.Packet, nsec3.Salt...)
+	msg.Packet = append(msg.Packet, byte(len(nsec3.NextHashedOwner)))
+	msg.Packet = append(msg.Packet, nsec3.NextHashedOwner...)
+	msg.Packet = append(msg.Packet, packTypeBitmap(nsec3.Types)...)
+	msg.off = uint16(len(msg.Packet))
+
+	// Write rdlength.
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
+}
+
+func (msg *Message) packNSEC3PARAM(rr *ResourceRecord) {
+	param := rr.NSEC3PARAM
+	n := uint16(5 + len(param.Salt))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.Packet = append(msg.Packet, param.HashAlgorithm, param.Flags)
+	libbytes.AppendUint16(&msg.Packet, param.Iterations)
+	msg.Packet = append(msg.Packet, byte(len(param.Salt)))
+	msg.Packet = append(msg.Packet, param.Salt...)
+	msg.off += 2 + n
+}
+
+func (msg *Message) packNAPTR(rr *ResourceRecord) {
+	naptr := rr.NAPTR
+
+	// Reserve two octets for rdlength.
+	off := uint(msg.off)
+	libbytes.AppendUint16(&msg.Packet, 0)
+
+	libbytes.AppendUint16(&msg.Packet, naptr.Order)
+	libbytes.AppendUint16(&msg.Packet, naptr.Preference)
+	msg.Packet = appendCharString(msg.Packet, naptr.Flags)
+	msg.Packet = appendCharString(msg.Packet, naptr.Services)
+	msg.Packet = appendCharString(msg.Packet, naptr.Regexp)
+	msg.off = uint16(len(msg.Packet))
+
+	// The replacement must not be compressed (RFC 3403 section 4.1).
+	msg.packDomainName(naptr.Replacement, false)
+
+	// Write rdlength.
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
+}
+
+func (msg *Message) packSSHFP(rr *ResourceRecord) {
+	n := uint16(2 + len(rr.SSHFP.Fingerprint))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.Packet = append(msg.Packet, rr.SSHFP.Algorithm, rr.SSHFP.FPType)
+	msg.Packet = append(msg.Packet, rr.SSHFP.Fingerprint...)
+	msg.off += 2 + n
+}
+
+func (msg *Message) packTLSA(rr *ResourceRecord) {
+	tlsa := rr.TLSA
+	n := uint16(3 + len(tlsa.CertData))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.Packet = append(msg.Packet, tlsa.Usage, tlsa.Selector,
+		tlsa.MatchingType)
+	msg.Packet = append(msg.Packet, tlsa.CertData...)
+	msg.off += 2 + n
+}
+
+func (msg *Message) packSVCB(rr *ResourceRecord) {
+	// Reserve two octets for rdlength.
+	off := uint(msg.off)
+	libbytes.AppendUint16(&msg.Packet, 0)
+
+	libbytes.AppendUint16(&msg.Packet, rr.SVCB.Priority)
+	msg.off = uint16(len(msg.Packet))
+
+	// The target name must not be compressed (RFC 9460 section 2.2).
+	msg.packDomainName(rr.SVCB.Target, false)
+
+	msg.Packet = append(msg.Packet, rr.SVCB.packParams()...)
+	msg.off = uint16(len(msg.Packet))
+
+	// Write rdlength.
+	libbytes.WriteUint16(&msg.Packet, off, uint16(len(msg.Packet)-int(off)-2))
+}
+
+func (msg *Message) packURI(rr *ResourceRecord) {
+	n := uint16(4 + len(rr.URI.Target))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	libbytes.AppendUint16(&msg.Packet, rr.URI.Priority)
+	libbytes.AppendUint16(&msg.Packet, rr.URI.Weight)
+	msg.Packet = append(msg.Packet, rr.URI.Target...)
+	msg.off += 2 + n
+}
+
+func (msg *Message) packCAA(rr *ResourceRecord) {
+	caa := rr.CAA
+	n := uint16(2 + len(caa.Tag) + len(caa.Value))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.Packet = append(msg.Packet, caa.Flags, byte(len(caa.Tag)))
+	msg.Packet = append(msg.Packet, caa.Tag...)
+	msg.Packet = append(msg.Packet, caa.Value...)
+	msg.off += 2 + n
+}
+
+func (msg *Message) packTSIG(rr *ResourceRecord) {
+	rdata := rr.TSIG.pack()
+
+	libbytes.AppendUint16(&msg.Packet, uint16(len(rdata)))
+	msg.Packet = append(msg.Packet, rdata...)
+	msg.off += uint16(2 + len(rdata))
+}
+
+//
+// packOpaque pack the RDATA of NULL or unknown type as is (RFC 3597
+// section 4).  The RDATA is stored in rr.Text.
+//
+func (msg *Message) packOpaque(rr *ResourceRecord) {
+	var rdata []byte
+	if rr.Text != nil {
+		rdata = rr.Text.Value
+	}
+	n := uint16(len(rdata))
+
+	libbytes.AppendUint16(&msg.Packet, n)
+	msg.Packet = append(msg.Packet, rdata...)
+	msg.off += 2 + n
+}
+
+//
+// appendCharString append the <character-string>, a single length octet
+// followed by the value, into b.
+//
+func appendCharString(b, s []byte) []byte {
+	b = append(b, byte(len(s)))
+	return append(b, s...)
 }
 
 //
@@ -465,6 +725,7 @@ func (msg *Message) Reset() {
 
 	msg.dname = ""
 	msg.off = 0
+	msg.tsigOff = 0
 	msg.dnameOff = make(map[string]uint16)
 }
 
@@ -537,11 +798,6 @@ func (msg *Message) Pack() ([]byte, error) {
 
 	msg.packQuestion()
 
-	if msg.Header.IsQuery {
-		msg.dnameOff = nil
-		return msg.Packet, nil
-	}
-
 	for x := 0; x < len(msg.Answer); x++ {
 		msg.packRR(msg.Answer[x])
 	}
@@ -567,6 +823,96 @@ func (msg *Message) SetID(id uint16) {
 	}
 }
 
+//
+// EDNS return the RDATA of OPT pseudo-RR in additional section, or nil if
+// message does not have it.
+//
+// If only the header and question of message has been unpacked, for example
+// the query in Request, the rest of sections will be unpacked first.
+//
+func (msg *Message) EDNS() *RDataOPT {
+	if len(msg.Answer)+len(msg.Authority)+len(msg.Additional) == 0 &&
+		msg.Header.ANCount+msg.Header.NSCount+msg.Header.ARCount > 0 {
+		err := msg.Unpack()
+		if err != nil {
+			return nil
+		}
+	}
+
+	for _, rr := range msg.Additional {
+		if rr.Type == QueryTypeOPT && rr.OPT != nil {
+			return rr.OPT
+		}
+	}
+
+	return nil
+}
+
+//
+// SetEDNS set the requestor's UDP payload size and DNSSEC OK bit in the OPT
+// pseudo-RR, and return its RDATA to set the EDNS options.  If message
+// does not have OPT pseudo-RR, a new one will be added to additional
+// section.  The message need to be packed to apply the changes.
+//
+func (msg *Message) SetEDNS(udpSize uint16, do bool) *RDataOPT {
+	if udpSize < 512 {
+		// Values lower than 512 must be treated as equal to 512
+		// (RFC 6891 section 6.2.3).
+		udpSize = 512
+	}
+
+	for _, rr := range msg.Additional {
+		if rr.Type == QueryTypeOPT && rr.OPT != nil {
+			rr.Class = udpSize
+			rr.OPT.DO = do
+			return rr.OPT
+		}
+	}
+
+	rr := &ResourceRecord{
+		Type:  QueryTypeOPT,
+		Class: udpSize,
+		OPT: &RDataOPT{
+			DO: do,
+		},
+	}
+	msg.Additional = append(msg.Additional, rr)
+
+	return rr.OPT
+}
+
+//
+// Pad the message with EDNS padding option (RFC 7830), so the length of
+// packet is multiple of blockSize.  If message does not have OPT
+// pseudo-RR, a new one will be added.  The message will be repacked.
+//
+func (msg *Message) Pad(blockSize int) (err error) {
+	if blockSize <= 0 {
+		return nil
+	}
+
+	opt := msg.EDNS()
+	if opt == nil {
+		opt = msg.SetEDNS(maxUDPPacketSize, false)
+	}
+	opt.RemoveOption(EDNSOptionPadding)
+
+	_, err = msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	// Include the option code and length of padding option.
+	n := len(msg.Packet) + 4
+	pad := (blockSize - n%blockSize) % blockSize
+
+	opt.SetOption(EDNSOptionPadding, make([]byte, pad))
+
+	_, err = msg.Pack()
+
+	return err
+}
+
 //
 // SubTTL subtract TTL in each resource records and in packet by n seconds.
 // If TTL is less than n, it will set to 0.
@@ -605,43 +951,130 @@ func (msg *Message) SubTTL(n uint32) {
 }
 
 //
-// String return the message representation as string.
+// String return the message representation as string, in the same format
+// as the output of dig command: the header, the OPT pseudo-RR, and the
+// non-empty sections, with each resource record in master file syntax.
 //
 func (msg *Message) String() string {
 	var b strings.Builder
 
-	fmt.Fprintf(&b, "{Header:%+v Question:%+v", msg.Header, msg.Question)
-
-	b.WriteString(" Answer:[")
-	for x := 0; x < len(msg.Answer); x++ {
-		if x > 0 {
+	fmt.Fprintf(&b, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n",
+		opCodeName(msg.Header.Op), rcodeName(msg.Header.RCode),
+		msg.Header.ID)
+
+	b.WriteString(";; flags:")
+	flags := []struct {
+		name  string
+		isSet bool
+	}{
+		{"qr", !msg.Header.IsQuery},
+		{"aa", msg.Header.IsAA},
+		{"tc", msg.Header.IsTC},
+		{"rd", msg.Header.IsRD},
+		{"ra", msg.Header.IsRA},
+		{"ad", msg.Header.IsAD},
+		{"cd", msg.Header.IsCD},
+	}
+	for _, f := range flags {
+		if f.isSet {
 			b.WriteByte(' ')
+			b.WriteString(f.name)
 		}
-		fmt.Fprintf(&b, "%+v", msg.Answer[x])
 	}
-	b.WriteString("]")
 
-	b.WriteString(" Authority:[")
-	for x := 0; x < len(msg.Authority); x++ {
-		if x > 0 {
-			b.WriteByte(' ')
+	qdcount := 0
+	if msg.Question != nil && len(msg.Question.Name) > 0 ||
+		msg.Header.QDCount > 0 {
+		qdcount = 1
+	}
+	fmt.Fprintf(&b, "; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		qdcount, len(msg.Answer), len(msg.Authority),
+		len(msg.Additional))
+
+	for _, rr := range msg.Additional {
+		if rr.Type == QueryTypeOPT && rr.OPT != nil {
+			b.WriteString("\n;; OPT PSEUDOSECTION:\n")
+			writeDigOPT(&b, rr)
+			break
 		}
-		fmt.Fprintf(&b, "%+v", msg.Authority[x])
 	}
-	b.WriteString("]")
 
-	b.WriteString(" Additional:[")
-	for x := 0; x < len(msg.Additional); x++ {
-		if x > 0 {
-			b.WriteByte(' ')
-		}
-		fmt.Fprintf(&b, "%+v", msg.Additional[x])
+	if qdcount > 0 {
+		b.WriteString("\n;; QUESTION SECTION:\n")
+		fmt.Fprintf(&b, ";%s\t\t%s\t%s\n",
+			masterAbsName(msg.Question.Name),
+			masterClassName(msg.Question.Class),
+			masterTypeName(msg.Question.Type))
 	}
-	b.WriteString("]}")
+
+	writeDigSection(&b, "ANSWER", msg.Answer)
+	writeDigSection(&b, "AUTHORITY", msg.Authority)
+	writeDigSection(&b, "ADDITIONAL", msg.Additional)
 
 	return b.String()
 }
 
+//
+// writeDigSection write the resource records in section, except the OPT
+// pseudo-RR, in master file syntax.
+//
+func writeDigSection(b *strings.Builder, name string, rrs []*ResourceRecord) {
+	isFirst := true
+
+	for _, rr := range rrs {
+		if rr.Type == QueryTypeOPT {
+			continue
+		}
+		if isFirst {
+			fmt.Fprintf(b, "\n;; %s SECTION:\n", name)
+			isFirst = false
+		}
+
+		rdata, err := masterRData(rr, masterAbsName)
+		if err != nil {
+			// Use the generic RDATA format for the type that can
+			// not be represented in master file (RFC 3597
+			// section 5).
+			raw := rr.packRData()
+			rdata = fmt.Sprintf("\\# %d %x", len(raw), raw)
+		}
+
+		fmt.Fprintf(b, "%s\t%d\t%s\t%s\t%s\n",
+			masterAbsName(rr.Name), rr.TTL,
+			masterClassName(rr.Class), masterTypeName(rr.Type), rdata)
+	}
+}
+
+//
+// writeDigOPT write the EDNS version, flags, UDP payload size, and the
+// options of OPT pseudo-RR.
+//
+func writeDigOPT(b *strings.Builder, rr *ResourceRecord) {
+	fmt.Fprintf(b, "; EDNS: version: %d, flags:", rr.OPT.Version)
+	if rr.OPT.DO {
+		b.WriteString(" do")
+	}
+	fmt.Fprintf(b, "; udp: %d\n", rr.Class)
+
+	for _, o := range rr.OPT.Options {
+		switch o.Code {
+		case EDNSOptionClientSubnet:
+			ecs, err := unpackEDNSClientSubnet(o.Data)
+			if err == nil {
+				fmt.Fprintf(b, "; CLIENT-SUBNET: %s\n", ecs)
+				continue
+			}
+		case EDNSOptionExtendedError:
+			ede, err := unpackEDNSExtendedError(o.Data)
+			if err == nil {
+				fmt.Fprintf(b, "; EDE: %s\n", ede)
+				continue
+			}
+		}
+		fmt.Fprintf(b, "; %s: %x\n", ednsOptionName(o.Code), o.Data)
+	}
+}
+
 //
 // Unpack the packet to fill the message fields.
 //
@@ -679,13 +1112,18 @@ func (msg *Message) Unpack() (err error) {
 		log.Printf("msg.Authority: %+v\n", msg.Authority)
 	}
 
+	msg.tsigOff = 0
 	for x = 0; x < msg.Header.ARCount; x++ {
 		rr := rrPool.Get().(*ResourceRecord)
 		rr.Reset()
+		off := startIdx
 		startIdx, err = rr.unpack(msg.Packet, startIdx)
 		if err != nil {
 			return err
 		}
+		if rr.Type == QueryTypeTSIG {
+			msg.tsigOff = off
+		}
 		msg.Additional = append(msg.Additional, rr)
 	}
 
@@ -718,3 +1156,45 @@ func (msg *Message) UnpackHeaderQuestion() {
 		log.Printf("msg.Question: %s\n", msg.Question)
 	}
 }
+
+//
+// opCodeName return the mnemonic of operation code, or "OPCODEn" if its
+// unknown.
+//
+func opCodeName(op OpCode) string {
+	switch op {
+	case OpCodeQuery:
+		return "QUERY"
+	case OpCodeIQuery:
+		return "IQUERY"
+	case OpCodeStatus:
+		return "STATUS"
+	case OpCodeNotify:
+		return "NOTIFY"
+	case OpCodeUpdate:
+		return "UPDATE"
+	}
+	return "OPCODE" + strconv.Itoa(int(op))
+}
+
+//
+// ednsOptionName return the mnemonic of EDNS option code, or "OPTn" if its
+// unknown.
+//
+func ednsOptionName(code uint16) string {
+	switch code {
+	case EDNSOptionNSID:
+		return "NSID"
+	case EDNSOptionClientSubnet:
+		return "CLIENT-SUBNET"
+	case EDNSOptionCookie:
+		return "COOKIE"
+	case EDNSOptionTCPKeepalive:
+		return "TCP-KEEPALIVE"
+	case EDNSOptionPadding:
+		return "PADDING"
+	case EDNSOptionExtendedError:
+		return "EDE"
+	}
+	return "OPT" + strconv.Itoa(int(code))
+}
@@ -5,6 +5,7 @@
 package dns
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/shuLhan/share/lib/test"
@@ -64,6 +65,12 @@ func TestMessagePackDomainName(t *testing.T) {
 	}, {
 		in:  []byte("a\\065"),
 		exp: []byte{2, 'a', 'a', 0},
+	}, {
+		in:  []byte("."),
+		exp: []byte{0},
+	}, {
+		in:  []byte(""),
+		exp: []byte{0},
 	}}
 
 	msg := NewMessage()
@@ -1749,3 +1756,296 @@ func TestMessageUnpack(t *testing.T) {
 		}
 	}
 }
+
+func TestMessageUnpackMalformed(t *testing.T) {
+	// Header with one question and two answers, and question "a" type A.
+	head := []byte{
+		0x00, 0x01, 0x81, 0x00,
+		0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00,
+		0x01, 'a', 0x00,
+		0x00, 0x01, 0x00, 0x01,
+	}
+
+	// The first answer is RR with unknown type, where its RDATA contains
+	// the chain of pointers, each point to the previous one.  The name of
+	// second answer point to the last pointer in chain.
+	chainRR := []byte{0xc0, 0x0c, 0xff, 0xfe, 0x00, 0x01, 0, 0, 0, 0, 0x00, 0x00}
+	base := len(head) + len(chainRR)
+	chain := []byte{0xc0, 0x0c}
+	for x := 1; x <= maxNamePointers; x++ {
+		off := base + (x-1)*2
+		chain = append(chain, maskPointer|byte(off>>8), byte(off))
+	}
+	chainRR[10] = byte(len(chain) >> 8)
+	chainRR[11] = byte(len(chain))
+	chainRR = append(chainRR, chain...)
+	last := base + len(chain) - 2
+
+	cases := []struct {
+		desc   string
+		answer []byte
+		expErr error
+	}{{
+		desc:   "With name pointer to itself",
+		answer: []byte{0xc0, byte(len(head))},
+		expErr: ErrNamePointer,
+	}, {
+		desc:   "With name pointer forward",
+		answer: []byte{0xc0, byte(len(head) + 2), 0x00},
+		expErr: ErrNamePointer,
+	}, {
+		desc: "With too many name pointers",
+		answer: append(chainRR, maskPointer|byte(last>>8), byte(last),
+			0x00, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0x00, 0x00),
+		expErr: ErrNamePointer,
+	}, {
+		desc:   "With label beyond packet",
+		answer: []byte{0x05, 'a'},
+		expErr: ErrNameLength,
+	}, {
+		desc:   "With name without end",
+		answer: []byte{0x01, 'a'},
+		expErr: ErrNameLength,
+	}, {
+		desc:   "With short RR",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x01},
+		expErr: ErrRDataLength,
+	}, {
+		desc: "With RDLENGTH beyond packet",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01,
+			0, 0, 0, 0, 0x00, 0x10, 1, 2, 3, 4},
+		expErr: ErrRDataLength,
+	}, {
+		desc: "With NS name beyond RDATA",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x02, 0x00, 0x01,
+			0, 0, 0, 0, 0x00, 0x02, 0x03, 'a', 'b', 'c', 0x00},
+		expErr: ErrNameLength,
+	}, {
+		desc: "With short SOA",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x06, 0x00, 0x01,
+			0, 0, 0, 0, 0x00, 0x04, 0xc0, 0x0c, 0xc0, 0x0c},
+		expErr: ErrRDataLength,
+	}, {
+		desc: "With short MX",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x0f, 0x00, 0x01,
+			0, 0, 0, 0, 0x00, 0x01, 0x00},
+		expErr: ErrRDataLength,
+	}, {
+		desc: "With short SRV",
+		answer: []byte{0xc0, 0x0c, 0x00, 0x21, 0x00, 0x01,
+			0, 0, 0, 0, 0x00, 0x02, 0x00, 0x00},
+		expErr: ErrRDataLength,
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		msg := NewMessage()
+		msg.Packet = append(msg.Packet[:0], head...)
+		msg.Packet = append(msg.Packet, c.answer...)
+
+		err := msg.Unpack()
+		test.Assert(t, "error", c.expErr, err, true)
+	}
+
+	// The EDNS of query with malformed OPT RR.
+	msg := NewMessage()
+	msg.Packet = append(msg.Packet[:0], head...)
+	msg.Packet[7] = 0
+	msg.Packet[11] = 1
+	msg.Packet = append(msg.Packet, 0xc0, byte(len(head)), 0x00, 0x29)
+	msg.UnpackHeaderQuestion()
+	test.Assert(t, "EDNS", (*RDataOPT)(nil), msg.EDNS(), true)
+
+	// Truncated question.
+	msg = NewMessage()
+	msg.Packet = append(msg.Packet[:0], head[:sectionHeaderSize+2]...)
+	msg.UnpackHeaderQuestion()
+	test.Assert(t, "Question.Name", "", string(msg.Question.Name), true)
+}
+
+func TestMessageUnknownType(t *testing.T) {
+	msg := &Message{
+		Header: &SectionHeader{
+			ID:      1,
+			QDCount: 1,
+			ANCount: 2,
+		},
+		Question: &SectionQuestion{
+			Name:  []byte("example.com"),
+			Type:  65534,
+			Class: 32,
+		},
+		Answer: []*ResourceRecord{{
+			Name:  []byte("example.com"),
+			Type:  65534,
+			Class: 32,
+			TTL:   3600,
+			Text: &RDataText{
+				Value: []byte{0xc0, 0x0c, 0, 1, 2},
+			},
+		}, {
+			Name:  []byte("example.com"),
+			Type:  QueryTypeNULL,
+			Class: QueryClassIN,
+			TTL:   3600,
+			Text: &RDataText{
+				Value: []byte("null"),
+			},
+		}},
+	}
+
+	_, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewMessage()
+	got.Packet = append(got.Packet[:0], msg.Packet...)
+
+	err = got.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x, rr := range msg.Answer {
+		test.Assert(t, "Class", rr.Class, got.Answer[x].Class, true)
+		test.Assert(t, "RData", rr.RData(), got.Answer[x].RData(), true)
+	}
+
+	// Repacking the unpacked message must produce the same sections.
+	packet := append([]byte(nil), msg.Packet[sectionHeaderSize:]...)
+
+	_, err = got.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "Packet", packet, got.Packet[sectionHeaderSize:], true)
+}
+
+func TestMessageTXT(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), 400)
+
+	msg := &Message{
+		Header: &SectionHeader{
+			ID:      1,
+			QDCount: 1,
+			ANCount: 2,
+		},
+		Question: &SectionQuestion{
+			Name:  []byte("example.com"),
+			Type:  QueryTypeTXT,
+			Class: QueryClassIN,
+		},
+		Answer: []*ResourceRecord{{
+			Name:  []byte("example.com"),
+			Type:  QueryTypeTXT,
+			Class: QueryClassIN,
+			TTL:   3600,
+			Text: &RDataText{
+				Value: long,
+			},
+		}, {
+			Name:  []byte("example.com"),
+			Type:  QueryTypeTXT,
+			Class: QueryClassIN,
+			TTL:   3600,
+			Text: &RDataText{
+				Value: []byte("Helloworld"),
+				Texts: [][]byte{[]byte("Hello"), []byte("world")},
+			},
+		}},
+	}
+
+	_, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewMessage()
+	got.Packet = append(got.Packet[:0], msg.Packet...)
+
+	err = got.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "rdlen", uint16(402), got.Answer[0].rdlen, true)
+	test.Assert(t, "Value", long, got.Answer[0].Text.Value, true)
+	test.Assert(t, "Texts", [][]byte{long[:255], long[255:]},
+		got.Answer[0].Text.Texts, true)
+
+	test.Assert(t, "rdlen", uint16(12), got.Answer[1].rdlen, true)
+	test.Assert(t, "Value", msg.Answer[1].Text.Value,
+		got.Answer[1].Text.Value, true)
+	test.Assert(t, "Texts", msg.Answer[1].Text.Texts,
+		got.Answer[1].Text.Texts, true)
+
+	// Repacking the unpacked message must keep the character-strings.
+	packet := append([]byte(nil), msg.Packet[sectionHeaderSize:]...)
+
+	_, err = got.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "Packet", packet, got.Packet[sectionHeaderSize:], true)
+}
+
+func TestMessageString(t *testing.T) {
+	msg := &Message{
+		Header: &SectionHeader{
+			ID:    4321,
+			IsAA:  true,
+			IsRD:  true,
+			RCode: RCodeOK,
+		},
+		Question: &SectionQuestion{
+			Name:  []byte("www.example.test"),
+			Type:  QueryTypeA,
+			Class: QueryClassIN,
+		},
+		Answer: []*ResourceRecord{{
+			Name:  []byte("www.example.test"),
+			Type:  QueryTypeCNAME,
+			Class: QueryClassIN,
+			TTL:   300,
+			Text: &RDataText{
+				Value: []byte("web.example.test"),
+			},
+		}, {
+			Name:  []byte("web.example.test"),
+			Type:  QueryTypeA,
+			Class: QueryClassIN,
+			TTL:   300,
+			Text: &RDataText{
+				Value: []byte("192.0.2.1"),
+			},
+		}},
+	}
+
+	opt := msg.SetEDNS(1232, true)
+	opt.SetOption(EDNSOptionNSID, []byte("ns1"))
+	opt.SetOption(EDNSOptionExtendedError, (&EDNSExtendedError{
+		InfoCode: EDEBlocked,
+	}).pack())
+
+	exp := `;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 4321
+;; flags: qr aa rd; QUERY: 1, ANSWER: 2, AUTHORITY: 0, ADDITIONAL: 1
+
+;; OPT PSEUDOSECTION:
+; EDNS: version: 0, flags: do; udp: 1232
+; NSID: 6e7331
+; EDE: {InfoCode:15 ExtraText:}
+
+;; QUESTION SECTION:
+;www.example.test.		IN	A
+
+;; ANSWER SECTION:
+www.example.test.	300	IN	CNAME	web.example.test.
+web.example.test.	300	IN	A	192.0.2.1
+`
+
+	test.Assert(t, "String", exp, msg.String(), true)
+}
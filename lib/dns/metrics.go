@@ -0,0 +1,188 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+//
+// metricsLatencyBuckets contains the upper bounds, in seconds, of latency
+// histogram buckets.
+//
+var metricsLatencyBuckets = []float64{
+	0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5,
+}
+
+//
+// rcodeNames contains the mnemonic of response codes.
+//
+var rcodeNames = []string{
+	"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED",
+	"YXDOMAIN", "YXRRSET", "NXRRSET", "NOTAUTH", "NOTZONE",
+}
+
+//
+// Metrics is an Observer that count the queries and responses, and
+// measure the latency of requests.  The metrics can be rendered in
+// Prometheus text format using WritePrometheus, or served on HTTP endpoint
+// since Metrics implement http.Handler.
+//
+// This type is safe to be used concurrently.
+//
+type Metrics struct {
+	mu        sync.Mutex
+	queries   map[string]uint64
+	responses map[string]uint64
+	latencies map[string]*metricsHistogram
+}
+
+//
+// metricsHistogram contains the cumulative count of observations in each
+// bucket, their sum and total count.
+//
+type metricsHistogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+//
+// NewMetrics create and initialize new metrics.
+//
+func NewMetrics() *Metrics {
+	return &Metrics{
+		queries:   make(map[string]uint64),
+		responses: make(map[string]uint64),
+		latencies: make(map[string]*metricsHistogram),
+	}
+}
+
+//
+// Observe count the request by its connection type, query type, and
+// response code, and add its latency to histogram.
+//
+func (m *Metrics) Observe(ev *QueryEvent) {
+	kind := connTypeName(ev.Kind)
+	latency := ev.Latency.Seconds()
+
+	queryLabels := fmt.Sprintf(`kind=%q,qtype=%q`, kind,
+		masterTypeName(ev.QType))
+	responseLabels := fmt.Sprintf(`kind=%q,rcode=%q`, kind,
+		rcodeName(ev.RCode))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queries[queryLabels]++
+	m.responses[responseLabels]++
+
+	h := m.latencies[kind]
+	if h == nil {
+		h = &metricsHistogram{
+			buckets: make([]uint64, len(metricsLatencyBuckets)),
+		}
+		m.latencies[kind] = h
+	}
+	for x, le := range metricsLatencyBuckets {
+		if latency <= le {
+			h.buckets[x]++
+		}
+	}
+	h.sum += latency
+	h.count++
+}
+
+//
+// ServeHTTP write the metrics in Prometheus text format.
+//
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	_ = m.WritePrometheus(w)
+}
+
+//
+// WritePrometheus write the metrics in Prometheus text exposition format
+// into w.
+//
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	var buf bytes.Buffer
+
+	m.mu.Lock()
+
+	buf.WriteString("# HELP dns_server_queries_total Number of queries received.\n")
+	buf.WriteString("# TYPE dns_server_queries_total counter\n")
+	for _, labels := range sortedKeys(m.queries) {
+		fmt.Fprintf(&buf, "dns_server_queries_total{%s} %d\n", labels,
+			m.queries[labels])
+	}
+
+	buf.WriteString("# HELP dns_server_responses_total Number of responses sent.\n")
+	buf.WriteString("# TYPE dns_server_responses_total counter\n")
+	for _, labels := range sortedKeys(m.responses) {
+		fmt.Fprintf(&buf, "dns_server_responses_total{%s} %d\n", labels,
+			m.responses[labels])
+	}
+
+	buf.WriteString("# HELP dns_server_request_duration_seconds Latency of requests.\n")
+	buf.WriteString("# TYPE dns_server_request_duration_seconds histogram\n")
+
+	kinds := make([]string, 0, len(m.latencies))
+	for kind := range m.latencies {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		h := m.latencies[kind]
+		for x, le := range metricsLatencyBuckets {
+			fmt.Fprintf(&buf, "dns_server_request_duration_seconds_bucket{kind=%q,le=%q} %d\n",
+				kind, strconv.FormatFloat(le, 'g', -1, 64),
+				h.buckets[x])
+		}
+		fmt.Fprintf(&buf, "dns_server_request_duration_seconds_bucket{kind=%q,le=\"+Inf\"} %d\n",
+			kind, h.count)
+		fmt.Fprintf(&buf, "dns_server_request_duration_seconds_sum{kind=%q} %s\n",
+			kind, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&buf, "dns_server_request_duration_seconds_count{kind=%q} %d\n",
+			kind, h.count)
+	}
+
+	m.mu.Unlock()
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+//
+// rcodeName return the mnemonic of response code, or "RCODEnnn" if its
+// unknown.
+//
+func rcodeName(rcode ResponseCode) string {
+	if int(rcode) < len(rcodeNames) {
+		return rcodeNames[rcode]
+	}
+	return "RCODE" + strconv.Itoa(int(rcode))
+}
+
+//
+// sortedKeys return the keys of map in sorted order.
+//
+func sortedKeys(m map[string]uint64) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,171 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testObserver is an observer that record the events.
+//
+type testObserver struct {
+	events []*QueryEvent
+}
+
+func (obs *testObserver) Observe(ev *QueryEvent) {
+	obs.events = append(obs.events, ev)
+}
+
+func TestRequestObserve(t *testing.T) {
+	obs := &testObserver{}
+
+	zh := NewZoneHandler()
+	zh.AddZone(newTestZone(t, `
+example.test. 3600 IN SOA ns.example.test. admin.example.test. 1 3600 600 86400 300
+www.example.test. 3600 IN A 10.0.0.1
+`))
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	req := newTestRequest(sender, 1, "none.example.test")
+	req.UDPAddr = &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}
+	req.observer = obs
+	req.start = time.Now()
+
+	zh.ServeDNS(req)
+	<-sender.C
+
+	test.Assert(t, "events", 1, len(obs.events), true)
+
+	ev := obs.events[0]
+	test.Assert(t, "RemoteAddr", "192.0.2.1:5353", ev.RemoteAddr, true)
+	test.Assert(t, "Kind", ConnTypeUDP, ev.Kind, true)
+	test.Assert(t, "QName", "none.example.test", ev.QName, true)
+	test.Assert(t, "QType", QueryTypeA, ev.QType, true)
+	test.Assert(t, "RCode", RCodeErrName, ev.RCode, true)
+	test.Assert(t, "Latency", true, ev.Latency > 0, true)
+}
+
+func TestMetricsWritePrometheus(t *testing.T) {
+	m := NewMetrics()
+
+	m.Observe(&QueryEvent{
+		Kind:    ConnTypeUDP,
+		QType:   QueryTypeA,
+		RCode:   RCodeOK,
+		Latency: 2 * time.Millisecond,
+	})
+	m.Observe(&QueryEvent{
+		Kind:    ConnTypeUDP,
+		QType:   QueryTypeAAAA,
+		RCode:   RCodeErrName,
+		Latency: 20 * time.Millisecond,
+	})
+	m.Observe(&QueryEvent{
+		Kind:    ConnTypeDoH,
+		QType:   QueryTypeA,
+		RCode:   RCodeOK,
+		Latency: 10 * time.Second,
+	})
+
+	var buf bytes.Buffer
+
+	err := m.WritePrometheus(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# HELP dns_server_queries_total Number of queries received.
+# TYPE dns_server_queries_total counter
+dns_server_queries_total{kind="doh",qtype="A"} 1
+dns_server_queries_total{kind="udp",qtype="A"} 1
+dns_server_queries_total{kind="udp",qtype="AAAA"} 1
+# HELP dns_server_responses_total Number of responses sent.
+# TYPE dns_server_responses_total counter
+dns_server_responses_total{kind="doh",rcode="NOERROR"} 1
+dns_server_responses_total{kind="udp",rcode="NOERROR"} 1
+dns_server_responses_total{kind="udp",rcode="NXDOMAIN"} 1
+# HELP dns_server_request_duration_seconds Latency of requests.
+# TYPE dns_server_request_duration_seconds histogram
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.0005"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.001"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.005"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.01"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.05"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.1"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="0.5"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="1"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="5"} 0
+dns_server_request_duration_seconds_bucket{kind="doh",le="+Inf"} 1
+dns_server_request_duration_seconds_sum{kind="doh"} 10
+dns_server_request_duration_seconds_count{kind="doh"} 1
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.0005"} 0
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.001"} 0
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.005"} 1
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.01"} 1
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.05"} 2
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.1"} 2
+dns_server_request_duration_seconds_bucket{kind="udp",le="0.5"} 2
+dns_server_request_duration_seconds_bucket{kind="udp",le="1"} 2
+dns_server_request_duration_seconds_bucket{kind="udp",le="5"} 2
+dns_server_request_duration_seconds_bucket{kind="udp",le="+Inf"} 2
+dns_server_request_duration_seconds_sum{kind="udp"} 0.022
+dns_server_request_duration_seconds_count{kind="udp"} 2
+`
+
+	test.Assert(t, "WritePrometheus", exp, buf.String(), true)
+}
+
+func TestResolverMetrics(t *testing.T) {
+	m := NewMetrics()
+
+	up := &testUpstream{
+		ttl: 60,
+	}
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver(up)
+
+	// The first response is forwarded from upstream, and the second one
+	// is from cache.
+	for id := uint16(1); id <= 2; id++ {
+		req := newTestRequest(sender, id, "kilabit.info")
+		req.UDPAddr = &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+		req.observer = m
+		req.start = time.Now()
+
+		rs.ServeDNS(req)
+		<-sender.C
+	}
+
+	var buf bytes.Buffer
+
+	err := m.WritePrometheus(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# HELP dns_server_queries_total Number of queries received.
+# TYPE dns_server_queries_total counter
+dns_server_queries_total{kind="udp",qtype="A"} 2
+# HELP dns_server_responses_total Number of responses sent.
+# TYPE dns_server_responses_total counter
+dns_server_responses_total{kind="udp",rcode="NOERROR"} 2
+`
+
+	test.Assert(t, "WritePrometheus", true,
+		strings.HasPrefix(buf.String(), exp), true)
+}
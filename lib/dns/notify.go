@@ -0,0 +1,248 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// maxNotifyRetry define the maximum number of NOTIFY retransmission
+	// to each secondary, until it respond (RFC 1996 section 3.6).
+	maxNotifyRetry = 5
+
+	// notifyTimeout define the time to wait for NOTIFY response before
+	// retransmission.
+	notifyTimeout = 2 * time.Second
+)
+
+//
+// SetNotify set the list of secondary name servers that will be notified
+// (RFC 1996) when the zone with origin is reloaded or updated.  Each name
+// server is an IP address with optional port, for example "192.0.2.2:53".
+//
+func (zh *ZoneHandler) SetNotify(origin string, nameservers []string) error {
+	addrs, err := ParseNameServers(nameservers)
+	if err != nil {
+		return err
+	}
+
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+
+	zh.Lock()
+	zh.notifies[origin] = addrs
+	zh.Unlock()
+
+	return nil
+}
+
+//
+// ReloadMaster load the master file and replace the zone with the same
+// origin, and the hosts records from previous load of file.  If the zone
+// SOA serial is changed, the secondaries of zone will be notified.
+//
+func (zh *ZoneHandler) ReloadMaster(file, origin string, ttl uint32) error {
+	old, zone, err := zh.swapMaster(file, origin, ttl)
+	if err != nil {
+		return err
+	}
+
+	if old == nil || old.SOA == nil || zone.SOA == nil ||
+		old.SOA.SOA.Serial != zone.SOA.SOA.Serial {
+		zh.notify(zone)
+	}
+
+	return nil
+}
+
+//
+// AddSecondary add the zone with origin as secondary zone, transferred
+// from the primary name server.  The zone will be refreshed when the
+// primary send the NOTIFY message.  The primary is an IP address with
+// optional port, for example "192.0.2.1:53".
+//
+func (zh *ZoneHandler) AddSecondary(origin, primary string) error {
+	addrs, err := ParseNameServers([]string{primary})
+	if err != nil {
+		return err
+	}
+
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+
+	zh.Lock()
+	zh.primaries[origin] = addrs[0]
+	zh.Unlock()
+
+	return zh.Refresh(origin)
+}
+
+//
+// Refresh transfer the secondary zone from its primary name server.  The
+// zone is replaced only if the SOA serial of transferred zone is greater
+// than the current one, and then its secondaries will be notified.
+//
+func (zh *ZoneHandler) Refresh(origin string) (err error) {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+
+	zh.RLock()
+	primary := zh.primaries[origin]
+	old := zh.zone(origin)
+	zh.RUnlock()
+
+	if primary == nil {
+		return fmt.Errorf("dns: ZoneHandler: Refresh: %q is not secondary zone",
+			origin)
+	}
+
+	cl, err := NewTCPClient(primary.String())
+	if err != nil {
+		return err
+	}
+
+	rrs, err := cl.Transfer([]byte(origin))
+	_ = cl.Close()
+	if err != nil {
+		return err
+	}
+
+	zone := NewZone(origin)
+	for _, rr := range rrs {
+		zone.add(rr)
+	}
+	if zone.SOA == nil {
+		return fmt.Errorf("dns: ZoneHandler: Refresh: %q: missing SOA",
+			origin)
+	}
+
+	if old != nil && old.SOA != nil &&
+		!serialLess(old.SOA.SOA.Serial, zone.SOA.SOA.Serial) {
+		return nil
+	}
+
+	zh.AddZone(zone)
+	zh.notify(zone)
+
+	return nil
+}
+
+//
+// serveNotify answer the NOTIFY request from primary name server and
+// refresh the zone (RFC 1996 section 3.7).  The request is only accepted
+// for secondary zone and from its primary.
+//
+func (zh *ZoneHandler) serveNotify(req *Request) {
+	q := req.Message
+
+	if q.Question.Type != QueryTypeSOA {
+		zh.sendResponse(req, newResponse(q, RCodeErrFormat))
+		return
+	}
+
+	origin := string(q.Question.Name)
+
+	zh.RLock()
+	primary := zh.primaries[origin]
+	zh.RUnlock()
+
+	if primary == nil {
+		zh.sendResponse(req, newResponse(q, RCodeNotAuth))
+		return
+	}
+	if !primary.IP.Equal(requestIP(req)) {
+		zh.sendResponse(req, newResponse(q, RCodeRefused))
+		return
+	}
+
+	res := newResponse(q, RCodeOK)
+	res.Header.IsAA = true
+	zh.sendResponse(req, res)
+
+	go func() {
+		err := zh.Refresh(origin)
+		if err != nil {
+			log.Println("dns: ZoneHandler: serveNotify: ", err)
+		}
+	}()
+}
+
+//
+// notify send the NOTIFY message to each secondaries of zone in the
+// background.
+//
+func (zh *ZoneHandler) notify(zone *Zone) {
+	zh.RLock()
+	addrs := zh.notifies[zone.Origin]
+	zh.RUnlock()
+
+	if len(addrs) == 0 || zone.SOA == nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		go func(addr *net.UDPAddr) {
+			err := sendNotify(zone, addr)
+			if err != nil {
+				log.Printf("dns: ZoneHandler: notify %s: %s\n", addr, err)
+			}
+		}(addr)
+	}
+}
+
+//
+// sendNotify send the NOTIFY message of zone to name server, with the zone
+// SOA in answer section as hint (RFC 1996 section 3.7).  The message is
+// retransmitted until the name server respond.
+//
+func sendNotify(zone *Zone, addr *net.UDPAddr) (err error) {
+	msg := NewMessage()
+	msg.Header.ID = getNextID()
+	msg.Header.Op = OpCodeNotify
+	msg.Header.IsAA = true
+	msg.Header.IsRD = false
+	msg.Question.Name = []byte(zone.Origin)
+	msg.Question.Type = QueryTypeSOA
+
+	zone.RLock()
+	msg.Question.Class = zone.SOA.Class
+	msg.Answer = append(msg.Answer, zone.SOA)
+	_, err = msg.Pack()
+	zone.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	cl, err := NewUDPClient(addr.String())
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	cl.SetTimeout(notifyTimeout)
+
+	for x := 0; x < maxNotifyRetry; x++ {
+		var res *Message
+
+		res, err = cl.Query(msg, nil)
+		if err != nil {
+			continue
+		}
+
+		err = isResponseTo(msg, res)
+		if err != nil {
+			continue
+		}
+		if res.Header.RCode != RCodeOK {
+			return fmt.Errorf("response code %d", res.Header.RCode)
+		}
+
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,63 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"time"
+)
+
+//
+// Observer is an interface that receive the event of each request that
+// has been answered by Server, for example to log the queries or to
+// collect the metrics.
+//
+// The Observe method is called synchronously before the response is sent,
+// so its should not block.
+//
+type Observer interface {
+	Observe(ev *QueryEvent)
+}
+
+//
+// QueryEvent contains the information of request that has been answered.
+//
+type QueryEvent struct {
+	// RemoteAddr is the address of client, in the format "ip:port".
+	RemoteAddr string
+
+	// Kind define the connection type of request, e.g. UDP, TCP, DoH,
+	// or DoT.
+	Kind int
+
+	// QName is the query name.
+	QName string
+
+	// QType is the query type.
+	QType uint16
+
+	// RCode is the response code.
+	RCode ResponseCode
+
+	// Latency is the duration between the request received and the
+	// response being sent.
+	Latency time.Duration
+}
+
+//
+// connTypeName return the name of connection type.
+//
+func connTypeName(kind int) string {
+	switch kind {
+	case ConnTypeUDP:
+		return "udp"
+	case ConnTypeTCP:
+		return "tcp"
+	case ConnTypeDoH:
+		return "doh"
+	case ConnTypeDoT:
+		return "dot"
+	}
+	return "unknown"
+}
@@ -0,0 +1,379 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//
+// PolicyAction define the action for the query name that match the policy
+// rule.
+//
+type PolicyAction int
+
+//
+// List of policy actions.
+//
+const (
+	// PolicyPassthru pass the query to the next handler, as exception of
+	// other rules.
+	PolicyPassthru PolicyAction = iota
+
+	// PolicyNXDomain answer the query with NXDOMAIN.
+	PolicyNXDomain
+
+	// PolicyNoData answer the query with NOERROR and empty answer.
+	PolicyNoData
+
+	// PolicySinkhole answer the query with the local records of the rule,
+	// for example the sinkhole address, or with empty answer if the
+	// rule does not have records with the query type.
+	PolicySinkhole
+)
+
+//
+// List of RPZ targets of CNAME record that define the policy action
+// (draft-vixie-dnsop-dns-rpz section 3).
+//
+const (
+	rpzTargetNXDomain = ""
+	rpzTargetNoData   = "*"
+	rpzTargetPassthru = "rpz-passthru"
+)
+
+//
+// PolicyHandler is a Handler that filter the query using block lists, for
+// example to block the advertisement or malware domains.  The query that
+// does not match any rules, or match the passthru rule, will be passed to
+// the Next handler.
+//
+// The rules are loaded from hosts files using LoadHosts, and from response
+// policy zone (RPZ) files using LoadRPZ.  Loading the same file again will
+// replace the rules from previous load of file, so the block lists can be
+// reloaded while serving the queries.
+//
+// The rule with exact name take precedence over the wildcard rule.  If
+// more than one file has the rule for the same name, the passthru rule
+// take precedence, and then the rule from file that loaded first.
+//
+type PolicyHandler struct {
+	// Next define the handler that will receive the query that is not
+	// blocked.  If its nil, the query will be answered with REFUSED.
+	Next Handler
+
+	sync.RWMutex
+	rules *policyRules
+
+	// files contains the rules loaded from each file, in order of first
+	// load.
+	files []*policyFile
+}
+
+//
+// policyFile contains the rules loaded from file.
+//
+type policyFile struct {
+	path  string
+	rules *policyRules
+}
+
+//
+// policyRules contains the rules on exact names and on wildcard names.
+// The wildcard rule is indexed by its parent, for example the rule of
+// "*.example.com" is indexed by "example.com".
+//
+type policyRules struct {
+	exact    map[string]*policyRule
+	wildcard map[string]*policyRule
+}
+
+//
+// policyRule contains the action and the local records for sinkhole
+// action.
+//
+type policyRule struct {
+	action PolicyAction
+	rrs    []*ResourceRecord
+}
+
+//
+// NewPolicyHandler create and initialize new policy handler.
+//
+func NewPolicyHandler(next Handler) *PolicyHandler {
+	return &PolicyHandler{
+		Next:  next,
+		rules: newPolicyRules(),
+	}
+}
+
+func newPolicyRules() *policyRules {
+	return &policyRules{
+		exact:    make(map[string]*policyRule),
+		wildcard: make(map[string]*policyRule),
+	}
+}
+
+//
+// LoadHosts load the host names from hosts file as rules with the action.
+// If action is PolicySinkhole, the query will be answered with the address
+// of host name in file.  If action is PolicyPassthru, the host names in
+// file will be excluded from other rules.
+//
+func (ph *PolicyHandler) LoadHosts(path string, action PolicyAction) error {
+	msgs, err := HostsLoad(path)
+	if err != nil {
+		return err
+	}
+
+	rules := newPolicyRules()
+
+	for _, msg := range msgs {
+		for _, rr := range msg.Answer {
+			rules.add(string(rr.Name), action, rr)
+		}
+	}
+
+	ph.setRules(path, rules)
+
+	return nil
+}
+
+//
+// LoadRPZ load the rules from response policy zone file with origin.  If
+// origin is empty, the base name of file will be used as origin.  The
+// owner name of each record, relative to origin, define the query name
+// that trigger the rule.  The action is defined by the record,
+//
+//	CNAME .             answer with NXDOMAIN,
+//	CNAME *.            answer with NODATA,
+//	CNAME rpz-passthru. pass the query to the next handler,
+//
+// and other records are used as local records of sinkhole.  The CNAME
+// record to other name answer the query of any type.  The SOA and NS
+// records are ignored.
+//
+func (ph *PolicyHandler) LoadRPZ(path, origin string) error {
+	msgs, err := MasterLoad(path, origin, 0)
+	if err != nil {
+		return err
+	}
+
+	origin = masterOrigin(path, origin, msgs)
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+	suffix := "." + origin
+
+	rules := newPolicyRules()
+
+	for _, msg := range msgs {
+		for _, rr := range msg.Answer {
+			switch rr.Type {
+			case QueryTypeSOA, QueryTypeNS:
+				continue
+			}
+
+			name := strings.ToLower(string(rr.Name))
+			if !strings.HasSuffix(name, suffix) {
+				return fmt.Errorf("dns: PolicyHandler: LoadRPZ: %q is not in %q",
+					name, origin)
+			}
+			name = strings.TrimSuffix(name, suffix)
+
+			if rr.Type != QueryTypeCNAME {
+				rules.add(name, PolicySinkhole, rr)
+				continue
+			}
+
+			switch string(rr.Text.Value) {
+			case rpzTargetNXDomain:
+				rules.add(name, PolicyNXDomain, nil)
+			case rpzTargetNoData:
+				rules.add(name, PolicyNoData, nil)
+			case rpzTargetPassthru:
+				rules.add(name, PolicyPassthru, nil)
+			default:
+				rules.add(name, PolicySinkhole, rr)
+			}
+		}
+	}
+
+	ph.setRules(path, rules)
+
+	return nil
+}
+
+//
+// Remove the rules loaded from file.
+//
+func (ph *PolicyHandler) Remove(path string) {
+	ph.Lock()
+	for x, pf := range ph.files {
+		if pf.path == path {
+			ph.files = append(ph.files[:x], ph.files[x+1:]...)
+			break
+		}
+	}
+	ph.rebuild()
+	ph.Unlock()
+}
+
+//
+// setRules replace the rules of file and rebuild the rules from all files.
+//
+func (ph *PolicyHandler) setRules(path string, rules *policyRules) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	for _, pf := range ph.files {
+		if pf.path == path {
+			pf.rules = rules
+			ph.rebuild()
+			return
+		}
+	}
+
+	ph.files = append(ph.files, &policyFile{
+		path:  path,
+		rules: rules,
+	})
+	ph.rebuild()
+}
+
+//
+// rebuild merge the rules from all files.  The rules is replaced, not
+// modified, so the query that still use the previous rules is not
+// affected.  This method must be called with the lock held.
+//
+func (ph *PolicyHandler) rebuild() {
+	all := newPolicyRules()
+
+	for _, pf := range ph.files {
+		mergePolicyRules(all.exact, pf.rules.exact)
+		mergePolicyRules(all.wildcard, pf.rules.wildcard)
+	}
+
+	ph.rules = all
+}
+
+func mergePolicyRules(dst, src map[string]*policyRule) {
+	for name, rule := range src {
+		old, ok := dst[name]
+		if !ok || rule.action == PolicyPassthru &&
+			old.action != PolicyPassthru {
+			dst[name] = rule
+		}
+	}
+}
+
+//
+// add the rule of name.  If the name already has the rule with the same
+// action, the record will be appended to the rule.
+//
+func (rules *policyRules) add(name string, action PolicyAction,
+	rr *ResourceRecord,
+) {
+	m := rules.exact
+	if strings.HasPrefix(name, "*.") {
+		m = rules.wildcard
+		name = name[2:]
+	}
+
+	rule, ok := m[name]
+	if !ok {
+		rule = &policyRule{
+			action: action,
+		}
+		m[name] = rule
+	} else if rule.action != action {
+		return
+	}
+	if rr != nil {
+		rule.rrs = append(rule.rrs, rr)
+	}
+}
+
+//
+// match return the rule for query name, or nil if no rule match.  The
+// wildcard rule is matched from the closest parent of name.
+//
+func (rules *policyRules) match(name string) *policyRule {
+	rule, ok := rules.exact[name]
+	if ok {
+		return rule
+	}
+
+	for {
+		x := strings.IndexByte(name, '.')
+		if x < 0 {
+			return nil
+		}
+		name = name[x+1:]
+
+		rule, ok = rules.wildcard[name]
+		if ok {
+			return rule
+		}
+	}
+}
+
+//
+// ServeDNS answer the query that match the rule based on its action, or
+// pass it to the Next handler.
+//
+func (ph *PolicyHandler) ServeDNS(req *Request) {
+	q := req.Message
+	qname := strings.ToLower(string(q.Question.Name))
+
+	ph.RLock()
+	rule := ph.rules.match(qname)
+	ph.RUnlock()
+
+	if rule == nil || rule.action == PolicyPassthru {
+		if ph.Next == nil {
+			ph.sendResponse(req, newResponse(q, RCodeRefused))
+			return
+		}
+		ph.Next.ServeDNS(req)
+		return
+	}
+
+	res := newResponse(q, RCodeOK)
+
+	switch rule.action {
+	case PolicyNXDomain:
+		res.Header.RCode = RCodeErrName
+	case PolicySinkhole:
+		// The CNAME record of sinkhole is the answer for any query
+		// type, and the client will follow it to the target name.
+		rrs := filterRR(rule.rrs, QueryTypeCNAME, q.Question.Class)
+		if len(rrs) == 0 {
+			rrs = filterRR(rule.rrs, q.Question.Type, q.Question.Class)
+		}
+		for _, rr := range rrs {
+			answer, err := rr.clone()
+			if err != nil {
+				continue
+			}
+			answer.Name = append(answer.Name[:0], q.Question.Name...)
+			res.Answer = append(res.Answer, answer)
+		}
+	}
+
+	ph.sendResponse(req, res)
+}
+
+//
+// sendResponse pack the response and send it to client.
+//
+func (ph *PolicyHandler) sendResponse(req *Request, res *Message) {
+	_, err := res.Pack()
+	if err != nil {
+		FreeRequest(req)
+		return
+	}
+	req.Respond(res)
+}
@@ -0,0 +1,111 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestPolicyHandlerServeDNS(t *testing.T) {
+	next := NewZoneHandler()
+	next.AddZone(newTestZone(t, `
+example.net. 3600 IN SOA ns.example.net. admin.example.net. 1 3600 600 86400 300
+www.malware.example.net. 3600 IN A 10.0.0.2
+`))
+
+	ph := NewPolicyHandler(next)
+
+	err := ph.LoadHosts("testdata/hosts.block", PolicySinkhole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ph.LoadHosts("testdata/allowlist.hosts", PolicyPassthru)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ph.LoadRPZ("testdata/rpz.local", "rpz.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc     string
+		qname    string
+		expRCode ResponseCode
+		exp      []string
+	}{{
+		desc:  "With sinkhole from hosts",
+		qname: "0101011.com",
+		exp:   []string{"127.0.0.2"},
+	}, {
+		desc:     "With exception from hosts",
+		qname:    "00fun.com",
+		expRCode: RCodeRefused,
+	}, {
+		desc:     "With NXDOMAIN",
+		qname:    "malware.example.net",
+		expRCode: RCodeErrName,
+	}, {
+		desc:     "With NXDOMAIN on wildcard",
+		qname:    "a.b.malware.example.net",
+		expRCode: RCodeErrName,
+	}, {
+		desc:  "With passthru",
+		qname: "www.malware.example.net",
+		exp:   []string{"10.0.0.2"},
+	}, {
+		desc:  "With NODATA",
+		qname: "nodata.example.net",
+	}, {
+		desc:  "With sinkhole from RPZ",
+		qname: "sink.example.net",
+		exp:   []string{"10.0.0.1"},
+	}, {
+		desc:  "With sinkhole on wildcard",
+		qname: "www.sink.example.net",
+		exp:   []string{"10.0.0.1"},
+	}, {
+		desc:  "With sinkhole CNAME from RPZ",
+		qname: "redirect.example.net",
+		exp:   []string{"sinkhole.example.org"},
+	}, {
+		desc:     "Without rule",
+		qname:    "other.example.net",
+		expRCode: RCodeErrName,
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		id := uint16(3000 + x)
+
+		ph.ServeDNS(newTestRequest(sender, id, c.qname))
+		res := <-sender.C
+
+		test.Assert(t, "ID", id, res.Header.ID, true)
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+
+		var got []string
+		for _, rr := range res.Answer {
+			test.Assert(t, "Name", c.qname, string(rr.Name), true)
+			got = append(got, testRDataString(rr))
+		}
+		test.Assert(t, "Answer", c.exp, got, true)
+	}
+
+	// Removing the block list should pass the query to the next handler.
+	ph.Remove("testdata/rpz.local")
+
+	ph.ServeDNS(newTestRequest(sender, 4000, "sink.example.net"))
+	res := <-sender.C
+
+	test.Assert(t, "RCode", RCodeErrName, res.Header.RCode, true)
+}
@@ -0,0 +1,297 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defRateLimitIPv4PrefixLen = 24
+	defRateLimitIPv6PrefixLen = 56
+
+	// rateLimitSweepInterval define the interval to remove the expired
+	// buckets.
+	rateLimitSweepInterval = 10 * time.Second
+)
+
+//
+// rateLimitAction define the action for the response after checking the
+// rate limit.
+//
+type rateLimitAction int
+
+const (
+	rateLimitSend rateLimitAction = iota
+	rateLimitDrop
+	rateLimitSlip
+)
+
+//
+// RateLimitOptions describes options for response rate limiting (RRL) and
+// per-client query limit on UDP server.
+//
+// The client is identified by its network prefix, not by its address,
+// because the address of spoofed queries can be anywhere inside the
+// victim network.
+//
+type RateLimitOptions struct {
+	// ResponsesPerSecond define the maximum number of identical
+	// responses per second sent to the client.  Responses are identical
+	// if they have the same query name and type, or, for name errors,
+	// the same zone, or, for other errors, the same response code.
+	// Zero means no limit.
+	ResponsesPerSecond int
+
+	// QueriesPerSecond define the maximum number of queries per second
+	// accepted from the client.  The query that exceed the limit will be
+	// dropped without response.  Zero means no limit.
+	QueriesPerSecond int
+
+	// Slip define how the responses that exceed the limit is handled.
+	// If its zero, all of them will be dropped.  If its one, all of them
+	// will be replaced by truncated response, which force the legitimate
+	// client to retry the query using TCP.  If its N, every N-th of them
+	// will be replaced by truncated response and the rest are dropped.
+	Slip int
+
+	// IPv4PrefixLen define the network prefix length of IPv4 client,
+	// default to 24.
+	IPv4PrefixLen int
+
+	// IPv6PrefixLen define the network prefix length of IPv6 client,
+	// default to 56.
+	IPv6PrefixLen int
+}
+
+func (opts *RateLimitOptions) init() {
+	if opts.IPv4PrefixLen <= 0 || opts.IPv4PrefixLen > 32 {
+		opts.IPv4PrefixLen = defRateLimitIPv4PrefixLen
+	}
+	if opts.IPv6PrefixLen <= 0 || opts.IPv6PrefixLen > 128 {
+		opts.IPv6PrefixLen = defRateLimitIPv6PrefixLen
+	}
+}
+
+//
+// RateLimitStats contains the number of queries and responses that has
+// been limited by RateLimiter.
+//
+type RateLimitStats struct {
+	// QueriesDropped is the number of queries that exceed the query
+	// limit.
+	QueriesDropped uint64
+
+	// ResponsesDropped is the number of responses that exceed the
+	// response limit and not sent.
+	ResponsesDropped uint64
+
+	// ResponsesSlipped is the number of responses that exceed the
+	// response limit and replaced by truncated response.
+	ResponsesSlipped uint64
+}
+
+//
+// RateLimiter limit the queries and responses of UDP server per client
+// network.  The limiter is enabled by setting the Server.RateLimiter
+// before serving.
+//
+// This type is safe to be used concurrently.
+//
+type RateLimiter struct {
+	opts  RateLimitOptions
+	mask4 net.IPMask
+	mask6 net.IPMask
+
+	mu        sync.Mutex
+	queries   map[string]*rateBucket
+	responses map[string]*rateBucket
+	lastSweep time.Time
+
+	queriesDropped   uint64
+	responsesDropped uint64
+	responsesSlipped uint64
+
+	// now return the current time, replaced on testing.
+	now func() time.Time
+}
+
+//
+// rateBucket count the number of queries or responses in one second
+// window.
+//
+type rateBucket struct {
+	window int64
+	count  int
+	nslip  int
+}
+
+//
+// NewRateLimiter create and initialize new rate limiter.
+//
+func NewRateLimiter(opts RateLimitOptions) *RateLimiter {
+	opts.init()
+
+	return &RateLimiter{
+		opts:      opts,
+		mask4:     net.CIDRMask(opts.IPv4PrefixLen, 32),
+		mask6:     net.CIDRMask(opts.IPv6PrefixLen, 128),
+		queries:   make(map[string]*rateBucket),
+		responses: make(map[string]*rateBucket),
+		now:       time.Now,
+	}
+}
+
+//
+// Stats return the number of queries and responses that has been limited.
+//
+func (rl *RateLimiter) Stats() RateLimitStats {
+	return RateLimitStats{
+		QueriesDropped:   atomic.LoadUint64(&rl.queriesDropped),
+		ResponsesDropped: atomic.LoadUint64(&rl.responsesDropped),
+		ResponsesSlipped: atomic.LoadUint64(&rl.responsesSlipped),
+	}
+}
+
+//
+// allowQuery return true if the query from client IP does not exceed the
+// query limit.
+//
+func (rl *RateLimiter) allowQuery(ip net.IP) bool {
+	if rl.opts.QueriesPerSecond <= 0 {
+		return true
+	}
+
+	rl.mu.Lock()
+	b := rl.bucket(rl.queries, rl.prefix(ip))
+	b.count++
+	ok := b.count <= rl.opts.QueriesPerSecond
+	rl.mu.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&rl.queriesDropped, 1)
+	}
+
+	return ok
+}
+
+//
+// limitResponse return the action for the response to client IP: send,
+// drop, or replace it with truncated response.
+//
+func (rl *RateLimiter) limitResponse(ip net.IP, res *Message) rateLimitAction {
+	if rl.opts.ResponsesPerSecond <= 0 {
+		return rateLimitSend
+	}
+
+	key := rl.prefix(ip) + "|" + responseKey(res)
+
+	rl.mu.Lock()
+	b := rl.bucket(rl.responses, key)
+	b.count++
+	if b.count <= rl.opts.ResponsesPerSecond {
+		rl.mu.Unlock()
+		return rateLimitSend
+	}
+
+	action := rateLimitDrop
+	if rl.opts.Slip > 0 {
+		b.nslip++
+		if b.nslip >= rl.opts.Slip {
+			b.nslip = 0
+			action = rateLimitSlip
+		}
+	}
+	rl.mu.Unlock()
+
+	if action == rateLimitSlip {
+		atomic.AddUint64(&rl.responsesSlipped, 1)
+	} else {
+		atomic.AddUint64(&rl.responsesDropped, 1)
+	}
+
+	return action
+}
+
+//
+// bucket return the bucket of key in the current window.  The buckets of
+// previous windows are removed periodically.  This method must be called
+// with the lock held.
+//
+func (rl *RateLimiter) bucket(buckets map[string]*rateBucket, key string) (
+	b *rateBucket,
+) {
+	now := rl.now()
+	window := now.Unix()
+
+	if now.Sub(rl.lastSweep) >= rateLimitSweepInterval {
+		rl.sweep(window)
+		rl.lastSweep = now
+	}
+
+	b = buckets[key]
+	if b == nil {
+		b = &rateBucket{}
+		buckets[key] = b
+	}
+	if b.window != window {
+		b.window = window
+		b.count = 0
+	}
+
+	return b
+}
+
+//
+// sweep remove the buckets that are not used in the current window.
+//
+func (rl *RateLimiter) sweep(window int64) {
+	for key, b := range rl.queries {
+		if b.window != window {
+			delete(rl.queries, key)
+		}
+	}
+	for key, b := range rl.responses {
+		if b.window != window {
+			delete(rl.responses, key)
+		}
+	}
+}
+
+//
+// prefix return the network prefix of client IP as string.
+//
+func (rl *RateLimiter) prefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(rl.mask4).String()
+	}
+	return ip.Mask(rl.mask6).String()
+}
+
+//
+// responseKey return the key that identify the identical responses.  The
+// name error responses are identified by their zone, so the attacker can
+// not avoid the limit by querying random names.
+//
+func responseKey(res *Message) string {
+	switch res.Header.RCode {
+	case RCodeOK:
+		return string(res.Question.Name) + "|" +
+			strconv.Itoa(int(res.Question.Type))
+	case RCodeErrName:
+		for _, rr := range res.Authority {
+			if rr.Type == QueryTypeSOA {
+				return "nxdomain|" + string(rr.Name)
+			}
+		}
+		return "nxdomain|"
+	}
+
+	return "error|" + strconv.Itoa(int(res.Header.RCode))
+}
@@ -0,0 +1,130 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestRateLimiterAllowQuery(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	rl := NewRateLimiter(RateLimitOptions{
+		QueriesPerSecond: 2,
+	})
+	rl.now = func() time.Time { return now }
+
+	cases := []struct {
+		desc string
+		ip   string
+		exp  bool
+	}{{
+		desc: "First query",
+		ip:   "192.0.2.1",
+		exp:  true,
+	}, {
+		desc: "Second query from the same network",
+		ip:   "192.0.2.2",
+		exp:  true,
+	}, {
+		desc: "Third query from the same network",
+		ip:   "192.0.2.3",
+		exp:  false,
+	}, {
+		desc: "First query from other network",
+		ip:   "192.0.3.1",
+		exp:  true,
+	}, {
+		desc: "IPv6 query",
+		ip:   "2001:db8::1",
+		exp:  true,
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		got := rl.allowQuery(net.ParseIP(c.ip))
+		test.Assert(t, "allowQuery", c.exp, got, true)
+	}
+
+	// The limit is reset on the next second.
+	now = now.Add(time.Second)
+	test.Assert(t, "allowQuery", true,
+		rl.allowQuery(net.ParseIP("192.0.2.1")), true)
+
+	test.Assert(t, "Stats", RateLimitStats{QueriesDropped: 1},
+		rl.Stats(), true)
+}
+
+func TestRequestLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	rl := NewRateLimiter(RateLimitOptions{
+		ResponsesPerSecond: 1,
+		Slip:               2,
+	})
+	rl.now = func() time.Time { return now }
+
+	zh := NewZoneHandler()
+	zh.AddZone(newTestZone(t, `
+example.test. 3600 IN SOA ns.example.test. admin.example.test. 1 3600 600 86400 300
+www.example.test. 3600 IN A 10.0.0.1
+`))
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	serve := func(id uint16, qname string) *Message {
+		req := newTestRequest(sender, id, qname)
+		req.UDPAddr = &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+		req.limiter = rl
+
+		zh.ServeDNS(req)
+
+		select {
+		case res := <-sender.C:
+			return res
+		default:
+			return nil
+		}
+	}
+
+	// The first response is sent, the second one is dropped, and the
+	// third one is slipped.
+	res := serve(1, "www.example.test")
+	test.Assert(t, "Answer", 1, len(res.Answer), true)
+
+	res = serve(2, "www.example.test")
+	test.Assert(t, "dropped", true, res == nil, true)
+
+	res = serve(3, "www.example.test")
+	test.Assert(t, "ID", uint16(3), res.Header.ID, true)
+	test.Assert(t, "IsTC", true, res.Header.IsTC, true)
+	test.Assert(t, "Answer", 0, len(res.Answer), true)
+
+	// The name errors on the same zone share the same limit.
+	res = serve(4, "a.example.test")
+	test.Assert(t, "RCode", RCodeErrName, res.Header.RCode, true)
+
+	res = serve(5, "b.example.test")
+	test.Assert(t, "dropped", true, res == nil, true)
+
+	exp := RateLimitStats{
+		ResponsesDropped: 2,
+		ResponsesSlipped: 1,
+	}
+	test.Assert(t, "Stats", exp, rl.Stats(), true)
+
+	// The limit is reset on the next second.
+	now = now.Add(time.Second)
+
+	res = serve(6, "www.example.test")
+	test.Assert(t, "Answer", 1, len(res.Answer), true)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+//
+// CAAFlagCritical is the issuer critical flag of CAA record.  If its set,
+// the certification authority must not issue certificate if it does not
+// understand the property tag.
+//
+const CAAFlagCritical byte = 0x80
+
+//
+// RDataCAA define format of RDATA for CAA (RFC 8659 section 4.1).  It
+// specify the certification authorities that are authorized to issue
+// certificate for the domain.
+//
+type RDataCAA struct {
+	// Flags contains the issuer critical flag.
+	Flags byte
+
+	// Tag is the property identifier, for example "issue",
+	// "issuewild", or "iodef".
+	Tag []byte
+
+	// Value is the value associated with the property tag.
+	Value []byte
+}
+
+//
+// String return readable representation of CAA record.
+//
+func (caa *RDataCAA) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Flags:%d Tag:%s Value:%s}", caa.Flags, caa.Tag,
+		caa.Value)
+
+	return b.String()
+}
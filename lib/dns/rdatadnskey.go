@@ -0,0 +1,85 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// List of DNSKEY flags.
+const (
+	// DNSKEYFlagZone indicates that the key is a zone key.
+	DNSKEYFlagZone uint16 = 0x0100
+
+	// DNSKEYFlagSEP indicates that the key is a secure entry point, also
+	// known as key signing key (KSK).
+	DNSKEYFlagSEP uint16 = 0x0001
+)
+
+//
+// RDataDNSKEY define format of RDATA for DNSKEY (RFC 4034 section 2).
+//
+type RDataDNSKEY struct {
+	// Flags of the key.  Bit 7 is the zone key flag and bit 15 is the
+	// secure entry point flag.
+	Flags uint16
+
+	// Protocol must be 3.
+	Protocol byte
+
+	// Algorithm identifies the public key's cryptographic algorithm.
+	Algorithm byte
+
+	// PublicKey holds the public key material, the format depends on
+	// the algorithm.
+	PublicKey []byte
+}
+
+//
+// KeyTag return the key tag of DNSKEY as defined in RFC 4034 Appendix B.
+//
+func (key *RDataDNSKEY) KeyTag() uint16 {
+	rdata := key.pack()
+
+	var ac uint32
+	for x, b := range rdata {
+		if x&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+
+	return uint16(ac & 0xFFFF)
+}
+
+//
+// pack the DNSKEY RDATA into wire format.
+//
+func (key *RDataDNSKEY) pack() []byte {
+	rdata := make([]byte, 0, 4+len(key.PublicKey))
+
+	rdata = append(rdata, byte(key.Flags>>8), byte(key.Flags))
+	rdata = append(rdata, key.Protocol, key.Algorithm)
+	rdata = append(rdata, key.PublicKey...)
+
+	return rdata
+}
+
+//
+// String return readable representation of DNSKEY record.
+//
+func (key *RDataDNSKEY) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Flags:%d Protocol:%d Algorithm:%d PublicKey:%s}",
+		key.Flags, key.Protocol, key.Algorithm,
+		base64.StdEncoding.EncodeToString(key.PublicKey))
+
+	return b.String()
+}
@@ -0,0 +1,48 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// List of DS digest types.
+const (
+	DSDigestSHA1   byte = 1
+	DSDigestSHA256 byte = 2
+	DSDigestSHA384 byte = 4
+)
+
+//
+// RDataDS define format of RDATA for DS (RFC 4034 section 5).
+//
+type RDataDS struct {
+	// KeyTag of the DNSKEY record referred by the DS record.
+	KeyTag uint16
+
+	// Algorithm of the DNSKEY record referred by the DS record.
+	Algorithm byte
+
+	// DigestType identifies the algorithm used to construct the digest.
+	DigestType byte
+
+	// Digest of the DNSKEY owner name and DNSKEY RDATA.
+	Digest []byte
+}
+
+//
+// String return readable representation of DS record.
+//
+func (ds *RDataDS) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{KeyTag:%d Algorithm:%d DigestType:%d Digest:%s}",
+		ds.KeyTag, ds.Algorithm, ds.DigestType,
+		strings.ToUpper(hex.EncodeToString(ds.Digest)))
+
+	return b.String()
+}
@@ -0,0 +1,54 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+//
+// RDataNAPTR define format of RDATA for NAPTR (RFC 3403 section 4.1).  It
+// contains the rule to rewrite the domain name into URI or into another
+// domain name.
+//
+type RDataNAPTR struct {
+	// Order specifies the order in which the NAPTR records must be
+	// processed.  Lower value is processed first.
+	Order uint16
+
+	// Preference specifies the order in which NAPTR records with equal
+	// Order should be processed.
+	Preference uint16
+
+	// Flags control the rewriting and interpretation of the fields in
+	// record, for example "S", "A", "U", or "P".
+	Flags []byte
+
+	// Services specifies the service parameters applicable to this
+	// delegation path, for example "SIP+D2U".
+	Services []byte
+
+	// Regexp contains the substitution expression that is applied to
+	// the original string to construct the next domain name to lookup.
+	Regexp []byte
+
+	// Replacement is the next domain name to query for, if Regexp is
+	// empty.  An empty Replacement mean the root domain ".".
+	Replacement []byte
+}
+
+//
+// String return readable representation of NAPTR record.
+//
+func (naptr *RDataNAPTR) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Order:%d Preference:%d Flags:%s Services:%s"+
+		" Regexp:%s Replacement:%s}", naptr.Order, naptr.Preference,
+		naptr.Flags, naptr.Services, naptr.Regexp, naptr.Replacement)
+
+	return b.String()
+}
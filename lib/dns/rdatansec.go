@@ -0,0 +1,35 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+//
+// RDataNSEC define format of RDATA for NSEC (RFC 4034 section 4).
+//
+type RDataNSEC struct {
+	// NextName contains the next owner name, in the canonical ordering
+	// of the zone, that has authoritative data or contains a delegation
+	// point NS RRset.
+	NextName []byte
+
+	// Types identifies the RRset types that exist at the NSEC RR's owner
+	// name.
+	Types []uint16
+}
+
+//
+// String return readable representation of NSEC record.
+//
+func (nsec *RDataNSEC) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{NextName:%s Types:%v}", nsec.NextName, nsec.Types)
+
+	return b.String()
+}
@@ -0,0 +1,71 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// List of NSEC3 flags.
+const (
+	// NSEC3FlagOptOut indicates that the NSEC3 record may cover unsigned
+	// delegations.
+	NSEC3FlagOptOut byte = 0x01
+)
+
+//
+// base32HexNoPad is the encoding for NSEC3 hashed owner name.
+//
+var base32HexNoPad = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+//
+// RDataNSEC3 define format of RDATA for NSEC3 (RFC 5155 section 3).
+//
+type RDataNSEC3 struct {
+	// HashAlgorithm identifies the cryptographic hash algorithm used to
+	// construct the hash value.  The only defined value is 1 (SHA-1).
+	HashAlgorithm byte
+
+	// Flags contains 8 one-bit flags, only the Opt-Out flag is defined.
+	Flags byte
+
+	// Iterations defines the number of additional times the hash
+	// function has been performed.
+	Iterations uint16
+
+	// Salt is appended to the original owner name before hashing.
+	Salt []byte
+
+	// NextHashedOwner contains the next hashed owner name in hash order,
+	// in binary format.
+	NextHashedOwner []byte
+
+	// Types identifies the RRset types that exist at the original owner
+	// name of the NSEC3 RR.
+	Types []uint16
+}
+
+//
+// String return readable representation of NSEC3 record.
+//
+func (nsec3 *RDataNSEC3) String() string {
+	var b strings.Builder
+
+	salt := "-"
+	if len(nsec3.Salt) > 0 {
+		salt = strings.ToUpper(hex.EncodeToString(nsec3.Salt))
+	}
+
+	fmt.Fprintf(&b, "{HashAlgorithm:%d Flags:%d Iterations:%d Salt:%s"+
+		" NextHashedOwner:%s Types:%v}", nsec3.HashAlgorithm,
+		nsec3.Flags, nsec3.Iterations, salt,
+		base32HexNoPad.EncodeToString(nsec3.NextHashedOwner),
+		nsec3.Types)
+
+	return b.String()
+}
@@ -0,0 +1,49 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+//
+// RDataNSEC3PARAM define format of RDATA for NSEC3PARAM (RFC 5155 section
+// 4).  It contains the parameters used by authoritative server to compute
+// the hashed owner names of NSEC3 records.
+//
+type RDataNSEC3PARAM struct {
+	// HashAlgorithm identifies the cryptographic hash algorithm used to
+	// construct the hash value.  The only defined value is 1 (SHA-1).
+	HashAlgorithm byte
+
+	// Flags contains 8 one-bit flags.  All flags must be zero.
+	Flags byte
+
+	// Iterations defines the number of additional times the hash
+	// function has been performed.
+	Iterations uint16
+
+	// Salt is appended to the original owner name before hashing.
+	Salt []byte
+}
+
+//
+// String return readable representation of NSEC3PARAM record.
+//
+func (param *RDataNSEC3PARAM) String() string {
+	var b strings.Builder
+
+	salt := "-"
+	if len(param.Salt) > 0 {
+		salt = strings.ToUpper(hex.EncodeToString(param.Salt))
+	}
+
+	fmt.Fprintf(&b, "{HashAlgorithm:%d Flags:%d Iterations:%d Salt:%s}",
+		param.HashAlgorithm, param.Flags, param.Iterations, salt)
+
+	return b.String()
+}
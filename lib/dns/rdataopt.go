@@ -7,6 +7,8 @@ package dns
 import (
 	"fmt"
 	"strings"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
 )
 
 //
@@ -33,15 +35,127 @@ type RDataOPT struct {
 	// DNSSEC OK bit as defined by [RFC3225].
 	DO bool
 
-	// Assigned by the Expert Review process as defined by the DNSEXT
-	// working group and the IESG.
-	Code uint16
+	// Options contains list of EDNS options in the RDATA, in the same
+	// order as they are packed.
+	Options []EDNSOption
+}
+
+//
+// Option return the first option with specific code, or nil if no option
+// found.
+//
+func (opt *RDataOPT) Option(code uint16) *EDNSOption {
+	for x := range opt.Options {
+		if opt.Options[x].Code == code {
+			return &opt.Options[x]
+		}
+	}
+	return nil
+}
+
+//
+// SetOption set the data of first option with specific code, or add new
+// option if its not exist.
+//
+func (opt *RDataOPT) SetOption(code uint16, data []byte) {
+	o := opt.Option(code)
+	if o != nil {
+		o.Data = data
+		return
+	}
+	opt.Options = append(opt.Options, EDNSOption{
+		Code: code,
+		Data: data,
+	})
+}
+
+//
+// RemoveOption remove all options with specific code.
+//
+func (opt *RDataOPT) RemoveOption(code uint16) {
+	var kept []EDNSOption
+	for _, o := range opt.Options {
+		if o.Code != code {
+			kept = append(kept, o)
+		}
+	}
+	opt.Options = kept
+}
 
-	// Size (in octets) of OPTION-DATA.
-	Length uint16
+//
+// ClientSubnet return the client subnet option (RFC 7871), or nil if the
+// option does not exist.
+//
+func (opt *RDataOPT) ClientSubnet() (*EDNSClientSubnet, error) {
+	o := opt.Option(EDNSOptionClientSubnet)
+	if o == nil {
+		return nil, nil
+	}
+	return unpackEDNSClientSubnet(o.Data)
+}
 
-	// Varies per OPTION-CODE.  MUST be treated as a bit field.
-	Data []byte
+//
+// SetClientSubnet set the client subnet option (RFC 7871).
+//
+func (opt *RDataOPT) SetClientSubnet(ecs *EDNSClientSubnet) error {
+	data, err := ecs.pack()
+	if err != nil {
+		return err
+	}
+	opt.SetOption(EDNSOptionClientSubnet, data)
+	return nil
+}
+
+//
+// Cookie return the DNS cookie option (RFC 7873), or nil if the option
+// does not exist.
+//
+func (opt *RDataOPT) Cookie() (*EDNSCookie, error) {
+	o := opt.Option(EDNSOptionCookie)
+	if o == nil {
+		return nil, nil
+	}
+	return unpackEDNSCookie(o.Data)
+}
+
+//
+// SetCookie set the DNS cookie option (RFC 7873).
+//
+func (opt *RDataOPT) SetCookie(cookie *EDNSCookie) error {
+	data, err := cookie.pack()
+	if err != nil {
+		return err
+	}
+	opt.SetOption(EDNSOptionCookie, data)
+	return nil
+}
+
+//
+// ExtendedErrors return all extended DNS error options (RFC 8914).
+//
+func (opt *RDataOPT) ExtendedErrors() (edes []*EDNSExtendedError, err error) {
+	for _, o := range opt.Options {
+		if o.Code != EDNSOptionExtendedError {
+			continue
+		}
+		ede, err := unpackEDNSExtendedError(o.Data)
+		if err != nil {
+			return nil, err
+		}
+		edes = append(edes, ede)
+	}
+	return edes, nil
+}
+
+//
+// AddExtendedError add the extended DNS error option (RFC 8914).  The
+// option can be added more than once.
+//
+func (opt *RDataOPT) AddExtendedError(ede *EDNSExtendedError) {
+	opt.Options = append(opt.Options, EDNSOption{
+		Code: EDNSOptionExtendedError,
+		Data: ede.pack(),
+	})
 }
 
 //
@@ -50,9 +164,50 @@ type RDataOPT struct {
 func (opt *RDataOPT) String() string {
 	var b strings.Builder
 
-	fmt.Fprintf(&b, "{ExtRCode:%d Version:%d DO:%v Code:%d Length:%d Data:%s}",
-		opt.ExtRCode, opt.Version, opt.DO, opt.Code, opt.Length,
-		opt.Data)
+	fmt.Fprintf(&b, "{ExtRCode:%d Version:%d DO:%v Options:[",
+		opt.ExtRCode, opt.Version, opt.DO)
+	for x, o := range opt.Options {
+		if x > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "{Code:%d Length:%d}", o.Code, len(o.Data))
+	}
+	b.WriteString("]}")
 
 	return b.String()
 }
+
+//
+// pack the options into RDATA.
+//
+func (opt *RDataOPT) pack() (rdata []byte) {
+	for _, o := range opt.Options {
+		libbytes.AppendUint16(&rdata, o.Code)
+		libbytes.AppendUint16(&rdata, uint16(len(o.Data)))
+		rdata = append(rdata, o.Data...)
+	}
+	return rdata
+}
+
+//
+// unpack the options from RDATA.
+//
+func (opt *RDataOPT) unpack(rdata []byte) error {
+	for x := 0; x < len(rdata); {
+		if x+4 > len(rdata) {
+			return ErrRDataLength
+		}
+		code := libbytes.ReadUint16(rdata, uint(x))
+		n := int(libbytes.ReadUint16(rdata, uint(x+2)))
+		x += 4
+		if x+n > len(rdata) {
+			return ErrRDataLength
+		}
+		opt.Options = append(opt.Options, EDNSOption{
+			Code: code,
+			Data: append([]byte(nil), rdata[x:x+n]...),
+		})
+		x += n
+	}
+	return nil
+}
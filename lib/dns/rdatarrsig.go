@@ -0,0 +1,99 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// RDataRRSIG define format of RDATA for RRSIG (RFC 4034 section 3).
+//
+type RDataRRSIG struct {
+	// TypeCovered identifies the type of the RRset that is covered by
+	// this RRSIG record.
+	TypeCovered uint16
+
+	// Algorithm identifies the cryptographic algorithm used to create
+	// the signature.
+	Algorithm byte
+
+	// Labels specifies the number of labels in the original RRSIG RR
+	// owner name, not including the root and the wildcard label.
+	Labels byte
+
+	// OrigTTL specifies the TTL of the covered RRset as it appears in
+	// the authoritative zone.
+	OrigTTL uint32
+
+	// Expiration and Inception specify a validity period for the
+	// signature, in number of seconds since 1 January 1970 00:00:00 UTC,
+	// using serial number arithmetic.
+	Expiration uint32
+	Inception  uint32
+
+	// KeyTag contains the key tag value of the DNSKEY RR that validates
+	// this signature.
+	KeyTag uint16
+
+	// SignerName identifies the owner name of the DNSKEY RR that a
+	// validator is supposed to use to validate this signature.
+	SignerName []byte
+
+	// Signature that cover the RRSIG RDATA, excluding the Signature
+	// field, and the RRset.
+	Signature []byte
+}
+
+//
+// String return readable representation of RRSIG record.
+//
+func (sig *RDataRRSIG) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{TypeCovered:%d Algorithm:%d Labels:%d OrigTTL:%d"+
+		" Expiration:%d Inception:%d KeyTag:%d SignerName:%s"+
+		" Signature:%s}", sig.TypeCovered, sig.Algorithm, sig.Labels,
+		sig.OrigTTL, sig.Expiration, sig.Inception, sig.KeyTag,
+		sig.SignerName,
+		base64.StdEncoding.EncodeToString(sig.Signature))
+
+	return b.String()
+}
+
+//
+// pack the RRSIG RDATA fields, excluding the signer name and signature,
+// into wire format.
+//
+func (sig *RDataRRSIG) pack() []byte {
+	rdata := make([]byte, 0, 18)
+
+	libbytes.AppendUint16(&rdata, sig.TypeCovered)
+	rdata = append(rdata, sig.Algorithm, sig.Labels)
+	libbytes.AppendUint32(&rdata, sig.OrigTTL)
+	libbytes.AppendUint32(&rdata, sig.Expiration)
+	libbytes.AppendUint32(&rdata, sig.Inception)
+	libbytes.AppendUint16(&rdata, sig.KeyTag)
+
+	return rdata
+}
+
+//
+// unpack the RRSIG RDATA fields, excluding the signer name and signature,
+// from wire format.
+//
+func (sig *RDataRRSIG) unpack(rdata []byte) {
+	sig.TypeCovered = libbytes.ReadUint16(rdata, 0)
+	sig.Algorithm = rdata[2]
+	sig.Labels = rdata[3]
+	sig.OrigTTL = libbytes.ReadUint32(rdata, 4)
+	sig.Expiration = libbytes.ReadUint32(rdata, 8)
+	sig.Inception = libbytes.ReadUint32(rdata, 12)
+	sig.KeyTag = libbytes.ReadUint16(rdata, 16)
+}
@@ -0,0 +1,42 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+//
+// RDataSSHFP define format of RDATA for SSHFP (RFC 4255 section 3.1).  It
+// contains the fingerprint of SSH public host key that is associated with
+// the domain name.
+//
+type RDataSSHFP struct {
+	// Algorithm of the public key: 1 for RSA, 2 for DSA, 3 for ECDSA,
+	// and 4 for Ed25519.
+	Algorithm byte
+
+	// FPType is the message digest algorithm used to calculate the
+	// fingerprint: 1 for SHA-1 and 2 for SHA-256.
+	FPType byte
+
+	// Fingerprint of the public key.
+	Fingerprint []byte
+}
+
+//
+// String return readable representation of SSHFP record.
+//
+func (sshfp *RDataSSHFP) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Algorithm:%d FPType:%d Fingerprint:%s}",
+		sshfp.Algorithm, sshfp.FPType,
+		strings.ToUpper(hex.EncodeToString(sshfp.Fingerprint)))
+
+	return b.String()
+}
@@ -0,0 +1,321 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// List of known SVCB service parameter keys (RFC 9460 section 14.3.2).
+//
+const (
+	SVCBKeyMandatory     uint16 = iota // Mandatory keys in this RR
+	SVCBKeyALPN                        // Additional supported protocols
+	SVCBKeyNoDefaultALPN               // No support for default protocol
+	SVCBKeyPort                        // Port for alternative endpoint
+	SVCBKeyIPv4Hint                    // IPv4 address hints
+	SVCBKeyECH                         // Encrypted ClientHello config
+	SVCBKeyIPv6Hint                    // IPv6 address hints
+)
+
+var svcbKeyNames = map[uint16]string{
+	SVCBKeyMandatory:     "mandatory",
+	SVCBKeyALPN:          "alpn",
+	SVCBKeyNoDefaultALPN: "no-default-alpn",
+	SVCBKeyPort:          "port",
+	SVCBKeyIPv4Hint:      "ipv4hint",
+	SVCBKeyECH:           "ech",
+	SVCBKeyIPv6Hint:      "ipv6hint",
+}
+
+//
+// SVCBParam contains the key and value of SVCB service parameter.  The
+// Value is stored in wire format.
+//
+type SVCBParam struct {
+	Key   uint16
+	Value []byte
+}
+
+//
+// RDataSVCB define format of RDATA for SVCB and HTTPS (RFC 9460 section
+// 2.2).  It provide the information needed to connect to the alternative
+// endpoint of service.
+//
+type RDataSVCB struct {
+	// Priority of the record.  Zero value indicates the AliasMode,
+	// while other values indicate the ServiceMode.
+	Priority uint16
+
+	// Target is the domain name of alternative endpoint.  An empty
+	// Target mean the root domain ".", which refer to owner name in
+	// ServiceMode.
+	Target []byte
+
+	// Params contains list of service parameters, ordered by key.
+	Params []SVCBParam
+}
+
+//
+// Param return the value of service parameter in wire format, and true if
+// the key exist.
+//
+func (svcb *RDataSVCB) Param(key uint16) ([]byte, bool) {
+	for _, p := range svcb.Params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+//
+// String return readable representation of SVCB or HTTPS record.
+//
+func (svcb *RDataSVCB) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Priority:%d Target:%s Params:[", svcb.Priority,
+		svcb.Target)
+	for x, p := range svcb.Params {
+		if x > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.String())
+	}
+	b.WriteString("]}")
+
+	return b.String()
+}
+
+//
+// packParams return the service parameters in wire format.
+//
+func (svcb *RDataSVCB) packParams() (b []byte) {
+	for _, p := range svcb.Params {
+		libbytes.AppendUint16(&b, p.Key)
+		libbytes.AppendUint16(&b, uint16(len(p.Value)))
+		b = append(b, p.Value...)
+	}
+	return b
+}
+
+//
+// unpackParams unpack the service parameters from wire format.
+//
+func (svcb *RDataSVCB) unpackParams(b []byte) error {
+	for x := 0; x < len(b); {
+		if x+4 > len(b) {
+			return ErrRDataLength
+		}
+		key := libbytes.ReadUint16(b, uint(x))
+		n := int(libbytes.ReadUint16(b, uint(x+2)))
+		x += 4
+		if x+n > len(b) {
+			return ErrRDataLength
+		}
+		svcb.Params = append(svcb.Params, SVCBParam{
+			Key:   key,
+			Value: append([]byte(nil), b[x:x+n]...),
+		})
+		x += n
+	}
+	return nil
+}
+
+//
+// String return the service parameter in presentation format, "key=value".
+//
+func (p SVCBParam) String() string {
+	name := svcbKeyName(p.Key)
+
+	var values []string
+
+	switch p.Key {
+	case SVCBKeyMandatory:
+		for x := 0; x+1 < len(p.Value); x += 2 {
+			key := libbytes.ReadUint16(p.Value, uint(x))
+			values = append(values, svcbKeyName(key))
+		}
+
+	case SVCBKeyALPN:
+		for x := 0; x < len(p.Value); {
+			n := int(p.Value[x])
+			x++
+			if x+n > len(p.Value) {
+				break
+			}
+			values = append(values, string(p.Value[x:x+n]))
+			x += n
+		}
+
+	case SVCBKeyNoDefaultALPN:
+		return name
+
+	case SVCBKeyPort:
+		if len(p.Value) == 2 {
+			values = append(values, strconv.Itoa(int(
+				libbytes.ReadUint16(p.Value, 0))))
+		}
+
+	case SVCBKeyIPv4Hint:
+		for x := 0; x+rdataIPv4Size <= len(p.Value); x += rdataIPv4Size {
+			values = append(values,
+				net.IP(p.Value[x:x+rdataIPv4Size]).String())
+		}
+
+	case SVCBKeyIPv6Hint:
+		for x := 0; x+rdataIPv6Size <= len(p.Value); x += rdataIPv6Size {
+			values = append(values,
+				net.IP(p.Value[x:x+rdataIPv6Size]).String())
+		}
+
+	case SVCBKeyECH:
+		values = append(values, base64.StdEncoding.EncodeToString(p.Value))
+
+	default:
+		return name + "=" + svcbEscape(p.Value)
+	}
+
+	return name + "=" + strings.Join(values, ",")
+}
+
+//
+// parseSVCBParam parse the service parameter in presentation format,
+// "key=value" or "key".
+//
+func parseSVCBParam(tok string) (p SVCBParam, err error) {
+	name, value := tok, ""
+	x := strings.IndexByte(tok, '=')
+	if x >= 0 {
+		name, value = tok[:x], tok[x+1:]
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+
+	p.Key, err = svcbKey(strings.ToLower(name))
+	if err != nil {
+		return p, err
+	}
+
+	switch p.Key {
+	case SVCBKeyMandatory:
+		for _, v := range strings.Split(value, ",") {
+			key, err := svcbKey(strings.ToLower(v))
+			if err != nil {
+				return p, err
+			}
+			libbytes.AppendUint16(&p.Value, key)
+		}
+
+	case SVCBKeyALPN:
+		for _, v := range strings.Split(value, ",") {
+			if len(v) == 0 || len(v) > 255 {
+				return p, fmt.Errorf("invalid alpn %q", value)
+			}
+			p.Value = append(p.Value, byte(len(v)))
+			p.Value = append(p.Value, v...)
+		}
+
+	case SVCBKeyNoDefaultALPN:
+		if len(value) > 0 {
+			return p, fmt.Errorf("%s must not have value", name)
+		}
+
+	case SVCBKeyPort:
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return p, fmt.Errorf("invalid port %q", value)
+		}
+		libbytes.AppendUint16(&p.Value, uint16(port))
+
+	case SVCBKeyIPv4Hint:
+		for _, v := range strings.Split(value, ",") {
+			ip := net.ParseIP(v).To4()
+			if ip == nil {
+				return p, fmt.Errorf("invalid ipv4hint %q", v)
+			}
+			p.Value = append(p.Value, ip...)
+		}
+
+	case SVCBKeyIPv6Hint:
+		for _, v := range strings.Split(value, ",") {
+			ip := net.ParseIP(v)
+			if ip == nil || ip.To4() != nil {
+				return p, fmt.Errorf("invalid ipv6hint %q", v)
+			}
+			p.Value = append(p.Value, ip...)
+		}
+
+	case SVCBKeyECH:
+		p.Value, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid ech: %s", err)
+		}
+
+	default:
+		p.Value = unescapeText([]byte(value))
+	}
+
+	return p, nil
+}
+
+//
+// svcbKeyName return the name of service parameter key, or "keyNNNNN" if
+// the key is unknown.
+//
+func svcbKeyName(key uint16) string {
+	name, ok := svcbKeyNames[key]
+	if ok {
+		return name
+	}
+	return "key" + strconv.Itoa(int(key))
+}
+
+//
+// svcbKey return the service parameter key from its name.
+//
+func svcbKey(name string) (uint16, error) {
+	for k, v := range svcbKeyNames {
+		if v == name {
+			return k, nil
+		}
+	}
+	if strings.HasPrefix(name, "key") {
+		key, err := strconv.ParseUint(name[3:], 10, 16)
+		if err == nil {
+			return uint16(key), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown SVCB key %q", name)
+}
+
+//
+// svcbEscape return the value with non-printable and special characters
+// escaped as "\DDD", so it can be written without quotes.
+//
+func svcbEscape(value []byte) string {
+	var b strings.Builder
+
+	for _, c := range value {
+		switch {
+		case c <= ' ' || c > '~' || c == '"' || c == '\\' ||
+			c == ';' || c == '(' || c == ')':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
@@ -10,9 +10,35 @@ package dns
 //
 type RDataText struct {
 	Value []byte
+
+	// Texts contains the character-strings of TXT RDATA, in the same
+	// order as in the packet or master file.  The Value of TXT record
+	// is the concatenation of Texts.
+	// If Texts is empty, the Value is packed as one or more
+	// character-strings, each with maximum 255 octets.
+	Texts [][]byte
 }
 
 // String return string representation of RDATA.
 func (text *RDataText) String() string {
 	return string(text.Value)
 }
+
+//
+// charStrings return the character-strings of TXT RDATA.  Each text longer
+// than 255 octets is splitted into several character-strings.
+//
+func (text *RDataText) charStrings() (out [][]byte) {
+	texts := text.Texts
+	if len(texts) == 0 {
+		texts = [][]byte{text.Value}
+	}
+	for _, s := range texts {
+		for len(s) > maxCharStringSize {
+			out = append(out, s[:maxCharStringSize])
+			s = s[maxCharStringSize:]
+		}
+		out = append(out, s)
+	}
+	return out
+}
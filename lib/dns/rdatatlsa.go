@@ -0,0 +1,49 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+//
+// RDataTLSA define format of RDATA for TLSA (RFC 6698 section 2.1).  It
+// associates the TLS server certificate or public key with the domain
+// name where the record is found.
+//
+type RDataTLSA struct {
+	// Usage specifies the provided association that will be used to
+	// match the certificate presented in the TLS handshake, for
+	// example 3 for domain-issued certificate (DANE-EE).
+	Usage byte
+
+	// Selector specifies which part of the certificate presented by
+	// the server will be matched: 0 for full certificate, 1 for
+	// SubjectPublicKeyInfo.
+	Selector byte
+
+	// MatchingType specifies how the certificate association is
+	// presented: 0 for exact match, 1 for SHA-256 hash, 2 for SHA-512
+	// hash.
+	MatchingType byte
+
+	// CertData is the certificate association data to be matched.
+	CertData []byte
+}
+
+//
+// String return readable representation of TLSA record.
+//
+func (tlsa *RDataTLSA) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Usage:%d Selector:%d MatchingType:%d CertData:%s}",
+		tlsa.Usage, tlsa.Selector, tlsa.MatchingType,
+		strings.ToUpper(hex.EncodeToString(tlsa.CertData)))
+
+	return b.String()
+}
@@ -0,0 +1,119 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// RDataTSIG define format of RDATA for TSIG meta-RR (RFC 8945 section
+// 4.2).
+//
+type RDataTSIG struct {
+	// Algorithm is the name of the MAC algorithm, in domain name form,
+	// for example "hmac-sha256".
+	Algorithm []byte
+
+	// TimeSigned is the 48 bits unsigned integer of seconds since
+	// 1 January 1970 00:00:00 UTC when the message is signed.
+	TimeSigned uint64
+
+	// Fudge is the number of seconds of error permitted in TimeSigned.
+	Fudge uint16
+
+	// MAC is the message authentication code.
+	MAC []byte
+
+	// OrigID is the original message ID.
+	OrigID uint16
+
+	// Error contains the extended RCODE covering TSIG processing.
+	Error uint16
+
+	// Other contains the server time when Error is BADTIME, or empty.
+	Other []byte
+}
+
+//
+// String return readable representation of TSIG record.
+//
+func (tsig *RDataTSIG) String() string {
+	return fmt.Sprintf("{Algorithm:%s TimeSigned:%d Fudge:%d MAC:%s"+
+		" OrigID:%d Error:%d Other:%x}", tsig.Algorithm,
+		tsig.TimeSigned, tsig.Fudge,
+		base64.StdEncoding.EncodeToString(tsig.MAC), tsig.OrigID,
+		tsig.Error, tsig.Other)
+}
+
+//
+// pack the TSIG RDATA into wire format.  The algorithm name is not
+// compressed.
+//
+func (tsig *RDataTSIG) pack() (rdata []byte) {
+	rdata = packCanonicalName(tsig.Algorithm)
+	rdata = appendUint48(rdata, tsig.TimeSigned)
+	libbytes.AppendUint16(&rdata, tsig.Fudge)
+	libbytes.AppendUint16(&rdata, uint16(len(tsig.MAC)))
+	rdata = append(rdata, tsig.MAC...)
+	libbytes.AppendUint16(&rdata, tsig.OrigID)
+	libbytes.AppendUint16(&rdata, tsig.Error)
+	libbytes.AppendUint16(&rdata, uint16(len(tsig.Other)))
+	rdata = append(rdata, tsig.Other...)
+
+	return rdata
+}
+
+//
+// unpack the TSIG RDATA fields, excluding the algorithm name, from wire
+// format.
+//
+func (tsig *RDataTSIG) unpack(rdata []byte) error {
+	if len(rdata) < 10 {
+		return ErrRDataLength
+	}
+
+	tsig.TimeSigned = readUint48(rdata, 0)
+	tsig.Fudge = libbytes.ReadUint16(rdata, 6)
+
+	x := 10 + uint(libbytes.ReadUint16(rdata, 8))
+	if uint(len(rdata)) < x+6 {
+		return ErrRDataLength
+	}
+	tsig.MAC = append(tsig.MAC[:0], rdata[10:x]...)
+
+	tsig.OrigID = libbytes.ReadUint16(rdata, x)
+	tsig.Error = libbytes.ReadUint16(rdata, x+2)
+
+	n := uint(libbytes.ReadUint16(rdata, x+4))
+	x += 6
+	if uint(len(rdata)) != x+n {
+		return ErrRDataLength
+	}
+	tsig.Other = append(tsig.Other[:0], rdata[x:]...)
+
+	return nil
+}
+
+//
+// appendUint48 append the lower 48 bits of v into b in big endian order.
+//
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16),
+		byte(v>>8), byte(v))
+}
+
+//
+// readUint48 read 48 bits unsigned integer from b start at index x.
+//
+func readUint48(b []byte, x int) (v uint64) {
+	for _, c := range b[x : x+6] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
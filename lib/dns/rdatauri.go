@@ -0,0 +1,39 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+//
+// RDataURI define format of RDATA for URI (RFC 7553 section 4.5).  It
+// publish the mapping from domain name to URI.
+//
+type RDataURI struct {
+	// Priority of the target URI.  Client must attempt to contact the
+	// target with the lowest priority first.
+	Priority uint16
+
+	// Weight define the relative weight for records with the same
+	// priority.
+	Weight uint16
+
+	// Target is the URI, for example "https://www.example.com/".
+	Target []byte
+}
+
+//
+// String return readable representation of URI record.
+//
+func (uri *RDataURI) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{Priority:%d Weight:%d Target:%s}", uri.Priority,
+		uri.Weight, uri.Target)
+
+	return b.String()
+}
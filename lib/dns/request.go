@@ -5,8 +5,10 @@
 package dns
 
 import (
+	"log"
 	"net"
 	"net/http"
+	"time"
 )
 
 // List of known connection type.
@@ -14,19 +16,22 @@ const (
 	ConnTypeUDP = 1
 	ConnTypeTCP = 2
 	ConnTypeDoH = 4
+	ConnTypeDoT = 8
 )
 
 //
 // Request contains UDP address and DNS query message from client.
 //
 // If Kind is UDP, Sender and UDPAddr must be non nil.
-// If Kind is TCP, Sender must be non nil.
+// If Kind is TCP or DoT, Sender must be non nil.
 // If Kind is DoH, both Sender and UDPAddr must be nil and ResponseWriter and
 // ChanResponded must be non nil and initialized.
 //
+// The response to request should be sent using Respond.
+//
 type Request struct {
 	// Kind define the connection type that this request is belong to,
-	// e.g. UDP, TCP, or DoH.
+	// e.g. UDP, TCP, DoH, or DoT.
 	Kind int
 
 	// Message define the DNS query.
@@ -35,6 +40,10 @@ type Request struct {
 	// UDPAddr is address of client if connection is from UDP.
 	UDPAddr *net.UDPAddr
 
+	// TCPAddr is address of client if connection is from TCP, DoT, or
+	// DoH.
+	TCPAddr *net.TCPAddr
+
 	// Sender is server connection that receive the query and responsible
 	// to answer back to client.
 	Sender Sender
@@ -46,6 +55,20 @@ type Request struct {
 	// ChanResponded is a channel that notify the DoH handler when answer
 	// has been written to ResponseWriter.
 	ChanResponded chan bool
+
+	// limiter limit the response to UDP client, if its not nil.
+	limiter *RateLimiter
+
+	// observer receive the event when the response is sent, if its not
+	// nil.
+	observer Observer
+
+	// start contains the time when the request is received.
+	start time.Time
+
+	// done is called when request is released back to the pool, to
+	// notify the server that the request has been answered.
+	done func()
 }
 
 //
@@ -63,6 +86,216 @@ func NewRequest() *Request {
 func (req *Request) Reset() {
 	req.Message.Reset()
 	req.UDPAddr = nil
+	req.TCPAddr = nil
 	req.Sender = nil
 	req.ResponseWriter = nil
+	req.limiter = nil
+	req.observer = nil
+}
+
+//
+// Respond send the response message back to the client based on the
+// connection type of request and release the request back to the pool.
+// The response message must already been packed, using Pack().
+//
+// Before the response is sent, the server observer is notified, the
+// response to UDP client is limited by server rate limiter and truncated
+// if its larger than the UDP payload size of client, and the response to
+// DoH client is padded.  The handler should use Respond instead of sending
+// the response using Sender or ResponseWriter directly.
+//
+// For DoH, the request is released by the server after the handler notify
+// the ChanResponded.
+//
+func (req *Request) Respond(res *Message) {
+	var err error
+
+	req.observe(res)
+
+	switch req.Kind {
+	case ConnTypeUDP:
+		res = req.limit(res)
+		if req.Sender != nil && res != nil {
+			_, err = req.Sender.Send(req.truncate(res), req.UDPAddr)
+			if err != nil {
+				log.Println("dns: Request.Respond: ", err)
+			}
+		}
+		FreeRequest(req)
+
+	case ConnTypeTCP, ConnTypeDoT:
+		if req.Sender != nil {
+			_, err = req.Sender.Send(res, nil)
+			if err != nil {
+				log.Println("dns: Request.Respond: ", err)
+			}
+		}
+		FreeRequest(req)
+
+	case ConnTypeDoH:
+		if req.ResponseWriter != nil {
+			_, err = req.ResponseWriter.Write(req.padResponse(res))
+			if err != nil {
+				log.Println("dns: Request.Respond: ", err)
+			}
+			req.ChanResponded <- true
+		}
+
+	default:
+		FreeRequest(req)
+	}
+}
+
+//
+// observe notify the observer that the request has been answered.
+//
+func (req *Request) observe(res *Message) {
+	if req.observer == nil {
+		return
+	}
+
+	ev := &QueryEvent{
+		Kind:    req.Kind,
+		QName:   string(req.Message.Question.Name),
+		QType:   req.Message.Question.Type,
+		RCode:   res.Header.RCode,
+		Latency: time.Since(req.start),
+	}
+	if req.UDPAddr != nil {
+		ev.RemoteAddr = req.UDPAddr.String()
+	} else if req.TCPAddr != nil {
+		ev.RemoteAddr = req.TCPAddr.String()
+	}
+
+	req.observer.Observe(ev)
+}
+
+//
+// limit return the response as is if its does not exceed the response rate
+// limit, nil if its should be dropped, or the new truncated response if its
+// should be slipped.
+//
+func (req *Request) limit(res *Message) *Message {
+	if req.limiter == nil || req.UDPAddr == nil {
+		return res
+	}
+
+	// The name error is limited based on the SOA in authority section,
+	// which is not unpacked if the response is sent from packet, for
+	// example by Resolver.
+	keyed := res
+	if res.Header.RCode == RCodeErrName && len(res.Authority) == 0 &&
+		res.Header.NSCount > 0 {
+		keyed = NewMessage()
+		keyed.Packet = append(keyed.Packet[:0], res.Packet...)
+		if keyed.Unpack() != nil {
+			keyed = res
+		}
+	}
+
+	switch req.limiter.limitResponse(req.UDPAddr.IP, keyed) {
+	case rateLimitDrop:
+		return nil
+	case rateLimitSlip:
+		tc := newResponse(req.Message, res.Header.RCode)
+		tc.Header.IsTC = true
+		_, err := tc.Pack()
+		if err != nil {
+			return nil
+		}
+		return tc
+	}
+
+	return res
+}
+
+//
+// maxUDPSize return the maximum size of UDP response that the client can
+// receive: the requestor's UDP payload size in OPT pseudo-RR, or 512 if
+// the query does not support EDNS (RFC 6891 section 6.2.5).
+//
+func (req *Request) maxUDPSize() int {
+	size := 512
+
+	if req.Message == nil || req.Message.EDNS() == nil {
+		return size
+	}
+
+	for _, rr := range req.Message.Additional {
+		if rr.Type == QueryTypeOPT && int(rr.Class) > size {
+			size = int(rr.Class)
+			break
+		}
+	}
+	if size > maxUDPPacketSize {
+		size = maxUDPPacketSize
+	}
+
+	return size
+}
+
+//
+// truncate return the response as is if its fit in UDP response size of
+// client.  Otherwise, it will return the new response with TC bit set,
+// that contains only the header, the question, and the OPT pseudo-RR, so
+// the client can retry the query using TCP (RFC 2181 section 9 and RFC
+// 7766 section 5).  The response message is not modified, since it may be
+// shared with the caches.
+//
+func (req *Request) truncate(res *Message) *Message {
+	size := req.maxUDPSize()
+	if len(res.Packet) <= size {
+		return res
+	}
+
+	tc := NewMessage()
+	tc.Packet = append(tc.Packet[:0], res.Packet...)
+
+	err := tc.Unpack()
+	if err != nil {
+		tc = newResponse(req.Message, res.Header.RCode)
+	}
+
+	opt := tc.EDNS()
+
+	tc.Header.IsTC = true
+	tc.Answer = nil
+	tc.Authority = nil
+	tc.Additional = nil
+	if opt != nil {
+		tc.SetEDNS(uint16(size), opt.DO)
+	}
+
+	_, err = tc.Pack()
+	if err != nil {
+		return res
+	}
+
+	return tc
+}
+
+//
+// padResponse return the packet of response padded with EDNS padding
+// option (RFC 8467 section 4.1), if the query support EDNS.  The response
+// message is not modified, since it may be shared with the caches.
+//
+func (req *Request) padResponse(res *Message) []byte {
+	if req.Message == nil || req.Message.EDNS() == nil {
+		return res.Packet
+	}
+
+	padded := NewMessage()
+	padded.Packet = append(padded.Packet[:0], res.Packet...)
+
+	err := padded.Unpack()
+	if err != nil {
+		return res.Packet
+	}
+
+	err = padded.Pad(EDNSPaddingBlockSize)
+	if err != nil {
+		return res.Packet
+	}
+
+	return padded.Packet
 }
@@ -0,0 +1,171 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// newTestBigZone create zone "big.test" with many A records on the same
+// name, so its response does not fit in 512 bytes.
+//
+func newTestBigZone(t *testing.T) *Zone {
+	var sb strings.Builder
+
+	sb.WriteString("big.test. 3600 IN SOA ns.big.test. admin.big.test. 1 3600 600 86400 300\n")
+	for x := 1; x <= 60; x++ {
+		fmt.Fprintf(&sb, "big.test. 3600 IN A 10.0.0.%d\n", x)
+	}
+
+	return newTestZone(t, sb.String())
+}
+
+func TestRequestTruncate(t *testing.T) {
+	zh := NewZoneHandler()
+	zh.AddZone(newTestBigZone(t))
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc      string
+		udpSize   uint16
+		expTC     bool
+		expAnswer int
+	}{{
+		desc:  "Without EDNS",
+		expTC: true,
+	}, {
+		desc:    "With EDNS small UDP size",
+		udpSize: 512,
+		expTC:   true,
+	}, {
+		desc:      "With EDNS large UDP size",
+		udpSize:   4096,
+		expAnswer: 60,
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		q := NewMessage()
+		q.Header.ID = uint16(100 + x)
+		q.Question.Name = []byte("big.test")
+		if c.udpSize > 0 {
+			q.SetEDNS(c.udpSize, false)
+		}
+
+		_, err := q.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := AllocRequest()
+		req.Kind = ConnTypeUDP
+		req.Sender = sender
+		req.Message.Packet = append(req.Message.Packet[:0], q.Packet...)
+		req.Message.UnpackHeaderQuestion()
+
+		zh.ServeDNS(req)
+		res := <-sender.C
+
+		test.Assert(t, "ID", q.Header.ID, res.Header.ID, true)
+		test.Assert(t, "RCode", RCodeOK, res.Header.RCode, true)
+		test.Assert(t, "IsTC", c.expTC, res.Header.IsTC, true)
+		test.Assert(t, "Answer", c.expAnswer, len(res.Answer), true)
+	}
+
+	// The response through TCP is never truncated.
+	req := newTestRequest(sender, 200, "big.test")
+	req.Kind = ConnTypeTCP
+
+	zh.ServeDNS(req)
+	res := <-sender.C
+
+	test.Assert(t, "IsTC", false, res.Header.IsTC, true)
+	test.Assert(t, "Answer", 60, len(res.Answer), true)
+}
+
+func TestRequestPadResponse(t *testing.T) {
+	cases := []struct {
+		desc      string
+		edns      bool
+		opt       []byte
+		expPadded bool
+	}{{
+		desc: "Without EDNS",
+	}, {
+		desc:      "With EDNS",
+		edns:      true,
+		expPadded: true,
+	}, {
+		desc: "With OPT name pointer to itself",
+		opt:  []byte{0xc0, 0x00, 0x00, 0x29},
+	}, {
+		desc: "With short OPT",
+		opt:  []byte{0x00, 0x00, 0x29, 0x10},
+	}, {
+		desc: "With OPT RDLENGTH beyond packet",
+		opt:  []byte{0x00, 0x00, 0x29, 0x10, 0x00, 0, 0, 0, 0, 0x00, 0x08, 0x00},
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		q := NewMessage()
+		q.Header.ID = uint16(300 + x)
+		q.Question.Name = []byte("www.test")
+		if c.edns {
+			q.SetEDNS(4096, false)
+		}
+
+		_, err := q.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := AllocRequest()
+		req.Kind = ConnTypeDoH
+		req.Message.Packet = append(req.Message.Packet[:0], q.Packet...)
+		if len(c.opt) > 0 {
+			req.Message.Packet[11] = 1
+			if c.opt[0] == 0xc0 {
+				c.opt[1] = byte(len(req.Message.Packet))
+			}
+			req.Message.Packet = append(req.Message.Packet, c.opt...)
+		}
+		req.Message.UnpackHeaderQuestion()
+
+		rec := httptest.NewRecorder()
+		req.ResponseWriter = rec
+		req.ChanResponded = make(chan bool, 1)
+
+		res := newResponse(req.Message, RCodeOK)
+		res.Answer = append(res.Answer, newTestA("www.test", "10.0.0.1"))
+		_, err = res.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Respond(res)
+		<-req.ChanResponded
+		FreeRequest(req)
+
+		got := rec.Body.Bytes()
+		if !c.expPadded {
+			test.Assert(t, "Packet", res.Packet, got, true)
+			continue
+		}
+
+		test.Assert(t, "padded size", 0, len(got)%EDNSPaddingBlockSize, true)
+	}
+}
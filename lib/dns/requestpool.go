@@ -25,6 +25,10 @@ func AllocRequest() *Request {
 // FreeRequest put the request back to the pool.
 //
 func FreeRequest(req *Request) {
+	if req.done != nil {
+		req.done()
+		req.done = nil
+	}
 	if req.ChanResponded != nil {
 		close(req.ChanResponded)
 		req.ChanResponded = nil
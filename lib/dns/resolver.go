@@ -0,0 +1,352 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// Resolver is a Handler that answer the query from its cache or, when the
+// answer is not in cache, by forwarding the query to the upstream name
+// servers.  Each upstream is tried in order until one of them return a
+// response.
+//
+// The answer from upstream is cached using the question as the key and
+// expired based on the TTL of resource records in answer.
+//
+// Multiple queries with the same question that arrive while the answer is
+// being forwarded are coalesced, only one query is sent to upstream and the
+// response is shared by all of them.
+//
+// If the validator is set, the response from upstream is validated before
+// being cached.  Secure response is sent with AD bit set and bogus response
+// is replaced with server failure.
+//
+// Resolver that created using NewIterativeResolver does not have upstream;
+// instead, it walk the delegation from root name servers.  The address of
+// name servers in each zone cut that has been walked is cached, and shared
+// by all queries.
+//
+type Resolver struct {
+	upstreams []*resolverUpstream
+	cache     *cache
+	validator *Validator
+
+	// roots contains the address of root name servers for iterative
+	// resolution.
+	roots       []*net.UDPAddr
+	delegations *delegationCache
+
+	// nsPort define the port of name servers that found in referral.
+	nsPort int
+
+	callsLock sync.Mutex
+	calls     map[string]*resolverCall
+}
+
+//
+// resolverUpstream wrap the upstream client with lock, because client
+// connection can only be used by one query at a time.
+//
+type resolverUpstream struct {
+	sync.Mutex
+	cl Client
+}
+
+//
+// resolverCall represent an in-flight query to upstream.
+//
+type resolverCall struct {
+	wg     sync.WaitGroup
+	packet []byte
+	err    error
+}
+
+//
+// NewResolver create and initialize new resolver that forward the query to
+// one of upstream clients.
+//
+func NewResolver(upstreams ...Client) *Resolver {
+	rs := &Resolver{
+		cache: newCache(),
+		calls: make(map[string]*resolverCall),
+	}
+
+	for _, cl := range upstreams {
+		rs.upstreams = append(rs.upstreams, &resolverUpstream{
+			cl: cl,
+		})
+	}
+
+	return rs
+}
+
+//
+// SetValidator set the DNSSEC validator for response from upstream.  If the
+// validator Lookup function is nil, it will be set to query the upstream.
+//
+func (rs *Resolver) SetValidator(v *Validator) {
+	if v != nil && v.Lookup == nil {
+		v.Lookup = rs.lookup
+	}
+	rs.validator = v
+}
+
+//
+// SaveCache write the snapshot of cache into file, so it can be loaded
+// later using LoadCache, for example when the resolver is restarted.  The
+// file is written into temporary file first and then renamed, so the
+// previous snapshot is kept if writing is failed.  It will return the
+// number of answers that has been written.
+//
+func (rs *Resolver) SaveCache(file string) (n int, err error) {
+	tmp := file + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = rs.cache.write(f)
+
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+//
+// LoadCache load the snapshot of cache from file that has been written by
+// SaveCache.  The answers that has been expired since the snapshot was
+// written are discarded, and the TTL of other answers are subtracted by
+// the elapsed time.  It will return the number of answers that has been
+// loaded.
+//
+func (rs *Resolver) LoadCache(file string) (n int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = rs.cache.read(f)
+
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+//
+// ServeDNS answer the request from cache; if its not exist or expired, it
+// will forward the request to upstream in another goroutine.
+//
+func (rs *Resolver) ServeDNS(req *Request) {
+	key := req.Message.Question.key()
+
+	packet := rs.cache.get(key)
+	if packet != nil {
+		rs.sendPacket(req, packet)
+		return
+	}
+
+	go rs.forward(req, key)
+}
+
+//
+// forward the request to upstream and send the response back to client.
+// If all upstream fail, it will response with server failure.
+//
+func (rs *Resolver) forward(req *Request, key string) {
+	packet, err := rs.resolve(req.Message.Question, key)
+	if err != nil {
+		res := newResponse(req.Message, RCodeErrServer)
+		res.Header.IsRA = true
+
+		_, err = res.Pack()
+		if err != nil {
+			FreeRequest(req)
+			return
+		}
+
+		req.Respond(res)
+		return
+	}
+
+	rs.sendPacket(req, packet)
+}
+
+//
+// sendPacket copy the packet, set its ID based on request ID, and send it
+// to the client.  Only the header and question of packet are unpacked, for
+// the observer and the rate limiter.
+//
+func (rs *Resolver) sendPacket(req *Request, packet []byte) {
+	res := NewMessage()
+	res.Packet = append(res.Packet[:0], packet...)
+
+	libbytes.WriteUint16(&res.Packet, 0, req.Message.Header.ID)
+
+	res.UnpackHeaderQuestion()
+
+	req.Respond(res)
+}
+
+//
+// resolve the question by forwarding it to upstream.  If the same question
+// is being forwarded by other goroutine, it will wait and return the result
+// of that goroutine.  The returned packet must not be modified.
+//
+func (rs *Resolver) resolve(q *SectionQuestion, key string) ([]byte, error) {
+	rs.callsLock.Lock()
+	call, ok := rs.calls[key]
+	if ok {
+		rs.callsLock.Unlock()
+		call.wg.Wait()
+		return call.packet, call.err
+	}
+
+	call = &resolverCall{}
+	call.wg.Add(1)
+	rs.calls[key] = call
+	rs.callsLock.Unlock()
+
+	res, err := rs.query(q)
+	if err == nil && rs.validator != nil {
+		err = rs.validate(res)
+	}
+	if err != nil {
+		call.err = err
+	} else {
+		call.packet = make([]byte, len(res.Packet))
+		copy(call.packet, res.Packet)
+		rs.cache.upsert(key, res)
+	}
+
+	rs.callsLock.Lock()
+	delete(rs.calls, key)
+	rs.callsLock.Unlock()
+
+	call.wg.Done()
+
+	return call.packet, call.err
+}
+
+//
+// validate the response using validator.  If the response is secure, the AD
+// bit in response will be set.
+//
+func (rs *Resolver) validate(res *Message) error {
+	isSecure, err := rs.validator.Validate(res)
+	if err != nil {
+		return err
+	}
+	if isSecure {
+		res.Header.IsAD = true
+		res.Packet[3] |= headerIsAD
+	}
+	return nil
+}
+
+//
+// lookup query the name with specific type to upstream, without cache.
+//
+func (rs *Resolver) lookup(qname []byte, qtype uint16) (*Message, error) {
+	q := &SectionQuestion{
+		Name:  qname,
+		Type:  qtype,
+		Class: QueryClassIN,
+	}
+	return rs.query(q)
+}
+
+//
+// query send the question to each of upstream until one of them return a
+// valid response.  If the resolver is iterative, the question will be
+// resolved by walking the delegation.
+//
+func (rs *Resolver) query(q *SectionQuestion) (res *Message, err error) {
+	if len(rs.roots) > 0 {
+		return rs.walk(q, 0)
+	}
+	if len(rs.upstreams) == 0 {
+		return nil, fmt.Errorf("dns: resolver: no upstream")
+	}
+
+	msg := NewMessage()
+
+	msg.Header.ID = getNextID()
+	msg.Question.Name = append(msg.Question.Name, q.Name...)
+	msg.Question.Type = q.Type
+	msg.Question.Class = q.Class
+
+	if rs.validator != nil {
+		// Request the DNSSEC records and disable the validation on
+		// upstream, so we can validate the response ourselves.
+		msg.Header.IsCD = true
+		msg.SetEDNS(maxUDPPacketSize, true)
+	}
+
+	_, err = msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, up := range rs.upstreams {
+		up.Lock()
+		res, err = up.cl.Query(msg, nil)
+		up.Unlock()
+		if err != nil {
+			continue
+		}
+
+		err = isResponseTo(msg, res)
+		if err != nil {
+			continue
+		}
+
+		return res, nil
+	}
+
+	return nil, err
+}
+
+//
+// isResponseTo check whether message "res" is the response of query "q",
+// by comparing their ID and question.
+//
+func isResponseTo(q, res *Message) error {
+	if res.Header.ID != q.Header.ID {
+		return fmt.Errorf("dns: mismatch response ID %d, want %d",
+			res.Header.ID, q.Header.ID)
+	}
+	if res.Question.Type != q.Question.Type ||
+		res.Question.Class != q.Question.Class ||
+		!bytes.Equal(res.Question.Name, q.Question.Name) {
+		return fmt.Errorf("dns: mismatch response question %s, want %s",
+			res.Question, q.Question)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testUpstream is a client that answer any query with A record "127.0.0.1"
+// after some delay, and count the number of query.
+//
+type testUpstream struct {
+	nquery int32
+	delay  time.Duration
+	ttl    uint32
+}
+
+func (up *testUpstream) Close() error                         { return nil }
+func (up *testUpstream) RemoteAddr() string                   { return "test" }
+func (up *testUpstream) SetTimeout(t time.Duration)           {}
+func (up *testUpstream) SetRemoteAddr(addr string) error      { return nil }
+func (up *testUpstream) Recv(msg *Message) (int, error)       { return 0, nil }
+func (up *testUpstream) Send(*Message, net.Addr) (int, error) { return 0, nil }
+
+func (up *testUpstream) Query(msg *Message, ns net.Addr) (*Message, error) {
+	atomic.AddInt32(&up.nquery, 1)
+	time.Sleep(up.delay)
+
+	res := newResponse(msg, RCodeOK)
+	res.Answer = []*ResourceRecord{{
+		Name:  msg.Question.Name,
+		Type:  msg.Question.Type,
+		Class: msg.Question.Class,
+		TTL:   up.ttl,
+		Text: &RDataText{
+			Value: []byte("127.0.0.1"),
+		},
+	}}
+
+	_, err := res.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	unpacked := NewMessage()
+	unpacked.Packet = append(unpacked.Packet[:0], res.Packet...)
+
+	err = unpacked.Unpack()
+	if err != nil {
+		return nil, err
+	}
+
+	return unpacked, nil
+}
+
+//
+// testSender is a sender that forward the sent message to channel.
+//
+type testSender struct {
+	C chan *Message
+}
+
+func (sender *testSender) Send(msg *Message, addr net.Addr) (int, error) {
+	res := NewMessage()
+	res.Packet = append(res.Packet[:0], msg.Packet...)
+	err := res.Unpack()
+	if err != nil {
+		return 0, err
+	}
+	sender.C <- res
+	return len(msg.Packet), nil
+}
+
+func newTestRequest(sender Sender, id uint16, qname string) *Request {
+	q := NewMessage()
+	q.Header.ID = id
+	q.Question.Name = append(q.Question.Name, qname...)
+
+	_, _ = q.Pack()
+
+	req := AllocRequest()
+	req.Kind = ConnTypeUDP
+	req.Sender = sender
+	req.Message.Packet = append(req.Message.Packet[:0], q.Packet...)
+	req.Message.UnpackHeaderQuestion()
+
+	return req
+}
+
+func TestResolverServeDNS(t *testing.T) {
+	up := &testUpstream{
+		ttl: 60,
+	}
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver(up)
+
+	rs.ServeDNS(newTestRequest(sender, 100, "kilabit.info"))
+	res := <-sender.C
+
+	test.Assert(t, "ID", uint16(100), res.Header.ID, true)
+	test.Assert(t, "Answer", "127.0.0.1", string(res.Answer[0].Text.Value), true)
+	test.Assert(t, "nquery", int32(1), atomic.LoadInt32(&up.nquery), true)
+
+	// The second query should be answered from cache.
+	rs.ServeDNS(newTestRequest(sender, 101, "kilabit.info"))
+	res = <-sender.C
+
+	test.Assert(t, "ID", uint16(101), res.Header.ID, true)
+	test.Assert(t, "Answer", "127.0.0.1", string(res.Answer[0].Text.Value), true)
+	test.Assert(t, "nquery", int32(1), atomic.LoadInt32(&up.nquery), true)
+
+	// Expire the cached answer.
+	key := res.Question.key()
+	rs.cache.Lock()
+	rs.cache.v[key].updatedAt -= 61
+	rs.cache.Unlock()
+
+	rs.ServeDNS(newTestRequest(sender, 102, "kilabit.info"))
+	res = <-sender.C
+
+	test.Assert(t, "ID", uint16(102), res.Header.ID, true)
+	test.Assert(t, "nquery", int32(2), atomic.LoadInt32(&up.nquery), true)
+}
+
+func TestResolverCacheSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cache")
+
+	up := &testUpstream{
+		ttl: 60,
+	}
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver(up)
+
+	for x, qname := range []string{"a.test", "b.test"} {
+		rs.ServeDNS(newTestRequest(sender, uint16(200+x), qname))
+		<-sender.C
+	}
+
+	// Make the answer of "b.test" will be expired in 10 seconds.
+	rs.cache.Lock()
+	for _, ans := range rs.cache.v {
+		if string(ans.msg.Question.Name) == "b.test" {
+			ans.updatedAt -= 50
+		}
+	}
+	rs.cache.Unlock()
+
+	n, err := rs.SaveCache(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "saved", 2, n, true)
+
+	// Move the time of snapshot 30 seconds back, so the answer of
+	// "b.test" is expired when its loaded.
+	snapshot, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := len(cacheSnapshotMagic)
+	writtenAt := binary.BigEndian.Uint64(snapshot[off:])
+	binary.BigEndian.PutUint64(snapshot[off:], writtenAt-30)
+
+	err = ioutil.WriteFile(file, snapshot, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up = &testUpstream{
+		ttl: 60,
+	}
+	rs = NewResolver(up)
+
+	n, err = rs.LoadCache(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "loaded", 1, n, true)
+
+	rs.ServeDNS(newTestRequest(sender, 210, "a.test"))
+	res := <-sender.C
+
+	test.Assert(t, "ID", uint16(210), res.Header.ID, true)
+	test.Assert(t, "Answer", "127.0.0.1", string(res.Answer[0].Text.Value), true)
+	test.Assert(t, "TTL", true, res.Answer[0].TTL <= 30, true)
+	test.Assert(t, "nquery", int32(0), atomic.LoadInt32(&up.nquery), true)
+
+	rs.ServeDNS(newTestRequest(sender, 211, "b.test"))
+	<-sender.C
+	test.Assert(t, "nquery", int32(1), atomic.LoadInt32(&up.nquery), true)
+
+	// Loading invalid snapshot should return an error.
+	err = ioutil.WriteFile(file, []byte("invalid"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rs.LoadCache(file)
+	test.Assert(t, "error", errCacheSnapshot, err, true)
+}
+
+func TestResolverCoalesce(t *testing.T) {
+	up := &testUpstream{
+		delay: 200 * time.Millisecond,
+		ttl:   60,
+	}
+	sender := &testSender{
+		C: make(chan *Message, 10),
+	}
+
+	rs := NewResolver(up)
+
+	var wg sync.WaitGroup
+	for x := 0; x < 10; x++ {
+		wg.Add(1)
+		go func(id uint16) {
+			rs.ServeDNS(newTestRequest(sender, id, "coalesce.test"))
+			wg.Done()
+		}(uint16(x))
+	}
+	wg.Wait()
+
+	ids := make(map[uint16]bool)
+	for x := 0; x < 10; x++ {
+		res := <-sender.C
+		ids[res.Header.ID] = true
+	}
+
+	test.Assert(t, "unique ID", 10, len(ids), true)
+	test.Assert(t, "nquery", int32(1), atomic.LoadInt32(&up.nquery), true)
+}
+
+func TestResolverServerFailure(t *testing.T) {
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver()
+
+	rs.ServeDNS(newTestRequest(sender, 200, "kilabit.info"))
+	res := <-sender.C
+
+	test.Assert(t, "ID", uint16(200), res.Header.ID, true)
+	test.Assert(t, "RCode", RCodeErrServer, res.Header.RCode, true)
+}
+
+func TestResolverRateLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	rl := NewRateLimiter(RateLimitOptions{
+		ResponsesPerSecond: 1,
+		Slip:               2,
+	})
+	rl.now = func() time.Time { return now }
+
+	up := &testUpstream{
+		ttl: 60,
+	}
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver(up)
+
+	newReq := func(id uint16, qname string) *Request {
+		req := newTestRequest(sender, id, qname)
+		req.UDPAddr = &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+		req.limiter = rl
+		return req
+	}
+	recv := func() *Message {
+		select {
+		case res := <-sender.C:
+			return res
+		default:
+			return nil
+		}
+	}
+
+	// The first response is forwarded from upstream, the next
+	// responses are from cache.
+	rs.ServeDNS(newReq(1, "kilabit.info"))
+	res := <-sender.C
+	test.Assert(t, "Answer", 1, len(res.Answer), true)
+
+	rs.ServeDNS(newReq(2, "kilabit.info"))
+	test.Assert(t, "dropped", true, recv() == nil, true)
+
+	rs.ServeDNS(newReq(3, "kilabit.info"))
+	res = recv()
+	test.Assert(t, "ID", uint16(3), res.Header.ID, true)
+	test.Assert(t, "IsTC", true, res.Header.IsTC, true)
+
+	// The name errors on the same zone share the same limit.
+	soa := &ResourceRecord{
+		Name:  []byte("test"),
+		Type:  QueryTypeSOA,
+		Class: QueryClassIN,
+		TTL:   300,
+		SOA: &RDataSOA{
+			MName:   []byte("ns.test"),
+			RName:   []byte("admin.test"),
+			Serial:  1,
+			Minimum: 300,
+		},
+	}
+	for x, qname := range []string{"a.test", "b.test"} {
+		req := newReq(uint16(4+x), qname)
+
+		nx := newResponse(req.Message, RCodeErrName)
+		nx.Authority = append(nx.Authority, soa)
+		_, err := nx.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rs.sendPacket(req, nx.Packet)
+	}
+
+	res = recv()
+	test.Assert(t, "RCode", RCodeErrName, res.Header.RCode, true)
+	test.Assert(t, "dropped", true, recv() == nil, true)
+
+	exp := RateLimitStats{
+		ResponsesDropped: 2,
+		ResponsesSlipped: 1,
+	}
+	test.Assert(t, "Stats", exp, rl.Stats(), true)
+}
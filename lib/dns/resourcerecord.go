@@ -7,7 +7,6 @@ package dns
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"net"
 
 	libbytes "github.com/shuLhan/share/lib/bytes"
@@ -48,7 +47,8 @@ type ResourceRecord struct {
 	// address.
 	rdata []byte
 
-	// Text represent A, NS, CNAME, MB, MG, NULL, PTR, and TXT.
+	// Text represent A, NS, MD, MF, CNAME, MB, MG, MR, NULL, PTR, TXT,
+	// AAAA, and the opaque RDATA of unknown type.
 	Text  *RDataText
 	SOA   *RDataSOA
 	WKS   *RDataWKS
@@ -57,22 +57,43 @@ type ResourceRecord struct {
 	MX    *RDataMX
 	OPT   *RDataOPT
 	SRV   *RDataSRV
+	NAPTR *RDataNAPTR
+	SSHFP *RDataSSHFP
+	TLSA  *RDataTLSA
+	URI   *RDataURI
+	CAA   *RDataCAA
+
+	// SVCB represent SVCB and HTTPS.
+	SVCB *RDataSVCB
+
+	// TSIG represent the transaction signature meta-RR.
+	TSIG *RDataTSIG
+
+	// DNSSEC records.
+	DS         *RDataDS
+	RRSIG      *RDataRRSIG
+	NSEC       *RDataNSEC
+	DNSKEY     *RDataDNSKEY
+	NSEC3      *RDataNSEC3
+	NSEC3PARAM *RDataNSEC3PARAM
 
 	off    uint
 	offTTL uint
 }
 
 //
-// RData will return slice of bytes, the pointer that hold specific record
-// data, or nil for obsolete type.
+// RData will return slice of bytes, or the pointer that hold specific
+// record data.
 //
-// For RR with type A, NS, CNAME, MB, MG, NULL, PTR, TXT or AAAA, it will
-// return it as slice of bytes.
+// For RR with type A, NS, MD, MF, CNAME, MB, MG, MR, NULL, PTR, TXT or
+// AAAA, it will return it as slice of bytes.
 //
-// For RR with type SOA, WKS, HINFO, MINFO, MX, or OPT it will return pointer
-// to specific record type.
+// For RR with type SOA, WKS, HINFO, MINFO, MX, SRV, OPT, DS, RRSIG, NSEC,
+// DNSKEY, NSEC3, NSEC3PARAM, NAPTR, SSHFP, TLSA, SVCB, HTTPS, URI, CAA, or
+// TSIG it will return pointer to specific record type.
 //
-// For RR with obsolete type (MD or MF) it will return nil.
+// For RR with unknown type it will return the opaque RDATA as slice of
+// bytes (RFC 3597).
 //
 func (rr *ResourceRecord) RData() interface{} {
 	switch rr.Type {
@@ -81,9 +102,9 @@ func (rr *ResourceRecord) RData() interface{} {
 	case QueryTypeNS:
 		return rr.Text.Value
 	case QueryTypeMD:
-		return nil
+		return rr.Text.Value
 	case QueryTypeMF:
-		return nil
+		return rr.Text.Value
 	case QueryTypeCNAME:
 		return rr.Text.Value
 	case QueryTypeSOA:
@@ -114,10 +135,115 @@ func (rr *ResourceRecord) RData() interface{} {
 		return rr.SRV
 	case QueryTypeOPT:
 		return rr.OPT
+	case QueryTypeDS:
+		return rr.DS
+	case QueryTypeRRSIG:
+		return rr.RRSIG
+	case QueryTypeNSEC:
+		return rr.NSEC
+	case QueryTypeDNSKEY:
+		return rr.DNSKEY
+	case QueryTypeNSEC3:
+		return rr.NSEC3
+	case QueryTypeNSEC3PARAM:
+		return rr.NSEC3PARAM
+	case QueryTypeNAPTR:
+		return rr.NAPTR
+	case QueryTypeSSHFP:
+		return rr.SSHFP
+	case QueryTypeTLSA:
+		return rr.TLSA
+	case QueryTypeSVCB, QueryTypeHTTPS:
+		return rr.SVCB
+	case QueryTypeURI:
+		return rr.URI
+	case QueryTypeCAA:
+		return rr.CAA
+	case QueryTypeTSIG:
+		return rr.TSIG
+	}
+	if rr.Text != nil {
+		return rr.Text.Value
 	}
 	return nil
 }
 
+//
+// clone return the deep copy of resource record, so it can be stored
+// after the message that contains it is released back to the pool.
+//
+func (rr *ResourceRecord) clone() (*ResourceRecord, error) {
+	msg := &Message{
+		dnameOff:   make(map[string]uint16),
+		noCompress: true,
+	}
+
+	msg.packRR(rr)
+
+	out := &ResourceRecord{}
+	_, err := out.unpack(msg.Packet, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+//
+// isEmptyRData will return true if the record is used in dynamic update
+// with class ANY or NONE and does not have RDATA (RFC 2136 section 2.4
+// and 2.5).
+//
+func (rr *ResourceRecord) isEmptyRData() bool {
+	if rr.Class != QueryClassANY && rr.Class != QueryClassNONE {
+		return false
+	}
+	if rr.Type == QueryTypeOPT || rr.Type == QueryTypeTSIG {
+		return false
+	}
+	if rr.rdlen > 0 {
+		return false
+	}
+	return rr.Text == nil && rr.SOA == nil && rr.WKS == nil &&
+		rr.HInfo == nil && rr.MInfo == nil && rr.MX == nil &&
+		rr.SRV == nil && rr.NAPTR == nil && rr.SSHFP == nil &&
+		rr.TLSA == nil && rr.URI == nil && rr.CAA == nil &&
+		rr.SVCB == nil && rr.DS == nil && rr.RRSIG == nil &&
+		rr.NSEC == nil && rr.DNSKEY == nil && rr.NSEC3 == nil &&
+		rr.NSEC3PARAM == nil
+}
+
+//
+// isEqual will return true if both resource records have the same name,
+// type, class, and RDATA.
+//
+func (rr *ResourceRecord) isEqual(other *ResourceRecord) bool {
+	if rr.Type != other.Type || rr.Class != other.Class {
+		return false
+	}
+	if !bytes.EqualFold(rr.Name, other.Name) {
+		return false
+	}
+	return bytes.Equal(rr.packRData(), other.packRData())
+}
+
+//
+// packRData return the RDATA of resource record in wire format, without
+// the RDLENGTH.
+//
+func (rr *ResourceRecord) packRData() []byte {
+	msg := &Message{
+		dnameOff: make(map[string]uint16),
+	}
+
+	msg.packRData(rr)
+	if len(msg.Packet) < 2 {
+		return nil
+	}
+
+	return msg.Packet[2:]
+}
+
 //
 // Reset the resource record fields to zero values.
 //
@@ -135,6 +261,20 @@ func (rr *ResourceRecord) Reset() {
 	rr.MInfo = nil
 	rr.MX = nil
 	rr.OPT = nil
+	rr.SRV = nil
+	rr.DS = nil
+	rr.RRSIG = nil
+	rr.NSEC = nil
+	rr.DNSKEY = nil
+	rr.NSEC3 = nil
+	rr.NSEC3PARAM = nil
+	rr.NAPTR = nil
+	rr.SSHFP = nil
+	rr.TLSA = nil
+	rr.SVCB = nil
+	rr.URI = nil
+	rr.CAA = nil
+	rr.TSIG = nil
 	rr.off = 0
 	rr.offTTL = 0
 }
@@ -168,6 +308,11 @@ func (rr *ResourceRecord) unpack(packet []byte, startIdx uint) (x uint, err erro
 		}
 	}
 
+	// Type, class, TTL, and RDLENGTH.
+	if x+10 > uint(len(packet)) {
+		return x, ErrRDataLength
+	}
+
 	rr.Type = libbytes.ReadUint16(packet, x)
 	x += 2
 	rr.Class = uint16(libbytes.ReadUint16(packet, x))
@@ -178,49 +323,82 @@ func (rr *ResourceRecord) unpack(packet []byte, startIdx uint) (x uint, err erro
 	rr.rdlen = libbytes.ReadUint16(packet, x)
 	x += 2
 
-	rr.rdata = append(rr.rdata, packet[x:x+uint(rr.rdlen)]...)
+	endIdx := x + uint(rr.rdlen)
+	if endIdx > uint(len(packet)) {
+		return x, ErrRDataLength
+	}
+
+	rr.rdata = append(rr.rdata, packet[x:endIdx]...)
+
+	if rr.isEmptyRData() {
+		return x, nil
+	}
 
-	err = rr.unpackRData(packet, x)
+	// The RDATA is unpacked from the packet that end at the end of RDATA,
+	// so the malformed RDATA can not be read beyond its length.
+	err = rr.unpackRData(packet[:endIdx], x)
 
 	x = x + uint(rr.rdlen)
 
 	return
 }
 
+//
+// unpackDomainName unpack the domain name start from index x in packet.
+//
+// The compression pointer must point to the prior occurrence of name
+// (RFC 1035 section 4.1.4), and only maxNamePointers of them are followed,
+// so the malformed packet can not cause the infinite loop.
+//
 func (rr *ResourceRecord) unpackDomainName(out *[]byte, packet []byte, x uint) error {
-	count := packet[x]
-	if count == 0 {
-		return nil
-	}
-	if (packet[x] & maskPointer) == maskPointer {
-		offset := uint16(packet[x]&maskOffset)<<8 | uint16(packet[x+1])
+	for npointer := 0; ; {
+		if x >= uint(len(packet)) {
+			return ErrNameLength
+		}
 
-		if rr.off == 0 {
-			rr.off = x + 1
+		count := packet[x]
+		if count == 0 {
+			return nil
+		}
+		if (count & maskPointer) == maskPointer {
+			if x+1 >= uint(len(packet)) {
+				return ErrNameLength
+			}
+
+			offset := uint(count&maskOffset)<<8 | uint(packet[x+1])
+			if offset >= x || npointer >= maxNamePointers {
+				return ErrNamePointer
+			}
+			npointer++
+
+			if rr.off == 0 {
+				rr.off = x + 1
+			}
+
+			x = offset
+			continue
+		}
+		if count > maxLabelSize {
+			return ErrLabelSizeLimit
 		}
 
-		err := rr.unpackDomainName(out, packet, uint(offset))
-		return err
-	}
-	if count > maxLabelSize {
-		return ErrLabelSizeLimit
-	}
-	if len(*out) > 0 {
-		*out = append(*out, '.')
-	}
+		x++
+		if x+uint(count) > uint(len(packet)) {
+			return ErrNameLength
+		}
+		if len(*out) > 0 {
+			*out = append(*out, '.')
+		}
 
-	x++
-	for y := byte(0); y < count; y++ {
-		if packet[x] >= 'A' && packet[x] <= 'Z' {
-			packet[x] += 32
+		for y := byte(0); y < count; y++ {
+			c := packet[x]
+			if c >= 'A' && c <= 'Z' {
+				c += 32
+			}
+			*out = append(*out, c)
+			x++
 		}
-		*out = append(*out, packet[x])
-		x++
 	}
-
-	err := rr.unpackDomainName(out, packet, x)
-
-	return err
 }
 
 func (rr *ResourceRecord) unpackRData(packet []byte, startIdx uint) error {
@@ -251,12 +429,16 @@ func (rr *ResourceRecord) unpackRData(packet []byte, startIdx uint) error {
 	// a master file is to reject them, or to convert them to MX RRs with a
 	// preference of 0.
 	case QueryTypeMD:
+		rr.Text = new(RDataText)
+		return rr.unpackDomainName(&rr.Text.Value, packet, startIdx)
 
 	// MF is obsolete.  See the definition of MX and [RFC-974] for details
 	// ofw the new scheme.  The recommended policy for dealing with MD RRs
 	// found in a master file is to reject them, or to convert them to MX
 	// RRs with a preference of 10.
 	case QueryTypeMF:
+		rr.Text = new(RDataText)
+		return rr.unpackDomainName(&rr.Text.Value, packet, startIdx)
 
 	// CNAME RRs cause no additional section processing, but name servers
 	// may choose to restart the query at the canonical name in certain
@@ -287,8 +469,7 @@ func (rr *ResourceRecord) unpackRData(packet []byte, startIdx uint) error {
 	// the DNS.
 	case QueryTypeNULL:
 		rr.Text = new(RDataText)
-		endIdx := startIdx + uint(rr.rdlen)
-		rr.Text.Value = append(rr.Text.Value, packet[startIdx:startIdx+endIdx]...)
+		rr.Text.Value = append(rr.Text.Value, rr.rdata...)
 		return nil
 
 	case QueryTypeWKS:
@@ -315,12 +496,7 @@ func (rr *ResourceRecord) unpackRData(packet []byte, startIdx uint) error {
 
 	case QueryTypeTXT:
 		rr.Text = new(RDataText)
-		endIdx := startIdx + uint(rr.rdlen)
-
-		// The first byte of TXT is length.
-		rr.Text.Value = append(rr.Text.Value, packet[startIdx+1:endIdx]...)
-
-		return nil
+		return rr.unpackTXT(packet, startIdx)
 
 	case QueryTypeAAAA:
 		rr.Text = new(RDataText)
@@ -332,10 +508,65 @@ func (rr *ResourceRecord) unpackRData(packet []byte, startIdx uint) error {
 
 	case QueryTypeOPT:
 		rr.OPT = new(RDataOPT)
-		return rr.unpackOPT(packet, startIdx)
+		return rr.unpackOPT()
+
+	case QueryTypeDS:
+		rr.DS = new(RDataDS)
+		return rr.unpackDS()
+
+	case QueryTypeRRSIG:
+		rr.RRSIG = new(RDataRRSIG)
+		return rr.unpackRRSIG(packet, startIdx)
+
+	case QueryTypeNSEC:
+		rr.NSEC = new(RDataNSEC)
+		return rr.unpackNSEC(packet, startIdx)
+
+	case QueryTypeDNSKEY:
+		rr.DNSKEY = new(RDataDNSKEY)
+		return rr.unpackDNSKEY()
 
+	case QueryTypeNSEC3:
+		rr.NSEC3 = new(RDataNSEC3)
+		return rr.unpackNSEC3()
+
+	case QueryTypeNSEC3PARAM:
+		rr.NSEC3PARAM = new(RDataNSEC3PARAM)
+		return rr.unpackNSEC3PARAM()
+
+	case QueryTypeNAPTR:
+		rr.NAPTR = new(RDataNAPTR)
+		return rr.unpackNAPTR(packet, startIdx)
+
+	case QueryTypeSSHFP:
+		rr.SSHFP = new(RDataSSHFP)
+		return rr.unpackSSHFP()
+
+	case QueryTypeTLSA:
+		rr.TLSA = new(RDataTLSA)
+		return rr.unpackTLSA()
+
+	case QueryTypeSVCB, QueryTypeHTTPS:
+		rr.SVCB = new(RDataSVCB)
+		return rr.unpackSVCB(packet, startIdx)
+
+	case QueryTypeURI:
+		rr.URI = new(RDataURI)
+		return rr.unpackURI()
+
+	case QueryTypeCAA:
+		rr.CAA = new(RDataCAA)
+		return rr.unpackCAA()
+
+	case QueryTypeTSIG:
+		rr.TSIG = new(RDataTSIG)
+		return rr.unpackTSIG(packet, startIdx)
+
+	// The RDATA of unknown type is stored as opaque data (RFC 3597
+	// section 4).
 	default:
-		log.Printf("= Unknown query type: %d\n", rr.Type)
+		rr.Text = new(RDataText)
+		rr.Text.Value = append(rr.Text.Value, rr.rdata...)
 	}
 
 	return nil
@@ -387,6 +618,10 @@ func (rr *ResourceRecord) unpackMInfo(packet []byte, startIdx uint) error {
 }
 
 func (rr *ResourceRecord) unpackMX(packet []byte, startIdx uint) error {
+	if len(rr.rdata) < 3 {
+		return ErrRDataLength
+	}
+
 	rr.MX.Preference = libbytes.ReadInt16(packet, startIdx)
 
 	rr.off = 0
@@ -395,6 +630,27 @@ func (rr *ResourceRecord) unpackMX(packet []byte, startIdx uint) error {
 	return err
 }
 
+//
+// unpackTXT unpack the one or more character-strings in TXT RDATA.
+//
+func (rr *ResourceRecord) unpackTXT(packet []byte, x uint) (err error) {
+	if len(rr.rdata) == 0 {
+		return ErrRDataLength
+	}
+
+	var text []byte
+	for y := 0; y < len(rr.rdata); {
+		text, y, err = unpackCharString(rr.rdata, y)
+		if err != nil {
+			return err
+		}
+		rr.Text.Texts = append(rr.Text.Texts, text)
+		rr.Text.Value = append(rr.Text.Value, text...)
+	}
+
+	return nil
+}
+
 func (rr *ResourceRecord) unpackSRV(packet []byte, x uint) (err error) {
 	// Unpack service, proto, and name from RR.Name
 	y := 0
@@ -415,6 +671,10 @@ func (rr *ResourceRecord) unpackSRV(packet []byte, x uint) (err error) {
 	}
 
 	// Unpack RDATA
+	if len(rr.rdata) < 7 {
+		return ErrRDataLength
+	}
+
 	rr.SRV.Priority = libbytes.ReadUint16(packet, x)
 	x += 2
 	rr.SRV.Weight = libbytes.ReadUint16(packet, x)
@@ -427,7 +687,7 @@ func (rr *ResourceRecord) unpackSRV(packet []byte, x uint) (err error) {
 	return
 }
 
-func (rr *ResourceRecord) unpackOPT(packet []byte, x uint) error {
+func (rr *ResourceRecord) unpackOPT() error {
 	// Unpack extended RCODE and flags from TTL.
 	rr.OPT.ExtRCode = byte(rr.TTL >> 24)
 	rr.OPT.Version = byte(rr.TTL >> 16)
@@ -436,18 +696,7 @@ func (rr *ResourceRecord) unpackOPT(packet []byte, x uint) error {
 		rr.OPT.DO = true
 	}
 
-	if rr.rdlen == 0 {
-		return nil
-	}
-
-	// Unpack the RDATA
-	rr.OPT.Code = libbytes.ReadUint16(packet, x)
-	x += 2
-	rr.OPT.Length = libbytes.ReadUint16(packet, x)
-	x += 2
-	endIdx := x + uint(rr.rdlen)
-	rr.OPT.Data = append(rr.OPT.Data, packet[x:endIdx]...)
-	return nil
+	return rr.OPT.unpack(rr.rdata)
 }
 
 func (rr *ResourceRecord) unpackSOA(packet []byte, startIdx uint) error {
@@ -476,6 +725,10 @@ func (rr *ResourceRecord) unpackSOA(packet []byte, startIdx uint) error {
 		x = x + uint(len(rr.SOA.RName)+2)
 	}
 
+	if x+20 > uint(len(packet)) {
+		return ErrRDataLength
+	}
+
 	rr.SOA.Serial = libbytes.ReadUint32(packet, x)
 	x += 4
 	rr.SOA.Refresh = libbytes.ReadInt32(packet, x)
@@ -488,3 +741,278 @@ func (rr *ResourceRecord) unpackSOA(packet []byte, startIdx uint) error {
 
 	return nil
 }
+
+func (rr *ResourceRecord) unpackDS() error {
+	if len(rr.rdata) < 4 {
+		return ErrRDataLength
+	}
+
+	rr.DS.KeyTag = libbytes.ReadUint16(rr.rdata, 0)
+	rr.DS.Algorithm = rr.rdata[2]
+	rr.DS.DigestType = rr.rdata[3]
+	rr.DS.Digest = append(rr.DS.Digest, rr.rdata[4:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackDNSKEY() error {
+	if len(rr.rdata) < 4 {
+		return ErrRDataLength
+	}
+
+	rr.DNSKEY.Flags = libbytes.ReadUint16(rr.rdata, 0)
+	rr.DNSKEY.Protocol = rr.rdata[2]
+	rr.DNSKEY.Algorithm = rr.rdata[3]
+	rr.DNSKEY.PublicKey = append(rr.DNSKEY.PublicKey, rr.rdata[4:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackRRSIG(packet []byte, x uint) error {
+	if len(rr.rdata) < 19 {
+		return ErrRDataLength
+	}
+
+	rr.RRSIG.unpack(rr.rdata)
+
+	end, err := rr.unpackDomainNameEnd(&rr.RRSIG.SignerName, packet, x+18)
+	if err != nil {
+		return err
+	}
+
+	endIdx := x + uint(rr.rdlen)
+	if end > endIdx {
+		return ErrRDataLength
+	}
+
+	rr.RRSIG.Signature = append(rr.RRSIG.Signature, packet[end:endIdx]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackNSEC(packet []byte, x uint) (err error) {
+	end, err := rr.unpackDomainNameEnd(&rr.NSEC.NextName, packet, x)
+	if err != nil {
+		return err
+	}
+
+	endIdx := x + uint(rr.rdlen)
+	if end > endIdx {
+		return ErrRDataLength
+	}
+
+	rr.NSEC.Types, err = unpackTypeBitmap(packet[end:endIdx])
+
+	return err
+}
+
+func (rr *ResourceRecord) unpackNSEC3() (err error) {
+	var (
+		nsec3 = rr.NSEC3
+		x     = 4
+	)
+
+	if len(rr.rdata) < 5 {
+		return ErrRDataLength
+	}
+
+	nsec3.HashAlgorithm = rr.rdata[0]
+	nsec3.Flags = rr.rdata[1]
+	nsec3.Iterations = libbytes.ReadUint16(rr.rdata, 2)
+
+	n := int(rr.rdata[x])
+	x++
+	if x+n >= len(rr.rdata) {
+		return ErrRDataLength
+	}
+	nsec3.Salt = append(nsec3.Salt, rr.rdata[x:x+n]...)
+	x += n
+
+	n = int(rr.rdata[x])
+	x++
+	if x+n > len(rr.rdata) {
+		return ErrRDataLength
+	}
+	nsec3.NextHashedOwner = append(nsec3.NextHashedOwner, rr.rdata[x:x+n]...)
+	x += n
+
+	nsec3.Types, err = unpackTypeBitmap(rr.rdata[x:])
+
+	return err
+}
+
+func (rr *ResourceRecord) unpackNSEC3PARAM() (err error) {
+	if len(rr.rdata) < 5 {
+		return ErrRDataLength
+	}
+
+	param := rr.NSEC3PARAM
+	param.HashAlgorithm = rr.rdata[0]
+	param.Flags = rr.rdata[1]
+	param.Iterations = libbytes.ReadUint16(rr.rdata, 2)
+
+	n := int(rr.rdata[4])
+	if 5+n > len(rr.rdata) {
+		return ErrRDataLength
+	}
+	param.Salt = append(param.Salt, rr.rdata[5:5+n]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackNAPTR(packet []byte, x uint) (err error) {
+	if len(rr.rdata) < 4 {
+		return ErrRDataLength
+	}
+
+	naptr := rr.NAPTR
+	naptr.Order = libbytes.ReadUint16(rr.rdata, 0)
+	naptr.Preference = libbytes.ReadUint16(rr.rdata, 2)
+
+	y := 4
+	for _, out := range []*[]byte{
+		&naptr.Flags, &naptr.Services, &naptr.Regexp,
+	} {
+		*out, y, err = unpackCharString(rr.rdata, y)
+		if err != nil {
+			return err
+		}
+	}
+	if y >= len(rr.rdata) {
+		return ErrRDataLength
+	}
+
+	_, err = rr.unpackDomainNameEnd(&naptr.Replacement, packet, x+uint(y))
+
+	return err
+}
+
+func (rr *ResourceRecord) unpackSSHFP() error {
+	if len(rr.rdata) < 2 {
+		return ErrRDataLength
+	}
+
+	rr.SSHFP.Algorithm = rr.rdata[0]
+	rr.SSHFP.FPType = rr.rdata[1]
+	rr.SSHFP.Fingerprint = append(rr.SSHFP.Fingerprint, rr.rdata[2:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackTLSA() error {
+	if len(rr.rdata) < 3 {
+		return ErrRDataLength
+	}
+
+	rr.TLSA.Usage = rr.rdata[0]
+	rr.TLSA.Selector = rr.rdata[1]
+	rr.TLSA.MatchingType = rr.rdata[2]
+	rr.TLSA.CertData = append(rr.TLSA.CertData, rr.rdata[3:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackSVCB(packet []byte, x uint) (err error) {
+	if len(rr.rdata) < 3 {
+		return ErrRDataLength
+	}
+
+	rr.SVCB.Priority = libbytes.ReadUint16(rr.rdata, 0)
+
+	end, err := rr.unpackDomainNameEnd(&rr.SVCB.Target, packet, x+2)
+	if err != nil {
+		return err
+	}
+
+	endIdx := x + uint(rr.rdlen)
+	if end > endIdx {
+		return ErrRDataLength
+	}
+
+	return rr.SVCB.unpackParams(packet[end:endIdx])
+}
+
+func (rr *ResourceRecord) unpackURI() error {
+	if len(rr.rdata) < 4 {
+		return ErrRDataLength
+	}
+
+	rr.URI.Priority = libbytes.ReadUint16(rr.rdata, 0)
+	rr.URI.Weight = libbytes.ReadUint16(rr.rdata, 2)
+	rr.URI.Target = append(rr.URI.Target, rr.rdata[4:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackCAA() error {
+	if len(rr.rdata) < 2 {
+		return ErrRDataLength
+	}
+
+	n := int(rr.rdata[1])
+	if 2+n > len(rr.rdata) {
+		return ErrRDataLength
+	}
+
+	rr.CAA.Flags = rr.rdata[0]
+	rr.CAA.Tag = append(rr.CAA.Tag, rr.rdata[2:2+n]...)
+	rr.CAA.Value = append(rr.CAA.Value, rr.rdata[2+n:]...)
+
+	return nil
+}
+
+func (rr *ResourceRecord) unpackTSIG(packet []byte, x uint) error {
+	end, err := rr.unpackDomainNameEnd(&rr.TSIG.Algorithm, packet, x)
+	if err != nil {
+		return err
+	}
+
+	endIdx := x + uint(rr.rdlen)
+	if end > endIdx {
+		return ErrRDataLength
+	}
+
+	return rr.TSIG.unpack(packet[end:endIdx])
+}
+
+//
+// unpackCharString unpack the <character-string> start from index x in b,
+// and return the index after it.
+//
+func unpackCharString(b []byte, x int) (s []byte, end int, err error) {
+	if x >= len(b) {
+		return nil, 0, ErrRDataLength
+	}
+	n := int(b[x])
+	x++
+	if x+n > len(b) {
+		return nil, 0, ErrRDataLength
+	}
+	return append([]byte(nil), b[x:x+n]...), x + n, nil
+}
+
+//
+// unpackDomainNameEnd unpack the domain name start from index x in packet
+// and return the index after the end of domain name.
+//
+func (rr *ResourceRecord) unpackDomainNameEnd(out *[]byte, packet []byte, x uint) (
+	end uint, err error,
+) {
+	rr.off = 0
+
+	err = rr.unpackDomainName(out, packet, x)
+	if err != nil {
+		return 0, err
+	}
+
+	if rr.off > 0 {
+		end = rr.off + 1
+		rr.off = 0
+	} else if len(*out) == 0 {
+		end = x + 1
+	} else {
+		end = x + uint(len(*out)+2)
+	}
+
+	return end, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+const hexDigits = "0123456789abcdef"
+
+//
+// ReverseName return the domain name for reverse lookup of IP address, for
+// example "1.2.0.192.in-addr.arpa" for IPv4 address "192.0.2.1" (RFC 1035
+// section 3.5), or the name in nibble format under "ip6.arpa" for IPv6
+// address (RFC 3596 section 2.5).  It will return empty string if the IP
+// address is invalid.
+//
+func ReverseName(ip net.IP) string {
+	var sb strings.Builder
+
+	if ip4 := ip.To4(); ip4 != nil {
+		for x := len(ip4) - 1; x >= 0; x-- {
+			sb.WriteString(strconv.Itoa(int(ip4[x])))
+			sb.WriteByte('.')
+		}
+		sb.WriteString("in-addr.arpa")
+		return sb.String()
+	}
+
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return ""
+	}
+
+	for x := len(ip6) - 1; x >= 0; x-- {
+		sb.WriteByte(hexDigits[ip6[x]&0x0F])
+		sb.WriteByte('.')
+		sb.WriteByte(hexDigits[ip6[x]>>4])
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa")
+
+	return sb.String()
+}
+
+//
+// synthesizePTR add the PTR record for each A and AAAA records into ptrs.
+// The PTR record that already exist in ptrs is not added.
+//
+func synthesizePTR(ptrs map[string][]*ResourceRecord, rrs []*ResourceRecord) {
+	for _, rr := range rrs {
+		if rr.Type != QueryTypeA && rr.Type != QueryTypeAAAA {
+			continue
+		}
+		if rr.Text == nil {
+			continue
+		}
+
+		name := ReverseName(net.ParseIP(string(rr.Text.Value)))
+		if len(name) == 0 {
+			continue
+		}
+
+		ptr := &ResourceRecord{
+			Name:  []byte(name),
+			Type:  QueryTypePTR,
+			Class: rr.Class,
+			TTL:   rr.TTL,
+			Text: &RDataText{
+				Value: append([]byte{}, rr.Name...),
+			},
+		}
+
+		isExist := false
+		for _, old := range ptrs[name] {
+			if old.isEqual(ptr) {
+				isExist = true
+				break
+			}
+		}
+		if !isExist {
+			ptrs[name] = append(ptrs[name], ptr)
+		}
+	}
+}
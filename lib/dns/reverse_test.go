@@ -0,0 +1,31 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestReverseName(t *testing.T) {
+	cases := []struct {
+		ip  net.IP
+		exp string
+	}{{
+		ip:  net.ParseIP("192.0.2.1"),
+		exp: "1.2.0.192.in-addr.arpa",
+	}, {
+		ip:  net.ParseIP("2001:db8::567:89ab"),
+		exp: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+	}, {
+		ip: nil,
+	}}
+
+	for _, c := range cases {
+		test.Assert(t, c.ip.String(), c.exp, ReverseName(c.ip), true)
+	}
+}
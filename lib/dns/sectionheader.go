@@ -15,6 +15,8 @@ const (
 	headerIsTC       byte = 0x02
 	headerIsRD       byte = 0x01
 	headerIsRA       byte = 0x80
+	headerIsAD       byte = 0x20
+	headerIsCD       byte = 0x10
 )
 
 //
@@ -77,6 +79,20 @@ type SectionHeader struct {
 	//
 	IsRA bool
 
+	//
+	// Authentic Data - this bit is set in a response by security-aware
+	// resolver to indicates that all RRsets in answer and authority
+	// sections has been validated as secure (RFC 4035 section 3.2.3).
+	//
+	IsAD bool
+
+	//
+	// Checking Disabled - this bit may be set in a query to indicates
+	// that the resolver should not validate the response (RFC 4035
+	// section 3.2.2).
+	//
+	IsCD bool
+
 	//
 	// Response code - this 4 bit field is set as part of responses.
 	//
@@ -110,6 +126,8 @@ func (hdr *SectionHeader) Reset() {
 	hdr.IsTC = false
 	hdr.IsRD = true
 	hdr.IsRA = false
+	hdr.IsAD = false
+	hdr.IsCD = false
 	hdr.RCode = RCodeOK
 	hdr.QDCount = 0
 	hdr.ANCount = 0
@@ -134,7 +152,7 @@ func (hdr *SectionHeader) pack() ([]byte, error) {
 		b0 = headerIsResponse
 	}
 
-	b0 = b0 | (0x78 & byte(hdr.Op<<2))
+	b0 = b0 | (0x78 & byte(hdr.Op<<3))
 
 	if hdr.IsRD {
 		b0 = b0 | headerIsRD
@@ -152,6 +170,12 @@ func (hdr *SectionHeader) pack() ([]byte, error) {
 		}
 		b1 = b1 | (0x0F & byte(hdr.RCode))
 	}
+	if hdr.IsAD {
+		b1 = b1 | headerIsAD
+	}
+	if hdr.IsCD {
+		b1 = b1 | headerIsCD
+	}
 
 	packet[2] = b0
 	packet[3] = b1
@@ -173,7 +197,7 @@ func (hdr *SectionHeader) unpack(packet []byte) error {
 	if packet[2]&headerIsResponse == headerIsResponse {
 		hdr.IsQuery = false
 	}
-	hdr.Op = OpCode((packet[2] & 0x78) >> 2)
+	hdr.Op = OpCode((packet[2] & 0x78) >> 3)
 
 	if packet[2]&headerIsAA == headerIsAA {
 		hdr.IsAA = true
@@ -187,6 +211,12 @@ func (hdr *SectionHeader) unpack(packet []byte) error {
 	if packet[3]&headerIsRA == headerIsRA {
 		hdr.IsRA = true
 	}
+	if packet[3]&headerIsAD == headerIsAD {
+		hdr.IsAD = true
+	}
+	if packet[3]&headerIsCD == headerIsCD {
+		hdr.IsCD = true
+	}
 
 	hdr.RCode = ResponseCode(0x0F & packet[3])
 
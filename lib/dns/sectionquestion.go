@@ -7,6 +7,8 @@ package dns
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 
 	libbytes "github.com/shuLhan/share/lib/bytes"
 )
@@ -44,12 +46,32 @@ func (question *SectionQuestion) Reset() {
 	question.Class = QueryClassIN
 }
 
+//
+// key return the string representation of question name, type, and class
+// that can be used as key to identify the same question.
+//
+func (question *SectionQuestion) key() string {
+	var b strings.Builder
+
+	b.Write(question.Name)
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(int(question.Type)))
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(int(question.Class)))
+
+	return b.String()
+}
+
 //
 // size return the section question size, length of name + 2 (1 octet for
 // beginning size plus 1 octet for end of label) + 2 octets of
-// qtype + 2 octets of qclass
+// qtype + 2 octets of qclass.  The root name only contains 1 octet of end
+// of label.
 //
 func (question *SectionQuestion) size() int {
+	if len(question.Name) == 0 {
+		return 5
+	}
 	return len(question.Name) + 6
 }
 
@@ -72,15 +94,21 @@ func (question *SectionQuestion) unpack(packet []byte) error {
 		return nil
 	}
 
+	question.Name = question.Name[:0]
+
 	count := packet[0]
 	x := uint(1)
 
-	for {
+	for count > 0 {
+		if x+uint(count) >= uint(len(packet)) {
+			return ErrNameLength
+		}
 		for y := byte(0); y < count; y++ {
-			if packet[x] >= 'A' && packet[x] <= 'Z' {
-				packet[x] += 32
+			c := packet[x]
+			if c >= 'A' && c <= 'Z' {
+				c += 32
 			}
-			question.Name = append(question.Name, packet[x])
+			question.Name = append(question.Name, c)
 			x++
 		}
 		count = packet[x]
@@ -91,6 +119,10 @@ func (question *SectionQuestion) unpack(packet []byte) error {
 		question.Name = append(question.Name, '.')
 	}
 
+	if x+4 > uint(len(packet)) {
+		return ErrRDataLength
+	}
+
 	question.Type = libbytes.ReadUint16(packet, x)
 	x += 2
 	question.Class = uint16(libbytes.ReadUint16(packet, x))
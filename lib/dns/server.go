@@ -5,6 +5,7 @@
 package dns
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"io"
@@ -13,55 +14,92 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/shuLhan/share/lib/debug"
 )
 
 //
 // Server defines DNS server.
 //
+// Server can be stopped using Shutdown, which will stop all listeners and
+// wait until all in-flight requests has been answered.
+//
 type Server struct {
 	Handler Handler
-	udp     *net.UDPConn
-	tcp     *net.TCPListener
-	doh     *http.Server
+
+	// RateLimiter limit the queries and responses on UDP connection.
+	// If its nil, no limit is applied.
+	RateLimiter *RateLimiter
+
+	// Observer receive the event of each request that has been
+	// answered.  If its nil, no event is generated.
+	Observer Observer
+
+	udp   *net.UDPConn
+	tcp   *net.TCPListener
+	doh   *http.Server
+	dohLn net.Listener
+	dot   net.Listener
+
+	// mu protect the listeners, the active connections, and the shutdown
+	// flag.
+	mu         sync.Mutex
+	isShutdown bool
+	conns      map[net.Conn]struct{}
+
+	// wg count the running serve loops, the active connections, and
+	// in-flight UDP requests.
+	wg sync.WaitGroup
 }
 
 //
-// ListenAndServe run DNS server on UDP, TCP, or DNS over HTTP (DoH).
+// ListenAndServe run DNS server on UDP, TCP, DNS over HTTP (DoH), or DNS
+// over TLS (DoT).  DoH is served if the certificate is set, and DoT is
+// served if the certificate and DoTPort are set.
+// It will return the first error from one of the listeners, or nil if all
+// of them has been stopped by Shutdown.
 //
-func (srv *Server) ListenAndServe(opts *ServerOptions) error {
-	err := opts.parse()
+func (srv *Server) ListenAndServe(opts *ServerOptions) (err error) {
+	err = opts.parse()
 	if err != nil {
 		return err
 	}
 
-	cherr := make(chan error, 1)
+	n := 2
+	cherr := make(chan error, 4)
 
 	go func() {
-		err = srv.ListenAndServeTCP(opts.getTCPAddress())
-		if err != nil {
-			cherr <- err
-		}
+		cherr <- srv.ListenAndServeTCP(opts.getTCPAddress())
 	}()
 
 	go func() {
-		err = srv.ListenAndServeUDP(opts.getUDPAddress())
-		if err != nil {
-			cherr <- err
-		}
+		cherr <- srv.ListenAndServeUDP(opts.getUDPAddress())
 	}()
 
 	if len(opts.DoHCert) > 0 && len(opts.DoHCertKey) > 0 {
+		n++
 		go func() {
-			err = srv.ListenAndServeDoH(opts)
-			if err != nil {
-				cherr <- err
-			}
+			cherr <- srv.ListenAndServeDoH(opts)
 		}()
+
+		if opts.DoTPort > 0 {
+			n++
+			go func() {
+				cherr <- srv.ListenAndServeDoT(opts)
+			}()
+		}
 	}
 
-	err = <-cherr
+	for ; n > 0; n-- {
+		err = <-cherr
+		if err != nil {
+			return err
+		}
+	}
 
-	return err
+	return nil
 }
 
 //
@@ -76,17 +114,78 @@ func (srv *Server) ListenAndServeDoH(opts *ServerOptions) error {
 		}
 	}
 
-	srv.doh = &http.Server{
-		Addr:        opts.getDoHAddress().String(),
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", srv)
+
+	doh := &http.Server{
+		Handler:     mux,
 		IdleTimeout: opts.DoHIdleTimeout,
 		TLSConfig: &tls.Config{
 			InsecureSkipVerify: opts.DoHAllowInsecure,
 		},
 	}
 
-	http.Handle("/dns-query", srv)
+	ln, err := net.ListenTCP("tcp", opts.getDoHAddress())
+	if err != nil {
+		return err
+	}
+
+	srv.mu.Lock()
+	if srv.isShutdown {
+		srv.mu.Unlock()
+		return ln.Close()
+	}
+	srv.doh = doh
+	srv.dohLn = ln
+	srv.mu.Unlock()
+
+	err = doh.ServeTLS(ln, opts.DoHCert, opts.DoHCertKey)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+//
+// ListenAndServeDoT listen for request over TLS using certificate and key
+// file in parameter.  Each message is prefixed with two octets length, the
+// same as TCP (RFC 7858 section 3.3).
+//
+func (srv *Server) ListenAndServeDoT(opts *ServerOptions) error {
+	if opts.ip == nil {
+		err := opts.parse()
+		if err != nil {
+			return err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.DoHCert, opts.DoHCertKey)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	ln, err := tls.Listen("tcp", opts.getDoTAddress().String(), tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	srv.mu.Lock()
+	if srv.isShutdown {
+		srv.mu.Unlock()
+		return ln.Close()
+	}
+	srv.dot = ln
+	srv.wg.Add(1)
+	srv.mu.Unlock()
+
+	defer srv.wg.Done()
 
-	return srv.doh.ListenAndServeTLS(opts.DoHCert, opts.DoHCertKey)
+	return srv.serveStream(ln, ConnTypeDoT)
 }
 
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -132,7 +231,7 @@ func (srv *Server) handleDoHGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	srv.handleDoHRequest(raw, w)
+	srv.handleDoHRequest(raw, w, r)
 }
 
 func (srv *Server) handleDoHPost(w http.ResponseWriter, r *http.Request) {
@@ -142,13 +241,17 @@ func (srv *Server) handleDoHPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	srv.handleDoHRequest(raw, w)
+	srv.handleDoHRequest(raw, w, r)
 }
 
-func (srv *Server) handleDoHRequest(raw []byte, w http.ResponseWriter) {
+func (srv *Server) handleDoHRequest(
+	raw []byte, w http.ResponseWriter, r *http.Request,
+) {
 	req := AllocRequest()
 
 	req.Kind = ConnTypeDoH
+	req.TCPAddr, _ = net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	srv.observe(req)
 	req.ResponseWriter = w
 	req.ChanResponded = make(chan bool, 1)
 
@@ -169,47 +272,70 @@ func (srv *Server) handleDoHRequest(raw []byte, w http.ResponseWriter) {
 // ListenAndServeTCP listen for request with TCP socket.
 //
 func (srv *Server) ListenAndServeTCP(tcpAddr *net.TCPAddr) error {
-	var err error
-
-	srv.tcp, err = net.ListenTCP("tcp", tcpAddr)
+	ln, err := net.ListenTCP("tcp", tcpAddr)
 	if err != nil {
 		return err
 	}
 
-	for {
-		conn, err := srv.tcp.AcceptTCP()
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
-		cl := &TCPClient{
-			Timeout: clientTimeout,
-			conn:    conn,
-		}
+	return srv.ServeTCP(ln)
+}
 
-		go srv.serveTCPClient(cl)
+//
+// ServeTCP accept the connection on listener and serve their requests.
+// The listener will be closed when Shutdown is called.
+//
+func (srv *Server) ServeTCP(ln *net.TCPListener) error {
+	srv.mu.Lock()
+	if srv.isShutdown {
+		srv.mu.Unlock()
+		return ln.Close()
 	}
+	srv.tcp = ln
+	srv.wg.Add(1)
+	srv.mu.Unlock()
+
+	defer srv.wg.Done()
+
+	return srv.serveStream(ln, ConnTypeTCP)
 }
 
 //
 // ListenAndServeUDP listen for request with UDP socket.
 //
 func (srv *Server) ListenAndServeUDP(udpAddr *net.UDPAddr) error {
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+
+	return srv.ServeUDP(conn)
+}
+
+//
+// ServeUDP read the requests from UDP connection and pass it to handler.
+// The connection will be closed when Shutdown is called.
+//
+func (srv *Server) ServeUDP(conn *net.UDPConn) error {
 	var (
 		n   int
 		err error
 		req *Request
 	)
 
-	srv.udp, err = net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		return err
+	srv.mu.Lock()
+	if srv.isShutdown {
+		srv.mu.Unlock()
+		return conn.Close()
 	}
+	srv.udp = conn
+	srv.wg.Add(1)
+	srv.mu.Unlock()
+
+	defer srv.wg.Done()
 
 	sender := &UDPClient{
 		Timeout: clientTimeout,
-		conn:    srv.udp,
+		conn:    conn,
 	}
 
 	for {
@@ -217,64 +343,269 @@ func (srv *Server) ListenAndServeUDP(udpAddr *net.UDPAddr) error {
 			req = AllocRequest()
 		}
 
-		n, req.UDPAddr, err = srv.udp.ReadFromUDP(req.Message.Packet)
+		n, req.UDPAddr, err = conn.ReadFromUDP(req.Message.Packet)
 		if err != nil {
+			if srv.isShuttingDown() {
+				FreeRequest(req)
+				return nil
+			}
 			log.Println(err)
 			continue
 		}
 
+		if srv.RateLimiter != nil {
+			if !srv.RateLimiter.allowQuery(req.UDPAddr.IP) {
+				continue
+			}
+			req.limiter = srv.RateLimiter
+		}
+
 		req.Kind = ConnTypeUDP
 		req.Message.Packet = req.Message.Packet[:n]
+		srv.observe(req)
 
 		req.Message.UnpackHeaderQuestion()
 		req.Sender = sender
 
+		srv.wg.Add(1)
+		req.done = srv.wg.Done
+
 		srv.Handler.ServeDNS(req)
 		req = nil
 	}
 }
 
-func (srv *Server) serveTCPClient(cl *TCPClient) {
+//
+// Shutdown gracefully stop the server.  It will stop all listeners, wait
+// until all in-flight requests has been answered, and then close all
+// connections.  If the context expired before all requests has been
+// answered, all connections will be closed and the context error will be
+// returned.
+//
+// All of ListenAndServe and Serve methods will return nil after Shutdown
+// has been called.
+//
+func (srv *Server) Shutdown(ctx context.Context) (err error) {
+	srv.mu.Lock()
+	srv.isShutdown = true
+
+	// Stop the UDP loop from reading new request, but keep the
+	// connection open until all in-flight requests has been answered.
+	if srv.udp != nil {
+		_ = srv.udp.SetReadDeadline(time.Now())
+	}
+	if srv.tcp != nil {
+		_ = srv.tcp.Close()
+	}
+	if srv.dot != nil {
+		_ = srv.dot.Close()
+	}
+	for conn := range srv.conns {
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	doh := srv.doh
+	srv.mu.Unlock()
+
+	if doh != nil {
+		err = doh.Shutdown(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		srv.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	srv.mu.Lock()
+	if srv.udp != nil {
+		_ = srv.udp.Close()
+	}
+	for conn := range srv.conns {
+		_ = conn.Close()
+	}
+	srv.mu.Unlock()
+
+	return err
+}
+
+//
+// UDPAddr return the local address of UDP listener, or nil if server is
+// not listening on UDP.
+//
+func (srv *Server) UDPAddr() *net.UDPAddr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.udp == nil {
+		return nil
+	}
+	addr, _ := srv.udp.LocalAddr().(*net.UDPAddr)
+	return addr
+}
+
+//
+// TCPAddr return the local address of TCP listener, or nil if server is
+// not listening on TCP.
+//
+func (srv *Server) TCPAddr() *net.TCPAddr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.tcp == nil {
+		return nil
+	}
+	addr, _ := srv.tcp.Addr().(*net.TCPAddr)
+	return addr
+}
+
+//
+// DoHAddr return the local address of DoH listener, or nil if server is
+// not listening on DoH.
+//
+func (srv *Server) DoHAddr() *net.TCPAddr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.dohLn == nil {
+		return nil
+	}
+	addr, _ := srv.dohLn.Addr().(*net.TCPAddr)
+	return addr
+}
+
+//
+// DoTAddr return the local address of DoT listener, or nil if server is
+// not listening on DoT.
+//
+func (srv *Server) DoTAddr() *net.TCPAddr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.dot == nil {
+		return nil
+	}
+	addr, _ := srv.dot.Addr().(*net.TCPAddr)
+	return addr
+}
+
+//
+// observe set the observer of request and start the request timer.
+//
+func (srv *Server) observe(req *Request) {
+	if srv.Observer == nil {
+		return
+	}
+	req.observer = srv.Observer
+	req.start = time.Now()
+}
+
+func (srv *Server) isShuttingDown() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.isShutdown
+}
+
+//
+// serveStream accept the connection from TCP or DoT listener and serve each
+// of them in new goroutine.
+//
+func (srv *Server) serveStream(ln net.Listener, kind int) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if srv.isShuttingDown() {
+				return nil
+			}
+			log.Println(err)
+			continue
+		}
+
+		srv.mu.Lock()
+		if srv.isShutdown {
+			srv.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		if srv.conns == nil {
+			srv.conns = make(map[net.Conn]struct{})
+		}
+		srv.conns[conn] = struct{}{}
+		srv.wg.Add(1)
+		srv.mu.Unlock()
+
+		cl := &TCPClient{
+			Timeout: clientTimeout,
+			conn:    conn,
+		}
+
+		go srv.serveTCPClient(cl, kind)
+	}
+}
+
+//
+// serveTCPClient read the DNS message from TCP or DoT connection and pass
+// it to handler, until the connection closed, no message received after
+// the client timeout, or the server is shutting down.
+// The connection is closed after all of its requests has been answered.
+//
+func (srv *Server) serveTCPClient(cl *TCPClient, kind int) {
 	var (
-		n   int
 		err error
 		req *Request
+		wg  sync.WaitGroup
 	)
+
+	tcpAddr, _ := cl.conn.RemoteAddr().(*net.TCPAddr)
+
 	for {
-		if req == nil {
-			req = AllocRequest()
+		// Set the read deadline while holding the lock, so it will not
+		// override the deadline set by Shutdown.
+		srv.mu.Lock()
+		if srv.isShutdown {
+			srv.mu.Unlock()
+			break
+		}
+		err = cl.conn.SetReadDeadline(time.Now().Add(cl.Timeout))
+		srv.mu.Unlock()
+		if err != nil {
+			break
 		}
 
-		for {
-			n, err = cl.Recv(req.Message)
-			if err == nil {
-				break
-			}
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				if n != 0 {
-					log.Println("serveTCPClient:", err)
-					req.Message.Reset()
-				}
-				continue
+		req = AllocRequest()
+
+		_, err = recvStream(cl.conn, req.Message)
+		if err != nil {
+			if err != io.EOF && debug.Value >= 1 {
+				log.Println("serveTCPClient:", err)
 			}
-		}
-		if err == io.EOF {
+			FreeRequest(req)
 			break
 		}
 
-		req.Kind = ConnTypeTCP
+		req.Kind = kind
+		srv.observe(req)
 		req.Message.UnpackHeaderQuestion()
 		req.Sender = cl
+		req.TCPAddr = tcpAddr
+
+		wg.Add(1)
+		req.done = wg.Done
 
 		srv.Handler.ServeDNS(req)
-		req = nil
 	}
 
+	wg.Wait()
+
+	srv.mu.Lock()
+	delete(srv.conns, cl.conn)
+	srv.mu.Unlock()
+
 	err = cl.conn.Close()
-	if err != nil {
+	if err != nil && debug.Value >= 1 {
 		log.Println("serveTCPClient: conn.Close:", err)
 	}
+
+	srv.wg.Done()
 }
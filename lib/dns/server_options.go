@@ -13,7 +13,7 @@ import (
 //
 // ServerOptions describes options for running a DNS server.
 // If certificate or key file is empty, server will not run with DNS over
-// HTTPS (DoH).
+// HTTPS (DoH) and DNS over TLS (DoT).  DoT is only served if DoTPort is set.
 //
 type ServerOptions struct {
 	// IPAddress of server to listen to, without port number.
@@ -28,10 +28,14 @@ type ServerOptions struct {
 	// DoHPort port for listening DNS over HTTP, default to 443.
 	DoHPort uint16
 
-	// DoHCert path to certificate file for serving DoH.
+	// DoTPort port for listening DNS over TLS, for example
+	// DefaultDoTPort.  If its zero, server will not run with DoT.
+	DoTPort uint16
+
+	// DoHCert path to certificate file for serving DoH and DoT.
 	DoHCert string
 
-	// DoHCertKey path to certificate key file for serving DoH.
+	// DoHCertKey path to certificate key file for serving DoH and DoT.
 	DoHCertKey string
 
 	// DoHAllowInsecure options to allow to serve DoH with self-signed
@@ -51,6 +55,7 @@ func (opts *ServerOptions) parse() error {
 		err := fmt.Errorf("Invalid address '%s'\n", opts.IPAddress)
 		return err
 	}
+	opts.ip = ip
 
 	if opts.UDPPort == 0 {
 		opts.UDPPort = DefaultPort
@@ -88,3 +93,18 @@ func (opts *ServerOptions) getDoHAddress() *net.TCPAddr {
 		Port: int(opts.DoHPort),
 	}
 }
+
+//
+// getDoTAddress return the DoT address, with DefaultDoTPort if DoTPort is
+// not set, since DoT is only served by ListenAndServe if DoTPort is set.
+//
+func (opts *ServerOptions) getDoTAddress() *net.TCPAddr {
+	port := opts.DoTPort
+	if port == 0 {
+		port = DefaultDoTPort
+	}
+	return &net.TCPAddr{
+		IP:   opts.ip,
+		Port: int(port),
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testSlowHandler is a handler that answer each query with empty response
+// after some delay.
+//
+type testSlowHandler struct {
+	delay time.Duration
+}
+
+func (h *testSlowHandler) ServeDNS(req *Request) {
+	go func() {
+		time.Sleep(h.delay)
+
+		res := newResponse(req.Message, RCodeOK)
+
+		_, err := res.Pack()
+		if err != nil {
+			FreeRequest(req)
+			return
+		}
+
+		req.Respond(res)
+	}()
+}
+
+func TestServerShutdown(t *testing.T) {
+	localhost := net.ParseIP("127.0.0.1")
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localhost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localhost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{
+		Handler: &testSlowHandler{
+			delay: 300 * time.Millisecond,
+		},
+	}
+
+	errUDP := make(chan error, 1)
+	errTCP := make(chan error, 1)
+
+	go func() {
+		errUDP <- srv.ServeUDP(udpConn)
+	}()
+	go func() {
+		errTCP <- srv.ServeTCP(tcpListener)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	test.Assert(t, "UDPAddr", udpConn.LocalAddr().String(),
+		srv.UDPAddr().String(), true)
+	test.Assert(t, "TCPAddr", tcpListener.Addr().String(),
+		srv.TCPAddr().String(), true)
+
+	udpClient, err := NewUDPClient(srv.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpClient, err := NewTCPClient(srv.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := NewMessage()
+	msg.Header.ID = 2000
+	msg.Header.QDCount = 1
+	msg.Question.Name = append(msg.Question.Name, "kilabit.info"...)
+
+	_, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send the queries before shutdown, the responses should be received
+	// after shutdown started.
+	resUDP := make(chan *Message, 1)
+	resTCP := make(chan *Message, 1)
+
+	go func() {
+		res, _ := udpClient.Query(msg, srv.UDPAddr())
+		resUDP <- res
+	}()
+	go func() {
+		res, _ := tcpClient.Query(msg, nil)
+		resTCP <- res
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-resUDP
+	test.Assert(t, "UDP response", true, res != nil, true)
+	test.Assert(t, "UDP response ID", msg.Header.ID, res.Header.ID, true)
+
+	res = <-resTCP
+	test.Assert(t, "TCP response", true, res != nil, true)
+	test.Assert(t, "TCP response ID", msg.Header.ID, res.Header.ID, true)
+
+	test.Assert(t, "ServeUDP", nil, <-errUDP, true)
+	test.Assert(t, "ServeTCP", nil, <-errTCP, true)
+
+	_ = udpClient.Close()
+	_ = tcpClient.Close()
+}
+
+func TestServerListenAndServeWithoutDoT(t *testing.T) {
+	srv := &Server{
+		Handler: &testSlowHandler{},
+	}
+
+	opts := &ServerOptions{
+		IPAddress:  "127.0.0.1",
+		UDPPort:    15300,
+		TCPPort:    15300,
+		DoHPort:    15443,
+		DoHCert:    "testdata/domain.crt",
+		DoHCertKey: "testdata/domain.key",
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe(opts)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	test.Assert(t, "DoHAddr", true, srv.DoHAddr() != nil, true)
+	test.Assert(t, "DoTAddr", true, srv.DoTAddr() == nil, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "ListenAndServe", nil, <-errc, true)
+}
@@ -5,6 +5,8 @@
 package dns
 
 import (
+	"fmt"
+	"io"
 	"net"
 	"time"
 
@@ -18,7 +20,7 @@ import (
 type TCPClient struct {
 	Timeout time.Duration
 	addr    *net.TCPAddr
-	conn    *net.TCPConn
+	conn    net.Conn
 }
 
 //
@@ -130,35 +132,82 @@ func (cl *TCPClient) Query(msg *Message, ns net.Addr) (*Message, error) {
 }
 
 //
-// Recv will read DNS message from active connection in client into `msg`.
+// Transfer request full zone transfer (AXFR) of zone origin from name
+// server.  On success, it will return all records in zone, started with
+// the zone SOA record.
 //
-func (cl *TCPClient) Recv(msg *Message) (n int, err error) {
-	err = cl.conn.SetReadDeadline(time.Now().Add(cl.Timeout))
+func (cl *TCPClient) Transfer(origin []byte) (rrs []*ResourceRecord, err error) {
+	msg := NewMessage()
+
+	msg.Header.ID = getNextID()
+	msg.Header.QDCount = 1
+	msg.Question.Type = QueryTypeAXFR
+	msg.Question.Class = QueryClassIN
+	msg.Question.Name = append(msg.Question.Name, origin...)
+
+	_, err = msg.Pack()
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	n, err = cl.conn.Read(msg.Packet)
+	_, err = cl.Send(msg, nil)
 	if err != nil {
-		return
-	}
-	if n == 0 {
-		return
+		return nil, err
 	}
 
-	msg.Packet = append(msg.Packet[:0], msg.Packet[:n]...)
-
-	if debug.Value >= 2 {
-		libbytes.PrintHex(">>> TCP msg.Packet:", msg.Packet, 8)
+	nsoa := 0
+	for nsoa < 2 {
+		res := NewMessage()
+
+		_, err = cl.Recv(res)
+		if err != nil {
+			return nil, err
+		}
+
+		err = res.Unpack()
+		if err != nil {
+			return nil, err
+		}
+		if res.Header.ID != msg.Header.ID {
+			return nil, fmt.Errorf("dns: Transfer: mismatch response ID %d, want %d",
+				res.Header.ID, msg.Header.ID)
+		}
+		if res.Header.RCode != RCodeOK {
+			return nil, fmt.Errorf("dns: Transfer: response code %d",
+				res.Header.RCode)
+		}
+		if len(res.Answer) == 0 {
+			return nil, fmt.Errorf("dns: Transfer: empty answer")
+		}
+
+		for _, rr := range res.Answer {
+			if rr.Type == QueryTypeSOA {
+				nsoa++
+				if nsoa == 2 {
+					break
+				}
+			} else if nsoa == 0 {
+				return nil, fmt.Errorf("dns: Transfer: missing SOA at the beginning")
+			}
+			rrs = append(rrs, rr)
+		}
 	}
 
-	msg.Packet = append(msg.Packet[:0], msg.Packet[2:]...)
+	return rrs, nil
+}
 
-	if debug.Value >= 2 {
-		libbytes.PrintHex(">>> DNS msg.Packet:", msg.Packet, 8)
+//
+// Recv will read DNS message from active connection in client into `msg`.
+// Each message in TCP connection is prefixed with two octets length field,
+// the length field is not included in the `msg.Packet`.
+//
+func (cl *TCPClient) Recv(msg *Message) (n int, err error) {
+	err = cl.conn.SetReadDeadline(time.Now().Add(cl.Timeout))
+	if err != nil {
+		return
 	}
 
-	return
+	return recvStream(cl.conn, msg)
 }
 
 //
@@ -173,14 +222,7 @@ func (cl *TCPClient) Send(msg *Message, addr net.Addr) (n int, err error) {
 		return
 	}
 
-	packet := make([]byte, 0)
-
-	libbytes.AppendUint16(&packet, uint16(len(msg.Packet)))
-	packet = append(packet, msg.Packet...)
-
-	n, err = cl.conn.Write(packet)
-
-	return
+	return sendStream(cl.conn, msg)
 }
 
 //
@@ -197,3 +239,46 @@ func (cl *TCPClient) SetRemoteAddr(addr string) (err error) {
 func (cl *TCPClient) SetTimeout(t time.Duration) {
 	cl.Timeout = t
 }
+
+//
+// recvStream read one DNS message, that is prefixed with two octets length
+// field, from stream connection (TCP or DoT) into msg.Packet.
+//
+func recvStream(r io.Reader, msg *Message) (n int, err error) {
+	var length [2]byte
+
+	_, err = io.ReadFull(r, length[:])
+	if err != nil {
+		return
+	}
+
+	size := int(length[0])<<8 | int(length[1])
+	if cap(msg.Packet) < size {
+		msg.Packet = make([]byte, size)
+	}
+	msg.Packet = msg.Packet[:size]
+
+	n, err = io.ReadFull(r, msg.Packet)
+	if err != nil {
+		return
+	}
+
+	if debug.Value >= 2 {
+		libbytes.PrintHex(">>> DNS msg.Packet:", msg.Packet, 8)
+	}
+
+	return
+}
+
+//
+// sendStream write the DNS message packet, prefixed with two octets length
+// field, into stream connection (TCP or DoT).
+//
+func sendStream(w io.Writer, msg *Message) (n int, err error) {
+	packet := make([]byte, 0, 2+len(msg.Packet))
+
+	libbytes.AppendUint16(&packet, uint16(len(msg.Packet)))
+	packet = append(packet, msg.Packet...)
+
+	return w.Write(packet)
+}
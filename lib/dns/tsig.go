@@ -0,0 +1,395 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+	"time"
+
+	libbytes "github.com/shuLhan/share/lib/bytes"
+)
+
+//
+// List of TSIG algorithm names (RFC 8945 section 6).
+//
+const (
+	TSIGAlgHMACMD5    = "hmac-md5.sig-alg.reg.int"
+	TSIGAlgHMACSHA1   = "hmac-sha1"
+	TSIGAlgHMACSHA224 = "hmac-sha224"
+	TSIGAlgHMACSHA256 = "hmac-sha256"
+	TSIGAlgHMACSHA384 = "hmac-sha384"
+	TSIGAlgHMACSHA512 = "hmac-sha512"
+)
+
+//
+// List of TSIG error codes, set in the Error field of TSIG record (RFC
+// 8945 section 3).
+//
+const (
+	TSIGErrBadSig  uint16 = 16
+	TSIGErrBadKey  uint16 = 17
+	TSIGErrBadTime uint16 = 18
+)
+
+const (
+	// defTSIGFudge define the default number of seconds of error
+	// permitted in time signed (RFC 8945 section 10).
+	defTSIGFudge = 300
+)
+
+//
+// List of TSIG errors.
+//
+var (
+	ErrTSIGAlgorithm = errors.New("tsig: unsupported algorithm")
+	ErrTSIGMissing   = errors.New("tsig: message is not signed")
+	ErrTSIGFormat    = errors.New("tsig: TSIG record is not the last record")
+	ErrTSIGBadKey    = errors.New("tsig: unknown key")
+	ErrTSIGBadSig    = errors.New("tsig: invalid MAC")
+	ErrTSIGBadTime   = errors.New("tsig: time signed is out of range")
+)
+
+//
+// TSIGKey define the shared secret key to sign and verify message.
+//
+type TSIGKey struct {
+	// Name of the key, in lowercase and without trailing dot.
+	Name string
+
+	// Algorithm is one of TSIG algorithm name.
+	Algorithm string
+
+	// Secret is the shared secret.
+	Secret []byte
+}
+
+//
+// NewTSIGKey create new TSIG key from its name, algorithm, and secret
+// encoded in base64, as in the "secret" statement of BIND key file.
+//
+func NewTSIGKey(name, algorithm, secret string) (key *TSIGKey, err error) {
+	key = &TSIGKey{
+		Name:      strings.ToLower(strings.TrimSuffix(name, ".")),
+		Algorithm: strings.ToLower(strings.TrimSuffix(algorithm, ".")),
+	}
+
+	_, err = tsigHash(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Secret, err = base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("dns: NewTSIGKey: invalid secret: %s", err)
+	}
+
+	return key, nil
+}
+
+//
+// tsigHash return the hash function of TSIG algorithm.
+//
+func tsigHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case TSIGAlgHMACMD5:
+		return md5.New, nil
+	case TSIGAlgHMACSHA1:
+		return sha1.New, nil
+	case TSIGAlgHMACSHA224:
+		return sha256.New224, nil
+	case TSIGAlgHMACSHA256:
+		return sha256.New, nil
+	case TSIGAlgHMACSHA384:
+		return sha512.New384, nil
+	case TSIGAlgHMACSHA512:
+		return sha512.New, nil
+	}
+	return nil, ErrTSIGAlgorithm
+}
+
+//
+// mac compute the MAC of data using the key.
+//
+func (key *TSIGKey) mac(data []byte) ([]byte, error) {
+	h, err := tsigHash(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(h, key.Secret)
+	mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+//
+// TSIGKeyring contains list of TSIG keys indexed by their name.
+//
+type TSIGKeyring struct {
+	sync.RWMutex
+	keys map[string]*TSIGKey
+}
+
+//
+// NewTSIGKeyring create and initialize new keyring.
+//
+func NewTSIGKeyring() *TSIGKeyring {
+	return &TSIGKeyring{
+		keys: make(map[string]*TSIGKey),
+	}
+}
+
+//
+// Add the key into keyring, replacing the key with the same name.
+//
+func (kr *TSIGKeyring) Add(key *TSIGKey) {
+	kr.Lock()
+	kr.keys[key.Name] = key
+	kr.Unlock()
+}
+
+//
+// Get the key by name.  It will return nil if key is not exist.
+//
+func (kr *TSIGKeyring) Get(name string) (key *TSIGKey) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	kr.RLock()
+	key = kr.keys[name]
+	kr.RUnlock()
+
+	return key
+}
+
+//
+// Remove the key from keyring.
+//
+func (kr *TSIGKeyring) Remove(name string) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	kr.Lock()
+	delete(kr.keys, name)
+	kr.Unlock()
+}
+
+//
+// TSIG return the TSIG record in the additional section of message, or
+// nil if message is not signed.
+//
+func (msg *Message) TSIG() *ResourceRecord {
+	if len(msg.Additional) == 0 {
+		return nil
+	}
+	rr := msg.Additional[len(msg.Additional)-1]
+	if rr.Type != QueryTypeTSIG || rr.TSIG == nil {
+		return nil
+	}
+	return rr
+}
+
+//
+// SignTSIG sign the message using the key and add the TSIG record at the
+// end of additional section (RFC 8945 section 5.3).  The previous TSIG
+// record, if its exist, will be replaced.
+//
+// For request, the reqMAC must be empty.  For response, the reqMAC is the
+// MAC of TSIG record in the request.
+//
+// The message will be repacked, so any changes to the message after
+// signing will invalidate the MAC.
+//
+func (msg *Message) SignTSIG(key *TSIGKey, reqMAC []byte) error {
+	return msg.signTSIG(key, reqMAC, time.Now(), 0)
+}
+
+func (msg *Message) signTSIG(key *TSIGKey, reqMAC []byte, now time.Time,
+	tsigErr uint16,
+) (err error) {
+	if msg.TSIG() != nil {
+		msg.Additional = msg.Additional[:len(msg.Additional)-1]
+	}
+
+	rr := &ResourceRecord{
+		Name:  []byte(key.Name),
+		Type:  QueryTypeTSIG,
+		Class: QueryClassANY,
+		TSIG: &RDataTSIG{
+			Algorithm:  []byte(key.Algorithm),
+			TimeSigned: uint64(now.Unix()),
+			Fudge:      defTSIGFudge,
+			OrigID:     msg.Header.ID,
+			Error:      tsigErr,
+		},
+	}
+	if tsigErr == TSIGErrBadTime {
+		rr.TSIG.Other = appendUint48(nil, uint64(now.Unix()))
+	}
+
+	_, err = msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	data := tsigData(reqMAC, msg.Packet, rr)
+
+	rr.TSIG.MAC, err = key.mac(data)
+	if err != nil {
+		return err
+	}
+
+	msg.Additional = append(msg.Additional, rr)
+
+	_, err = msg.Pack()
+
+	return err
+}
+
+//
+// VerifyTSIG verify the TSIG record of unpacked message using the key in
+// keyring (RFC 8945 section 5.2).  For response, the reqMAC is the MAC of
+// TSIG record in the request.  On success, it will return the key that
+// sign the message.
+//
+// If the key is known but the MAC is invalid or the time signed is out of
+// range, the returned key is not nil, so the server can sign the error
+// response.
+//
+func (msg *Message) VerifyTSIG(keyring *TSIGKeyring, reqMAC []byte) (
+	key *TSIGKey, err error,
+) {
+	return msg.verifyTSIG(keyring, reqMAC, time.Now())
+}
+
+func (msg *Message) verifyTSIG(keyring *TSIGKeyring, reqMAC []byte,
+	now time.Time,
+) (key *TSIGKey, err error) {
+	for x := 0; x < len(msg.Additional)-1; x++ {
+		if msg.Additional[x].Type == QueryTypeTSIG {
+			return nil, ErrTSIGFormat
+		}
+	}
+
+	rr := msg.TSIG()
+	if rr == nil || msg.tsigOff == 0 {
+		return nil, ErrTSIGMissing
+	}
+
+	key = keyring.Get(string(rr.Name))
+	if key == nil || !strings.EqualFold(key.Algorithm,
+		strings.TrimSuffix(string(rr.TSIG.Algorithm), ".")) {
+		return nil, ErrTSIGBadKey
+	}
+
+	// The MAC is computed using the original ID and the number of
+	// additional records without TSIG.
+	packet := make([]byte, msg.tsigOff)
+	copy(packet, msg.Packet)
+	libbytes.WriteUint16(&packet, 0, rr.TSIG.OrigID)
+	libbytes.WriteUint16(&packet, 10, uint16(len(msg.Additional)-1))
+
+	mac, err := key.mac(tsigData(reqMAC, packet, rr))
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, rr.TSIG.MAC) {
+		return key, ErrTSIGBadSig
+	}
+
+	signed := int64(rr.TSIG.TimeSigned)
+	fudge := int64(rr.TSIG.Fudge)
+	if now.Unix() < signed-fudge || now.Unix() > signed+fudge {
+		return key, ErrTSIGBadTime
+	}
+
+	return key, nil
+}
+
+//
+// newTSIGErrorResponse create the response for query that failed the TSIG
+// verification (RFC 8945 section 5.2).
+//
+// The response for unknown key or invalid MAC contains the unsigned TSIG
+// record with the error code.  The response for time signed out of range
+// is signed with the key and contains the current time.  Other errors are
+// answered with FORMERR.
+//
+func newTSIGErrorResponse(q *Message, key *TSIGKey, verr error) (
+	res *Message, err error,
+) {
+	tsig := q.TSIG()
+	if tsig == nil {
+		return newResponse(q, RCodeErrFormat), nil
+	}
+
+	res = newResponse(q, RCodeNotAuth)
+
+	var tsigErr uint16
+
+	switch verr {
+	case ErrTSIGBadTime:
+		err = res.signTSIG(key, tsig.TSIG.MAC, time.Now(), TSIGErrBadTime)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case ErrTSIGBadKey:
+		tsigErr = TSIGErrBadKey
+	case ErrTSIGBadSig:
+		tsigErr = TSIGErrBadSig
+	default:
+		return newResponse(q, RCodeErrFormat), nil
+	}
+
+	res.Additional = append(res.Additional, &ResourceRecord{
+		Name:  append([]byte(nil), tsig.Name...),
+		Type:  QueryTypeTSIG,
+		Class: QueryClassANY,
+		TSIG: &RDataTSIG{
+			Algorithm:  append([]byte(nil), tsig.TSIG.Algorithm...),
+			TimeSigned: tsig.TSIG.TimeSigned,
+			Fudge:      tsig.TSIG.Fudge,
+			OrigID:     q.Header.ID,
+			Error:      tsigErr,
+		},
+	})
+
+	return res, nil
+}
+
+//
+// tsigData return the data to be signed: the MAC of request if its not
+// empty, the message packet without TSIG record, and the TSIG variables
+// (RFC 8945 section 4.3).
+//
+func tsigData(reqMAC, packet []byte, rr *ResourceRecord) (data []byte) {
+	if len(reqMAC) > 0 {
+		libbytes.AppendUint16(&data, uint16(len(reqMAC)))
+		data = append(data, reqMAC...)
+	}
+
+	data = append(data, packet...)
+
+	data = append(data, packCanonicalName(rr.Name)...)
+	libbytes.AppendUint16(&data, rr.Class)
+	libbytes.AppendUint32(&data, rr.TTL)
+	data = append(data, packCanonicalName(rr.TSIG.Algorithm)...)
+	data = appendUint48(data, rr.TSIG.TimeSigned)
+	libbytes.AppendUint16(&data, rr.TSIG.Fudge)
+	libbytes.AppendUint16(&data, rr.TSIG.Error)
+	libbytes.AppendUint16(&data, uint16(len(rr.TSIG.Other)))
+	data = append(data, rr.TSIG.Other...)
+
+	return data
+}
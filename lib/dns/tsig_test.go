@@ -0,0 +1,188 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+// testTSIGSecret is the base64 of "secret-of-test-key".
+const testTSIGSecret = "c2VjcmV0LW9mLXRlc3Qta2V5"
+
+//
+// testUnpack return the new message from unpacking the packet of msg.
+//
+func testUnpack(t *testing.T, msg *Message) *Message {
+	out := NewMessage()
+	out.Packet = append(out.Packet[:0], msg.Packet...)
+
+	err := out.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func TestNewTSIGKey(t *testing.T) {
+	key, err := NewTSIGKey("Key.Example.", "HMAC-SHA256.", testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "Name", "key.example", key.Name, true)
+	test.Assert(t, "Algorithm", TSIGAlgHMACSHA256, key.Algorithm, true)
+	test.Assert(t, "Secret", "secret-of-test-key", string(key.Secret), true)
+
+	_, err = NewTSIGKey("key", "hmac-unknown", testTSIGSecret)
+	test.Assert(t, "error", ErrTSIGAlgorithm, err, true)
+}
+
+func TestMessageTSIG(t *testing.T) {
+	keyring := NewTSIGKeyring()
+
+	for _, alg := range []string{
+		TSIGAlgHMACMD5, TSIGAlgHMACSHA1, TSIGAlgHMACSHA256,
+		TSIGAlgHMACSHA512,
+	} {
+		t.Log(alg)
+
+		key, err := NewTSIGKey("key."+alg, alg, testTSIGSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring.Add(key)
+
+		q := NewMessage()
+		q.Header.ID = 10
+		q.Question.Name = []byte("WWW.Example.com")
+
+		err = q.SignTSIG(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := testUnpack(t, q)
+
+		gotKey, err := got.VerifyTSIG(keyring, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Assert(t, "key", key, gotKey, true)
+
+		// The response is signed using the MAC of request.
+		reqMAC := got.TSIG().TSIG.MAC
+
+		res := newResponse(got, RCodeOK)
+		res.Answer = append(res.Answer, newTestA("www.example.com", "10.0.0.1"))
+
+		err = res.SignTSIG(key, reqMAC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRes := testUnpack(t, res)
+
+		_, err = gotRes.VerifyTSIG(keyring, reqMAC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = gotRes.VerifyTSIG(keyring, nil)
+		test.Assert(t, "error without request MAC", ErrTSIGBadSig, err, true)
+	}
+}
+
+func TestMessageVerifyTSIG(t *testing.T) {
+	key, err := NewTSIGKey("key.example", TSIGAlgHMACSHA256, testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewTSIGKeyring()
+	keyring.Add(key)
+
+	now := time.Now()
+
+	cases := []struct {
+		desc   string
+		sign   func(msg *Message)
+		now    time.Time
+		expErr error
+	}{{
+		desc: "With unsigned message",
+		sign: func(msg *Message) {
+			_, _ = msg.Pack()
+		},
+		now:    now,
+		expErr: ErrTSIGMissing,
+	}, {
+		desc: "With unknown key",
+		sign: func(msg *Message) {
+			other := *key
+			other.Name = "other.example"
+			_ = msg.signTSIG(&other, nil, now, 0)
+		},
+		now:    now,
+		expErr: ErrTSIGBadKey,
+	}, {
+		desc: "With different secret",
+		sign: func(msg *Message) {
+			other := *key
+			other.Secret = []byte("other secret")
+			_ = msg.signTSIG(&other, nil, now, 0)
+		},
+		now:    now,
+		expErr: ErrTSIGBadSig,
+	}, {
+		desc: "With time signed in the past",
+		sign: func(msg *Message) {
+			_ = msg.signTSIG(key, nil, now.Add(-301*time.Second), 0)
+		},
+		now:    now,
+		expErr: ErrTSIGBadTime,
+	}, {
+		desc: "With time signed within fudge",
+		sign: func(msg *Message) {
+			_ = msg.signTSIG(key, nil, now.Add(-299*time.Second), 0)
+		},
+		now: now,
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		msg := NewMessage()
+		msg.Header.ID = 20
+		msg.Question.Name = []byte("example.com")
+
+		c.sign(msg)
+
+		got := testUnpack(t, msg)
+
+		_, err := got.verifyTSIG(keyring, nil, c.now)
+		test.Assert(t, "error", c.expErr, err, true)
+	}
+
+	// Modifying the message after signing should invalidate the MAC.
+	msg := NewMessage()
+	msg.Header.ID = 30
+	msg.Question.Name = []byte("example.com")
+
+	err = msg.SignTSIG(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg.Packet[sectionHeaderSize+1] = 'E'
+
+	got := testUnpack(t, msg)
+
+	_, err = got.VerifyTSIG(keyring, nil)
+	test.Assert(t, "error", ErrTSIGBadSig, err, true)
+}
@@ -99,6 +99,8 @@ func (cl *UDPClient) Lookup(qtype uint16, qclass uint16, qname []byte) (
 
 //
 // Query send DNS query to name server "ns" and return the unpacked response.
+// If the response is truncated, the query will be sent again to the same
+// name server using TCP.
 //
 func (cl *UDPClient) Query(msg *Message, ns net.Addr) (*Message, error) {
 	if ns == nil {
@@ -122,6 +124,34 @@ func (cl *UDPClient) Query(msg *Message, ns net.Addr) (*Message, error) {
 		return nil, err
 	}
 
+	if res.Header.IsTC && res.Header.ID == msg.Header.ID {
+		return cl.queryTCP(msg, ns)
+	}
+
+	return res, nil
+}
+
+//
+// queryTCP send the query to name server using new TCP connection.
+//
+func (cl *UDPClient) queryTCP(msg *Message, ns net.Addr) (*Message, error) {
+	tcl, err := NewTCPClient(ns.String())
+	if err != nil {
+		return nil, err
+	}
+
+	tcl.SetTimeout(cl.Timeout)
+
+	res, err := tcl.Query(msg, nil)
+
+	errClose := tcl.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	return res, nil
 }
 
@@ -5,7 +5,9 @@
 package dns
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/shuLhan/share/lib/test"
 )
@@ -152,3 +154,43 @@ func TestUDPClientLookup(t *testing.T) {
 		test.Assert(t, "Packet", c.exp.Packet, got.Packet, true)
 	}
 }
+
+func TestUDPClientQueryTruncated(t *testing.T) {
+	srv, h, addr := newTestWalkServer(t, "127.0.0.1", 0, newTestBigZone(t))
+
+	time.Sleep(100 * time.Millisecond)
+
+	cl, err := NewUDPClient(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := NewMessage()
+	msg.Header.ID = 300
+	msg.Question.Name = []byte("big.test")
+
+	_, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cl.Query(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "ID", uint16(300), res.Header.ID, true)
+	test.Assert(t, "IsTC", false, res.Header.IsTC, true)
+	test.Assert(t, "Answer", 60, len(res.Answer), true)
+
+	// The query is sent twice, through UDP and then TCP.
+	test.Assert(t, "queries", []string{"big.test", "big.test"},
+		h.queries(), true)
+
+	_ = cl.Close()
+
+	err = srv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
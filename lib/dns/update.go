@@ -0,0 +1,335 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"strings"
+)
+
+//
+// NewUpdate create new dynamic update message (RFC 2136) for zone.
+//
+// The records in Answer section are the prerequisites and the records in
+// Authority section are the updates.  To add the record to zone, set the
+// record class to the zone class.  To delete the RRset, set the record
+// class to QueryClassANY without RDATA; use type QueryTypeALL to delete
+// all RRsets on the name.  To delete the specific record, set the record
+// class to QueryClassNONE.  The TTL of deleted records must be zero.
+//
+func NewUpdate(zone string) *Message {
+	msg := NewMessage()
+
+	msg.Header.Op = OpCodeUpdate
+	msg.Header.IsRD = false
+	msg.Question.Name = []byte(strings.TrimSuffix(zone, "."))
+	msg.Question.Type = QueryTypeSOA
+	msg.Question.Class = QueryClassIN
+
+	return msg
+}
+
+//
+// applyUpdate check the prerequisites and apply the updates in message to
+// zone (RFC 2136 section 3).  It will return the response code of update.
+//
+func (zone *Zone) applyUpdate(msg *Message) ResponseCode {
+	zclass := msg.Question.Class
+
+	zone.Lock()
+	defer zone.Unlock()
+
+	rcode := zone.checkPrerequisites(msg.Answer, zclass)
+	if rcode != RCodeOK {
+		return rcode
+	}
+
+	rcode = zone.prescanUpdates(msg.Authority, zclass)
+	if rcode != RCodeOK {
+		return rcode
+	}
+
+	j := &zoneJournal{
+		from: zone.SOA,
+	}
+
+	for _, rr := range msg.Authority {
+		switch rr.Class {
+		case QueryClassANY:
+			zone.updateDeleteRRSet(j, rr)
+		case QueryClassNONE:
+			zone.updateDeleteRR(j, rr, zclass)
+		default:
+			rr, err := rr.clone()
+			if err != nil {
+				return RCodeErrServer
+			}
+			zone.updateAdd(j, rr)
+		}
+	}
+
+	if len(j.deleted) == 0 && len(j.added) == 0 && j.to == nil {
+		return RCodeOK
+	}
+
+	zone.commit(j)
+
+	return RCodeOK
+}
+
+//
+// checkPrerequisites check the prerequisite section of update (RFC 2136
+// section 3.2).
+//
+func (zone *Zone) checkPrerequisites(prereqs []*ResourceRecord, zclass uint16) (
+	rcode ResponseCode,
+) {
+	var values []*ResourceRecord
+
+	for _, rr := range prereqs {
+		if rr.TTL != 0 {
+			return RCodeErrFormat
+		}
+
+		name := string(rr.Name)
+		if !zone.isIn(name) {
+			return RCodeNotZone
+		}
+
+		switch rr.Class {
+		case QueryClassANY:
+			if !rr.isEmptyRData() {
+				return RCodeErrFormat
+			}
+			if rr.Type == QueryTypeALL {
+				if len(zone.records[name]) == 0 {
+					return RCodeErrName
+				}
+			} else if len(zone.get(name, rr.Type, zclass)) == 0 {
+				return RCodeNXRRSet
+			}
+
+		case QueryClassNONE:
+			if !rr.isEmptyRData() {
+				return RCodeErrFormat
+			}
+			if rr.Type == QueryTypeALL {
+				if len(zone.records[name]) > 0 {
+					return RCodeYXDomain
+				}
+			} else if len(zone.get(name, rr.Type, zclass)) > 0 {
+				return RCodeYXRRSet
+			}
+
+		case zclass:
+			values = append(values, rr)
+
+		default:
+			return RCodeErrFormat
+		}
+	}
+
+	// The value dependent prerequisites: the RRset in zone must be
+	// equal with the RRset in prerequisites.
+	for _, rr := range values {
+		rrset := zone.get(string(rr.Name), rr.Type, zclass)
+
+		n := 0
+		for _, in := range rrset {
+			for _, v := range values {
+				if in.isEqual(v) {
+					n++
+					break
+				}
+			}
+		}
+		if n != len(rrset) || !containsRR(rrset, rr) {
+			return RCodeNXRRSet
+		}
+	}
+
+	return RCodeOK
+}
+
+//
+// prescanUpdates check the update section for invalid records (RFC 2136
+// section 3.4.1).
+//
+func (zone *Zone) prescanUpdates(updates []*ResourceRecord, zclass uint16) (
+	rcode ResponseCode,
+) {
+	for _, rr := range updates {
+		if !zone.isIn(string(rr.Name)) {
+			return RCodeNotZone
+		}
+
+		switch rr.Class {
+		case zclass:
+			if isMetaType(rr.Type) {
+				return RCodeErrFormat
+			}
+		case QueryClassANY:
+			if rr.TTL != 0 || !rr.isEmptyRData() {
+				return RCodeErrFormat
+			}
+			if isMetaType(rr.Type) && rr.Type != QueryTypeALL {
+				return RCodeErrFormat
+			}
+		case QueryClassNONE:
+			if rr.TTL != 0 || isMetaType(rr.Type) {
+				return RCodeErrFormat
+			}
+		default:
+			return RCodeErrFormat
+		}
+	}
+
+	return RCodeOK
+}
+
+//
+// updateAdd add the record to zone (RFC 2136 section 3.4.2.2).
+//
+// The new SOA is applied only if its serial is greater than the current
+// serial.  The CNAME record is ignored if the name has other records, and
+// other records are ignored if the name has CNAME record.  The existing
+// CNAME record is replaced with the new one.
+//
+func (zone *Zone) updateAdd(j *zoneJournal, rr *ResourceRecord) {
+	name := string(rr.Name)
+
+	if rr.Type == QueryTypeSOA {
+		if name != zone.Origin || zone.SOA == nil {
+			return
+		}
+		if !serialLess(zone.SOA.SOA.Serial, rr.SOA.Serial) {
+			return
+		}
+		j.to = rr
+		return
+	}
+
+	rrs := append([]*ResourceRecord(nil), zone.records[name]...)
+
+	for _, in := range rrs {
+		isCNAME := in.Type == QueryTypeCNAME
+		if isCNAME != (rr.Type == QueryTypeCNAME) {
+			return
+		}
+	}
+
+	for _, in := range rrs {
+		if in.Type == QueryTypeCNAME {
+			zone.updateRemove(j, in)
+			continue
+		}
+		if in.isEqual(rr) {
+			if in.TTL == rr.TTL {
+				return
+			}
+			zone.updateRemove(j, in)
+		}
+	}
+
+	zone.add(rr)
+
+	for x, del := range j.deleted {
+		if del.isEqual(rr) && del.TTL == rr.TTL {
+			j.deleted = append(j.deleted[:x], j.deleted[x+1:]...)
+			return
+		}
+	}
+	j.added = append(j.added, rr)
+}
+
+//
+// updateDeleteRRSet delete the RRset, or all RRsets if type is
+// QueryTypeALL, on the name (RFC 2136 section 3.4.2.3).  The SOA and NS
+// RRsets on zone origin are not deleted.
+//
+func (zone *Zone) updateDeleteRRSet(j *zoneJournal, rr *ResourceRecord) {
+	name := string(rr.Name)
+	rrs := append([]*ResourceRecord(nil), zone.records[name]...)
+
+	for _, in := range rrs {
+		if rr.Type != QueryTypeALL && in.Type != rr.Type {
+			continue
+		}
+		if name == zone.Origin && (in.Type == QueryTypeSOA ||
+			in.Type == QueryTypeNS) {
+			continue
+		}
+		zone.updateRemove(j, in)
+	}
+}
+
+//
+// updateDeleteRR delete the record from RRset (RFC 2136 section 3.4.2.4).
+// The SOA record and the last NS record on zone origin are not deleted.
+//
+func (zone *Zone) updateDeleteRR(j *zoneJournal, rr *ResourceRecord,
+	zclass uint16,
+) {
+	name := string(rr.Name)
+
+	if rr.Type == QueryTypeSOA {
+		return
+	}
+	if rr.Type == QueryTypeNS && name == zone.Origin &&
+		len(zone.get(name, QueryTypeNS, zclass)) <= 1 {
+		return
+	}
+
+	target := *rr
+	target.Class = zclass
+
+	rrs := append([]*ResourceRecord(nil), zone.records[name]...)
+	for _, in := range rrs {
+		if in.isEqual(&target) {
+			zone.updateRemove(j, in)
+		}
+	}
+}
+
+//
+// updateRemove remove the record from zone and record it in journal.  If
+// the record is added by the same update, it will be removed from the
+// journal instead.
+//
+func (zone *Zone) updateRemove(j *zoneJournal, rr *ResourceRecord) {
+	zone.remove(rr)
+
+	for x, add := range j.added {
+		if add == rr {
+			j.added = append(j.added[:x], j.added[x+1:]...)
+			return
+		}
+	}
+	j.deleted = append(j.deleted, rr)
+}
+
+//
+// containsRR will return true if rrs contains record that is equal to rr.
+//
+func containsRR(rrs []*ResourceRecord, rr *ResourceRecord) bool {
+	for _, in := range rrs {
+		if in.isEqual(rr) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// isMetaType will return true if type is meta-type or query type, that
+// can not be stored in zone.
+//
+func isMetaType(qtype uint16) bool {
+	switch qtype {
+	case QueryTypeOPT, QueryTypeTSIG, QueryTypeIXFR, QueryTypeAXFR,
+		QueryTypeMAILB, QueryTypeMAILA, QueryTypeALL:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// newTestUpdateRequest create the request for update message that sent
+// from ip address.
+//
+func newTestUpdateRequest(sender Sender, msg *Message, ip string) *Request {
+	req := AllocRequest()
+	req.Kind = ConnTypeUDP
+	req.Sender = sender
+	req.UDPAddr = &net.UDPAddr{IP: net.ParseIP(ip)}
+	req.Message.Packet = append(req.Message.Packet[:0], msg.Packet...)
+	req.Message.UnpackHeaderQuestion()
+
+	return req
+}
+
+func newTestRR(name string, qtype, qclass uint16, value string) *ResourceRecord {
+	rr := &ResourceRecord{
+		Name:  []byte(name),
+		Type:  qtype,
+		Class: qclass,
+	}
+	if len(value) > 0 {
+		rr.Text = &RDataText{
+			Value: []byte(value),
+		}
+	}
+	return rr
+}
+
+func TestZoneHandlerUpdate(t *testing.T) {
+	zh := NewZoneHandler()
+
+	err := zh.LoadMaster("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewTSIGKey("dhcp.example.com", TSIGAlgHMACSHA256,
+		testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zh.Keyring = NewTSIGKeyring()
+	zh.Keyring.Add(key)
+
+	_, localnet, _ := net.ParseCIDR("127.0.0.0/8")
+	zh.AllowUpdate = []*net.IPNet{localnet}
+
+	zone := zh.findZone("example.com")
+	serial := zone.SOA.SOA.Serial
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	host := newTestRR("host.example.com", QueryTypeA, QueryClassIN, "10.0.0.10")
+	host.TTL = 300
+
+	cases := []struct {
+		desc     string
+		zone     string
+		ip       string
+		key      *TSIGKey
+		prereqs  []*ResourceRecord
+		updates  []*ResourceRecord
+		expRCode ResponseCode
+		expTSIG  bool
+		qname    string
+		qtype    uint16
+		exp      []string
+	}{{
+		desc:     "With client not allowed",
+		zone:     "example.com",
+		ip:       "10.0.0.1",
+		updates:  []*ResourceRecord{host},
+		expRCode: RCodeRefused,
+		qname:    "host.example.com",
+		qtype:    QueryTypeA,
+	}, {
+		desc: "With unknown key",
+		zone: "example.com",
+		ip:   "10.0.0.1",
+		key: &TSIGKey{
+			Name:      "other.example.com",
+			Algorithm: TSIGAlgHMACSHA256,
+			Secret:    key.Secret,
+		},
+		updates:  []*ResourceRecord{host},
+		expRCode: RCodeNotAuth,
+		qname:    "host.example.com",
+		qtype:    QueryTypeA,
+	}, {
+		desc:     "With unknown zone",
+		zone:     "example.org",
+		ip:       "10.0.0.1",
+		key:      key,
+		updates:  []*ResourceRecord{host},
+		expRCode: RCodeNotAuth,
+		expTSIG:  true,
+	}, {
+		desc:     "With name outside zone",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		updates:  []*ResourceRecord{newTestRR("host.example.org", QueryTypeA, QueryClassIN, "10.0.0.10")},
+		expRCode: RCodeNotZone,
+	}, {
+		desc:     "With prerequisite name not in use failed",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		prereqs:  []*ResourceRecord{newTestRR("web.example.com", QueryTypeALL, QueryClassNONE, "")},
+		updates:  []*ResourceRecord{newTestRR("web.example.com", QueryTypeA, QueryClassIN, "10.0.0.10")},
+		expRCode: RCodeYXDomain,
+		qname:    "web.example.com",
+		qtype:    QueryTypeA,
+		exp:      []string{"10.0.0.4"},
+	}, {
+		desc:     "With prerequisite RRset exists failed",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		prereqs:  []*ResourceRecord{newTestRR("host.example.com", QueryTypeA, QueryClassANY, "")},
+		updates:  []*ResourceRecord{host},
+		expRCode: RCodeNXRRSet,
+		qname:    "host.example.com",
+		qtype:    QueryTypeA,
+	}, {
+		desc:    "With signed add",
+		zone:    "example.com",
+		ip:      "10.0.0.1",
+		key:     key,
+		prereqs: []*ResourceRecord{newTestRR("host.example.com", QueryTypeALL, QueryClassNONE, "")},
+		updates: []*ResourceRecord{
+			host,
+			newTestRR("host.example.com", QueryTypeAAAA, QueryClassIN, "::10"),
+		},
+		expRCode: RCodeOK,
+		expTSIG:  true,
+		qname:    "host.example.com",
+		qtype:    QueryTypeALL,
+		exp:      []string{"10.0.0.10", "::10"},
+	}, {
+		desc:     "With value dependent prerequisite failed",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		prereqs:  []*ResourceRecord{newTestRR("host.example.com", QueryTypeA, QueryClassIN, "10.0.0.11")},
+		updates:  []*ResourceRecord{newTestRR("host.example.com", QueryTypeA, QueryClassANY, "")},
+		expRCode: RCodeNXRRSet,
+		qname:    "host.example.com",
+		qtype:    QueryTypeA,
+		exp:      []string{"10.0.0.10"},
+	}, {
+		desc:    "With replace RRset",
+		zone:    "example.com",
+		ip:      "127.0.0.1",
+		prereqs: []*ResourceRecord{newTestRR("host.example.com", QueryTypeA, QueryClassIN, "10.0.0.10")},
+		updates: []*ResourceRecord{
+			newTestRR("host.example.com", QueryTypeA, QueryClassANY, ""),
+			newTestRR("host.example.com", QueryTypeA, QueryClassIN, "10.0.0.11"),
+		},
+		expRCode: RCodeOK,
+		qname:    "host.example.com",
+		qtype:    QueryTypeA,
+		exp:      []string{"10.0.0.11"},
+	}, {
+		desc:     "With delete specific record",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		updates:  []*ResourceRecord{newTestRR("host.example.com", QueryTypeAAAA, QueryClassNONE, "::10")},
+		expRCode: RCodeOK,
+		qname:    "host.example.com",
+		qtype:    QueryTypeALL,
+		exp:      []string{"10.0.0.11"},
+	}, {
+		desc:     "With CNAME on name with other records",
+		zone:     "example.com",
+		ip:       "127.0.0.1",
+		updates:  []*ResourceRecord{newTestRR("host.example.com", QueryTypeCNAME, QueryClassIN, "web.example.com")},
+		expRCode: RCodeOK,
+		qname:    "host.example.com",
+		qtype:    QueryTypeALL,
+		exp:      []string{"10.0.0.11"},
+	}, {
+		desc: "With delete all RRsets on zone origin",
+		zone: "example.com",
+		ip:   "127.0.0.1",
+		updates: []*ResourceRecord{
+			newTestRR("example.com", QueryTypeALL, QueryClassANY, ""),
+			newTestRR("host.example.com", QueryTypeALL, QueryClassANY, ""),
+		},
+		expRCode: RCodeOK,
+		qname:    "example.com",
+		qtype:    QueryTypeNS,
+		exp:      []string{"ns1.example.com"},
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		msg := NewUpdate(c.zone)
+		msg.Header.ID = 1
+		msg.Answer = c.prereqs
+		msg.Authority = c.updates
+
+		if c.key != nil {
+			err = msg.SignTSIG(c.key, nil)
+		} else {
+			_, err = msg.Pack()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqTSIG := msg.TSIG()
+
+		zh.ServeDNS(newTestUpdateRequest(sender, msg, c.ip))
+		res := <-sender.C
+
+		test.Assert(t, "Op", OpCodeUpdate, res.Header.Op, true)
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+
+		if c.expTSIG {
+			_, err = res.VerifyTSIG(zh.Keyring, reqTSIG.TSIG.MAC)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(c.qname) == 0 {
+			continue
+		}
+
+		var got []string
+		for _, rr := range zone.get(c.qname, c.qtype, QueryClassIN) {
+			got = append(got, testRDataString(rr))
+		}
+		test.Assert(t, "records", c.exp, got, true)
+	}
+
+	test.Assert(t, "host.example.com exist", 0,
+		len(zone.records["host.example.com"]), true)
+	test.Assert(t, "SOA exist", 1,
+		len(zone.get("example.com", QueryTypeSOA, QueryClassIN)), true)
+
+	// Each successful update that change the zone increment the serial.
+	test.Assert(t, "serial", serial+4, zone.SOA.SOA.Serial, true)
+}
@@ -0,0 +1,392 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// UpstreamPolicy define how the upstream pool select the upstream for each
+// query.
+//
+type UpstreamPolicy int
+
+//
+// List of upstream policies.
+//
+const (
+	// UpstreamFailover send the query to the first upstream, and to the
+	// next upstream if its failed.
+	UpstreamFailover UpstreamPolicy = iota
+
+	// UpstreamRoundRobin send each query to the next upstream in turn.
+	UpstreamRoundRobin
+
+	// UpstreamFastest send the query to the upstream with the lowest
+	// average round-trip time.
+	UpstreamFastest
+)
+
+const (
+	defUpstreamMaxFails      = 3
+	defUpstreamProbeInterval = 10 * time.Second
+)
+
+//
+// errUpstreamPoolEmpty is returned when creating upstream pool without
+// client.
+//
+var errUpstreamPoolEmpty = errors.New("dns: UpstreamPool: empty upstream")
+
+//
+// errUpstreamPoolNoResponse is returned by Recv when there is no response
+// of message sent using Send.
+//
+var errUpstreamPoolNoResponse = errors.New("dns: UpstreamPool: no response to receive")
+
+//
+// UpstreamPoolOptions describes options for upstream pool.
+//
+type UpstreamPoolOptions struct {
+	// Policy define how the upstream is selected for each query,
+	// default to UpstreamFailover.
+	Policy UpstreamPolicy
+
+	// MaxFails define the number of consecutive failures before the
+	// upstream is marked as down, default to 3.
+	MaxFails int
+
+	// ProbeInterval define the interval to probe the upstreams that
+	// are marked as down, default to 10 seconds.
+	ProbeInterval time.Duration
+}
+
+func (opts *UpstreamPoolOptions) init() {
+	if opts.MaxFails <= 0 {
+		opts.MaxFails = defUpstreamMaxFails
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = defUpstreamProbeInterval
+	}
+}
+
+//
+// UpstreamPool is a Client that send the query to one of several upstream
+// clients, which can be mixed of UDP, TCP, DoT, or DoH clients.
+//
+// If the query to upstream is failed, for example because of timeout, the
+// query is sent to the next upstream.  The upstream that failed several
+// times in a row is marked as down and will only be used if all other
+// upstreams are failed.  The down upstream is probed periodically, using
+// the query of NS records of root zone, and marked as up when its respond.
+//
+// The Query method is safe to be used concurrently.  The response of each
+// successful Send is queued and returned by Recv in the same order, without
+// matching the message ID, so the Send and Recv should be used by one
+// goroutine at a time.
+//
+type UpstreamPool struct {
+	opts      UpstreamPoolOptions
+	upstreams []*poolUpstream
+
+	// next contains the counter for round-robin policy.
+	next uint32
+
+	// recvq contains the responses of message sent using Send, that
+	// has not been consumed by Recv.
+	recvLock sync.Mutex
+	recvq    []*Message
+
+	done chan struct{}
+}
+
+//
+// poolUpstream contains the upstream client and its health status.
+//
+type poolUpstream struct {
+	// Mutex protect the client, because client connection can only be
+	// used by one query at a time.
+	sync.Mutex
+	cl Client
+
+	// fails contains the number of consecutive failures.
+	fails int32
+
+	// rtt contains the average round-trip time in nanoseconds.
+	rtt int64
+}
+
+//
+// NewUpstreamPool create and initialize new pool of upstream clients.  If
+// opts is nil, the default options will be used.  The pool will probe the
+// down upstreams in the background until its closed.
+//
+func NewUpstreamPool(opts *UpstreamPoolOptions, clients ...Client) (
+	pool *UpstreamPool, err error,
+) {
+	if len(clients) == 0 {
+		return nil, errUpstreamPoolEmpty
+	}
+
+	pool = &UpstreamPool{
+		done: make(chan struct{}),
+	}
+	if opts != nil {
+		pool.opts = *opts
+	}
+	pool.opts.init()
+
+	for _, cl := range clients {
+		pool.upstreams = append(pool.upstreams, &poolUpstream{
+			cl: cl,
+		})
+	}
+
+	go pool.probing()
+
+	return pool, nil
+}
+
+//
+// Close stop probing the upstreams and close all upstream clients.
+//
+func (pool *UpstreamPool) Close() (err error) {
+	close(pool.done)
+
+	for _, up := range pool.upstreams {
+		errClose := up.cl.Close()
+		if errClose != nil {
+			err = errClose
+		}
+	}
+
+	return err
+}
+
+//
+// Query send the query to upstream selected by policy.  If the upstream
+// failed, the query is sent to the next upstream until one of them return
+// a valid response.
+// The addr parameter is unused.
+//
+func (pool *UpstreamPool) Query(msg *Message, ns net.Addr) (
+	res *Message, err error,
+) {
+	for _, up := range pool.order() {
+		res, err = pool.query(up, msg)
+		if err == nil {
+			return res, nil
+		}
+	}
+
+	return nil, err
+}
+
+//
+// query send the query to upstream and update its health status.
+//
+func (pool *UpstreamPool) query(up *poolUpstream, msg *Message) (
+	res *Message, err error,
+) {
+	start := time.Now()
+
+	up.Lock()
+	res, err = up.cl.Query(msg, nil)
+	up.Unlock()
+
+	if err == nil {
+		err = isResponseTo(msg, res)
+	}
+	if err != nil {
+		atomic.AddInt32(&up.fails, 1)
+		return nil, err
+	}
+
+	up.success(time.Since(start))
+
+	return res, nil
+}
+
+//
+// order return the upstreams in order that they will be queried based on
+// policy.  The down upstreams are put at the end, in their original order.
+//
+func (pool *UpstreamPool) order() []*poolUpstream {
+	var ups, downs []*poolUpstream
+
+	for _, up := range pool.upstreams {
+		if up.isDown(pool.opts.MaxFails) {
+			downs = append(downs, up)
+		} else {
+			ups = append(ups, up)
+		}
+	}
+
+	switch pool.opts.Policy {
+	case UpstreamRoundRobin:
+		if len(ups) > 1 {
+			n := atomic.AddUint32(&pool.next, 1) - 1
+			start := int(n % uint32(len(ups)))
+			ups = append(ups[start:], ups[:start]...)
+		}
+	case UpstreamFastest:
+		sort.SliceStable(ups, func(x, y int) bool {
+			return atomic.LoadInt64(&ups[x].rtt) <
+				atomic.LoadInt64(&ups[y].rtt)
+		})
+	}
+
+	return append(ups, downs...)
+}
+
+//
+// probing probe the down upstreams periodically until the pool is closed.
+//
+func (pool *UpstreamPool) probing() {
+	ticker := time.NewTicker(pool.opts.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.done:
+			return
+		case <-ticker.C:
+			pool.probe()
+		}
+	}
+}
+
+//
+// probe send the query of NS records of root zone to each down upstreams.
+// The upstream that respond the query will be marked as up.
+//
+func (pool *UpstreamPool) probe() {
+	for _, up := range pool.upstreams {
+		if !up.isDown(pool.opts.MaxFails) {
+			continue
+		}
+
+		msg := NewMessage()
+		msg.Header.ID = getNextID()
+		msg.Question.Type = QueryTypeNS
+
+		_, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+
+		_, _ = pool.query(up, msg)
+	}
+}
+
+//
+// RemoteAddr return the remote address of all upstreams, separated by
+// comma.
+//
+func (pool *UpstreamPool) RemoteAddr() string {
+	addrs := make([]string, 0, len(pool.upstreams))
+	for _, up := range pool.upstreams {
+		addrs = append(addrs, up.cl.RemoteAddr())
+	}
+	return strings.Join(addrs, ",")
+}
+
+//
+// Recv read the oldest response of message that sent using Send.  If there
+// is no response, because the message has not been sent or the Send was
+// failed, it will return an error instead of waiting.  The response is not
+// matched with the message ID; use Query instead to send the message
+// concurrently.
+//
+func (pool *UpstreamPool) Recv(msg *Message) (int, error) {
+	pool.recvLock.Lock()
+	if len(pool.recvq) == 0 {
+		pool.recvLock.Unlock()
+		return 0, errUpstreamPoolNoResponse
+	}
+	res := pool.recvq[0]
+	pool.recvq[0] = nil
+	pool.recvq = pool.recvq[1:]
+	pool.recvLock.Unlock()
+
+	msg.Packet = append(msg.Packet[:0], res.Packet...)
+
+	err := msg.Unpack()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(msg.Packet), nil
+}
+
+//
+// Send the message using Query, and queue the response to be consumed by
+// Recv.  If the query failed, the error is returned and nothing is queued.
+// The addr parameter is unused.
+//
+func (pool *UpstreamPool) Send(msg *Message, addr net.Addr) (int, error) {
+	res, err := pool.Query(msg, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	pool.recvLock.Lock()
+	pool.recvq = append(pool.recvq, res)
+	pool.recvLock.Unlock()
+
+	return len(msg.Packet), nil
+}
+
+//
+// SetRemoteAddr is not supported by upstream pool, it will always return
+// an error.
+//
+func (pool *UpstreamPool) SetRemoteAddr(addr string) error {
+	return fmt.Errorf("dns: UpstreamPool: SetRemoteAddr is not supported")
+}
+
+//
+// SetTimeout set the timeout for sending and receiving packet on all
+// upstreams.
+//
+func (pool *UpstreamPool) SetTimeout(t time.Duration) {
+	for _, up := range pool.upstreams {
+		up.Lock()
+		up.cl.SetTimeout(t)
+		up.Unlock()
+	}
+}
+
+//
+// isDown will return true if the number of consecutive failures reach the
+// maxFails.
+//
+func (up *poolUpstream) isDown(maxFails int) bool {
+	return int(atomic.LoadInt32(&up.fails)) >= maxFails
+}
+
+//
+// success reset the number of failures and update the average round-trip
+// time.
+//
+func (up *poolUpstream) success(rtt time.Duration) {
+	atomic.StoreInt32(&up.fails, 0)
+
+	avg := atomic.LoadInt64(&up.rtt)
+	if avg == 0 {
+		avg = int64(rtt)
+	} else {
+		avg = (avg*7 + int64(rtt)) / 8
+	}
+	atomic.StoreInt64(&up.rtt, avg)
+}
@@ -0,0 +1,249 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testPoolClient is a client that answer any query with A record of its
+// name after some delay, or return timeout error if its failed.
+//
+type testPoolClient struct {
+	name   string
+	delay  time.Duration
+	isFail int32
+	nquery int32
+}
+
+func (cl *testPoolClient) Close() error                         { return nil }
+func (cl *testPoolClient) RemoteAddr() string                   { return cl.name }
+func (cl *testPoolClient) SetTimeout(t time.Duration)           {}
+func (cl *testPoolClient) SetRemoteAddr(addr string) error      { return nil }
+func (cl *testPoolClient) Recv(msg *Message) (int, error)       { return 0, nil }
+func (cl *testPoolClient) Send(*Message, net.Addr) (int, error) { return 0, nil }
+
+func (cl *testPoolClient) Query(msg *Message, ns net.Addr) (*Message, error) {
+	atomic.AddInt32(&cl.nquery, 1)
+
+	if atomic.LoadInt32(&cl.isFail) == 1 {
+		return nil, errors.New("i/o timeout")
+	}
+
+	time.Sleep(cl.delay)
+
+	res := newResponse(msg, RCodeOK)
+	res.Answer = []*ResourceRecord{{
+		Name:  msg.Question.Name,
+		Type:  QueryTypeA,
+		Class: QueryClassIN,
+		TTL:   60,
+		Text: &RDataText{
+			Value: []byte(cl.name),
+		},
+	}}
+
+	_, err := res.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	unpacked := NewMessage()
+	unpacked.Packet = append(unpacked.Packet[:0], res.Packet...)
+
+	err = unpacked.Unpack()
+	if err != nil {
+		return nil, err
+	}
+
+	return unpacked, nil
+}
+
+func (cl *testPoolClient) setFail(isFail bool) {
+	if isFail {
+		atomic.StoreInt32(&cl.isFail, 1)
+	} else {
+		atomic.StoreInt32(&cl.isFail, 0)
+	}
+}
+
+func testPoolQuery(t *testing.T, pool *UpstreamPool) string {
+	msg := NewMessage()
+	msg.Header.ID = 1
+	msg.Question.Name = []byte("kilabit.info")
+
+	_, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := pool.Query(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(res.Answer[0].Text.Value)
+}
+
+func TestUpstreamPoolFailover(t *testing.T) {
+	cl1 := &testPoolClient{name: "10.0.0.1"}
+	cl2 := &testPoolClient{name: "10.0.0.2"}
+
+	pool, err := NewUpstreamPool(&UpstreamPoolOptions{
+		MaxFails:      2,
+		ProbeInterval: time.Hour,
+	}, cl1, cl2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	test.Assert(t, "answer", "10.0.0.1", testPoolQuery(t, pool), true)
+
+	// The query to failed upstream is retried to the next upstream.
+	cl1.setFail(true)
+
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+	test.Assert(t, "cl1 nquery", int32(3), atomic.LoadInt32(&cl1.nquery), true)
+
+	// After two failures the first upstream is down and should not be
+	// queried.
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+	test.Assert(t, "cl1 nquery", int32(3), atomic.LoadInt32(&cl1.nquery), true)
+
+	// Probing the failed upstream does not mark it as up.
+	pool.probe()
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+
+	cl1.setFail(false)
+	pool.probe()
+	test.Assert(t, "answer", "10.0.0.1", testPoolQuery(t, pool), true)
+
+	// If all upstreams are down, the down upstreams is still queried.
+	cl1.setFail(true)
+	cl2.setFail(true)
+	for x := 0; x < 2; x++ {
+		_, err = pool.Query(NewMessage(), nil)
+		test.Assert(t, "error", true, err != nil, true)
+	}
+
+	cl2.setFail(false)
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+}
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	cl1 := &testPoolClient{name: "10.0.0.1"}
+	cl2 := &testPoolClient{name: "10.0.0.2"}
+	cl3 := &testPoolClient{name: "10.0.0.3"}
+
+	pool, err := NewUpstreamPool(&UpstreamPoolOptions{
+		Policy:        UpstreamRoundRobin,
+		MaxFails:      1,
+		ProbeInterval: time.Hour,
+	}, cl1, cl2, cl3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	var got []string
+	for x := 0; x < 4; x++ {
+		got = append(got, testPoolQuery(t, pool))
+	}
+	exp := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1"}
+	test.Assert(t, "answers", exp, got, true)
+
+	// The query to the failed upstream is retried to the next upstream,
+	// and then the queries are rotated between the remaining upstreams.
+	cl3.setFail(true)
+
+	got = got[:0]
+	for x := 0; x < 5; x++ {
+		got = append(got, testPoolQuery(t, pool))
+	}
+	exp = []string{"10.0.0.2", "10.0.0.1", "10.0.0.1", "10.0.0.2", "10.0.0.1"}
+	test.Assert(t, "answers", exp, got, true)
+}
+
+func TestUpstreamPoolFastest(t *testing.T) {
+	slow := &testPoolClient{name: "10.0.0.1", delay: 50 * time.Millisecond}
+	fast := &testPoolClient{name: "10.0.0.2"}
+
+	pool, err := NewUpstreamPool(&UpstreamPoolOptions{
+		Policy:        UpstreamFastest,
+		ProbeInterval: time.Hour,
+	}, slow, fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The upstream without round-trip time is queried first, until all
+	// of them are measured.
+	test.Assert(t, "answer", "10.0.0.1", testPoolQuery(t, pool), true)
+	test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+
+	for x := 0; x < 3; x++ {
+		test.Assert(t, "answer", "10.0.0.2", testPoolQuery(t, pool), true)
+	}
+	test.Assert(t, "slow nquery", int32(1), atomic.LoadInt32(&slow.nquery), true)
+}
+
+func TestUpstreamPoolSendRecv(t *testing.T) {
+	cl := &testPoolClient{name: "10.0.0.1"}
+
+	pool, err := NewUpstreamPool(nil, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	msg := NewMessage()
+	msg.Question.Name = []byte("kilabit.info")
+
+	// Recv without Send does not wait.
+	res := NewMessage()
+	_, err = pool.Recv(res)
+	test.Assert(t, "error", errUpstreamPoolNoResponse, err, true)
+
+	// The responses of two Send are received in the same order.
+	for _, id := range []uint16{1, 2} {
+		msg.Header.ID = id
+		_, err = msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = pool.Send(msg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []uint16{1, 2} {
+		_, err = pool.Recv(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Assert(t, "ID", id, res.Header.ID, true)
+	}
+
+	// The failed Send return the error, and Recv does not wait for its
+	// response.
+	cl.setFail(true)
+
+	_, err = pool.Send(msg, nil)
+	test.Assert(t, "Send error", true, err != nil, true)
+
+	_, err = pool.Recv(res)
+	test.Assert(t, "Recv error", errUpstreamPoolNoResponse, err, true)
+}
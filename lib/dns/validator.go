@@ -0,0 +1,663 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxValidatorDepth define the maximum number of zones, from the
+	// zone of signer to the trust anchor, that are walked to validate
+	// the DNSKEY.
+	maxValidatorDepth = 16
+)
+
+//
+// errValidatorInsecure is returned when the zone is proven to not have DS
+// record in its parent zone; the zone is not signed.
+//
+var errValidatorInsecure = errors.New("dnssec: insecure delegation")
+
+//
+// List of delegation states of a name in secure zone, as proven by DS
+// record or by NSEC or NSEC3 record in the response of DS query.
+//
+const (
+	delegationNone     = iota // The name is not a zone cut.
+	delegationSecure          // The name is a zone cut with DS.
+	delegationInsecure        // The name is a zone cut without DS.
+	delegationNXDomain        // The name does not exist.
+)
+
+//
+// Validator verify the signatures of resource records in DNS response using
+// the chain of trust from the trust anchors (RFC 4035 section 5).
+//
+// The DNSKEY of each zone is validated using the trust anchors of the zone
+// or the DS records in their parent zone, recursively until one of trust
+// anchor.  The DNSKEY and DS records are queried using Lookup function.
+// Validated DNSKEY are cached until their TTL expired.
+//
+// The RRset without RRSIG is considered insecure only if the NSEC or NSEC3
+// records, signed by one of its parent zone, prove that the zone of RRset
+// is delegated without DS record; otherwise, it is bogus.  Validator does
+// not prove the non-existence of RRset in negative response.
+//
+type Validator struct {
+	// Lookup is the function that is used to query DNSKEY and DS
+	// records.  The response must include the RRSIG records.
+	Lookup func(qname []byte, qtype uint16) (*Message, error)
+
+	sync.Mutex
+	anchors map[string][]*ResourceRecord
+	keys    map[string]*validatorKeys
+}
+
+//
+// validatorKeys contains the validated DNSKEY of a zone.
+//
+type validatorKeys struct {
+	keys      []*RDataDNSKEY
+	expiredAt int64
+}
+
+//
+// NewValidator create new DNSSEC validator with specific lookup function.
+//
+func NewValidator(lookup func(qname []byte, qtype uint16) (*Message, error)) *Validator {
+	return &Validator{
+		Lookup:  lookup,
+		anchors: make(map[string][]*ResourceRecord),
+		keys:    make(map[string]*validatorKeys),
+	}
+}
+
+//
+// AddTrustAnchor add DS or DNSKEY record as trust anchor of zone with the
+// same name as record.
+//
+func (v *Validator) AddTrustAnchor(rr *ResourceRecord) error {
+	switch rr.Type {
+	case QueryTypeDS:
+		if rr.DS == nil {
+			return ErrRDataLength
+		}
+	case QueryTypeDNSKEY:
+		if rr.DNSKEY == nil {
+			return ErrRDataLength
+		}
+	default:
+		return fmt.Errorf("dnssec: invalid trust anchor type %d", rr.Type)
+	}
+
+	zone := canonicalZone(rr.Name)
+
+	v.Lock()
+	v.anchors[zone] = append(v.anchors[zone], rr)
+	v.Unlock()
+
+	return nil
+}
+
+//
+// Validate verify the signatures of RRset in answer and authority sections
+// of message.
+//
+// It will return true if all RRset are signed and their signatures are
+// valid, false if one of RRset is in the zone that is proven to be
+// unsigned, and an error if one of RRset can not be validated (bogus).
+//
+func (v *Validator) Validate(msg *Message) (isSecure bool, err error) {
+	return v.validate(msg, 0)
+}
+
+func (v *Validator) validate(msg *Message, depth int) (isSecure bool, err error) {
+	rrsets, sigs := groupRRSet(msg)
+	if len(rrsets) == 0 {
+		return false, nil
+	}
+
+	isSecure = true
+	for key, rrset := range rrsets {
+		rrsig := sigs[key]
+		if len(rrsig) == 0 {
+			// The NS RRset of delegation point in referral is
+			// not signed (RFC 4035 section 2.2).
+			if len(msg.Answer) == 0 && rrset[0].Type == QueryTypeNS {
+				isSecure = false
+				continue
+			}
+
+			isInsecure, err := v.isInsecure(rrset[0].Name, depth)
+			if err != nil {
+				return false, err
+			}
+			if !isInsecure {
+				return false, fmt.Errorf("%s: %s type %d",
+					ErrDNSSECUnsigned, rrset[0].Name,
+					rrset[0].Type)
+			}
+			isSecure = false
+			continue
+		}
+
+		err = v.verifyRRSet(rrset, rrsig, depth)
+		if err == errValidatorInsecure {
+			isSecure = false
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return isSecure, nil
+}
+
+//
+// verifyRRSet verify the RRset using one of its signature.
+//
+func (v *Validator) verifyRRSet(rrset, rrsig []*ResourceRecord, depth int) (err error) {
+	now := time.Now()
+
+	for _, rr := range rrsig {
+		sig := rr.RRSIG
+
+		if !isSubdomain(rrset[0].Name, sig.SignerName) {
+			err = fmt.Errorf("dnssec: signer %s is not parent of %s",
+				sig.SignerName, rrset[0].Name)
+			continue
+		}
+		if !sig.isValidPeriod(now) {
+			err = ErrDNSSECExpired
+			continue
+		}
+
+		var keys []*RDataDNSKEY
+		keys, err = v.zoneKeys(sig.SignerName, depth)
+		if err != nil {
+			if err == errValidatorInsecure {
+				return err
+			}
+			continue
+		}
+
+		for _, key := range keys {
+			err = verifyRRSIG(sig, rrset, key)
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	return err
+}
+
+//
+// zoneKeys return the validated DNSKEY of zone.
+//
+func (v *Validator) zoneKeys(name []byte, depth int) ([]*RDataDNSKEY, error) {
+	if depth > maxValidatorDepth {
+		return nil, fmt.Errorf("dnssec: maximum chain depth reached")
+	}
+
+	zone := canonicalZone(name)
+	now := time.Now().Unix()
+
+	v.Lock()
+	vkeys, ok := v.keys[zone]
+	anchors := v.anchors[zone]
+	v.Unlock()
+
+	if ok && vkeys.expiredAt > now {
+		return vkeys.keys, nil
+	}
+	if v.Lookup == nil {
+		return nil, fmt.Errorf("dnssec: no lookup function")
+	}
+
+	res, err := v.Lookup(name, QueryTypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dnskeys []*ResourceRecord
+		keys    []*RDataDNSKEY
+		sigs    []*ResourceRecord
+		ttl     uint32
+	)
+	for _, rr := range res.Answer {
+		if canonicalZone(rr.Name) != zone {
+			continue
+		}
+		switch {
+		case rr.Type == QueryTypeDNSKEY && rr.DNSKEY != nil:
+			dnskeys = append(dnskeys, rr)
+			keys = append(keys, rr.DNSKEY)
+			if ttl == 0 || rr.TTL < ttl {
+				ttl = rr.TTL
+			}
+		case rr.Type == QueryTypeRRSIG && rr.RRSIG != nil &&
+			rr.RRSIG.TypeCovered == QueryTypeDNSKEY:
+			sigs = append(sigs, rr)
+		}
+	}
+	if len(dnskeys) == 0 {
+		return nil, fmt.Errorf("dnssec: no DNSKEY for zone %q", zone)
+	}
+
+	var trusted []*RDataDNSKEY
+	if len(anchors) > 0 {
+		trusted = anchoredKeys(name, keys, anchors)
+	} else {
+		trusted, err = v.delegatedKeys(name, keys, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("dnssec: no trusted DNSKEY for zone %q", zone)
+	}
+
+	// The DNSKEY RRset must be signed by one of trusted key.
+	err = ErrDNSSECSignature
+	for _, rr := range sigs {
+		if !rr.RRSIG.isValidPeriod(time.Unix(now, 0)) {
+			err = ErrDNSSECExpired
+			continue
+		}
+		for _, key := range trusted {
+			err = verifyRRSIG(rr.RRSIG, dnskeys, key)
+			if err == nil {
+				break
+			}
+		}
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dnssec: DNSKEY of zone %q: %s", zone, err)
+	}
+
+	v.Lock()
+	v.keys[zone] = &validatorKeys{
+		keys:      keys,
+		expiredAt: now + int64(ttl),
+	}
+	v.Unlock()
+
+	return keys, nil
+}
+
+//
+// delegatedKeys return the keys that are referred by DS records in parent
+// zone.
+//
+func (v *Validator) delegatedKeys(name []byte, keys []*RDataDNSKEY, depth int) (
+	trusted []*RDataDNSKEY, err error,
+) {
+	if len(canonicalZone(name)) == 0 {
+		return nil, fmt.Errorf("dnssec: no trust anchor for root zone")
+	}
+
+	res, err := v.Lookup(name, QueryTypeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	var ds []*ResourceRecord
+	for _, rr := range res.Answer {
+		if rr.Type == QueryTypeDS && rr.DS != nil {
+			ds = append(ds, rr)
+		}
+	}
+	if len(ds) == 0 {
+		// The zone is insecure only if the absence of DS is
+		// proven.
+		isInsecure, err := v.isInsecure(name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if !isInsecure {
+			return nil, fmt.Errorf("dnssec: missing DS for zone %q",
+				canonicalZone(name))
+		}
+		return nil, errValidatorInsecure
+	}
+
+	isSecure, err := v.validate(res, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	if !isSecure {
+		return nil, errValidatorInsecure
+	}
+
+	return anchoredKeys(name, keys, ds), nil
+}
+
+//
+// isInsecure will return true if one of the zone cut between the closest
+// trust anchor and the name is proven to not have DS record, or if the name
+// is not under any trust anchor.  It will return false if the name is in
+// secure zone, and an error if the delegation can not be proven.
+//
+// The zone cuts are walked from the trust anchor down to the name, one
+// label at a time, by querying the DS record of each label.
+//
+func (v *Validator) isInsecure(name []byte, depth int) (bool, error) {
+	if depth > maxValidatorDepth {
+		return false, fmt.Errorf("dnssec: maximum chain depth reached")
+	}
+
+	var labels []string
+	if zone := canonicalZone(name); len(zone) > 0 {
+		labels = strings.Split(zone, ".")
+	}
+
+	// Find the closest trust anchor.
+	x := 0
+	zone := ""
+	v.Lock()
+	for ; x <= len(labels); x++ {
+		zone = strings.Join(labels[x:], ".")
+		if len(v.anchors[zone]) > 0 {
+			break
+		}
+	}
+	v.Unlock()
+
+	if x > len(labels) {
+		return true, nil
+	}
+
+	for x--; x >= 0; x-- {
+		child := strings.Join(labels[x:], ".")
+
+		state, err := v.delegation(zone, child, depth)
+		if err != nil {
+			return false, err
+		}
+
+		switch state {
+		case delegationSecure:
+			zone = child
+		case delegationInsecure:
+			return true, nil
+		case delegationNXDomain:
+			return false, nil
+		}
+	}
+
+	return false, nil
+}
+
+//
+// delegation query the DS record of child and return its delegation state,
+// as proven by the records in response that are signed by the secure zone,
+// the closest parent of child.
+//
+func (v *Validator) delegation(zone, child string, depth int) (int, error) {
+	res, err := v.Lookup([]byte(child), QueryTypeDS)
+	if err != nil {
+		return 0, err
+	}
+
+	err = v.verifyZoneRRSets(res, zone, depth)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rr := range res.Answer {
+		if rr.Type == QueryTypeDS && canonicalZone(rr.Name) == child {
+			return delegationSecure, nil
+		}
+	}
+
+	for _, rr := range res.Authority {
+		var (
+			state   int
+			isProof bool
+		)
+
+		switch {
+		case rr.Type == QueryTypeNSEC && rr.NSEC != nil:
+			state, isProof = nsecDelegation(rr, child)
+		case rr.Type == QueryTypeNSEC3 && rr.NSEC3 != nil:
+			state, isProof = nsec3Delegation(rr, zone, child)
+		}
+		if !isProof {
+			continue
+		}
+		if state == delegationSecure {
+			return 0, fmt.Errorf("dnssec: missing DS for zone %q",
+				child)
+		}
+		return state, nil
+	}
+
+	return 0, fmt.Errorf("dnssec: no DS and no proof of its absence for %q",
+		child)
+}
+
+//
+// verifyZoneRRSets verify that all RRset in answer and authority sections
+// are signed by the keys of zone.
+//
+func (v *Validator) verifyZoneRRSets(msg *Message, zone string, depth int) (
+	err error,
+) {
+	keys, err := v.zoneKeys([]byte(zone), depth+1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rrsets, sigs := groupRRSet(msg)
+
+	for key, rrset := range rrsets {
+		err = fmt.Errorf("%s: %s type %d", ErrDNSSECUnsigned,
+			rrset[0].Name, rrset[0].Type)
+
+		for _, rr := range sigs[key] {
+			sig := rr.RRSIG
+			if canonicalZone(sig.SignerName) != zone {
+				continue
+			}
+			if !sig.isValidPeriod(now) {
+				err = ErrDNSSECExpired
+				continue
+			}
+			for _, k := range keys {
+				err = verifyRRSIG(sig, rrset, k)
+				if err == nil {
+					break
+				}
+			}
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// nsecDelegation return the delegation state of child from NSEC record, and
+// true if the NSEC record match or cover the child.
+//
+func nsecDelegation(rr *ResourceRecord, child string) (int, bool) {
+	owner := canonicalZone(rr.Name)
+	next := canonicalZone(rr.NSEC.NextName)
+
+	if owner == child {
+		return bitmapDelegation(rr.NSEC.Types), true
+	}
+
+	// The last NSEC in zone has the zone apex as next name.
+	isLast := !canonicalLess(owner, next)
+	if canonicalLess(owner, child) &&
+		(canonicalLess(child, next) || isLast) {
+		return delegationNXDomain, true
+	}
+
+	return 0, false
+}
+
+//
+// nsec3Delegation return the delegation state of child from NSEC3 record in
+// zone, and true if the NSEC3 record match or cover the hash of child.  The
+// covering NSEC3 with Opt-Out flag may cover the insecure delegation (RFC
+// 5155 section 6).
+//
+func nsec3Delegation(rr *ResourceRecord, zone, child string) (int, bool) {
+	owner := canonicalZone(rr.Name)
+
+	x := strings.IndexByte(owner, '.')
+	if x < 0 || owner[x+1:] != zone {
+		return 0, false
+	}
+
+	ownerHash, err := base32HexNoPad.DecodeString(strings.ToUpper(owner[:x]))
+	if err != nil {
+		return 0, false
+	}
+
+	nsec3 := rr.NSEC3
+	hash, err := nsec3Hash([]byte(child), nsec3.HashAlgorithm,
+		nsec3.Iterations, nsec3.Salt)
+	if err != nil {
+		return 0, false
+	}
+
+	if bytes.Equal(hash, ownerHash) {
+		return bitmapDelegation(nsec3.Types), true
+	}
+
+	next := nsec3.NextHashedOwner
+	isLast := bytes.Compare(ownerHash, next) >= 0
+	if bytes.Compare(ownerHash, hash) < 0 &&
+		(bytes.Compare(hash, next) < 0 || isLast) {
+		if nsec3.Flags&NSEC3FlagOptOut != 0 {
+			return delegationInsecure, true
+		}
+		return delegationNXDomain, true
+	}
+
+	return 0, false
+}
+
+//
+// bitmapDelegation return the delegation state from the types that exist
+// at the name.
+//
+func bitmapDelegation(types []uint16) int {
+	var hasNS, hasSOA bool
+
+	for _, t := range types {
+		switch t {
+		case QueryTypeNS:
+			hasNS = true
+		case QueryTypeSOA:
+			hasSOA = true
+		case QueryTypeDS:
+			return delegationSecure
+		}
+	}
+	if hasNS && !hasSOA {
+		return delegationInsecure
+	}
+	return delegationNone
+}
+
+//
+// anchoredKeys return the keys that match with DS or DNSKEY in anchors.
+//
+func anchoredKeys(name []byte, keys []*RDataDNSKEY, anchors []*ResourceRecord) (
+	trusted []*RDataDNSKEY,
+) {
+	for _, key := range keys {
+		for _, anchor := range anchors {
+			switch anchor.Type {
+			case QueryTypeDS:
+				if !anchor.DS.isMatchDS(name, key) {
+					continue
+				}
+			case QueryTypeDNSKEY:
+				if !bytes.Equal(anchor.DNSKEY.pack(), key.pack()) {
+					continue
+				}
+			}
+			trusted = append(trusted, key)
+			break
+		}
+	}
+	return trusted
+}
+
+//
+// groupRRSet group the records in answer and authority sections by their
+// name, type, and class.  The RRSIG records is grouped by their name, type
+// covered, and class.
+//
+func groupRRSet(msg *Message) (rrsets, sigs map[string][]*ResourceRecord) {
+	rrsets = make(map[string][]*ResourceRecord)
+	sigs = make(map[string][]*ResourceRecord)
+
+	rrs := make([]*ResourceRecord, 0, len(msg.Answer)+len(msg.Authority))
+	rrs = append(rrs, msg.Answer...)
+	rrs = append(rrs, msg.Authority...)
+
+	for _, rr := range rrs {
+		name := canonicalZone(rr.Name)
+		switch rr.Type {
+		case QueryTypeOPT:
+			continue
+		case QueryTypeRRSIG:
+			if rr.RRSIG == nil {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d:%d", name, rr.RRSIG.TypeCovered, rr.Class)
+			sigs[key] = append(sigs[key], rr)
+		default:
+			key := fmt.Sprintf("%s:%d:%d", name, rr.Type, rr.Class)
+			rrsets[key] = append(rrsets[key], rr)
+		}
+	}
+
+	return rrsets, sigs
+}
+
+//
+// canonicalZone return the domain name in lower case, without trailing dot.
+//
+func canonicalZone(name []byte) string {
+	return strings.ToLower(strings.TrimSuffix(string(name), "."))
+}
+
+//
+// isSubdomain will return true if name is equal to parent or is sub-domain
+// of parent.
+//
+func isSubdomain(name, parent []byte) bool {
+	n := canonicalZone(name)
+	p := canonicalZone(parent)
+	if len(p) == 0 || n == p {
+		return true
+	}
+	return strings.HasSuffix(n, "."+p)
+}
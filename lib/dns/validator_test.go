@@ -0,0 +1,419 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testZoneKey contains the DNSKEY record of zone and its private key.
+//
+type testZoneKey struct {
+	rr     *ResourceRecord
+	signer crypto.Signer
+}
+
+func newTestZoneKey(t *testing.T, zone string) *testZoneKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubkey := make([]byte, 64)
+	priv.X.FillBytes(pubkey[:32])
+	priv.Y.FillBytes(pubkey[32:])
+
+	return &testZoneKey{
+		rr: &ResourceRecord{
+			Name:  []byte(zone),
+			Type:  QueryTypeDNSKEY,
+			Class: QueryClassIN,
+			TTL:   3600,
+			DNSKEY: &RDataDNSKEY{
+				Flags:     DNSKEYFlagZone | DNSKEYFlagSEP,
+				Protocol:  3,
+				Algorithm: DNSSECAlgECDSAP256SHA256,
+				PublicKey: pubkey,
+			},
+		},
+		signer: priv,
+	}
+}
+
+//
+// sign the RRset and return the RRSIG record that valid from inception
+// until expiration.
+//
+func (key *testZoneKey) sign(t *testing.T, rrset []*ResourceRecord,
+	inception, expiration time.Time,
+) *ResourceRecord {
+	sig := &RDataRRSIG{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   key.rr.DNSKEY.Algorithm,
+		Labels:      countLabels(rrset[0].Name),
+		OrigTTL:     rrset[0].TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      key.rr.DNSKEY.KeyTag(),
+		SignerName:  key.rr.Name,
+	}
+
+	err := signRRSIG(sig, rrset, key.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &ResourceRecord{
+		Name:  rrset[0].Name,
+		Type:  QueryTypeRRSIG,
+		Class: rrset[0].Class,
+		TTL:   rrset[0].TTL,
+		RRSIG: sig,
+	}
+}
+
+//
+// testSignedZones contains the signed records, indexed by name and type,
+// that is used as lookup function of validator and as upstream of
+// resolver.
+//
+type testSignedZones struct {
+	rrs  map[string][]*ResourceRecord
+	auth map[string][]*ResourceRecord
+}
+
+func (zones *testSignedZones) add(rrs ...*ResourceRecord) {
+	for _, rr := range rrs {
+		qtype := rr.Type
+		if rr.Type == QueryTypeRRSIG {
+			qtype = rr.RRSIG.TypeCovered
+		}
+		key := fmt.Sprintf("%s:%d", rr.Name, qtype)
+		zones.rrs[key] = append(zones.rrs[key], rr)
+	}
+}
+
+//
+// addAuthority add the records into authority section of response to the
+// query with name and type, for example the NSEC proof.
+//
+func (zones *testSignedZones) addAuthority(qname string, qtype uint16,
+	rrs ...*ResourceRecord,
+) {
+	if zones.auth == nil {
+		zones.auth = make(map[string][]*ResourceRecord)
+	}
+	key := fmt.Sprintf("%s:%d", qname, qtype)
+	zones.auth[key] = append(zones.auth[key], rrs...)
+}
+
+func (zones *testSignedZones) lookup(qname []byte, qtype uint16) (*Message, error) {
+	key := fmt.Sprintf("%s:%d", qname, qtype)
+	msg := NewMessage()
+	msg.Answer = zones.rrs[key]
+	msg.Authority = zones.auth[key]
+	return msg, nil
+}
+
+func (zones *testSignedZones) Close() error                         { return nil }
+func (zones *testSignedZones) RemoteAddr() string                   { return "test" }
+func (zones *testSignedZones) SetTimeout(t time.Duration)           {}
+func (zones *testSignedZones) SetRemoteAddr(addr string) error      { return nil }
+func (zones *testSignedZones) Recv(msg *Message) (int, error)       { return 0, nil }
+func (zones *testSignedZones) Send(*Message, net.Addr) (int, error) { return 0, nil }
+
+func (zones *testSignedZones) Query(msg *Message, ns net.Addr) (*Message, error) {
+	res := newResponse(msg, RCodeOK)
+	res.Answer = zones.rrs[fmt.Sprintf("%s:%d", msg.Question.Name, msg.Question.Type)]
+
+	_, err := res.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	unpacked := NewMessage()
+	unpacked.Packet = append(unpacked.Packet[:0], res.Packet...)
+
+	err = unpacked.Unpack()
+	if err != nil {
+		return nil, err
+	}
+
+	return unpacked, nil
+}
+
+func newTestA(name, ip string) *ResourceRecord {
+	return &ResourceRecord{
+		Name:  []byte(name),
+		Type:  QueryTypeA,
+		Class: QueryClassIN,
+		TTL:   300,
+		Text: &RDataText{
+			Value: []byte(ip),
+		},
+	}
+}
+
+func newTestNSEC(name, next string, types ...uint16) *ResourceRecord {
+	return &ResourceRecord{
+		Name:  []byte(name),
+		Type:  QueryTypeNSEC,
+		Class: QueryClassIN,
+		TTL:   300,
+		NSEC: &RDataNSEC{
+			NextName: []byte(next),
+			Types:    types,
+		},
+	}
+}
+
+func TestValidator(t *testing.T) {
+	now := time.Now()
+	inception := now.Add(-time.Hour)
+	expiration := now.Add(time.Hour)
+
+	parent := newTestZoneKey(t, "test")
+	child := newTestZoneKey(t, "example.test")
+	unsigned := newTestZoneKey(t, "unsigned.test")
+
+	zones := &testSignedZones{
+		rrs: make(map[string][]*ResourceRecord),
+	}
+
+	// The parent zone "test" is the trust anchor.
+	zones.add(parent.rr, parent.sign(t, []*ResourceRecord{parent.rr},
+		inception, expiration))
+
+	// The child zone "example.test" is delegated using DS record in
+	// parent zone.
+	digest, err := digestDS(child.rr.Name, child.rr.DNSKEY, DSDigestSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := &ResourceRecord{
+		Name:  child.rr.Name,
+		Type:  QueryTypeDS,
+		Class: QueryClassIN,
+		TTL:   3600,
+		DS: &RDataDS{
+			KeyTag:     child.rr.DNSKEY.KeyTag(),
+			Algorithm:  child.rr.DNSKEY.Algorithm,
+			DigestType: DSDigestSHA256,
+			Digest:     digest,
+		},
+	}
+	zones.add(ds, parent.sign(t, []*ResourceRecord{ds}, inception, expiration))
+	zones.add(child.rr, child.sign(t, []*ResourceRecord{child.rr},
+		inception, expiration))
+
+	// The zone "unsigned.test" does not have DS record in parent, as
+	// proven by NSEC record in parent.
+	zones.add(unsigned.rr, unsigned.sign(t, []*ResourceRecord{unsigned.rr},
+		inception, expiration))
+	nsec := newTestNSEC("unsigned.test", "www.test", QueryTypeNS,
+		QueryTypeRRSIG, QueryTypeNSEC)
+	zones.addAuthority("unsigned.test", QueryTypeDS, nsec,
+		parent.sign(t, []*ResourceRecord{nsec}, inception, expiration))
+
+	// The name "www.example.test" is not a zone cut in "example.test".
+	nsec = newTestNSEC("www.example.test", "example.test", QueryTypeA,
+		QueryTypeRRSIG, QueryTypeNSEC)
+	zones.addAuthority("www.example.test", QueryTypeDS, nsec,
+		child.sign(t, []*ResourceRecord{nsec}, inception, expiration))
+
+	// The DS record of zone "stripped.test" is removed from response.
+	stripped := newTestZoneKey(t, "stripped.test")
+	zones.add(stripped.rr, stripped.sign(t, []*ResourceRecord{stripped.rr},
+		inception, expiration))
+
+	// The absence of DS record of zone "forged.test" is proven by
+	// unsigned NSEC record.
+	forged := newTestZoneKey(t, "forged.test")
+	zones.add(forged.rr, forged.sign(t, []*ResourceRecord{forged.rr},
+		inception, expiration))
+	zones.addAuthority("forged.test", QueryTypeDS,
+		newTestNSEC("forged.test", "stripped.test", QueryTypeNS,
+			QueryTypeRRSIG, QueryTypeNSEC))
+
+	// The absence of DS record of zone "generic.test" is proven by
+	// NSEC record, loaded from master file, that contains unknown type
+	// in its type bitmap.
+	m := newMaster()
+	m.Init("generic.test. 300 IN NSEC www.test. NS TYPE1234 RRSIG NSEC", "", 0)
+	err = m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsec = m.msgs[0].Answer[0]
+	zones.addAuthority("generic.test", QueryTypeDS, nsec,
+		parent.sign(t, []*ResourceRecord{nsec}, inception, expiration))
+
+	cases := []struct {
+		desc      string
+		rrs       []*ResourceRecord
+		key       *testZoneKey
+		inception time.Time
+		tamper    bool
+		expSecure bool
+		expErr    string
+	}{{
+		desc:      "Signed by anchor",
+		rrs:       []*ResourceRecord{newTestA("www.test", "10.0.0.1")},
+		key:       parent,
+		expSecure: true,
+	}, {
+		desc: "Signed by child",
+		rrs: []*ResourceRecord{
+			newTestA("www.example.test", "10.0.0.1"),
+			newTestA("www.example.test", "10.0.0.2"),
+		},
+		key:       child,
+		expSecure: true,
+	}, {
+		desc:   "Unsigned in secure zone",
+		rrs:    []*ResourceRecord{newTestA("www.example.test", "10.0.0.1")},
+		expErr: ErrDNSSECUnsigned.Error() + ": www.example.test type 1",
+	}, {
+		desc:   "Unsigned in secure zone without proof",
+		rrs:    []*ResourceRecord{newTestA("mail.example.test", "10.0.0.1")},
+		expErr: `dnssec: no DS and no proof of its absence for "mail.example.test"`,
+	}, {
+		desc: "Signed by insecure zone",
+		rrs:  []*ResourceRecord{newTestA("www.unsigned.test", "10.0.0.1")},
+		key:  unsigned,
+	}, {
+		desc: "Unsigned in insecure zone",
+		rrs:  []*ResourceRecord{newTestA("www.unsigned.test", "10.0.0.1")},
+	}, {
+		desc: "Unsigned in insecure zone with unknown type in NSEC proof",
+		rrs:  []*ResourceRecord{newTestA("www.generic.test", "10.0.0.1")},
+	}, {
+		desc:   "Signed by zone with DS removed",
+		rrs:    []*ResourceRecord{newTestA("www.stripped.test", "10.0.0.1")},
+		key:    stripped,
+		expErr: `dnssec: no DS and no proof of its absence for "stripped.test"`,
+	}, {
+		desc:   "Unsigned in zone with DS removed",
+		rrs:    []*ResourceRecord{newTestA("www.stripped.test", "10.0.0.1")},
+		expErr: `dnssec: no DS and no proof of its absence for "stripped.test"`,
+	}, {
+		desc:   "Signed by zone with forged proof",
+		rrs:    []*ResourceRecord{newTestA("www.forged.test", "10.0.0.1")},
+		key:    forged,
+		expErr: ErrDNSSECUnsigned.Error() + ": forged.test type 47",
+	}, {
+		desc:   "Tampered",
+		rrs:    []*ResourceRecord{newTestA("www.example.test", "10.0.0.1")},
+		key:    child,
+		tamper: true,
+		expErr: ErrDNSSECSignature.Error(),
+	}, {
+		desc:      "Expired",
+		rrs:       []*ResourceRecord{newTestA("www.example.test", "10.0.0.1")},
+		key:       child,
+		inception: now.Add(-2 * time.Hour),
+		expErr:    ErrDNSSECExpired.Error(),
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		v := NewValidator(zones.lookup)
+		err = v.AddTrustAnchor(parent.rr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := NewMessage()
+		msg.Answer = append(msg.Answer, c.rrs...)
+
+		if c.key != nil {
+			inc, exp := inception, expiration
+			if !c.inception.IsZero() {
+				inc, exp = c.inception, c.inception.Add(time.Minute)
+			}
+			msg.Answer = append(msg.Answer, c.key.sign(t, c.rrs, inc, exp))
+		}
+		if c.tamper {
+			msg.Answer[0] = newTestA("www.example.test", "10.0.0.3")
+		}
+
+		gotSecure, err := v.Validate(msg)
+		if err != nil {
+			test.Assert(t, "error", c.expErr, err.Error(), true)
+			continue
+		}
+
+		test.Assert(t, "error", c.expErr, "", true)
+		test.Assert(t, "isSecure", c.expSecure, gotSecure, true)
+	}
+}
+
+func TestResolverValidator(t *testing.T) {
+	now := time.Now()
+	inception := now.Add(-time.Hour)
+	expiration := now.Add(time.Hour)
+
+	key := newTestZoneKey(t, "secure.test")
+
+	zones := &testSignedZones{
+		rrs: make(map[string][]*ResourceRecord),
+	}
+
+	zones.add(key.rr, key.sign(t, []*ResourceRecord{key.rr}, inception,
+		expiration))
+
+	a := newTestA("www.secure.test", "10.0.0.1")
+	zones.add(a, key.sign(t, []*ResourceRecord{a}, inception, expiration))
+
+	// The signature of bogus record is made for different address.
+	bogus := newTestA("bogus.secure.test", "10.0.0.1")
+	sig := key.sign(t, []*ResourceRecord{bogus}, inception, expiration)
+	zones.add(newTestA("bogus.secure.test", "10.0.0.2"), sig)
+
+	// The signature of stripped record is removed.
+	zones.add(newTestA("stripped.secure.test", "10.0.0.1"))
+
+	v := NewValidator(nil)
+	err := v.AddTrustAnchor(key.rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	rs := NewResolver(zones)
+	rs.SetValidator(v)
+
+	rs.ServeDNS(newTestRequest(sender, 300, "www.secure.test"))
+	res := <-sender.C
+
+	test.Assert(t, "RCode", RCodeOK, res.Header.RCode, true)
+	test.Assert(t, "IsAD", true, res.Header.IsAD, true)
+
+	rs.ServeDNS(newTestRequest(sender, 301, "bogus.secure.test"))
+	res = <-sender.C
+
+	test.Assert(t, "RCode", RCodeErrServer, res.Header.RCode, true)
+	test.Assert(t, "IsAD", false, res.Header.IsAD, true)
+
+	rs.ServeDNS(newTestRequest(sender, 302, "stripped.secure.test"))
+	res = <-sender.C
+
+	test.Assert(t, "RCode", RCodeErrServer, res.Header.RCode, true)
+	test.Assert(t, "Answer", 0, len(res.Answer), true)
+}
@@ -0,0 +1,204 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/shuLhan/share/lib/ini"
+)
+
+//
+// List of section and keys of view in INI configuration.
+//
+const (
+	viewSection         = "view"
+	viewKeyMatchClients = "match-clients"
+	viewKeyZone         = "zone"
+	viewKeyHosts        = "hosts"
+	viewKeyForwarder    = "forwarder"
+)
+
+//
+// View define the handler that answer the query from clients in the
+// networks, for example to answer the internal and external clients with
+// different records for the same name (split-horizon).
+//
+type View struct {
+	// Name of view.
+	Name string
+
+	// Networks define the list of client networks that are served by
+	// this view.  If its empty, all clients are served by this view.
+	Networks []*net.IPNet
+
+	// Handler answer the query from clients of this view.
+	Handler Handler
+}
+
+//
+// isMatch will return true if the client IP is in one of view networks.
+//
+func (view *View) isMatch(ip net.IP) bool {
+	if len(view.Networks) == 0 {
+		return true
+	}
+	return isIPAllowed(view.Networks, ip)
+}
+
+//
+// ViewHandler is a Handler that pass the query to the first view that
+// serve the client address.  The client address is taken from UDPAddr for
+// UDP request, and from TCPAddr for TCP, DoT, and DoH requests.  If no
+// view serve the client, the query will be answered with REFUSED.
+//
+type ViewHandler struct {
+	Views []*View
+}
+
+//
+// LoadViews load the views from INI file.  See ParseViews for the format
+// of file.
+//
+func LoadViews(file string) (*ViewHandler, error) {
+	in, err := ini.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseViews(in)
+}
+
+//
+// ParseViews create the views from "view" sections in INI configuration,
+// in the order of sections.  Each view is defined in the section with the
+// name of view as subsection, for example,
+//
+//	[view "internal"]
+//	match-clients = 10.0.0.0/8
+//	match-clients = 192.168.0.0/16
+//	zone = /etc/dns/internal/example.com
+//	hosts = /etc/dns/internal/hosts
+//	forwarder = 10.0.0.53
+//
+//	[view "external"]
+//	zone = /etc/dns/external/example.com
+//
+// The "match-clients" define the client networks of view.  The "zone" and
+// "hosts" define the master files and hosts files loaded into view.  The
+// query with name that is not in any zones of view is forwarded to the
+// name servers in "forwarder", or answered with REFUSED if view does not
+// have forwarder.  All keys can be set more than once.
+//
+func ParseViews(in *ini.Ini) (vh *ViewHandler, err error) {
+	vh = &ViewHandler{}
+
+	for _, sec := range in.GetSections(viewSection) {
+		view, err := parseView(sec)
+		if err != nil {
+			return nil, err
+		}
+		vh.Views = append(vh.Views, view)
+	}
+
+	return vh, nil
+}
+
+func parseView(sec *ini.Section) (view *View, err error) {
+	if len(sec.Sub) == 0 {
+		return nil, fmt.Errorf("dns: view: missing name on line %d",
+			sec.LineNum)
+	}
+
+	view = &View{
+		Name: sec.Sub,
+	}
+	zh := NewZoneHandler()
+
+	var forwarders []string
+
+	for _, v := range sec.Vars {
+		switch v.KeyLower {
+		case viewKeyMatchClients:
+			_, ipnet, err := net.ParseCIDR(strings.TrimSpace(v.Value))
+			if err != nil {
+				return nil, fmt.Errorf("dns: view %q: %s", view.Name, err)
+			}
+			view.Networks = append(view.Networks, ipnet)
+
+		case viewKeyZone:
+			err = zh.LoadMaster(v.Value, "", 0)
+			if err != nil {
+				return nil, fmt.Errorf("dns: view %q: %s", view.Name, err)
+			}
+
+		case viewKeyHosts:
+			err = zh.LoadHosts(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("dns: view %q: %s", view.Name, err)
+			}
+
+		case viewKeyForwarder:
+			forwarders = append(forwarders, v.Value)
+		}
+	}
+
+	if len(forwarders) > 0 {
+		zh.Fallback, err = newViewResolver(forwarders)
+		if err != nil {
+			return nil, fmt.Errorf("dns: view %q: %s", view.Name, err)
+		}
+	}
+
+	view.Handler = zh
+
+	return view, nil
+}
+
+//
+// newViewResolver create the resolver that forward the query to name
+// servers using UDP.
+//
+func newViewResolver(nameservers []string) (*Resolver, error) {
+	addrs, err := ParseNameServers(nameservers)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]Client, 0, len(addrs))
+	for _, addr := range addrs {
+		cl, err := NewUDPClient(addr.String())
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, cl)
+	}
+
+	return NewResolver(clients...), nil
+}
+
+//
+// ServeDNS pass the request to the view of client address.
+//
+func (vh *ViewHandler) ServeDNS(req *Request) {
+	ip := requestIP(req)
+
+	for _, view := range vh.Views {
+		if view.isMatch(ip) {
+			view.Handler.ServeDNS(req)
+			return
+		}
+	}
+
+	res := newResponse(req.Message, RCodeRefused)
+	_, err := res.Pack()
+	if err != nil {
+		FreeRequest(req)
+		return
+	}
+	req.Respond(res)
+}
@@ -0,0 +1,154 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shuLhan/share/lib/ini"
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestViewHandlerServeDNS(t *testing.T) {
+	vh, err := LoadViews("testdata/view/views.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "Views", 2, len(vh.Views), true)
+	test.Assert(t, "Name", "internal", vh.Views[0].Name, true)
+	test.Assert(t, "Name", "external", vh.Views[1].Name, true)
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc     string
+		kind     int
+		ip       string
+		qname    string
+		expRCode ResponseCode
+		exp      []string
+	}{{
+		desc:  "UDP from internal",
+		kind:  ConnTypeUDP,
+		ip:    "10.1.2.3",
+		qname: "www.example.test",
+		exp:   []string{"10.0.0.1"},
+	}, {
+		desc:  "TCP from internal",
+		kind:  ConnTypeTCP,
+		ip:    "192.168.1.1",
+		qname: "intra.example.test",
+		exp:   []string{"10.0.0.2"},
+	}, {
+		desc:  "DoH from external",
+		kind:  ConnTypeDoH,
+		ip:    "198.51.100.1",
+		qname: "www.example.test",
+		exp:   []string{"192.0.2.1"},
+	}, {
+		desc:     "UDP from external on internal name",
+		kind:     ConnTypeUDP,
+		ip:       "198.51.100.1",
+		qname:    "intra.example.test",
+		expRCode: RCodeErrName,
+	}, {
+		desc:     "IPv6 without view",
+		kind:     ConnTypeUDP,
+		ip:       "2001:db8::1",
+		qname:    "www.example.test",
+		expRCode: RCodeRefused,
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		id := uint16(5000 + x)
+		ip := net.ParseIP(c.ip)
+
+		req := newTestRequest(sender, id, c.qname)
+		req.Kind = c.kind
+
+		var res *Message
+
+		switch c.kind {
+		case ConnTypeUDP:
+			req.UDPAddr = &net.UDPAddr{IP: ip}
+			vh.ServeDNS(req)
+			res = <-sender.C
+
+		case ConnTypeDoH:
+			rec := httptest.NewRecorder()
+			req.TCPAddr = &net.TCPAddr{IP: ip}
+			req.Sender = nil
+			req.ResponseWriter = rec
+			req.ChanResponded = make(chan bool, 1)
+
+			vh.ServeDNS(req)
+			<-req.ChanResponded
+			FreeRequest(req)
+
+			res = NewMessage()
+			res.Packet = append(res.Packet[:0], rec.Body.Bytes()...)
+			err = res.Unpack()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+		default:
+			req.TCPAddr = &net.TCPAddr{IP: ip}
+			vh.ServeDNS(req)
+			res = <-sender.C
+		}
+
+		test.Assert(t, "ID", id, res.Header.ID, true)
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+
+		var got []string
+		for _, rr := range res.Answer {
+			got = append(got, testRDataString(rr))
+		}
+		test.Assert(t, "Answer", c.exp, got, true)
+	}
+}
+
+func TestParseViews(t *testing.T) {
+	cases := []struct {
+		desc   string
+		in     string
+		expErr string
+	}{{
+		desc:   "Without name",
+		in:     "[view]\nzone = testdata/view/internal.example.test\n",
+		expErr: "dns: view: missing name on line 1",
+	}, {
+		desc:   "With invalid network",
+		in:     "[view \"a\"]\nmatch-clients = 10.0.0.1\n",
+		expErr: `dns: view "a": invalid CIDR address: 10.0.0.1`,
+	}, {
+		desc:   "With invalid forwarder",
+		in:     "[view \"a\"]\nforwarder = x:y:z\n",
+		expErr: `dns: view "a": Invalid host address`,
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		in, err := ini.NewReader().Parse([]byte(c.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ParseViews(in)
+		if err == nil {
+			t.Fatal("expecting error")
+		}
+		test.Assert(t, "error", c.expErr, err.Error(), true)
+	}
+}
@@ -0,0 +1,527 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWalkDepth define the maximum number of nested resolution, for
+	// example to resolve the address of name server that does not have
+	// glue records.
+	maxWalkDepth = 8
+
+	// maxWalkSteps define the maximum number of queries sent to resolve
+	// one name.
+	maxWalkSteps = 32
+)
+
+//
+// RootHints contains the IPv4 address of root name servers, from
+// "a.root-servers.net" to "m.root-servers.net".
+//
+var RootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+//
+// List of errors on iterative resolution.
+//
+var (
+	ErrWalkDepth    = errors.New("dns: resolver: maximum depth reached")
+	ErrWalkSteps    = errors.New("dns: resolver: maximum number of queries reached")
+	ErrWalkCNAME    = errors.New("dns: resolver: CNAME chain is too long")
+	ErrWalkReferral = errors.New("dns: resolver: invalid referral")
+	ErrWalkNoServer = errors.New("dns: resolver: no address of name servers")
+)
+
+//
+// delegation contains the address of name servers of a zone, and the time
+// when its expired.
+//
+type delegation struct {
+	addrs     []*net.UDPAddr
+	expiredAt int64
+}
+
+//
+// delegationCache contains the delegation of zones that has been walked,
+// indexed by zone origin.
+//
+type delegationCache struct {
+	sync.Mutex
+	v map[string]*delegation
+}
+
+func newDelegationCache() *delegationCache {
+	return &delegationCache{
+		v: make(map[string]*delegation),
+	}
+}
+
+//
+// closest return the delegation of the nearest zone that contains the
+// name.  If no delegation found it will return nil.
+//
+func (dc *delegationCache) closest(name string) (zone string, addrs []*net.UDPAddr) {
+	now := time.Now().Unix()
+
+	dc.Lock()
+	defer dc.Unlock()
+
+	for len(name) > 0 {
+		d, ok := dc.v[name]
+		if ok {
+			if d.expiredAt > now {
+				return name, d.addrs
+			}
+			delete(dc.v, name)
+		}
+
+		x := strings.IndexByte(name, '.')
+		if x < 0 {
+			break
+		}
+		name = name[x+1:]
+	}
+
+	return "", nil
+}
+
+//
+// upsert insert or replace the delegation of zone.
+//
+func (dc *delegationCache) upsert(zone string, addrs []*net.UDPAddr, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+
+	dc.Lock()
+	dc.v[zone] = &delegation{
+		addrs:     addrs,
+		expiredAt: time.Now().Unix() + int64(ttl),
+	}
+	dc.Unlock()
+}
+
+//
+// NewIterativeResolver create and initialize new resolver that resolve the
+// query iteratively, by following the referral from root name servers
+// down to the authoritative name servers of the query name.  Each of
+// hints is the address of root name server, with optional port.  If hints
+// is empty, the RootHints will be used.
+//
+func NewIterativeResolver(hints ...string) (rs *Resolver, err error) {
+	if len(hints) == 0 {
+		hints = RootHints
+	}
+
+	roots, err := ParseNameServers(hints)
+	if err != nil {
+		return nil, err
+	}
+
+	rs = NewResolver()
+	rs.roots = roots
+	rs.nsPort = int(DefaultPort)
+	rs.delegations = newDelegationCache()
+
+	return rs, nil
+}
+
+//
+// walk resolve the question iteratively.  The CNAME records in answer
+// are followed until the answer with question type is found.
+//
+// The returned message contains the question and the answer of the
+// original query, with the recursion available bit set.
+//
+func (rs *Resolver) walk(q *SectionQuestion, depth int) (res *Message, err error) {
+	if depth > maxWalkDepth {
+		return nil, ErrWalkDepth
+	}
+
+	var (
+		name  = strings.ToLower(strings.TrimSuffix(string(q.Name), "."))
+		chain []*ResourceRecord
+		rrs   []*ResourceRecord
+	)
+
+	// The root name is resolved by querying the root name servers.
+	for n := 0; n == 0 || len(name) > 0; n++ {
+		if n > maxCNAMEChain {
+			return nil, ErrWalkCNAME
+		}
+
+		var zone string
+
+		res, zone, err = rs.walkName(name, q.Type, q.Class, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		rrs, name = followCNAME(res.Answer, zone, name, q.Type)
+		chain = append(chain, rrs...)
+	}
+
+	out := NewMessage()
+	out.Header.IsQuery = false
+	out.Header.IsRA = true
+	out.Header.RCode = RCodeErrServer
+	out.Question.Name = append(out.Question.Name, q.Name...)
+	out.Question.Type = q.Type
+	out.Question.Class = q.Class
+	out.Answer = chain
+	if res != nil {
+		out.Header.RCode = res.Header.RCode
+		out.Authority = res.Authority
+	}
+
+	_, err = out.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Unpack the packet into new message, so the offset of each records
+	// refer to the new packet.
+	res = NewMessage()
+	res.Packet = append(res.Packet[:0], out.Packet...)
+
+	err = res.Unpack()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+//
+// walkName resolve the name by walking the delegation, started from the
+// nearest delegation in cache or from root name servers.  It return the
+// response and the zone of name servers that send the response.
+//
+// To minimise the name that are exposed to the name servers (RFC 9156),
+// each name server is queried with NS type and with one more label than
+// its zone, until the name is equal to the query name.  If the name
+// server does not respond the minimised query properly, the full query
+// name will be used.
+//
+func (rs *Resolver) walkName(qname string, qtype, qclass uint16, depth int) (
+	res *Message, zone string, err error,
+) {
+	zone, addrs := rs.delegations.closest(qname)
+	if addrs == nil {
+		zone = ""
+		addrs = rs.roots
+	}
+
+	var (
+		nlabels    = int(countLabels([]byte(zone))) + 1
+		isMinimise = true
+	)
+
+	for x := 0; x < maxWalkSteps; x++ {
+		sname, stype := qname, qtype
+		if isMinimise && nlabels < int(countLabels([]byte(qname))) {
+			sname = lastLabels(qname, nlabels)
+			stype = QueryTypeNS
+		}
+
+		res, err = rs.queryServers(addrs, sname, stype, qclass)
+		if err != nil {
+			return nil, "", err
+		}
+
+		cut, ns, err := referral(res, zone, qname)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(ns) > 0 {
+			addrs, err = rs.nsAddrs(res, ns, zone, depth)
+			if err != nil {
+				return nil, "", err
+			}
+			rs.delegations.upsert(cut, addrs, ns[0].TTL)
+
+			zone = cut
+			nlabels = int(countLabels([]byte(zone))) + 1
+			continue
+		}
+
+		if sname == qname {
+			return res, zone, nil
+		}
+		if res.Header.RCode != RCodeOK {
+			isMinimise = false
+			continue
+		}
+		nlabels++
+	}
+
+	return nil, "", ErrWalkSteps
+}
+
+//
+// queryServers send the query to each name servers until one of them
+// return a valid response.
+//
+func (rs *Resolver) queryServers(addrs []*net.UDPAddr, qname string,
+	qtype, qclass uint16,
+) (res *Message, err error) {
+	msg := NewMessage()
+
+	msg.Header.ID = getNextID()
+	msg.Header.IsRD = false
+	msg.Question.Name = append(msg.Question.Name, qname...)
+	msg.Question.Type = qtype
+	msg.Question.Class = qclass
+
+	msg.SetEDNS(maxUDPPacketSize, rs.validator != nil)
+
+	_, err = msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ErrWalkNoServer
+
+	for _, addr := range addrs {
+		res, err = exchange(addr, msg)
+		if err != nil {
+			continue
+		}
+
+		switch res.Header.RCode {
+		case RCodeErrServer, RCodeNotImplemented, RCodeRefused:
+			err = fmt.Errorf("dns: resolver: %s: response code %d",
+				addr, res.Header.RCode)
+			continue
+		}
+
+		return res, nil
+	}
+
+	return nil, err
+}
+
+//
+// exchange send the message to name server using UDP.  The UDP client
+// will retry the query using TCP if the response is truncated.
+//
+func exchange(addr *net.UDPAddr, msg *Message) (res *Message, err error) {
+	cl, err := NewUDPClient(addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = cl.Query(msg, nil)
+	_ = cl.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = isResponseTo(msg, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+//
+// referral return the NS records in authority section, if the response is
+// a referral to the zone cut below the zone that contains the query name.
+// It will return an error if the response refer to the zone that is not
+// below the zone.
+//
+func referral(res *Message, zone, qname string) (
+	cut string, ns []*ResourceRecord, err error,
+) {
+	if res.Header.IsAA || res.Header.RCode != RCodeOK || len(res.Answer) > 0 {
+		return "", nil, nil
+	}
+
+	for _, rr := range res.Authority {
+		if rr.Type != QueryTypeNS {
+			continue
+		}
+		name := string(rr.Name)
+		if len(ns) == 0 {
+			cut = name
+		} else if name != cut {
+			continue
+		}
+		ns = append(ns, rr)
+	}
+	if len(ns) == 0 {
+		return "", nil, nil
+	}
+
+	if cut == zone || !isSubdomain([]byte(cut), []byte(zone)) ||
+		!isSubdomain([]byte(qname), []byte(cut)) {
+		return "", nil, ErrWalkReferral
+	}
+
+	return cut, ns, nil
+}
+
+//
+// nsAddrs return the address of name servers in NS records.  The address
+// is taken from glue records in additional section that is in the zone of
+// name server that send the referral.  If no glue records found, the
+// address of name servers will be resolved.
+//
+func (rs *Resolver) nsAddrs(res *Message, ns []*ResourceRecord, zone string,
+	depth int,
+) (addrs []*net.UDPAddr, err error) {
+	for _, rr := range ns {
+		target := string(rr.Text.Value)
+		if !isSubdomain(rr.Text.Value, []byte(zone)) {
+			continue
+		}
+		for _, glue := range res.Additional {
+			if string(glue.Name) != target {
+				continue
+			}
+			addrs = rs.appendAddr(addrs, glue)
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+
+	for _, rr := range ns {
+		q := &SectionQuestion{
+			Name:  rr.Text.Value,
+			Type:  QueryTypeA,
+			Class: QueryClassIN,
+		}
+
+		var ans *Message
+
+		ans, err = rs.walk(q, depth+1)
+		if err != nil {
+			continue
+		}
+		for _, a := range ans.Answer {
+			addrs = rs.appendAddr(addrs, a)
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ErrWalkNoServer
+}
+
+//
+// appendAddr append the address in A or AAAA record into addrs.
+//
+func (rs *Resolver) appendAddr(addrs []*net.UDPAddr, rr *ResourceRecord) []*net.UDPAddr {
+	if rr.Type != QueryTypeA && rr.Type != QueryTypeAAAA {
+		return addrs
+	}
+	ip := net.ParseIP(string(rr.Text.Value))
+	if ip == nil {
+		return addrs
+	}
+	return append(addrs, &net.UDPAddr{IP: ip, Port: rs.nsPort})
+}
+
+//
+// followCNAME return the records in answer that match with the name and
+// type, including the CNAME records that lead to them.  If the CNAME chain
+// end with the name that does not exist in answer, or with the name that
+// is outside of the zone of name servers that send the answer, the last
+// target name will be returned as next.  The records outside of the zone
+// are not trusted, to prevent the cache poisoning, and the target name
+// must be resolved again from its own zone.
+//
+func followCNAME(answer []*ResourceRecord, zone, name string, qtype uint16) (
+	rrs []*ResourceRecord, next string,
+) {
+	for x := 0; x <= maxCNAMEChain; x++ {
+		var (
+			cname   *ResourceRecord
+			isFound bool
+		)
+
+		for _, rr := range answer {
+			if string(rr.Name) != name {
+				continue
+			}
+			switch {
+			case qtype == QueryTypeALL || rr.Type == qtype:
+				rrs = append(rrs, rr)
+				isFound = true
+			case rr.Type == QueryTypeRRSIG:
+				rrs = append(rrs, rr)
+			case rr.Type == QueryTypeCNAME && cname == nil:
+				cname = rr
+			}
+		}
+
+		if isFound || cname == nil {
+			return rrs, ""
+		}
+
+		rrs = append(rrs, cname)
+		name = string(cname.Text.Value)
+
+		if !isSubdomain([]byte(name), []byte(zone)) ||
+			!containsName(answer, name) {
+			return rrs, name
+		}
+	}
+
+	return rrs, ""
+}
+
+//
+// containsName will return true if one of records has the name.
+//
+func containsName(rrs []*ResourceRecord, name string) bool {
+	for _, rr := range rrs {
+		if string(rr.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// lastLabels return the last n labels of name.
+//
+func lastLabels(name string, n int) string {
+	x := len(name)
+	for ; n > 0; n-- {
+		x = strings.LastIndexByte(name[:x], '.')
+		if x < 0 {
+			return name
+		}
+	}
+	return name[x+1:]
+}
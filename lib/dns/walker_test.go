@@ -0,0 +1,272 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+//
+// testWalkHandler is a handler that record the query names and answer
+// the query from zones.  The query for "big.example.test" through UDP is
+// answered with truncated response.  The query for "poison.example.test"
+// is answered with CNAME to "www.other.test" and the forged address of
+// "www.other.test".
+//
+type testWalkHandler struct {
+	sync.Mutex
+	zh    *ZoneHandler
+	names []string
+}
+
+func (h *testWalkHandler) ServeDNS(req *Request) {
+	qname := string(req.Message.Question.Name)
+
+	h.Lock()
+	h.names = append(h.names, qname)
+	h.Unlock()
+
+	if req.Kind == ConnTypeUDP && qname == "big.example.test" {
+		res := newResponse(req.Message, RCodeOK)
+		res.Header.IsTC = true
+		h.zh.sendResponse(req, res)
+		return
+	}
+	if qname == "poison.example.test" {
+		res := newResponse(req.Message, RCodeOK)
+		res.Header.IsAA = true
+		res.Answer = []*ResourceRecord{{
+			Name:  []byte(qname),
+			Type:  QueryTypeCNAME,
+			Class: QueryClassIN,
+			TTL:   300,
+			Text: &RDataText{
+				Value: []byte("www.other.test"),
+			},
+		},
+			newTestA("www.other.test", "10.6.6.6"),
+		}
+		h.zh.sendResponse(req, res)
+		return
+	}
+
+	h.zh.ServeDNS(req)
+}
+
+func (h *testWalkHandler) queries() []string {
+	h.Lock()
+	defer h.Unlock()
+	return append([]string(nil), h.names...)
+}
+
+func newTestZone(t *testing.T, content string) *Zone {
+	m := newMaster()
+	m.Init(content, "", 0)
+
+	err := m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zone := NewZone(masterOrigin("", "", m.msgs))
+	for _, msg := range m.msgs {
+		for _, rr := range msg.Answer {
+			zone.add(rr)
+		}
+	}
+
+	return zone
+}
+
+//
+// newTestWalkServer create and run the server that answer the query from
+// zones, on UDP and TCP with the same address.
+//
+func newTestWalkServer(t *testing.T, ip string, port int, zones ...*Zone) (
+	srv *Server, h *testWalkHandler, addr *net.UDPAddr,
+) {
+	h = &testWalkHandler{
+		zh: NewZoneHandler(),
+	}
+	for _, zone := range zones {
+		h.zh.AddZone(zone)
+	}
+
+	srv = &Server{
+		Handler: h,
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP:   net.ParseIP(ip),
+		Port: port,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr = conn.LocalAddr().(*net.UDPAddr)
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   addr.IP,
+		Port: addr.Port,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = srv.ServeUDP(conn)
+	}()
+	go func() {
+		_ = srv.ServeTCP(ln)
+	}()
+
+	return srv, h, addr
+}
+
+func TestResolverWalk(t *testing.T) {
+	root := newTestZone(t, `
+. 3600 IN SOA a.root. admin.root. 1 3600 600 86400 300
+. 3600 IN NS a.root.
+test. 3600 IN NS ns.test.
+ns.test. 3600 IN A 127.0.0.2
+`)
+	tld := newTestZone(t, `
+test. 3600 IN SOA ns.test. admin.test. 1 3600 600 86400 300
+test. 3600 IN NS ns.test.
+ns.test. 3600 IN A 127.0.0.2
+example.test. 3600 IN NS ns.example.test.
+ns.example.test. 3600 IN A 127.0.0.3
+other.test. 3600 IN NS ns.other.example.test.
+`)
+	example := newTestZone(t, `
+example.test. 3600 IN SOA ns.example.test. admin.example.test. 1 3600 600 86400 300
+example.test. 3600 IN NS ns.example.test.
+ns.example.test. 3600 IN A 127.0.0.3
+ns.other.example.test. 3600 IN A 127.0.0.3
+www.example.test. 3600 IN CNAME web.example.test.
+web.example.test. 3600 IN A 10.0.0.1
+alias.example.test. 3600 IN CNAME www.other.test.
+big.example.test. 3600 IN A 10.0.0.9
+`)
+	other := newTestZone(t, `
+other.test. 3600 IN SOA ns.other.example.test. admin.other.test. 1 3600 600 86400 300
+other.test. 3600 IN NS ns.other.example.test.
+www.other.test. 3600 IN A 10.0.0.2
+`)
+
+	// All servers listen on the same port, with different addresses.
+	rootSrv, rootHandler, rootAddr := newTestWalkServer(t, "127.0.0.1", 0, root)
+	tldSrv, _, _ := newTestWalkServer(t, "127.0.0.2", rootAddr.Port, tld)
+	exampleSrv, exampleHandler, _ := newTestWalkServer(t, "127.0.0.3", rootAddr.Port,
+		example, other)
+
+	time.Sleep(100 * time.Millisecond)
+
+	rs, err := NewIterativeResolver(rootAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.nsPort = rootAddr.Port
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc     string
+		qname    string
+		expRCode ResponseCode
+		exp      []string
+	}{{
+		desc:  "With CNAME in the same zone",
+		qname: "www.example.test",
+		exp:   []string{"web.example.test", "10.0.0.1"},
+	}, {
+		desc:  "With CNAME to other zone without glue",
+		qname: "alias.example.test",
+		exp:   []string{"www.other.test", "10.0.0.2"},
+	}, {
+		desc:  "With CNAME target outside of zone in the same answer",
+		qname: "poison.example.test",
+		exp:   []string{"www.other.test", "10.0.0.2"},
+	}, {
+		desc:  "With truncated response",
+		qname: "big.example.test",
+		exp:   []string{"10.0.0.9"},
+	}, {
+		desc:     "With unknown name",
+		qname:    "none.example.test",
+		expRCode: RCodeErrName,
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		id := uint16(1000 + x)
+
+		rs.ServeDNS(newTestRequest(sender, id, c.qname))
+		res := <-sender.C
+
+		test.Assert(t, "ID", id, res.Header.ID, true)
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+		test.Assert(t, "IsRA", true, res.Header.IsRA, true)
+
+		var got []string
+		for _, rr := range res.Answer {
+			got = append(got, testRDataString(rr))
+		}
+		test.Assert(t, "Answer", c.exp, got, true)
+	}
+
+	// The root name server should only receive the minimised query name,
+	// and only once because the delegation of "test" is cached.
+	test.Assert(t, "root queries", []string{"test"},
+		rootHandler.queries(), true)
+
+	// The answer of previous query should be answered from cache.
+	nquery := len(exampleHandler.queries())
+
+	rs.ServeDNS(newTestRequest(sender, 2000, "www.example.test"))
+	res := <-sender.C
+	test.Assert(t, "ID", uint16(2000), res.Header.ID, true)
+	test.Assert(t, "cached answer", "10.0.0.1",
+		testRDataString(res.Answer[1]), true)
+	test.Assert(t, "nquery", nquery, len(exampleHandler.queries()), true)
+
+	// The root name is queried to the root name servers.
+	req := newTestRequest(sender, 3000, "")
+	req.Message.Question.Type = QueryTypeNS
+
+	rs.ServeDNS(req)
+	res = <-sender.C
+
+	test.Assert(t, "ID", uint16(3000), res.Header.ID, true)
+	test.Assert(t, "RCode", RCodeOK, res.Header.RCode, true)
+	test.Assert(t, "Answer", 1, len(res.Answer), true)
+	test.Assert(t, "NS", "a.root", testRDataString(res.Answer[0]), true)
+
+	res, err = rs.walk(&SectionQuestion{
+		Name:  []byte("."),
+		Type:  QueryTypeNS,
+		Class: QueryClassIN,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Assert(t, "Answer", 1, len(res.Answer), true)
+
+	for _, srv := range []*Server{rootSrv, tldSrv, exampleSrv} {
+		err = srv.Shutdown(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
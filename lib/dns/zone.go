@@ -0,0 +1,451 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxZoneJournal define the maximum number of changes that are kept
+	// in zone journal.
+	maxZoneJournal = 64
+)
+
+//
+// Zone contains resource records of a zone of authority, indexed by their
+// owner name.
+//
+type Zone struct {
+	// Origin define the domain name of the top node of zone, without
+	// trailing dot.  Origin of root zone is empty string.
+	Origin string
+
+	// SOA define the start of authority record of zone.
+	SOA *ResourceRecord
+
+	sync.RWMutex
+	records map[string][]*ResourceRecord
+	journal []*zoneJournal
+}
+
+//
+// zoneJournal contains the changes that transform the zone with SOA "from"
+// into the zone with SOA "to".  The deleted and added records does not
+// include the SOA record.
+//
+type zoneJournal struct {
+	from    *ResourceRecord
+	to      *ResourceRecord
+	deleted []*ResourceRecord
+	added   []*ResourceRecord
+}
+
+//
+// NewZone create and initialize new zone with specific origin.
+//
+func NewZone(origin string) *Zone {
+	origin = strings.ToLower(strings.TrimRight(origin, "."))
+
+	return &Zone{
+		Origin:  origin,
+		records: make(map[string][]*ResourceRecord),
+	}
+}
+
+//
+// LoadZone load all records in master file into new zone.  If origin is
+// empty, the base name of file will be used as origin.  The zone origin is
+// set to the owner of the first SOA record in file, or to the origin if
+// file does not contains SOA record.
+//
+func LoadZone(file, origin string, ttl uint32) (zone *Zone, err error) {
+	msgs, err := MasterLoad(file, origin, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	zone = NewZone(masterOrigin(file, origin, msgs))
+
+	for _, msg := range msgs {
+		for _, rr := range msg.Answer {
+			zone.add(rr)
+		}
+	}
+
+	return zone, nil
+}
+
+//
+// masterOrigin return the zone origin of records in master file.
+//
+func masterOrigin(file, origin string, msgs []*Message) string {
+	if len(origin) == 0 {
+		origin = path.Base(file)
+	}
+	for _, msg := range msgs {
+		if msg.Question.Type == QueryTypeSOA {
+			return string(msg.Question.Name)
+		}
+	}
+	return origin
+}
+
+//
+// Add resource record to zone.  If the record is SOA and its name is equal
+// to zone origin, it will be set as zone SOA, replacing the previous one.
+//
+func (zone *Zone) Add(rr *ResourceRecord) {
+	zone.Lock()
+	zone.add(rr)
+	zone.Unlock()
+}
+
+func (zone *Zone) add(rr *ResourceRecord) {
+	name := string(rr.Name)
+
+	if rr.Type == QueryTypeSOA && name == zone.Origin {
+		if zone.SOA != nil {
+			zone.remove(zone.SOA)
+		}
+		zone.SOA = rr
+	}
+
+	for _, in := range zone.records[name] {
+		if in.isEqual(rr) {
+			return
+		}
+	}
+
+	zone.records[name] = append(zone.records[name], rr)
+}
+
+//
+// Remove the resource record from zone.  Record is removed only if their
+// name, type, class, and data are equal.
+//
+func (zone *Zone) Remove(rr *ResourceRecord) {
+	zone.Lock()
+	zone.remove(rr)
+	zone.Unlock()
+}
+
+func (zone *Zone) remove(rr *ResourceRecord) {
+	name := string(rr.Name)
+	rrs := zone.records[name]
+
+	for x := 0; x < len(rrs); x++ {
+		if !rrs[x].isEqual(rr) {
+			continue
+		}
+		copy(rrs[x:], rrs[x+1:])
+		rrs[len(rrs)-1] = nil
+		rrs = rrs[:len(rrs)-1]
+		break
+	}
+
+	if len(rrs) == 0 {
+		delete(zone.records, name)
+	} else {
+		zone.records[name] = rrs
+	}
+}
+
+//
+// Update apply the changes to zone by removing the deleted records and
+// adding the added records.
+//
+// If the added records does not contains new SOA, the zone SOA serial will
+// be incremented by one.  The changes is recorded in zone journal, so
+// secondary servers can request incremental zone transfer (IXFR).
+//
+func (zone *Zone) Update(deleted, added []*ResourceRecord) {
+	zone.Lock()
+	defer zone.Unlock()
+
+	j := &zoneJournal{
+		from: zone.SOA,
+	}
+
+	for _, rr := range deleted {
+		if rr.Type == QueryTypeSOA {
+			continue
+		}
+		zone.remove(rr)
+		j.deleted = append(j.deleted, rr)
+	}
+	for _, rr := range added {
+		if rr.Type == QueryTypeSOA && string(rr.Name) == zone.Origin {
+			j.to = rr
+			continue
+		}
+		zone.add(rr)
+		j.added = append(j.added, rr)
+	}
+
+	zone.commit(j)
+}
+
+//
+// commit set the new zone SOA from journal and record the journal.  If
+// the journal does not contains new SOA, the zone SOA serial will be
+// incremented by one.
+//
+func (zone *Zone) commit(j *zoneJournal) {
+	if j.from == nil {
+		if j.to != nil {
+			zone.add(j.to)
+		}
+		return
+	}
+
+	if j.to == nil {
+		soa := *j.from
+		soa.SOA = &RDataSOA{}
+		*soa.SOA = *j.from.SOA
+		soa.SOA.Serial++
+		j.to = &soa
+	}
+
+	zone.add(j.to)
+
+	zone.journal = append(zone.journal, j)
+	if len(zone.journal) > maxZoneJournal {
+		zone.journal = zone.journal[len(zone.journal)-maxZoneJournal:]
+	}
+}
+
+//
+// journalSince return list of continuous changes from SOA serial until the
+// current SOA serial.  It will return nil if the journal does not contains
+// the serial or the changes is not continuous.
+//
+func (zone *Zone) journalSince(serial uint32) (changes []*zoneJournal) {
+	x := 0
+	for ; x < len(zone.journal); x++ {
+		if zone.journal[x].from.SOA.Serial == serial {
+			break
+		}
+	}
+	if x == len(zone.journal) {
+		return nil
+	}
+
+	for ; x < len(zone.journal); x++ {
+		j := zone.journal[x]
+		if len(changes) > 0 {
+			prev := changes[len(changes)-1]
+			if prev.to.SOA.Serial != j.from.SOA.Serial {
+				return nil
+			}
+		}
+		changes = append(changes, j)
+	}
+
+	last := changes[len(changes)-1]
+	if last.to.SOA.Serial != zone.SOA.SOA.Serial {
+		return nil
+	}
+
+	return changes
+}
+
+//
+// all return all resource records in zone, except the SOA record, ordered
+// by name, with zone origin at the beginning.
+//
+func (zone *Zone) all() (rrs []*ResourceRecord) {
+	names := make([]string, 0, len(zone.records))
+	for name := range zone.records {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(x, y int) bool {
+		if names[x] == zone.Origin {
+			return true
+		}
+		if names[y] == zone.Origin {
+			return false
+		}
+		return names[x] < names[y]
+	})
+
+	for _, name := range names {
+		for _, rr := range zone.records[name] {
+			if rr == zone.SOA {
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return rrs
+}
+
+//
+// isIn will return true if domain name is equal to zone origin or is
+// sub-domain of zone origin.
+//
+func (zone *Zone) isIn(name string) bool {
+	if len(zone.Origin) == 0 {
+		return true
+	}
+	if name == zone.Origin {
+		return true
+	}
+	return strings.HasSuffix(name, "."+zone.Origin)
+}
+
+//
+// get list of resource records with specific name, type, and class.
+// If qtype is QueryTypeALL it will return all records on that name.
+//
+func (zone *Zone) get(name string, qtype, qclass uint16) []*ResourceRecord {
+	return filterRR(zone.records[name], qtype, qclass)
+}
+
+//
+// isEmptyNonTerminal will return true if name does not have any records
+// but one of its sub-domain has, for example "_tcp.example.com" on zone
+// that only have "_sip._tcp.example.com" records.
+//
+func (zone *Zone) isEmptyNonTerminal(name string) bool {
+	suffix := "." + name
+	for k := range zone.records {
+		if strings.HasSuffix(k, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// delegation return the NS records of the zone cut, below the zone origin,
+// that contains the name.  It will return nil if name is not delegated to
+// other name servers.
+//
+func (zone *Zone) delegation(name string, qclass uint16) []*ResourceRecord {
+	var cut []*ResourceRecord
+
+	for len(name) > 0 && name != zone.Origin {
+		ns := zone.get(name, QueryTypeNS, qclass)
+		if len(ns) > 0 {
+			cut = ns
+		}
+
+		x := strings.IndexByte(name, '.')
+		if x < 0 {
+			break
+		}
+		name = name[x+1:]
+	}
+
+	return cut
+}
+
+//
+// negativeSOA return copy of zone SOA record to be used in authority
+// section of negative response.  The TTL is set to the minimum of SOA TTL
+// and SOA MINIMUM field (RFC 2308 section 3).
+//
+func (zone *Zone) negativeSOA() *ResourceRecord {
+	if zone.SOA == nil {
+		return nil
+	}
+
+	soa := *zone.SOA
+	if soa.SOA.Minimum < soa.TTL {
+		soa.TTL = soa.SOA.Minimum
+	}
+
+	return &soa
+}
+
+//
+// transferRecords return list of records to be transferred to secondary
+// server for AXFR or IXFR query.
+//
+// For AXFR, or IXFR where the journal does not contains the client serial,
+// the list contains the zone SOA, all records in zone, and the zone SOA
+// again.
+//
+// For IXFR where client serial is equal or greater than the zone serial,
+// the list only contains the zone SOA.  Otherwise, the list contains the
+// zone SOA, followed by each changes in journal in the form of old SOA,
+// deleted records, new SOA, and added records, and ended with the zone SOA
+// (RFC 1995 section 4).
+//
+func (zone *Zone) transferRecords(q *Message) (rrs []*ResourceRecord) {
+	rrs = append(rrs, zone.SOA)
+
+	if q.Question.Type == QueryTypeIXFR {
+		for _, rr := range q.Authority {
+			if rr.Type != QueryTypeSOA || rr.SOA == nil {
+				continue
+			}
+			if !serialLess(rr.SOA.Serial, zone.SOA.SOA.Serial) {
+				return rrs
+			}
+
+			changes := zone.journalSince(rr.SOA.Serial)
+			if len(changes) == 0 {
+				break
+			}
+
+			for _, j := range changes {
+				rrs = append(rrs, j.from)
+				rrs = append(rrs, j.deleted...)
+				rrs = append(rrs, j.to)
+				rrs = append(rrs, j.added...)
+			}
+			rrs = append(rrs, zone.SOA)
+			return rrs
+		}
+	}
+
+	rrs = append(rrs, zone.all()...)
+	rrs = append(rrs, zone.SOA)
+
+	return rrs
+}
+
+//
+// serialLess will return true if SOA serial s1 is less than s2, using the
+// serial number arithmetic defined in RFC 1982.
+//
+func serialLess(s1, s2 uint32) bool {
+	if s1 == s2 {
+		return false
+	}
+	return (s1 < s2 && s2-s1 < 1<<31) || (s1 > s2 && s1-s2 > 1<<31)
+}
+
+//
+// Write all records in zone into w in master file syntax, start with the
+// zone SOA, using absolute domain names.
+//
+func (zone *Zone) Write(w io.Writer) (err error) {
+	zone.RLock()
+	defer zone.RUnlock()
+
+	if zone.SOA != nil {
+		err = writeMasterRR(w, zone.SOA)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rr := range zone.all() {
+		err = writeMasterRR(w, rr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,898 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	libio "github.com/shuLhan/share/lib/io"
+)
+
+const (
+	// maxCNAMEChain define the maximum number of CNAME records that will
+	// be followed when answering a query.
+	maxCNAMEChain = 8
+
+	// maxTransferRR define the maximum number of records in each message
+	// of zone transfer.
+	maxTransferRR = 128
+)
+
+// errFileDeleted define the error when the watched file is deleted.
+var errFileDeleted = errors.New("file is deleted")
+
+//
+// ZoneHandler is a Handler that answer query authoritatively from zones
+// loaded from master files and from records loaded from hosts files.
+//
+// Query with name that exist in hosts files will be answered from hosts
+// records.  Otherwise, query will be answered by the zone with the longest
+// origin that contains the query name.  If no zone contains the name, query
+// will be passed to the Fallback handler, or answered with REFUSED if
+// Fallback is nil.
+//
+type ZoneHandler struct {
+	// Fallback define the handler that will receive the query if the
+	// name is not in any zones.
+	Fallback Handler
+
+	// AllowTransfer define list of client networks that are allowed to
+	// request zone transfer (AXFR or IXFR).  If its empty, all zone
+	// transfer requests will be refused.
+	AllowTransfer []*net.IPNet
+
+	// AllowUpdate define list of client networks that are allowed to
+	// send dynamic update (RFC 2136) without TSIG.  The update signed
+	// with the key in Keyring is allowed from any networks.
+	AllowUpdate []*net.IPNet
+
+	// Keyring contains the TSIG keys to verify the signed request.
+	Keyring *TSIGKeyring
+
+	// SynthesizePTR define whether the PTR records for reverse lookup
+	// are created from the A and AAAA records in master files and hosts
+	// files, when the files are loaded.  The PTR records are answered
+	// only if the name does not exist in hosts and zones, and replaced
+	// when the file is reloaded.  The records added by dynamic update
+	// does not have PTR records.
+	SynthesizePTR bool
+
+	// OnReloadError define the function that will be called when
+	// reloading the watched file is failed.  The records from previous
+	// load of file are kept.  If its nil, the error will be logged.
+	OnReloadError func(file string, err error)
+
+	sync.RWMutex
+	zones []*Zone
+	hosts map[string][]*ResourceRecord
+
+	// files contains the hosts records loaded from each file.
+	files map[string]map[string][]*ResourceRecord
+
+	// ptrs contains the synthesized PTR records from all files, and
+	// ptrFiles contains the synthesized PTR records of each file.
+	ptrs     map[string][]*ResourceRecord
+	ptrFiles map[string]map[string][]*ResourceRecord
+
+	// notifies contains the secondary name servers of each zone origin.
+	notifies map[string][]*net.UDPAddr
+
+	// primaries contains the primary name server of each secondary zone
+	// origin.
+	primaries map[string]*net.UDPAddr
+}
+
+//
+// NewZoneHandler create and initialize new zone handler.
+//
+func NewZoneHandler() *ZoneHandler {
+	return &ZoneHandler{
+		hosts:     make(map[string][]*ResourceRecord),
+		files:     make(map[string]map[string][]*ResourceRecord),
+		ptrs:      make(map[string][]*ResourceRecord),
+		ptrFiles:  make(map[string]map[string][]*ResourceRecord),
+		notifies:  make(map[string][]*net.UDPAddr),
+		primaries: make(map[string]*net.UDPAddr),
+	}
+}
+
+//
+// AddZone add or replace zone with the same origin.
+//
+func (zh *ZoneHandler) AddZone(zone *Zone) {
+	zh.Lock()
+	zh.addZone(zone)
+	zh.Unlock()
+}
+
+//
+// addZone add or replace zone with the same origin, and return the
+// replaced zone.
+//
+func (zh *ZoneHandler) addZone(zone *Zone) (old *Zone) {
+	for x := 0; x < len(zh.zones); x++ {
+		if zh.zones[x].Origin == zone.Origin {
+			old = zh.zones[x]
+			zh.zones[x] = zone
+			return old
+		}
+	}
+	zh.zones = append(zh.zones, zone)
+	return nil
+}
+
+//
+// LoadMaster load the master file as a zone.  If origin is empty, the base
+// name of file will be used as origin.  The zone origin is set to the
+// owner of the first SOA record in file, or to the origin if file does not
+// contains SOA record.  Records in file that does not belong to zone origin
+// is answered as hosts records.
+//
+// Loading the same file again will replace the zone and the hosts records
+// from previous load of file.
+//
+func (zh *ZoneHandler) LoadMaster(file, origin string, ttl uint32) error {
+	_, _, err := zh.swapMaster(file, origin, ttl)
+	return err
+}
+
+//
+// swapMaster load the master file and replace the zone and the hosts
+// records from previous load of file at once.  On failure, the previous
+// records are kept.
+//
+func (zh *ZoneHandler) swapMaster(file, origin string, ttl uint32) (
+	old, zone *Zone, err error,
+) {
+	zone, hosts, err := loadMaster(file, origin, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ptrs := make(map[string][]*ResourceRecord)
+	if zh.SynthesizePTR {
+		var rrs []*ResourceRecord
+		for _, list := range zone.records {
+			rrs = append(rrs, list...)
+		}
+		for _, list := range hosts {
+			rrs = append(rrs, list...)
+		}
+		synthesizePTR(ptrs, rrs)
+	}
+
+	zh.Lock()
+	old = zh.addZone(zone)
+	zh.setHosts(file, hosts, ptrs)
+	zh.Unlock()
+
+	return old, zone, nil
+}
+
+//
+// loadMaster load the master file into zone and the records that does not
+// belong to zone origin into hosts.
+//
+func loadMaster(file, origin string, ttl uint32) (
+	zone *Zone, hosts map[string][]*ResourceRecord, err error,
+) {
+	msgs, err := MasterLoad(file, origin, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zone = NewZone(masterOrigin(file, origin, msgs))
+	hosts = make(map[string][]*ResourceRecord)
+
+	for _, msg := range msgs {
+		for _, rr := range msg.Answer {
+			if zone.isIn(string(rr.Name)) {
+				zone.add(rr)
+				continue
+			}
+			name := string(rr.Name)
+			hosts[name] = append(hosts[name], rr)
+		}
+	}
+
+	return zone, hosts, nil
+}
+
+//
+// LoadHosts load the A and AAAA records from hosts file.
+// If path is empty, it will load from the system hosts file.
+// Loading the same file again will replace the records from previous load
+// of file.
+//
+func (zh *ZoneHandler) LoadHosts(path string) error {
+	if len(path) == 0 {
+		path = GetSystemHosts()
+	}
+
+	msgs, err := HostsLoad(path)
+	if err != nil {
+		return err
+	}
+
+	hosts := make(map[string][]*ResourceRecord)
+	ptrs := make(map[string][]*ResourceRecord)
+	for _, msg := range msgs {
+		for _, rr := range msg.Answer {
+			name := string(rr.Name)
+			hosts[name] = append(hosts[name], rr)
+		}
+		if zh.SynthesizePTR {
+			synthesizePTR(ptrs, msg.Answer)
+		}
+	}
+
+	zh.Lock()
+	zh.setHosts(path, hosts, ptrs)
+	zh.Unlock()
+
+	return nil
+}
+
+//
+// setHosts replace the hosts records and the synthesized PTR records of
+// file, and rebuild the hosts and PTR records from all files.  The maps are
+// replaced, not modified, so the query that still use the previous map is
+// not affected.
+//
+func (zh *ZoneHandler) setHosts(file string,
+	hosts, ptrs map[string][]*ResourceRecord,
+) {
+	zh.files[file] = hosts
+	zh.hosts = mergeFiles(zh.files)
+
+	zh.ptrFiles[file] = ptrs
+	zh.ptrs = mergeFiles(zh.ptrFiles)
+}
+
+//
+// mergeFiles return the records of all files, indexed by name.
+//
+func mergeFiles(files map[string]map[string][]*ResourceRecord) (
+	all map[string][]*ResourceRecord,
+) {
+	all = make(map[string][]*ResourceRecord)
+	for _, hosts := range files {
+		for name, rrs := range hosts {
+			all[name] = append(all[name], rrs...)
+		}
+	}
+	return all
+}
+
+//
+// WatchMaster watch the master file for changes, inspected every
+// duration d, and reload the zone using ReloadMaster when the file is
+// changed.  Call the returned stop function to stop watching the file.
+//
+func (zh *ZoneHandler) WatchMaster(file, origin string, ttl uint32,
+	d time.Duration,
+) (stop func(), err error) {
+	return zh.watch(file, d, func() error {
+		return zh.ReloadMaster(file, origin, ttl)
+	})
+}
+
+//
+// WatchHosts watch the hosts file for changes, inspected every duration d,
+// and reload the records using LoadHosts when the file is changed.  Call
+// the returned stop function to stop watching the file.
+//
+func (zh *ZoneHandler) WatchHosts(path string, d time.Duration) (
+	stop func(), err error,
+) {
+	if len(path) == 0 {
+		path = GetSystemHosts()
+	}
+	return zh.watch(path, d, func() error {
+		return zh.LoadHosts(path)
+	})
+}
+
+//
+// watch the file and call reload when the file is changed.  If the file is
+// deleted or reload is failed, the error will be reported using
+// OnReloadError.  The deleted file is reported once, until the file is
+// created again.
+//
+// The returned stop function stop the watcher and wait until the last
+// reload is completed.
+//
+func (zh *ZoneHandler) watch(file string, d time.Duration,
+	reload func() error,
+) (stop func(), err error) {
+	w, err := libio.NewWatcher(file, d)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		for fi := range w.C {
+			err := errFileDeleted
+			if fi != nil {
+				err = reload()
+			}
+			if err != nil {
+				zh.reloadError(file, err)
+			}
+		}
+		close(done)
+	}()
+
+	stop = func() {
+		w.Stop()
+		<-done
+	}
+
+	return stop, nil
+}
+
+//
+// reloadError report the error when reloading the watched file.
+//
+func (zh *ZoneHandler) reloadError(file string, err error) {
+	if zh.OnReloadError != nil {
+		zh.OnReloadError(file, err)
+		return
+	}
+	log.Printf("dns: ZoneHandler: reload %s: %s\n", file, err)
+}
+
+//
+// ServeDNS answer the request from hosts records or from zones.
+//
+func (zh *ZoneHandler) ServeDNS(req *Request) {
+	switch req.Message.Header.Op {
+	case OpCodeUpdate:
+		zh.serveUpdate(req)
+		return
+	case OpCodeNotify:
+		zh.serveNotify(req)
+		return
+	}
+
+	switch req.Message.Question.Type {
+	case QueryTypeAXFR, QueryTypeIXFR:
+		zh.serveTransfer(req)
+		return
+	}
+
+	res := zh.answer(req.Message)
+	if res == nil {
+		if zh.Fallback != nil {
+			zh.Fallback.ServeDNS(req)
+			return
+		}
+		res = newResponse(req.Message, RCodeRefused)
+	}
+
+	zh.sendResponse(req, res)
+}
+
+//
+// serveTransfer answer the zone transfer request.
+//
+// Zone transfer is only allowed for client with address in AllowTransfer,
+// and for query name that equal to one of zone origin.  AXFR is only
+// allowed through TCP or DoT.  IXFR through UDP is answered with the current
+// zone SOA, as defined in RFC 1995 section 2.
+//
+func (zh *ZoneHandler) serveTransfer(req *Request) {
+	var (
+		q     = req.Message
+		qname = string(q.Question.Name)
+	)
+
+	if !isIPAllowed(zh.AllowTransfer, requestIP(req)) {
+		zh.sendResponse(req, newResponse(q, RCodeRefused))
+		return
+	}
+
+	zh.RLock()
+	zone := zh.zone(qname)
+	zh.RUnlock()
+
+	if zone == nil {
+		zh.sendResponse(req, newResponse(q, RCodeNotAuth))
+		return
+	}
+
+	isStream := req.Kind == ConnTypeTCP || req.Kind == ConnTypeDoT
+
+	if !isStream && q.Question.Type == QueryTypeAXFR {
+		zh.sendResponse(req, newResponse(q, RCodeNotImplemented))
+		return
+	}
+
+	// Unpack the authority section of IXFR query, that contains the SOA
+	// of client zone.
+	err := q.Unpack()
+	if err != nil {
+		zh.sendResponse(req, newResponse(q, RCodeErrFormat))
+		return
+	}
+
+	// The zone SOA may be replaced by dynamic update, so it must be read
+	// with the lock held.
+	zone.RLock()
+	if zone.SOA == nil {
+		zone.RUnlock()
+		zh.sendResponse(req, newResponse(q, RCodeNotAuth))
+		return
+	}
+	rrs := zone.transferRecords(q)
+	zone.RUnlock()
+
+	if !isStream {
+		res := newResponse(q, RCodeOK)
+		res.Header.IsAA = true
+		res.Answer = rrs[:1]
+		zh.sendResponse(req, res)
+		return
+	}
+
+	msgs, err := packTransfer(q, rrs)
+	if err != nil {
+		log.Println("dns: ZoneHandler: serveTransfer: ", err)
+		FreeRequest(req)
+		return
+	}
+
+	// The transfer is sent as several messages on the same stream, so
+	// the observer is notified once using the first message.
+	if len(msgs) > 0 {
+		req.observe(msgs[0])
+	}
+
+	for _, msg := range msgs {
+		_, err = req.Sender.Send(msg, nil)
+		if err != nil {
+			log.Println("dns: ZoneHandler: serveTransfer: ", err)
+			break
+		}
+	}
+
+	FreeRequest(req)
+}
+
+//
+// serveUpdate apply the dynamic update request to the zone (RFC 2136
+// section 3).
+//
+// The signed request is verified using the keys in Keyring, and the
+// response is signed with the same key.  The unsigned request is only
+// allowed from client with address in AllowUpdate.
+//
+func (zh *ZoneHandler) serveUpdate(req *Request) {
+	q := req.Message
+
+	if q.Header.QDCount != 1 || q.Question.Type != QueryTypeSOA {
+		zh.sendResponse(req, newResponse(q, RCodeErrFormat))
+		return
+	}
+
+	err := q.Unpack()
+	if err != nil {
+		zh.sendResponse(req, newResponse(q, RCodeErrFormat))
+		return
+	}
+
+	var (
+		key    *TSIGKey
+		reqMAC []byte
+	)
+
+	if tsig := q.TSIG(); tsig != nil {
+		keyring := zh.Keyring
+		if keyring == nil {
+			keyring = NewTSIGKeyring()
+		}
+		key, err = q.VerifyTSIG(keyring, nil)
+		if err != nil {
+			zh.sendTSIGError(req, key, err)
+			return
+		}
+		reqMAC = tsig.TSIG.MAC
+	} else if !isIPAllowed(zh.AllowUpdate, requestIP(req)) {
+		zh.sendResponse(req, newResponse(q, RCodeRefused))
+		return
+	}
+
+	qname := string(q.Question.Name)
+
+	zh.RLock()
+	zone := zh.zone(qname)
+	zh.RUnlock()
+
+	res := newResponse(q, RCodeNotAuth)
+	if zone != nil {
+		zone.RLock()
+		soa := zone.SOA
+		zone.RUnlock()
+
+		res.Header.RCode = zone.applyUpdate(q)
+
+		zone.RLock()
+		isChanged := zone.SOA != soa
+		zone.RUnlock()
+
+		if isChanged {
+			zh.notify(zone)
+		}
+	}
+
+	if key == nil {
+		zh.sendResponse(req, res)
+		return
+	}
+
+	err = res.SignTSIG(key, reqMAC)
+	if err != nil {
+		log.Println("dns: ZoneHandler: serveUpdate: ", err)
+		FreeRequest(req)
+		return
+	}
+
+	req.Respond(res)
+}
+
+//
+// sendTSIGError send the response for request that failed the TSIG
+// verification.
+//
+func (zh *ZoneHandler) sendTSIGError(req *Request, key *TSIGKey, err error) {
+	res, err := newTSIGErrorResponse(req.Message, key, err)
+	if err != nil {
+		log.Println("dns: ZoneHandler: sendTSIGError: ", err)
+		FreeRequest(req)
+		return
+	}
+	zh.sendResponse(req, res)
+}
+
+//
+// requestIP return the IP address of client that send the request, or nil
+// if its unknown.
+//
+func requestIP(req *Request) net.IP {
+	switch req.Kind {
+	case ConnTypeUDP:
+		if req.UDPAddr != nil {
+			return req.UDPAddr.IP
+		}
+	case ConnTypeTCP, ConnTypeDoT, ConnTypeDoH:
+		if req.TCPAddr != nil {
+			return req.TCPAddr.IP
+		}
+	}
+	return nil
+}
+
+//
+// isIPAllowed will return true if IP address is in one of networks.
+//
+func isIPAllowed(ipnets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range ipnets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// sendResponse pack the response and send it to client.
+//
+func (zh *ZoneHandler) sendResponse(req *Request, res *Message) {
+	_, err := res.Pack()
+	if err != nil {
+		FreeRequest(req)
+		return
+	}
+	req.Respond(res)
+}
+
+//
+// packTransfer split the transferred records into several messages, where
+// each message size is less than maximum TCP message size.
+//
+func packTransfer(q *Message, rrs []*ResourceRecord) (msgs []*Message, err error) {
+	for len(rrs) > 0 {
+		var res *Message
+
+		n := len(rrs)
+		if n > maxTransferRR {
+			n = maxTransferRR
+		}
+
+		for {
+			res = newResponse(q, RCodeOK)
+			res.Header.IsAA = true
+			res.Answer = rrs[:n]
+
+			_, err = res.Pack()
+			if err != nil {
+				return nil, err
+			}
+			if len(res.Packet) <= maxTCPPacketSize || n == 1 {
+				break
+			}
+			n /= 2
+		}
+
+		msgs = append(msgs, res)
+		rrs = rrs[n:]
+	}
+
+	return msgs, nil
+}
+
+//
+// answer create the response message for query.  It will return nil if
+// the query name does not exist in hosts and is not in any zones.
+//
+func (zh *ZoneHandler) answer(q *Message) (res *Message) {
+	qname := string(q.Question.Name)
+
+	zh.RLock()
+	defer zh.RUnlock()
+
+	if q.Header.Op != OpCodeQuery {
+		return newResponse(q, RCodeNotImplemented)
+	}
+
+	switch q.Question.Type {
+	case QueryTypeMAILA, QueryTypeMAILB:
+		return newResponse(q, RCodeNotImplemented)
+	}
+
+	hosts, ok := zh.hosts[qname]
+	if ok {
+		res = newResponse(q, RCodeOK)
+		res.Header.IsAA = true
+		res.Answer = filterRR(hosts, q.Question.Type, q.Question.Class)
+		return res
+	}
+
+	zone := zh.findZone(qname)
+
+	// The synthesized PTR records does not override the records in zone.
+	ptrs, ok := zh.ptrs[qname]
+	if ok && !zh.isInZone(zone, qname, q.Question.Class) {
+		res = newResponse(q, RCodeOK)
+		res.Header.IsAA = true
+		res.Answer = filterRR(ptrs, q.Question.Type, q.Question.Class)
+		return res
+	}
+
+	if zone == nil {
+		return nil
+	}
+
+	res = newResponse(q, RCodeOK)
+	res.Header.IsAA = true
+
+	zone.RLock()
+	zh.answerZone(res, zone, qname)
+	zone.RUnlock()
+
+	zh.addGlue(res)
+
+	return res
+}
+
+//
+// isInZone return true if zone has records or delegation on the name.
+//
+func (zh *ZoneHandler) isInZone(zone *Zone, name string, qclass uint16) bool {
+	if zone == nil {
+		return false
+	}
+
+	zone.RLock()
+	defer zone.RUnlock()
+
+	_, ok := zone.records[name]
+	if ok {
+		return true
+	}
+	return len(zone.delegation(name, qclass)) > 0
+}
+
+//
+// answerZone fill the response with records from zone, following the CNAME
+// records that still in the same zone.
+//
+func (zh *ZoneHandler) answerZone(res *Message, zone *Zone, name string) {
+	qtype := res.Question.Type
+	qclass := res.Question.Class
+
+	for x := 0; x < maxCNAMEChain; x++ {
+		ns := zone.delegation(name, qclass)
+		if len(ns) > 0 {
+			// Referral to the name servers of sub-zone.
+			if len(res.Answer) == 0 {
+				res.Header.IsAA = false
+			}
+			res.Authority = append(res.Authority, ns...)
+			return
+		}
+
+		rrs, ok := zone.records[name]
+		if !ok {
+			if !zone.isEmptyNonTerminal(name) {
+				res.Header.RCode = RCodeErrName
+			}
+			zh.addNegativeSOA(res, zone)
+			return
+		}
+
+		answers := filterRR(rrs, qtype, qclass)
+		if len(answers) > 0 {
+			res.Answer = append(res.Answer, answers...)
+			return
+		}
+
+		if qtype == QueryTypeCNAME {
+			break
+		}
+
+		cnames := filterRR(rrs, QueryTypeCNAME, qclass)
+		if len(cnames) == 0 {
+			break
+		}
+
+		res.Answer = append(res.Answer, cnames[0])
+
+		name = string(cnames[0].Text.Value)
+		if !zone.isIn(name) {
+			return
+		}
+	}
+
+	// The name exist but has no records with the query type (NODATA).
+	zh.addNegativeSOA(res, zone)
+}
+
+func (zh *ZoneHandler) addNegativeSOA(res *Message, zone *Zone) {
+	soa := zone.negativeSOA()
+	if soa != nil {
+		res.Authority = append(res.Authority, soa)
+	}
+}
+
+//
+// addGlue add the A and AAAA records of the target name of NS, MX, and SRV
+// records in answer and authority sections into additional section.
+//
+func (zh *ZoneHandler) addGlue(res *Message) {
+	var targets []string
+
+	rrs := make([]*ResourceRecord, 0, len(res.Answer)+len(res.Authority))
+	rrs = append(rrs, res.Answer...)
+	rrs = append(rrs, res.Authority...)
+
+	for _, rr := range rrs {
+		var target []byte
+
+		switch rr.Type {
+		case QueryTypeNS:
+			target = rr.Text.Value
+		case QueryTypeMX:
+			target = rr.MX.Exchange
+		case QueryTypeSRV:
+			target = rr.SRV.Target
+		default:
+			continue
+		}
+		if len(target) == 0 {
+			continue
+		}
+
+		name := string(target)
+		isExist := false
+		for _, t := range targets {
+			if t == name {
+				isExist = true
+				break
+			}
+		}
+		if isExist {
+			continue
+		}
+		targets = append(targets, name)
+
+		res.Additional = append(res.Additional, zh.addresses(name)...)
+	}
+}
+
+//
+// addresses return the A and AAAA records of name from hosts or zones.
+//
+func (zh *ZoneHandler) addresses(name string) (rrs []*ResourceRecord) {
+	all, ok := zh.hosts[name]
+	if !ok {
+		zone := zh.findZone(name)
+		if zone == nil {
+			return nil
+		}
+		zone.RLock()
+		rrs = filterAddresses(zone.records[name])
+		zone.RUnlock()
+		return rrs
+	}
+
+	return filterAddresses(all)
+}
+
+//
+// filterAddresses return list of A and AAAA records.
+//
+func filterAddresses(all []*ResourceRecord) (rrs []*ResourceRecord) {
+	for _, rr := range all {
+		if rr.Type == QueryTypeA || rr.Type == QueryTypeAAAA {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+//
+// findZone return the zone with the longest origin that contains the name.
+//
+func (zh *ZoneHandler) findZone(name string) (zone *Zone) {
+	for _, z := range zh.zones {
+		if !z.isIn(name) {
+			continue
+		}
+		if zone == nil || len(z.Origin) > len(zone.Origin) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+//
+// zone return the zone with origin equal to name, or nil if no zone found.
+//
+func (zh *ZoneHandler) zone(origin string) *Zone {
+	for _, z := range zh.zones {
+		if z.Origin == origin {
+			return z
+		}
+	}
+	return nil
+}
+
+//
+// filterRR return list of resource records that match with type and class.
+// If qtype is QueryTypeALL, all records that match with class will be
+// returned.
+//
+func filterRR(rrs []*ResourceRecord, qtype, qclass uint16) (out []*ResourceRecord) {
+	for _, rr := range rrs {
+		if qtype != QueryTypeALL && rr.Type != qtype {
+			continue
+		}
+		if qclass != QueryClassANY && rr.Class != qclass {
+			continue
+		}
+		out = append(out, rr)
+	}
+	return out
+}
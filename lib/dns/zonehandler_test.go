@@ -0,0 +1,727 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+func TestZoneHandlerServeDNS(t *testing.T) {
+	zh := NewZoneHandler()
+
+	err := zh.LoadMaster("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = zh.LoadHosts("testdata/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc          string
+		qname         string
+		qtype         uint16
+		expRCode      ResponseCode
+		expAA         bool
+		expAnswer     []string
+		expAuthority  []uint16
+		expAdditional []string
+	}{{
+		desc:      "With A record",
+		qname:     "example.com",
+		qtype:     QueryTypeA,
+		expRCode:  RCodeOK,
+		expAA:     true,
+		expAnswer: []string{"10.0.0.1"},
+	}, {
+		desc:          "With MX record and glue",
+		qname:         "example.com",
+		qtype:         QueryTypeMX,
+		expRCode:      RCodeOK,
+		expAA:         true,
+		expAnswer:     []string{"{Preference:10 Exchange:mail.example.com}"},
+		expAdditional: []string{"10.0.0.3", "::3"},
+	}, {
+		desc:          "With NS record and glue",
+		qname:         "example.com",
+		qtype:         QueryTypeNS,
+		expRCode:      RCodeOK,
+		expAA:         true,
+		expAnswer:     []string{"ns1.example.com"},
+		expAdditional: []string{"10.0.0.2"},
+	}, {
+		desc:      "With CNAME chain in zone",
+		qname:     "www.example.com",
+		qtype:     QueryTypeA,
+		expRCode:  RCodeOK,
+		expAA:     true,
+		expAnswer: []string{"web.example.com", "10.0.0.4"},
+	}, {
+		desc:      "With CNAME to outside zone",
+		qname:     "ext.example.com",
+		qtype:     QueryTypeA,
+		expRCode:  RCodeOK,
+		expAA:     true,
+		expAnswer: []string{"www.kilabit.info"},
+	}, {
+		desc:         "With NODATA",
+		qname:        "web.example.com",
+		qtype:        QueryTypeTXT,
+		expRCode:     RCodeOK,
+		expAA:        true,
+		expAuthority: []uint16{QueryTypeSOA},
+	}, {
+		desc:         "With empty non-terminal",
+		qname:        "empty.example.com",
+		qtype:        QueryTypeA,
+		expRCode:     RCodeOK,
+		expAA:        true,
+		expAuthority: []uint16{QueryTypeSOA},
+	}, {
+		desc:         "With NXDOMAIN",
+		qname:        "notexist.example.com",
+		qtype:        QueryTypeA,
+		expRCode:     RCodeErrName,
+		expAA:        true,
+		expAuthority: []uint16{QueryTypeSOA},
+	}, {
+		desc:          "With delegation",
+		qname:         "www.sub.example.com",
+		qtype:         QueryTypeA,
+		expRCode:      RCodeOK,
+		expAuthority:  []uint16{QueryTypeNS},
+		expAdditional: []string{"10.0.1.1"},
+	}, {
+		desc:      "From hosts",
+		qname:     "alpha",
+		qtype:     QueryTypeA,
+		expRCode:  RCodeOK,
+		expAA:     true,
+		expAnswer: []string{"127.0.0.1"},
+	}, {
+		desc:     "Not in any zone",
+		qname:    "kilabit.info",
+		qtype:    QueryTypeA,
+		expRCode: RCodeRefused,
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		req := newTestRequest(sender, 1, c.qname)
+		req.Message.Question.Type = c.qtype
+
+		zh.ServeDNS(req)
+
+		res := <-sender.C
+
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+		test.Assert(t, "IsAA", c.expAA, res.Header.IsAA, true)
+
+		var answers []string
+		for _, rr := range res.Answer {
+			answers = append(answers, testRDataString(rr))
+		}
+		test.Assert(t, "Answer", c.expAnswer, answers, true)
+
+		var authTypes []uint16
+		for _, rr := range res.Authority {
+			authTypes = append(authTypes, rr.Type)
+		}
+		test.Assert(t, "Authority", c.expAuthority, authTypes, true)
+
+		var additionals []string
+		for _, rr := range res.Additional {
+			additionals = append(additionals, testRDataString(rr))
+		}
+		test.Assert(t, "Additional", c.expAdditional, additionals, true)
+	}
+}
+
+func testRDataString(rr *ResourceRecord) string {
+	switch v := rr.RData().(type) {
+	case []byte:
+		return string(v)
+	case interface{ String() string }:
+		return v.String()
+	}
+	return ""
+}
+
+func TestZoneHandlerSynthesizePTR(t *testing.T) {
+	zh := NewZoneHandler()
+	zh.SynthesizePTR = true
+
+	err := zh.LoadMaster("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = zh.LoadHosts("testdata/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	query := func(id uint16, qname string) (got []string) {
+		q := NewMessage()
+		q.Header.ID = id
+		q.Question.Name = []byte(qname)
+		q.Question.Type = QueryTypePTR
+
+		_, err := q.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := AllocRequest()
+		req.Kind = ConnTypeUDP
+		req.Sender = sender
+		req.Message.Packet = append(req.Message.Packet[:0], q.Packet...)
+		req.Message.UnpackHeaderQuestion()
+
+		zh.ServeDNS(req)
+		res := <-sender.C
+
+		test.Assert(t, "RCode", RCodeOK, res.Header.RCode, true)
+
+		for _, rr := range res.Answer {
+			got = append(got, testRDataString(rr))
+		}
+		return got
+	}
+
+	cases := []struct {
+		desc  string
+		qname string
+		exp   []string
+	}{{
+		desc:  "From zone A record",
+		qname: "3.0.0.10.in-addr.arpa",
+		exp:   []string{"mail.example.com"},
+	}, {
+		desc:  "From zone AAAA record",
+		qname: "3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa",
+		exp:   []string{"mail.example.com"},
+	}, {
+		desc:  "From hosts record",
+		qname: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa",
+		exp:   []string{"alpha", "beta", "charlie"},
+	}}
+
+	for x, c := range cases {
+		t.Log(c.desc)
+
+		got := query(uint16(x+1), c.qname)
+		test.Assert(t, "Answer", c.exp, got, true)
+	}
+
+	// The PTR record in reverse zone take precedence over the
+	// synthesized one, while the name that does not exist in reverse
+	// zone is still answered by synthesized PTR record.
+	zh.AddZone(newTestZone(t, `
+0.0.10.in-addr.arpa. 3600 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300
+3.0.0.10.in-addr.arpa. 3600 IN PTR mx.example.com.
+`))
+
+	got := query(10, "3.0.0.10.in-addr.arpa")
+	test.Assert(t, "Answer", []string{"mx.example.com"}, got, true)
+
+	got = query(11, "4.0.0.10.in-addr.arpa")
+	test.Assert(t, "Answer", []string{"web.example.com"}, got, true)
+}
+
+func TestZoneHandlerTransfer(t *testing.T) {
+	zh := NewZoneHandler()
+
+	err := zh.LoadMaster("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, localnet, _ := net.ParseCIDR("127.0.0.0/8")
+	zh.AllowTransfer = []*net.IPNet{localnet}
+
+	srv := &Server{
+		Handler: zh,
+	}
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP: net.ParseIP("127.0.0.1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		errServe := srv.ServeTCP(ln)
+		if errServe != nil {
+			t.Log(errServe)
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	cl, err := NewTCPClient(srv.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rrs, err := cl.Transfer([]byte("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Assert(t, "number of records", 13, len(rrs), true)
+	test.Assert(t, "first record", QueryTypeSOA, rrs[0].Type, true)
+
+	// Transfer of unknown zone should be failed.
+	_, err = cl.Transfer([]byte("example.org"))
+	test.Assert(t, "error", true, err != nil, true)
+
+	_ = cl.Close()
+
+	err = srv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZoneHandlerIXFR(t *testing.T) {
+	zh := NewZoneHandler()
+
+	err := zh.LoadMaster("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, localnet, _ := net.ParseCIDR("127.0.0.0/8")
+	zh.AllowTransfer = []*net.IPNet{localnet}
+
+	zone := zh.findZone("example.com")
+	oldSOA := zone.SOA
+
+	added := &ResourceRecord{
+		Name:  []byte("new.example.com"),
+		Type:  QueryTypeA,
+		Class: QueryClassIN,
+		TTL:   3600,
+		Text: &RDataText{
+			Value: []byte("10.0.0.6"),
+		},
+	}
+	zone.Update(nil, []*ResourceRecord{added})
+
+	test.Assert(t, "serial", oldSOA.SOA.Serial+1, zone.SOA.SOA.Serial, true)
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	cases := []struct {
+		desc     string
+		ip       string
+		serial   uint32
+		expRCode ResponseCode
+		exp      []uint16
+	}{{
+		desc:     "With client not allowed",
+		ip:       "10.0.0.1",
+		serial:   oldSOA.SOA.Serial,
+		expRCode: RCodeRefused,
+	}, {
+		desc:   "With client serial up to date",
+		ip:     "127.0.0.1",
+		serial: zone.SOA.SOA.Serial,
+		exp:    []uint16{QueryTypeSOA},
+	}, {
+		desc:   "With client serial in journal",
+		ip:     "127.0.0.1",
+		serial: oldSOA.SOA.Serial,
+		exp: []uint16{
+			QueryTypeSOA, QueryTypeSOA, QueryTypeSOA,
+			QueryTypeA, QueryTypeSOA,
+		},
+	}, {
+		desc:   "With client serial not in journal",
+		ip:     "127.0.0.1",
+		serial: oldSOA.SOA.Serial - 1,
+		exp: []uint16{
+			QueryTypeSOA, QueryTypeNS, QueryTypeMX,
+			QueryTypeA, QueryTypeCNAME, QueryTypeA,
+			QueryTypeA, QueryTypeAAAA, QueryTypeA,
+			QueryTypeA, QueryTypeA, QueryTypeNS,
+			QueryTypeA, QueryTypeCNAME, QueryTypeSOA,
+		},
+	}}
+
+	for _, c := range cases {
+		t.Log(c.desc)
+
+		soa := *oldSOA
+		soa.SOA = &RDataSOA{}
+		*soa.SOA = *oldSOA.SOA
+		soa.SOA.Serial = c.serial
+
+		q := NewMessage()
+		q.Header.ID = 1
+		q.Question.Name = append(q.Question.Name, "example.com"...)
+		q.Question.Type = QueryTypeIXFR
+		q.Authority = []*ResourceRecord{&soa}
+
+		_, err = q.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := AllocRequest()
+		req.Kind = ConnTypeTCP
+		req.Sender = sender
+		req.TCPAddr = &net.TCPAddr{IP: net.ParseIP(c.ip)}
+		req.Message.Packet = append(req.Message.Packet[:0], q.Packet...)
+		req.Message.UnpackHeaderQuestion()
+
+		zh.ServeDNS(req)
+		res := <-sender.C
+
+		test.Assert(t, "RCode", c.expRCode, res.Header.RCode, true)
+
+		var got []uint16
+		for _, rr := range res.Answer {
+			got = append(got, rr.Type)
+		}
+
+		test.Assert(t, "Answer", c.exp, got, true)
+	}
+}
+
+func TestZoneHandlerNotify(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := f.Name()
+	defer os.Remove(file)
+
+	_, err = f.Write(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	// Setup the primary server.
+	primary := NewZoneHandler()
+
+	err = primary.LoadMaster(file, "example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, localnet, _ := net.ParseCIDR("127.0.0.0/8")
+	primary.AllowTransfer = []*net.IPNet{localnet}
+
+	primarySrv := &Server{
+		Handler: primary,
+	}
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP: net.ParseIP("127.0.0.1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		errServe := primarySrv.ServeTCP(ln)
+		if errServe != nil {
+			t.Log(errServe)
+		}
+	}()
+
+	// Setup the secondary server.
+	secondary := NewZoneHandler()
+
+	secondarySrv := &Server{
+		Handler: secondary,
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP: net.ParseIP("127.0.0.1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		errServe := secondarySrv.ServeUDP(conn)
+		if errServe != nil {
+			t.Log(errServe)
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = secondary.AddSecondary("example.com",
+		primarySrv.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := func() uint32 {
+		secondary.RLock()
+		zone := secondary.zone("example.com")
+		secondary.RUnlock()
+		return zone.SOA.SOA.Serial
+	}
+
+	test.Assert(t, "serial", uint32(2018100101), serial(), true)
+
+	// NOTIFY from non primary should be refused.
+	msg := NewMessage()
+	msg.Header.ID = 1
+	msg.Header.Op = OpCodeNotify
+	msg.Question.Name = []byte("example.com")
+	msg.Question.Type = QueryTypeSOA
+	_, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &testSender{
+		C: make(chan *Message, 1),
+	}
+
+	secondary.ServeDNS(newTestUpdateRequest(sender, msg, "10.0.0.1"))
+	res := <-sender.C
+	test.Assert(t, "RCode", RCodeRefused, res.Header.RCode, true)
+
+	// Editing the zone file in primary should propagated to secondary.
+	err = primary.SetNotify("example.com",
+		[]string{secondarySrv.UDPAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop, err := primary.WatchMaster(file, "example.com", 0,
+		50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content = bytes.Replace(content, []byte("2018100101"),
+		[]byte("2018100102"), 1)
+	content = append(content, []byte("new\tIN\tA\t10.0.0.6\n")...)
+
+	err = ioutil.WriteFile(file, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 50 && serial() != 2018100102; x++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	stop()
+
+	test.Assert(t, "serial", uint32(2018100102), serial(), true)
+
+	secondary.RLock()
+	zone := secondary.zone("example.com")
+	secondary.RUnlock()
+
+	var got []string
+	for _, rr := range zone.get("new.example.com", QueryTypeA, QueryClassIN) {
+		got = append(got, testRDataString(rr))
+	}
+	test.Assert(t, "new record", []string{"10.0.0.6"}, got, true)
+
+	err = primarySrv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = secondarySrv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZoneHandlerWatch(t *testing.T) {
+	hostsFile, err := ioutil.TempFile("", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(hostsFile.Name())
+
+	_, err = hostsFile.WriteString("10.0.0.10 host.test\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = hostsFile.Close()
+
+	masterFile, err := ioutil.TempFile("", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(masterFile.Name())
+
+	content, err := ioutil.ReadFile("testdata/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = masterFile.Write(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = masterFile.Close()
+
+	zh := NewZoneHandler()
+
+	errs := make(chan error, 1)
+	zh.OnReloadError = func(file string, err error) {
+		errs <- err
+	}
+
+	err = zh.LoadHosts(hostsFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = zh.LoadMaster(masterFile.Name(), "example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopHosts, err := zh.WatchHosts(hostsFile.Name(), 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopHosts()
+
+	stopMaster, err := zh.WatchMaster(masterFile.Name(), "example.com",
+		0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopMaster()
+
+	lookup := func(qname string) (got []string) {
+		q := NewMessage()
+		q.Question.Name = []byte(qname)
+		q.Question.Type = QueryTypeA
+
+		res := zh.answer(q)
+		if res == nil {
+			return nil
+		}
+		for _, rr := range res.Answer {
+			got = append(got, testRDataString(rr))
+		}
+		return got
+	}
+
+	waitFor := func(qname string, exp []string) {
+		for x := 0; x < 50; x++ {
+			if len(lookup(qname)) == len(exp) {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		test.Assert(t, qname, exp, lookup(qname), true)
+	}
+
+	test.Assert(t, "host.test", []string{"10.0.0.10"}, lookup("host.test"), true)
+
+	// Changes on hosts file should replace the previous records.
+	err = ioutil.WriteFile(hostsFile.Name(),
+		[]byte("10.0.0.11 other.test\n10.0.0.12 other.test\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor("other.test", []string{"10.0.0.11", "10.0.0.12"})
+	test.Assert(t, "host.test", []string(nil), lookup("host.test"), true)
+
+	// Changes on master file should replace the zone.
+	content = append(content, []byte("new\tIN\tA\t10.0.0.6\n")...)
+	err = ioutil.WriteFile(masterFile.Name(), content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor("new.example.com", []string{"10.0.0.6"})
+
+	// Invalid master file should be reported and keep the previous zone.
+	err = ioutil.WriteFile(masterFile.Name(),
+		append(content, []byte("bad\tIN\tBADTYPE\tx\n")...), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting reload error")
+	}
+
+	test.Assert(t, "reload error", true, err != nil, true)
+	test.Assert(t, "new.example.com", []string{"10.0.0.6"},
+		lookup("new.example.com"), true)
+	test.Assert(t, "other.test", []string{"10.0.0.11", "10.0.0.12"},
+		lookup("other.test"), true)
+
+	// Deleted file should be reported only once.
+	err = os.Remove(masterFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting deleted file error")
+	}
+
+	test.Assert(t, "deleted file error", errFileDeleted, err, true)
+
+	select {
+	case err = <-errs:
+		t.Fatalf("deleted file is reported again: %s", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Changes after the watcher stopped should not be reloaded.
+	stopMaster()
+
+	content = append(content, []byte("stopped\tIN\tA\t10.0.0.7\n")...)
+	err = ioutil.WriteFile(masterFile.Name(), content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	test.Assert(t, "stopped.example.com", []string(nil),
+		lookup("stopped.example.com"), true)
+}
@@ -0,0 +1,440 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defSignatureValidity define the default validity period of
+	// signature, start from inception time.
+	defSignatureValidity = 30 * 24 * time.Hour
+
+	// defSignatureSkew define the default duration before the current
+	// time that is used as signature inception, to allow clock skew on
+	// validators.
+	defSignatureSkew = time.Hour
+)
+
+//
+// ZoneSigner sign the zone using DNSSEC keys (RFC 4035 section 2).
+//
+// The key with secure entry point flag is used as key signing key (KSK)
+// to sign the DNSKEY RRset, while the other keys are used as zone signing
+// keys (ZSK) to sign the rest of RRsets.  If there is no ZSK, the KSK is
+// used to sign all RRsets; if there is no KSK, the ZSK is used to sign the
+// DNSKEY RRset.
+//
+type ZoneSigner struct {
+	// Keys contains the KSK and ZSK used to sign the zone.
+	Keys []*DNSSECKey
+
+	// Inception and Expiration define the validity period of
+	// signatures.  If Inception is zero, it will default to one hour
+	// before the current time.  If Expiration is zero, it will default
+	// to 30 days after inception.
+	Inception  time.Time
+	Expiration time.Time
+
+	// NSEC3 define the parameters to create the NSEC3 chain.  If its
+	// nil, the zone will use NSEC chain.
+	NSEC3 *RDataNSEC3PARAM
+}
+
+//
+// Sign the zone.  The previous DNSSEC records (DNSKEY, RRSIG, NSEC, NSEC3,
+// and NSEC3PARAM) in zone are removed and replaced with the new one: the
+// DNSKEY of each key, the NSEC or NSEC3 chain, and the RRSIG of each
+// authoritative RRset.  The zone must have SOA record.
+//
+func (zs *ZoneSigner) Sign(zone *Zone) (err error) {
+	var ksk, zsk []*DNSSECKey
+
+	for _, key := range zs.Keys {
+		if key.IsKSK() {
+			ksk = append(ksk, key)
+		} else {
+			zsk = append(zsk, key)
+		}
+	}
+	if len(ksk) == 0 {
+		ksk = zsk
+	}
+	if len(zsk) == 0 {
+		zsk = ksk
+	}
+	if len(zsk) == 0 {
+		return fmt.Errorf("dns: ZoneSigner: no keys")
+	}
+
+	inception := zs.Inception
+	if inception.IsZero() {
+		inception = time.Now().Add(-defSignatureSkew)
+	}
+	expiration := zs.Expiration
+	if expiration.IsZero() {
+		expiration = inception.Add(defSignatureValidity)
+	}
+
+	zone.Lock()
+	defer zone.Unlock()
+
+	if zone.SOA == nil {
+		return fmt.Errorf("dns: ZoneSigner: zone %q does not have SOA",
+			zone.Origin)
+	}
+
+	for _, key := range zs.Keys {
+		if canonicalZone(key.DNSKEY.Name) != zone.Origin {
+			return fmt.Errorf("dns: ZoneSigner: key %s is not for zone %q",
+				key.DNSKEY.Name, zone.Origin)
+		}
+	}
+
+	zone.removeDNSSEC()
+
+	for _, key := range zs.Keys {
+		dnskey := *key.DNSKEY
+		dnskey.Name = []byte(zone.Origin)
+		dnskey.Class = zone.SOA.Class
+		dnskey.TTL = zone.SOA.TTL
+		zone.add(&dnskey)
+	}
+
+	if zs.NSEC3 != nil {
+		err = zs.addNSEC3Chain(zone)
+	} else {
+		zone.addNSECChain()
+	}
+	if err != nil {
+		return err
+	}
+
+	for name, isDelegation := range zone.authoritativeNames() {
+		for _, rrset := range groupByType(zone.records[name]) {
+			qtype := rrset[0].Type
+
+			if isDelegation && qtype != QueryTypeDS &&
+				qtype != QueryTypeNSEC {
+				continue
+			}
+
+			keys := zsk
+			if qtype == QueryTypeDNSKEY {
+				keys = ksk
+			}
+
+			for _, key := range keys {
+				rrsig, err := signRRSet(rrset, key, inception, expiration)
+				if err != nil {
+					return err
+				}
+				zone.add(rrsig)
+			}
+		}
+	}
+
+	return nil
+}
+
+//
+// signRRSet create RRSIG record for the RRset using the key.
+//
+func signRRSet(rrset []*ResourceRecord, key *DNSSECKey,
+	inception, expiration time.Time,
+) (*ResourceRecord, error) {
+	rr := rrset[0]
+
+	sig := &RDataRRSIG{
+		TypeCovered: rr.Type,
+		Algorithm:   key.DNSKEY.DNSKEY.Algorithm,
+		Labels:      countLabels(rr.Name),
+		OrigTTL:     rr.TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      key.DNSKEY.DNSKEY.KeyTag(),
+		SignerName:  []byte(canonicalZone(key.DNSKEY.Name)),
+	}
+
+	err := signRRSIG(sig, rrset, key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("dns: ZoneSigner: sign %s %s: %s",
+			rr.Name, masterTypeName(rr.Type), err)
+	}
+
+	return &ResourceRecord{
+		Name:  rr.Name,
+		Type:  QueryTypeRRSIG,
+		Class: rr.Class,
+		TTL:   rr.TTL,
+		RRSIG: sig,
+	}, nil
+}
+
+//
+// removeDNSSEC remove all DNSSEC records generated by signer from zone.
+//
+func (zone *Zone) removeDNSSEC() {
+	for name, rrs := range zone.records {
+		var kept []*ResourceRecord
+		for _, rr := range rrs {
+			switch rr.Type {
+			case QueryTypeRRSIG, QueryTypeNSEC, QueryTypeNSEC3,
+				QueryTypeNSEC3PARAM:
+				continue
+			case QueryTypeDNSKEY:
+				if name == zone.Origin {
+					continue
+				}
+			}
+			kept = append(kept, rr)
+		}
+		if len(kept) == 0 {
+			delete(zone.records, name)
+		} else {
+			zone.records[name] = kept
+		}
+	}
+}
+
+//
+// authoritativeNames return the names that have authoritative data or
+// delegation point in zone, mapped to true if its a delegation point.
+// Names below the delegation point (glue) and names outside of zone are
+// excluded.
+//
+func (zone *Zone) authoritativeNames() (names map[string]bool) {
+	names = make(map[string]bool)
+
+	for name := range zone.records {
+		if !zone.isIn(name) {
+			continue
+		}
+
+		isGlue := false
+		for parent := name; parent != zone.Origin; {
+			x := strings.IndexByte(parent, '.')
+			if x < 0 {
+				break
+			}
+			parent = parent[x+1:]
+			if parent != zone.Origin && zone.hasNS(parent) {
+				isGlue = true
+				break
+			}
+		}
+		if isGlue {
+			continue
+		}
+
+		isDelegation := name != zone.Origin && zone.hasNS(name)
+
+		names[name] = isDelegation
+	}
+
+	return names
+}
+
+//
+// hasNS will return true if the name has NS records.
+//
+func (zone *Zone) hasNS(name string) bool {
+	return len(zone.get(name, QueryTypeNS, zone.SOA.Class)) > 0
+}
+
+//
+// chainTypes return the list of types in the name for NSEC or NSEC3 type
+// bit maps, without the NSEC or NSEC3 type itself.
+//
+func (zone *Zone) chainTypes(name string, isDelegation bool) (types []uint16) {
+	hasSig := false
+
+	for _, rrset := range groupByType(zone.records[name]) {
+		qtype := rrset[0].Type
+		if isDelegation && qtype != QueryTypeNS && qtype != QueryTypeDS {
+			continue
+		}
+		if !isDelegation || qtype == QueryTypeDS {
+			hasSig = true
+		}
+		types = append(types, qtype)
+	}
+	if hasSig {
+		types = append(types, QueryTypeRRSIG)
+	}
+
+	return types
+}
+
+//
+// addNSECChain add the NSEC record to each authoritative names in zone.
+//
+func (zone *Zone) addNSECChain() {
+	authNames := zone.authoritativeNames()
+
+	names := make([]string, 0, len(authNames))
+	for name := range authNames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(x, y int) bool {
+		return canonicalLess(names[x], names[y])
+	})
+
+	ttl := zone.SOA.SOA.Minimum
+
+	for x, name := range names {
+		next := names[(x+1)%len(names)]
+
+		types := zone.chainTypes(name, authNames[name])
+		types = append(types, QueryTypeNSEC)
+		if authNames[name] {
+			types = append(types, QueryTypeRRSIG)
+		}
+
+		zone.add(&ResourceRecord{
+			Name:  []byte(name),
+			Type:  QueryTypeNSEC,
+			Class: zone.SOA.Class,
+			TTL:   ttl,
+			NSEC: &RDataNSEC{
+				NextName: []byte(next),
+				Types:    uniqTypes(types),
+			},
+		})
+	}
+}
+
+//
+// addNSEC3Chain add the NSEC3PARAM record in zone origin and NSEC3 record
+// for each authoritative names and empty non-terminals in zone.
+//
+func (zs *ZoneSigner) addNSEC3Chain(zone *Zone) (err error) {
+	param := &RDataNSEC3PARAM{
+		HashAlgorithm: zs.NSEC3.HashAlgorithm,
+		Iterations:    zs.NSEC3.Iterations,
+		Salt:          zs.NSEC3.Salt,
+	}
+	if param.HashAlgorithm == 0 {
+		param.HashAlgorithm = 1
+	}
+
+	zone.add(&ResourceRecord{
+		Name:       []byte(zone.Origin),
+		Type:       QueryTypeNSEC3PARAM,
+		Class:      zone.SOA.Class,
+		TTL:        0,
+		NSEC3PARAM: param,
+	})
+
+	authNames := zone.authoritativeNames()
+
+	// Add the empty non-terminals between names and zone origin (RFC
+	// 5155 section 7.1).
+	allNames := make(map[string]bool, len(authNames))
+	for name, isDelegation := range authNames {
+		allNames[name] = isDelegation
+		for parent := name; parent != zone.Origin; {
+			x := strings.IndexByte(parent, '.')
+			if x < 0 {
+				break
+			}
+			parent = parent[x+1:]
+			if _, ok := allNames[parent]; !ok {
+				allNames[parent] = false
+			}
+		}
+	}
+
+	type hashedName struct {
+		name string
+		hash []byte
+	}
+
+	hashed := make([]hashedName, 0, len(allNames))
+	for name := range allNames {
+		hash, err := nsec3Hash([]byte(name), param.HashAlgorithm,
+			param.Iterations, param.Salt)
+		if err != nil {
+			return err
+		}
+		hashed = append(hashed, hashedName{name: name, hash: hash})
+	}
+	sort.Slice(hashed, func(x, y int) bool {
+		return bytes.Compare(hashed[x].hash, hashed[y].hash) < 0
+	})
+
+	ttl := zone.SOA.SOA.Minimum
+	suffix := ""
+	if len(zone.Origin) > 0 {
+		suffix = "." + zone.Origin
+	}
+
+	for x, h := range hashed {
+		next := hashed[(x+1)%len(hashed)]
+
+		owner := strings.ToLower(base32HexNoPad.EncodeToString(h.hash)) + suffix
+
+		zone.add(&ResourceRecord{
+			Name:  []byte(owner),
+			Type:  QueryTypeNSEC3,
+			Class: zone.SOA.Class,
+			TTL:   ttl,
+			NSEC3: &RDataNSEC3{
+				HashAlgorithm:   param.HashAlgorithm,
+				Iterations:      param.Iterations,
+				Salt:            param.Salt,
+				NextHashedOwner: next.hash,
+				Types:           zone.chainTypes(h.name, allNames[h.name]),
+			},
+		})
+	}
+
+	return nil
+}
+
+//
+// groupByType group the records by their type, ordered by type.
+//
+func groupByType(rrs []*ResourceRecord) (rrsets [][]*ResourceRecord) {
+	byType := make(map[uint16][]*ResourceRecord)
+	for _, rr := range rrs {
+		byType[rr.Type] = append(byType[rr.Type], rr)
+	}
+
+	types := make([]uint16, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(x, y int) bool {
+		return types[x] < types[y]
+	})
+
+	for _, t := range types {
+		rrsets = append(rrsets, byType[t])
+	}
+
+	return rrsets
+}
+
+//
+// uniqTypes return the sorted list of types without duplicate.
+//
+func uniqTypes(types []uint16) (out []uint16) {
+	sort.Slice(types, func(x, y int) bool {
+		return types[x] < types[y]
+	})
+	for x, t := range types {
+		if x > 0 && t == types[x-1] {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+// Copyright 2018, Shulhan <ms@kilabit.info>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shuLhan/share/lib/test"
+)
+
+const (
+	testKSKFile = "testdata/Kexample.com.+013+41112"
+	testZSKFile = "testdata/Kexample.com.+013+62151.key"
+)
+
+//
+// testZoneRRSet return the records with specific type, and its RRSIG, on
+// the name in zone.
+//
+func testZoneRRSet(zone *Zone, name string, qtype uint16) (rrs []*ResourceRecord) {
+	for _, rr := range zone.records[name] {
+		if rr.Type == qtype ||
+			(rr.Type == QueryTypeRRSIG && rr.RRSIG.TypeCovered == qtype) {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+func newTestSignedZone(t *testing.T, nsec3 *RDataNSEC3PARAM) (
+	zone *Zone, ksk *DNSSECKey,
+) {
+	zone, err := LoadZone("testdata/example.com", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ksk, err = LoadDNSSECKey(testKSKFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsk, err := LoadDNSSECKey(testZSKFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zs := &ZoneSigner{
+		Keys:  []*DNSSECKey{ksk, zsk},
+		NSEC3: nsec3,
+	}
+
+	err = zs.Sign(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return zone, ksk
+}
+
+func TestZoneSignerNSEC(t *testing.T) {
+	zone, ksk := newTestSignedZone(t, nil)
+
+	// Walk the NSEC chain from zone origin.
+	var names []string
+	name := zone.Origin
+	for {
+		names = append(names, name)
+		nsec := zone.get(name, QueryTypeNSEC, QueryClassIN)
+		if len(nsec) != 1 {
+			t.Fatalf("%s: expecting one NSEC record, got %d", name, len(nsec))
+		}
+		name = string(nsec[0].NSEC.NextName)
+		if name == zone.Origin {
+			break
+		}
+	}
+
+	expNames := []string{
+		"example.com",
+		"host.empty.example.com",
+		"ext.example.com",
+		"mail.example.com",
+		"ns1.example.com",
+		"sub.example.com",
+		"web.example.com",
+		"www.example.com",
+	}
+	test.Assert(t, "NSEC chain", expNames, names, true)
+
+	nsec := zone.get("sub.example.com", QueryTypeNSEC, QueryClassIN)
+	test.Assert(t, "NSEC delegation types", []uint16{QueryTypeNS,
+		QueryTypeRRSIG, QueryTypeNSEC}, nsec[0].NSEC.Types, true)
+
+	nsec = zone.get(zone.Origin, QueryTypeNSEC, QueryClassIN)
+	test.Assert(t, "NSEC origin types", []uint16{QueryTypeA, QueryTypeNS,
+		QueryTypeSOA, QueryTypeMX, QueryTypeRRSIG, QueryTypeNSEC,
+		QueryTypeDNSKEY}, nsec[0].NSEC.Types, true)
+
+	// Glue and NS at delegation point must not be signed.
+	test.Assert(t, "glue RRSIG", 0,
+		len(zone.get("ns.sub.example.com", QueryTypeRRSIG, QueryClassIN)), true)
+	test.Assert(t, "delegation RRSIG", 1,
+		len(zone.get("sub.example.com", QueryTypeRRSIG, QueryClassIN)), true)
+
+	v := NewValidator(func(qname []byte, qtype uint16) (*Message, error) {
+		msg := NewMessage()
+		msg.Answer = testZoneRRSet(zone, string(qname), qtype)
+		return msg, nil
+	})
+	err := v.AddTrustAnchor(ksk.DNSKEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range expNames {
+		for _, rrset := range groupByType(zone.records[name]) {
+			qtype := rrset[0].Type
+			if qtype == QueryTypeRRSIG || (name == "sub.example.com" &&
+				qtype == QueryTypeNS) {
+				continue
+			}
+
+			msg := NewMessage()
+			msg.Answer = testZoneRRSet(zone, name, qtype)
+
+			isSecure, err := v.Validate(msg)
+			if err != nil {
+				t.Fatalf("%s %d: %s", name, qtype, err)
+			}
+			test.Assert(t, name+" isSecure", true, isSecure, true)
+		}
+	}
+}
+
+func TestZoneSignerNSEC3(t *testing.T) {
+	zone, _ := newTestSignedZone(t, &RDataNSEC3PARAM{
+		Iterations: 2,
+		Salt:       []byte{0xaa, 0xbb},
+	})
+
+	param := zone.get(zone.Origin, QueryTypeNSEC3PARAM, QueryClassIN)
+	test.Assert(t, "NSEC3PARAM", 1, len(param), true)
+
+	// The NSEC3 chain contains 8 authoritative names and one empty
+	// non-terminal "empty.example.com".
+	var nsec3 []*ResourceRecord
+	for _, rrs := range zone.records {
+		for _, rr := range rrs {
+			if rr.Type == QueryTypeNSEC3 {
+				nsec3 = append(nsec3, rr)
+			}
+		}
+	}
+	test.Assert(t, "number of NSEC3", 9, len(nsec3), true)
+
+	hash, err := nsec3Hash([]byte("empty.example.com"), 1, 2, []byte{0xaa, 0xbb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := string(bytes.ToLower([]byte(base32HexNoPad.EncodeToString(hash)))) +
+		".example.com"
+
+	ent := zone.get(owner, QueryTypeNSEC3, QueryClassIN)
+	test.Assert(t, "empty non-terminal", 1, len(ent), true)
+	test.Assert(t, "empty non-terminal types", 0, len(ent[0].NSEC3.Types), true)
+
+	// Each NSEC3 next hashed owner must point to other NSEC3.
+	for _, rr := range nsec3 {
+		next := string(bytes.ToLower([]byte(
+			base32HexNoPad.EncodeToString(rr.NSEC3.NextHashedOwner)))) +
+			".example.com"
+		test.Assert(t, "next NSEC3", 1,
+			len(zone.get(next, QueryTypeNSEC3, QueryClassIN)), true)
+	}
+}
+
+func TestZoneWrite(t *testing.T) {
+	zone, _ := newTestSignedZone(t, nil)
+
+	var buf bytes.Buffer
+
+	err := zone.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMaster()
+	m.Init(buf.String(), "", 0)
+
+	err = m.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewZone(zone.Origin)
+	for _, msg := range m.msgs {
+		for _, rr := range msg.Answer {
+			got.add(rr)
+		}
+	}
+
+	exp := zone.all()
+	test.Assert(t, "number of records", len(exp), len(got.all()), true)
+
+	for _, rr := range exp {
+		found := false
+		for _, in := range got.records[string(rr.Name)] {
+			if in.isEqual(rr) && in.TTL == rr.TTL {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("record not found after write: %s %d", rr.Name, rr.Type)
+		}
+	}
+}
@@ -6,14 +6,15 @@ package io
 
 import (
 	"os"
+	"sync"
 	"time"
 )
 
 //
 // A Watcher hold a channel that deliver file information when file is
 // changed.
-// If file is deleted, it will send a nil file information to channel and stop
-// watching the file.
+// If file is deleted, it will send a nil file information to channel once,
+// and deliver the file information again when the file is created.
 //
 // This is a naive implementation of file event change notification.
 //
@@ -22,6 +23,8 @@ type Watcher struct {
 	cin    chan *os.FileInfo
 	file   string
 	ticker *time.Ticker
+	done   chan struct{}
+	stop   sync.Once
 }
 
 //
@@ -41,30 +44,56 @@ func NewWatcher(file string, d time.Duration) (*Watcher, error) {
 		cin:    c,
 		file:   file,
 		ticker: time.NewTicker(d),
+		done:   make(chan struct{}),
 	}
 
-	go watcher.start()
+	// Get the initial file information before returning, so any changes
+	// after the watcher created will be delivered.
+	oldStat, _ := os.Stat(file)
+
+	go watcher.start(oldStat)
 
 	return watcher, nil
 }
 
-func (w *Watcher) start() {
-	oldStat, _ := os.Stat(w.file)
-	for _ = range w.ticker.C {
+func (w *Watcher) start(oldStat os.FileInfo) {
+	defer close(w.cin)
+
+	isDeleted := false
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.ticker.C:
+		}
+
 		newStat, err := os.Stat(w.file)
 		if err != nil {
-			w.cin <- nil
+			if isDeleted {
+				continue
+			}
+			if !w.send(nil) {
+				return
+			}
+			isDeleted = true
+			oldStat = nil
 			continue
 		}
+		isDeleted = false
 		if oldStat == nil {
-			w.cin <- &newStat
+			if !w.send(&newStat) {
+				return
+			}
 			oldStat = newStat
 			continue
 		}
 		if oldStat.Size() != newStat.Size() ||
 			oldStat.Mode() != newStat.Mode() ||
 			oldStat.ModTime() != newStat.ModTime() {
-			w.cin <- &newStat
+			if !w.send(&newStat) {
+				return
+			}
 			oldStat = newStat
 			continue
 		}
@@ -72,8 +101,25 @@ func (w *Watcher) start() {
 }
 
 //
-// Stop watching the file.
+// send the file information to channel.  It will return false if the
+// watcher is stopped.
+//
+func (w *Watcher) send(fi *os.FileInfo) bool {
+	select {
+	case w.cin <- fi:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+//
+// Stop watching the file.  The channel C will be closed after the watcher
+// stopped.
 //
 func (w *Watcher) Stop() {
-	w.ticker.Stop()
+	w.stop.Do(func() {
+		w.ticker.Stop()
+		close(w.done)
+	})
 }
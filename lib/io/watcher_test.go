@@ -73,3 +73,45 @@ func TestWatcher(t *testing.T) {
 
 	ok = true
 }
+
+func TestWatcherStop(t *testing.T) {
+	f, err := ioutil.TempFile("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	watcher, err := NewWatcher(f.Name(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted file should be delivered only once.
+	err = os.Remove(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi := <-watcher.C
+	if fi != nil {
+		t.Fatalf("expecting nil file information, got %+v", *fi)
+	}
+
+	select {
+	case fi = <-watcher.C:
+		t.Fatalf("expecting no file information, got %v", fi)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Stop should close the channel.
+	watcher.Stop()
+
+	select {
+	case _, ok := <-watcher.C:
+		if ok {
+			t.Fatal("expecting channel is closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting channel closed")
+	}
+}